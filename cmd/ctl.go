@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/cdfmlr/gofer/gofer"
+)
+
+// gofer ctl！！
+// 通过控制接口 (见 gofer/control.go) 查看和控制一个常驻的 gofer:
+//
+//  - gofer ctl transfers: 列出正在进行的传输, 以及提供的文件
+//  - gofer ctl cancel FILE_ID: 取消收发一个大文件
+//  - gofer ctl pause FILE_ID, gofer ctl resume FILE_ID: 暂停、继续收发一个大文件
+//  - gofer ctl rate [-rate=N] [-peer-rate=N] [-schedule=S] [PEER]: 查看 (或修改) 限速
+//  - gofer ctl send FILE: 让 gofer send -bigfile -s 再提供一个文件; 有 -c 的话放进对方的发件箱
+//
+// 选项写在子命令后面、参数前面 (gofer ctl pause -control=SOCKET FILE_ID)。
+// 常驻的 gofer 要用 -control=SOCKET 启动控制接口; gofer ctl 的 -control 默认是 ~/.gofer/control.sock。
+
+// startControl 有 -control 的话, 在上面提供控制接口
+func startControl(server *gofer.ControlServer) {
+	if controlSocket == "" {
+		return
+	}
+	if _, err := server.ListenAndServe(controlSocket); err != nil {
+		fail(os.Stdout, errCodeUsage, "bad -control", err)
+		exit(1)
+	}
+}
+
+func cmdCtl(sub string) {
+	socket := controlSocket
+	if socket == "" {
+		socket = gofer.DefaultControlSocket()
+	}
+	ctl := gofer.NewControlClient(socket)
+
+	var err error
+	switch sub {
+	case "transfers":
+		err = ctlTransfers(ctl)
+	case "cancel", "pause", "resume":
+		if flag.NArg() != 1 {
+			usage()
+			return
+		}
+		var result map[string]string
+		if err = ctl.Do("POST", "/transfers/"+url.PathEscape(flag.Arg(0))+"/"+sub, nil, &result); err == nil {
+			setResult(result)
+			fmt.Println(map[string]string{"cancel": "canceled:", "pause": "paused:", "resume": "resumed:"}[sub], flag.Arg(0))
+		}
+	case "rate":
+		err = ctlRate(ctl)
+	case "send":
+		err = ctlSend(ctl)
+	default:
+		usage()
+		return
+	}
+	if err != nil {
+		code := gofer.ErrCodeConnect // 不是控制接口回的错误, 就是没连上
+		var e *gofer.ErrorPacket
+		if errors.As(err, &e) {
+			code = e.Code()
+		}
+		fail(os.Stdout, code, "ctl "+sub, err)
+		exit(1)
+	}
+}
+
+func ctlTransfers(ctl *gofer.ControlClient) error {
+	var result gofer.ControlTransfers
+	if err := ctl.Do("GET", "/transfers", nil, &result); err != nil {
+		return err
+	}
+	setResult(result)
+	for _, t := range result.Transfers {
+		blocks := ""
+		if t.Blocks > 0 {
+			blocks = fmt.Sprintf("%d/%d blocks", t.SavedBlocks, t.Blocks)
+		}
+		if t.Paused {
+			blocks += " (paused)"
+		}
+		fmt.Printf("%s\t%-32s\t%s\t%5.1f%%\t%s/s\t%s\t%s\n",
+			t.Direction, t.FileID, t.Name, t.Percent(), formatBytes(uint64(t.Rate)), t.Peer, blocks)
+	}
+	for _, f := range result.Offered {
+		state := "offered"
+		if f.Canceled {
+			state = "canceled"
+		} else if f.Paused {
+			state = "paused"
+		}
+		fmt.Printf("%s\t%s\t%s\t%d\n", state, f.FileID, f.Name, f.Size)
+	}
+	return nil
+}
+
+// ctlRate 查看限速; 给了 -rate, -peer-rate, -schedule 的话先修改
+func ctlRate(ctl *gofer.ControlClient) error {
+	req := gofer.ControlRate{Peer: flag.Arg(0)}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "rate":
+			req.Rate = &rate
+		case "peer-rate":
+			req.PeerRate = &peerRate
+		case "schedule":
+			req.Schedule = &schedule
+		}
+	})
+
+	var result gofer.ControlRate
+	var err error
+	if req.Rate != nil || req.PeerRate != nil || req.Schedule != nil {
+		err = ctl.Do("PUT", "/rate", req, &result)
+	} else {
+		err = ctl.Do("GET", "/rate?peer="+url.QueryEscape(req.Peer), nil, &result)
+	}
+	if err != nil {
+		return err
+	}
+	setResult(result)
+	fmt.Printf("rate: %d\npeer rate: %d\n", *result.Rate, *result.PeerRate)
+	return nil
+}
+
+// ctlSend 让对方的 gofer 发文件 FILE (或者有 -c 时, 把 FILE 或 -m 的消息放进它的发件箱)
+func ctlSend(ctl *gofer.ControlClient) error {
+	req := gofer.ControlSend{To: client, Info: msgInfo, Message: message}
+	if flag.NArg() > 0 { // 对方的工作目录不一定和这里一样
+		path, err := filepath.Abs(flag.Arg(0))
+		if err != nil {
+			return err
+		}
+		req.Path = path
+	}
+	if req.Path == "" && req.Message == "" {
+		usage()
+		exit(1)
+	}
+	var result gofer.ControlSent
+	if err := ctl.Do("POST", "/send", req, &result); err != nil {
+		return err
+	}
+	setResult(result)
+	if result.Queued != nil {
+		fmt.Println("queued:", result.Queued.ID)
+	} else {
+		fmt.Println("offered:", result.FileID)
+	}
+	return nil
+}
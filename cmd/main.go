@@ -1,15 +1,43 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
 	"github.com/cdfmlr/gofer/gofer"
+	"io"
+	"net"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
 )
 
 func usage() {
+	if output != nil {
+		output.fail(errCodeUsage, "bad arguments, see gofer -h")
+	}
 	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "gofer <send|recv> [-f=FILE] [-m=MESSAGE [-i INFO]] <-s|-c>=ADDRESS\n")
-	_, _ = fmt.Fprintf(flag.CommandLine.Output(), " send: send things\n recv: receive things.\n")
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "gofer <send|recv> [-f=FILE] [-m=MESSAGE [-i INFO]] -relay=ADDRESS -code=CODE\n")
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "gofer send [-f=FILE] [-m=MESSAGE [-i INFO]] -to=NAME\n")
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "gofer send -bigfile=FILE [-expect=N] -s=ADDRESS\n")
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "gofer send -watch=DIR [-debounce=DURATION] -c=ADDRESS\n")
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "gofer send -queue [-outbox=DIR] [-f=FILE] [-m=MESSAGE [-i INFO]] -c=ADDRESS\n")
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "gofer outbox <run|list> [-outbox=DIR]\n")
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "gofer ctl <transfers|cancel|pause|resume|send> [-control=SOCKET] [FILE_ID|FILE]\n")
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "gofer ctl rate [-rate=BYTES_PER_SEC] [-peer-rate=BYTES_PER_SEC] [-schedule=SCHEDULE] [-control=SOCKET] [PEER]\n")
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "gofer recv [-share=ADDRESS] -c=ADDRESS,ADDRESS...\n")
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "gofer recv -announce=NAME -s=ADDRESS\n")
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "gofer relay [-relay-rate=BYTES_PER_SEC] -s=ADDRESS\n")
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "gofer peers [-timeout=DURATION]\n")
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "gofer serve [-config=FILE] [-export=DIR] [-inbox=DIR] [-allow=PERMISSIONS] [-web=ADDR] [-http=ADDR] [-https=ADDR] -s=ADDRESS\n")
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "gofer get HOST:PORT:PATH\n")
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "gofer ls [-l] [-json] HOST:PORT[:PATH]\n")
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "gofer sync [-delete] [-dry-run] [-checksum] [-include=PATTERN]... [-exclude=PATTERN]... SRC HOST:PORT:DST\n")
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), "gofer sync -bidirectional [-conflict=POLICY] [-dry-run] [-checksum] [-include=PATTERN]... [-exclude=PATTERN]... SRC HOST:PORT:DST\n")
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), " send: send things\n recv: receive things.\n relay: relay for peers that can't reach each other.\n peers: list receivers announced on the local network.\n")
+	_, _ = fmt.Fprintf(flag.CommandLine.Output(), " serve: export directories read-only and receive things into an inbox.\n get: download a file from a serving peer.\n ls: list files exported by a serving peer.\n sync: make DST in the inbox of a serving peer the same as the local directory SRC (or sync them both ways).\n outbox: deliver things queued by <gofer send -queue> in the background, or list them.\n ctl: list, cancel, pause, resume, rate limit or add transfers of a running gofer started with -control.\n")
 	flag.PrintDefaults()
 }
 
@@ -21,15 +49,146 @@ var (
 	bigFile string
 	serve   string
 	client  string
+
+	relay     string
+	code      string
+	relayRate int64
+
+	announce string
+	to       string
+	timeout  time.Duration
+
+	export     string
+	inbox      string
+	configFile string
+	allow      string
+	webAddr    string
+	httpAddr   string
+	httpsAddr  string
+
+	longFormat bool
+	jsonFormat bool
+
+	delta bool
+
+	syncDelete   bool
+	syncDryRun   bool
+	syncChecksum bool
+	syncInclude  stringList
+	syncExclude  stringList
+	syncBoth     bool
+	syncConflict string
+
+	watch    string
+	debounce time.Duration
+
+	queue     bool
+	outboxDir string
+
+	expect  int
+	share   string
+	retries int
+
+	rate     int64
+	peerRate int64
+	schedule string
+
+	compress string
+
+	showProgress bool
+	outputFormat string
+	logLevel     string
+	metricsAddr  string
+
+	controlSocket string
 )
 
+// setLogger 按 -log-level 把 gofer 的日志写到 w
+func setLogger(w io.Writer) error {
+	if logLevel == "off" {
+		gofer.SetLogger(nil)
+		return nil
+	}
+	level, err := gofer.ParseLogLevel(logLevel)
+	if err != nil {
+		return fmt.Errorf("%v, or off", err)
+	}
+	gofer.SetLogger(gofer.NewTextLogger(w, level))
+	return nil
+}
+
+// setBandwidth 按 -rate, -peer-rate, -schedule 设置发送限速
+func setBandwidth() error {
+	gofer.DefaultBandwidth.SetRate(rate)
+	gofer.DefaultBandwidth.SetPeerRate("", peerRate)
+	if schedule != "" {
+		windows, err := gofer.ParseRateSchedule(schedule)
+		if err != nil {
+			return err
+		}
+		gofer.DefaultBandwidth.SetSchedule(windows)
+	}
+	return nil
+}
+
+// stringList 是可以重复给出的字符串参数, 例如 -exclude=a -exclude=b
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 func init() {
 	flag.StringVar(&message, "m", "", "`MESSAGE` to send. (Only for <gofer send>)")
 	flag.StringVar(&msgInfo, "i", "", "`INFO` of message to send. (use with <gofer send -m xxx>)")
 	flag.StringVar(&file, "f", "", "path of `FILE` to send (Only for <gofer send>)")
 	flag.StringVar(&bigFile, "bigfile", "", "path of `BiG_FILE` to send (Only for <gofer send>)")
-	flag.StringVar(&serve, "s", "", "start a server at given `ADDRESS`")
-	flag.StringVar(&client, "c", "", "run as a client, connect to a server at given `ADDRESS`")
+	flag.StringVar(&serve, "s", "", "start a server at given `ADDRESS` (HOST:PORT, or ws://HOST:PORT/PATH, wss://HOST:PORT/PATH to serve over WebSocket)")
+	flag.StringVar(&client, "c", "", "run as a client, connect to a server at given `ADDRESS`, ws:// and wss:// ones over WebSocket (<gofer recv> takes comma-separated addresses to download one big file from all of them)")
+	flag.StringVar(&relay, "relay", "", "connect to the other side through the relay server at given `ADDRESS` (use with -code)")
+	flag.StringVar(&code, "code", "", "secret transfer `CODE` to pair up with and authenticate the other side on the relay server, use a long random one")
+	flag.Int64Var(&relayRate, "relay-rate", 0, "bandwidth limit of each relayed pair in `BYTES_PER_SEC`, 0 for unlimited (Only for <gofer relay>)")
+	flag.StringVar(&announce, "announce", "", "announce this receiver on the local network as `NAME` (Only for <gofer recv -s>)")
+	flag.StringVar(&to, "to", "", "send to the receiver announced as `NAME` on the local network, announcements are not authenticated (Only for <gofer send>)")
+	flag.DurationVar(&timeout, "timeout", 3*time.Second, "how long to wait for announcements on the local network")
+	flag.StringVar(&export, "export", "", "`DIR` to export read-only (Only for <gofer serve>)")
+	flag.StringVar(&inbox, "inbox", "", "`DIR` to receive pushed messages and files into (Only for <gofer serve>)")
+	flag.StringVar(&allow, "allow", "", "comma separated `PERMISSIONS` (get,list,push,sync) for every client when the config has no client rules, default get,list (Only for <gofer serve>)")
+	flag.StringVar(&webAddr, "web", "", "serve a web UI on http://`ADDR`/ to browse and download exports, upload into the inbox and watch transfers (Only for <gofer serve>)")
+	flag.StringVar(&httpAddr, "http", "", "serve an HTTP gateway on http://`ADDR`/ for curl: PUT /inbox/NAME uploads, GET /export/PATH downloads (Only for <gofer serve>)")
+	flag.StringVar(&httpsAddr, "https", "", "serve the HTTP gateway over HTTPS on `ADDR` with the built-in server certificate (Only for <gofer serve>)")
+	flag.StringVar(&configFile, "config", "", "JSON config `FILE` describing exports, inboxes and client permissions (Only for <gofer serve>)")
+	flag.BoolVar(&longFormat, "l", false, "use a long listing format (Only for <gofer ls>)")
+	flag.BoolVar(&jsonFormat, "json", false, "same as -output json: the listing is the data of the final result (Only for <gofer ls>)")
+	flag.BoolVar(&syncDelete, "delete", false, "delete files in DST that don't exist in SRC (Only for <gofer sync>)")
+	flag.BoolVar(&syncDryRun, "dry-run", false, "only print what would be done (Only for <gofer sync>)")
+	flag.BoolVar(&syncChecksum, "checksum", false, "compare files by md5 instead of size and modification time (Only for <gofer sync>)")
+	flag.Var(&syncInclude, "include", "only sync files matching `PATTERN`, can be given multiple times (Only for <gofer sync>)")
+	flag.Var(&syncExclude, "exclude", "don't sync files matching `PATTERN`, can be given multiple times (Only for <gofer sync>)")
+	flag.BoolVar(&syncBoth, "bidirectional", false, "propagate changes and deletions in both directions (Only for <gofer sync>)")
+	flag.StringVar(&syncConflict, "conflict", gofer.SyncConflictKeepBoth, "how to resolve files changed on both sides: `POLICY` is newest, keep-both or ask (Only for <gofer sync -bidirectional>)")
+	flag.StringVar(&watch, "watch", "", "keep pushing new or modified files in `DIR` (Only for <gofer send -c>)")
+	flag.DurationVar(&debounce, "debounce", gofer.DefaultWatchDebounce, "push a watched file after it hasn't changed for `DURATION` (use with -watch)")
+	flag.IntVar(&expect, "expect", 0, "exit after `N` receivers have received the big file, 0 for never (Only for <gofer send -bigfile -s>)")
+	flag.IntVar(&retries, "retries", 10, "give up after `N` failed connection attempts in a row, 0 to retry forever (Only for <gofer send|recv -c>)")
+	flag.StringVar(&share, "share", "", "share received blocks of big files with other receivers at `ADDRESS` (Only for <gofer recv -c>)")
+	flag.BoolVar(&queue, "queue", false, "put the message or file into the outbox, <gofer outbox run> delivers it when the receiver is online (Only for <gofer send -c>)")
+	flag.StringVar(&outboxDir, "outbox", "", "outbox `DIR`, default ~/.gofer/outbox (use with <gofer send -queue> and <gofer outbox>)")
+	flag.BoolVar(&delta, "delta", false, "when an older version of a big file exists locally, only download the changed parts (Only for receiving sides)")
+	flag.Int64Var(&rate, "rate", 0, "bandwidth limit of sending files in `BYTES_PER_SEC`, 0 for unlimited")
+	flag.Int64Var(&peerRate, "peer-rate", 0, "bandwidth limit of sending files to each peer in `BYTES_PER_SEC`, 0 for unlimited")
+	flag.BoolVar(&showProgress, "progress", false, "show progress of sending and receiving files: a progress bar if stdout is a terminal, otherwise a line every 5s; on by default only if stdout is a terminal (Only for <gofer send|recv|get>)")
+	flag.StringVar(&controlSocket, "control", "", "serve the control API on unix socket `SOCKET` (for <gofer recv|send -s|-c>, <gofer serve> and <gofer outbox run>); <gofer ctl> talks to it, default ~/.gofer/control.sock")
+	flag.StringVar(&metricsAddr, "metrics", "", "serve Prometheus metrics on http://`ADDR`/metrics, for long-running servers like <gofer recv -s> and <gofer serve>")
+	flag.StringVar(&logLevel, "log-level", "info", "print logs at `LEVEL` and above to stderr: debug (a line per block), info, warn, error, or off")
+	flag.StringVar(&outputFormat, "output", outputHuman, "`FORMAT` of output: human, or json for newline-delimited JSON events and a final result object on stdout")
+	flag.StringVar(&compress, "compress", "none", "compress sent big file blocks with `CODEC`: zstd, gzip or none; blocks are compressed only if the receiver supports it")
+	flag.StringVar(&schedule, "schedule", "", "comma-separated `HH:MM-HH:MM=BYTES_PER_SEC` windows overriding -rate at those times of day, e.g. 09:00-18:00=1048576")
 }
 
 func main() {
@@ -39,13 +198,97 @@ func main() {
 	}
 
 	cmd := os.Args[1]
+	if (cmd == "outbox" || cmd == "ctl") && len(os.Args) > 2 { // 子命令: "outbox run", "ctl cancel"...
+		cmd += " " + os.Args[2]
+		os.Args = os.Args[1:]
+	}
 
 	// flag.Parse() parses the command-line flags from os.Args[1:]
 	os.Args = os.Args[1:]
 	flag.Parse()
 
-	if (serve == "") == (client == "") { // both exist or neither
-		usage()
+	progressSet := false
+	flag.Visit(func(f *flag.Flag) { progressSet = progressSet || f.Name == "progress" })
+	if !progressSet { // 没给 -progress 的话, 只在终端上显示进度条
+		showProgress = isTerminal(os.Stdout)
+	}
+
+	if cmd == "ls" && jsonFormat { // ls -json 就是 -output json, 列表在结果的 data 里
+		outputFormat = outputJSON
+	}
+	switch outputFormat {
+	case outputHuman:
+	case outputJSON: // 只输出 JSON, 没有进度条
+		output = startJSONOutput(cmd)
+		showProgress = false
+		defer func() {
+			if r := recover(); r != nil {
+				crash(r)
+			}
+			exit(0)
+		}()
+		go exitOnInterrupt()
+	default:
+		fmt.Printf("bad -output: unknown format %q: want human or json\n", outputFormat)
+		os.Exit(1)
+	}
+
+	if err := setLogger(os.Stderr); err != nil {
+		fail(os.Stdout, errCodeUsage, "bad -log-level", err)
+		exit(1)
+	}
+	if metricsAddr != "" {
+		if _, err := gofer.ListenAndServeMetrics(metricsAddr); err != nil {
+			fail(os.Stdout, errCodeUsage, "bad -metrics", err)
+			exit(1)
+		}
+	}
+	gofer.EnableDelta = delta
+	if err := setBandwidth(); err != nil {
+		fail(os.Stdout, errCodeUsage, "bad -schedule", err)
+		exit(1)
+	}
+	if c, err := gofer.ParseCompression(compress); err != nil {
+		fail(os.Stdout, errCodeUsage, "bad -compress", err)
+		exit(1)
+	} else {
+		gofer.DefaultCompression = c
+	}
+
+	switch cmd {
+	case "send", "recv", "get":
+		if showProgress {
+			stop := startProgress()
+			defer stop()
+		}
+	}
+
+	switch cmd {
+	case "send", "recv":
+		if !validAddress() {
+			usage()
+			return
+		}
+	case "peers":
+		cmdPeers()
+		return
+	case "get":
+		cmdGet()
+		return
+	case "ls":
+		cmdLs()
+		return
+	case "sync":
+		cmdSync()
+		return
+	case "outbox run":
+		cmdOutboxRun()
+		return
+	case "outbox list":
+		cmdOutboxList()
+		return
+	case "ctl transfers", "ctl cancel", "ctl pause", "ctl resume", "ctl rate", "ctl send":
+		cmdCtl(cmd[len("ctl "):])
 		return
 	}
 
@@ -54,12 +297,39 @@ func main() {
 		cmdSend()
 	case "recv":
 		cmdRecv()
+	case "relay":
+		cmdRelay()
+	case "serve":
+		cmdServe()
 	default:
 		usage()
 	}
 }
 
+// validAddress 检查连接方式: -s, -c, -relay, -to 有且只有一个
+func validAddress() bool {
+	n := 0
+	for _, address := range []string{serve, client, relay, to} {
+		if address != "" {
+			n++
+		}
+	}
+	if relay != "" && code == "" { // 走中继需要配对码
+		return false
+	}
+	return n == 1
+}
+
 func cmdSend() {
+	if watch != "" {
+		cmdWatch()
+		return
+	}
+	if queue {
+		cmdQueue()
+		return
+	}
+
 	var sender gofer.Sender
 
 	switch {
@@ -69,41 +339,513 @@ func cmdSend() {
 		sender = gofer.NewSimpleFileSender(file)
 	case bigFile != "":
 		bfSender := gofer.NewBigFileSender()
-		bfSender.AppendFile(bigFile)
+		if _, err := bfSender.AppendFile(bigFile); err != nil {
+			fail(os.Stdout, gofer.ErrCodeIO, "bad -bigfile", err)
+			exit(1)
+		}
+		startControl(&gofer.ControlServer{Senders: []*gofer.BigFileSender{bfSender}})
 		sender = bfSender
 	default:
-		panic("neither message nor file")
+		usage()
+		return
 	}
 
 	switch {
+	case relay != "":
+		client := gofer.NewSendClient(sender)
+		if err := gofer.DialRelayAndRunClientTLS(relay, code, client); err != nil {
+			fail(os.Stdout, gofer.ErrCodeConnect, "relay failed", err)
+			exit(1)
+		}
+	case to != "":
+		peer, err := gofer.DiscoverPeer(to, timeout)
+		if err != nil {
+			fail(os.Stdout, gofer.ErrCodeNotFound, "discover failed", err)
+			exit(1)
+		}
+		client := gofer.NewSendClient(sender)
+		if err := gofer.DialAndRunClientTLSSameBuild(peer.Addr, peer.Fingerprint, client); err != nil {
+			fail(os.Stdout, gofer.ErrCodeConnect, "send failed", err)
+			exit(1)
+		}
 	case serve != "":
 		address := serve
+		if bfSender, ok := sender.(*gofer.BigFileSender); ok {
+			cmdBroadcast(address, bfSender)
+			return
+		}
 		server := gofer.NewSendServer(sender)
 		//gofer.ListenAndServe(address, server)
-		gofer.ListenAndServeTLS(address, server)
+		if err := gofer.ListenAndServeTLS(address, server); err != nil {
+			fail(os.Stdout, errCodeUsage, "bad -s", err)
+			exit(1)
+		}
 	case client != "":
 		address := client
 		client := gofer.NewSendClient(sender)
 		//gofer.DialAndRunClient(address, client)
-		gofer.DialAndRunClientTLS(address, client)
+		if err := gofer.RetryDialAndRunClientTLS(address, client, time.Minute, retries); err != nil { // 断线重连, 大文件从断点续传
+			fail(os.Stdout, gofer.ErrCodeConnect, "send failed", err)
+			exit(1)
+		}
+	default:
+		usage()
+	}
+}
+
+// cmdBroadcast 把大文件发给每一个连进来的接收端, 定时打印进度。
+// 收到 -expect 个接收端的确认 (或者 Ctrl-C) 以后打印汇总, 退出。
+func cmdBroadcast(address string, sender *gofer.BigFileSender) {
+	server := gofer.NewBroadcastServer(sender, expect)
+	goSafe(func() {
+		if err := gofer.ListenAndServeTLS(address, server); err != nil {
+			fail(os.Stdout, errCodeUsage, "bad -s", err)
+			exit(1)
+		}
+	})
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	ticker := time.NewTicker(5 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !showProgress {
+				server.WriteProgress(os.Stdout)
+			}
+		case <-server.Done():
+			server.WriteSummary(os.Stdout)
+			return
+		case <-interrupt:
+			server.WriteSummary(os.Stdout)
+			exit(1)
+		}
+	}
+}
+
+// cmdWatch 监视目录, 一直把变了的文件推送给 -c 指定的对方, 断了就重连
+func cmdWatch() {
+	if client == "" {
+		usage()
+		return
+	}
+
+	watchClient := gofer.NewWatchClient(watch)
+	watchClient.Debounce = debounce
+	if err := watchClient.Watch(nil); err != nil {
+		fail(os.Stdout, gofer.ErrCodeIO, "bad -watch", err)
+		exit(1)
+	}
+	if err := gofer.RetryDialAndRunClientTLS(client, watchClient, time.Minute, retries); err != nil {
+		fail(os.Stdout, gofer.ErrCodeConnect, "watch failed", err)
+		exit(1)
+	}
+}
+
+// cmdQueue 把要发的东西放进发件箱, 由 gofer outbox run 投递
+func cmdQueue() {
+	if client == "" {
+		usage()
+		return
+	}
+	outbox, err := openOutbox()
+	if err != nil {
+		fail(os.Stdout, gofer.ErrCodeIO, "bad -outbox", err)
+		exit(1)
+	}
+
+	var item *gofer.OutboxItem
+	switch {
+	case message != "":
+		item, err = outbox.EnqueueMessage(client, msgInfo, message)
+	case file != "":
+		item, err = outbox.EnqueueFile(client, file)
+	case bigFile != "":
+		item, err = outbox.EnqueueFile(client, bigFile)
 	default:
-		panic("neither serve nor client")
+		usage()
+		return
+	}
+	if err != nil {
+		fail(os.Stdout, gofer.ErrCodeIO, "queue failed", err)
+		exit(1)
+	}
+	setResult(item)
+	fmt.Println("queued:", item.ID)
+}
+
+func openOutbox() (*gofer.Outbox, error) {
+	if outboxDir == "" {
+		outboxDir = gofer.DefaultOutboxDir()
+	}
+	return gofer.OpenOutbox(outboxDir)
+}
+
+func cmdOutboxRun() {
+	outbox, err := openOutbox()
+	if err != nil {
+		fail(os.Stdout, gofer.ErrCodeIO, "bad -outbox", err)
+		exit(1)
+	}
+	startControl(&gofer.ControlServer{Outbox: outbox})
+	if err := outbox.Run(nil); err != nil {
+		fail(os.Stdout, gofer.ErrCodeIO, "outbox failed", err)
+		exit(1)
+	}
+}
+
+func cmdOutboxList() {
+	outbox, err := openOutbox()
+	if err != nil {
+		fail(os.Stdout, gofer.ErrCodeIO, "bad -outbox", err)
+		exit(1)
+	}
+	items, err := outbox.List()
+	if err != nil {
+		fail(os.Stdout, gofer.ErrCodeIO, "outbox failed", err)
+		exit(1)
+	}
+	setResult(items)
+	for _, item := range items {
+		fmt.Printf("%s\t%-9s\t%d\t%-7s\t%s\t%s\t%s\n",
+			item.ID, item.Status, item.Attempts, item.Kind, item.To, item.Describe(), item.LastError)
 	}
 }
 
 func cmdRecv() {
+	startControl(&gofer.ControlServer{Receivers: []*gofer.BigFileReceiver{gofer.BigFileReceiverInstance()}})
+	if share != "" {
+		receiver := gofer.BigFileReceiverInstance()
+		receiver.ShareAddr = share
+		goSafe(func() {
+			if err := gofer.ListenAndServeTLS(share, gofer.NewShareServer(receiver)); err != nil {
+				fail(os.Stdout, errCodeUsage, "bad -share", err)
+				exit(1)
+			}
+		})
+	}
 	switch {
+	case relay != "":
+		client := gofer.NewReceiveClient()
+		if err := gofer.WaitRelayAndRunClientTLS(relay, code, client); err != nil {
+			fail(os.Stdout, gofer.ErrCodeConnect, "relay failed", err)
+			exit(1)
+		}
 	case serve != "":
 		address := serve
+		if announce != "" {
+			goSafe(func() { announceSelf(address) })
+		}
 		server := gofer.NewReceiveServer()
 		//gofer.ListenAndServe(address, server)
-		gofer.ListenAndServeTLS(address, server)
+		if err := gofer.ListenAndServeTLS(address, server); err != nil {
+			fail(os.Stdout, errCodeUsage, "bad -s", err)
+			exit(1)
+		}
+	case strings.Contains(client, ","):
+		cmdSwarm(strings.Split(client, ","))
 	case client != "":
 		address := client
 		client := gofer.NewReceiveClient()
 		//gofer.DialAndRunClient(address, client)
-		gofer.DialAndRunClientTLS(address, client)
+		if err := gofer.RetryDialAndRunClientTLS(address, client, time.Minute, retries); err != nil { // 断线重连, 大文件从断点续传
+			fail(os.Stdout, gofer.ErrCodeConnect, "recv failed", err)
+			exit(1)
+		}
+	default:
+		usage()
+	}
+}
+
+// cmdSwarm 同时从多个发送端接收同一个大文件: 每个发送端一个连接, 断了就重连。
+// 有发送端结束了, 而且没有在收的文件了才退出: 有的发送端发的是别的文件, 它先结束了也要等要收的文件收完。
+// 所有发送端都连不上 (重试了 -retries 次) 的话失败退出。
+func cmdSwarm(addresses []string) {
+	returned := make(chan error, len(addresses))
+	for _, address := range addresses {
+		goSafe(func() {
+			returned <- gofer.RetryDialAndRunClientTLS(address, gofer.NewReceiveClient(), time.Minute, retries)
+		})
+	}
+	var err error
+	for range addresses {
+		if err = <-returned; err == nil {
+			break
+		}
+	}
+	if err != nil {
+		fail(os.Stdout, gofer.ErrCodeConnect, "recv failed", err)
+		exit(1)
+	}
+	gofer.BigFileReceiverInstance().Wait()
+}
+
+func cmdRelay() {
+	if serve == "" {
+		usage()
+		return
+	}
+	server := gofer.NewRelayServer(relayRate)
+	// 中继只搬运双方端到端加密过的数据, 本身不需要 TLS
+	if err := gofer.ListenAndServe(serve, server); err != nil {
+		fail(os.Stdout, errCodeUsage, "bad -s", err)
+		exit(1)
+	}
+}
+
+// announceSelf 在局域网里宣告本接收端, address 是监听的地址。宣告不了也不影响接收, 只打日志
+func announceSelf(address string) {
+	warn := func(err error) {
+		gofer.GetLogger().Log(gofer.LogWarn, "announce failed", gofer.Field{Key: "error", Value: err})
+	}
+	_, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		warn(err)
+		return
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		warn(err)
+		return
+	}
+
+	fingerprint, err := gofer.ServerCertFingerprint()
+	if err != nil {
+		warn(err)
+		return
+	}
+	a := gofer.NewAnnouncement(announce, port, fingerprint, []string{"message", "file", "bigfile"})
+	if err := gofer.Announce(a, time.Second, nil); err != nil {
+		warn(err)
+	}
+}
+
+func cmdPeers() {
+	peers, err := gofer.Discover(timeout)
+	if err != nil {
+		fail(os.Stdout, gofer.ErrCodeNetwork, "discover failed", err)
+		exit(1)
+	}
+	if output != nil {
+		setResult(peersResult(peers))
+	}
+	for _, p := range peers {
+		fmt.Printf("%s\t%s\t%.16s\t%s\n",
+			p.Name(), p.Addr, p.Fingerprint, strings.Join(p.Capabilities, ","))
+	}
+}
+
+func cmdServe() {
+	config := &gofer.DaemonConfig{}
+	if configFile != "" {
+		c, err := gofer.LoadDaemonConfig(configFile)
+		if err != nil {
+			fail(os.Stdout, errCodeUsage, "bad -config", err)
+			exit(1)
+		}
+		config = c
+	}
+	// -export 和 -inbox 作为 "" 导出目录和 "" 收件箱, 覆盖配置文件里的
+	if export != "" {
+		if config.Exports == nil {
+			config.Exports = map[string]string{}
+		}
+		config.Exports[""] = export
+	}
+	if inbox != "" {
+		if config.Inboxes == nil {
+			config.Inboxes = map[string]string{}
+		}
+		config.Inboxes[""] = inbox
+	}
+	// -allow 相当于一条匹配所有客户端的规则; 配置文件里有规则的话, 以规则为准
+	if allow != "" {
+		if len(config.Clients) > 0 {
+			fail(os.Stdout, errCodeUsage, "bad -allow", fmt.Errorf("the config already has client rules"))
+			exit(1)
+		}
+		config.Clients = []gofer.ClientRule{{Match: "*", Permissions: strings.Split(allow, ",")}}
+	}
+
+	if serve == "" || (len(config.Exports) == 0 && len(config.Inboxes) == 0) {
+		usage()
+		return
+	}
+
+	server, err := gofer.NewDaemon(config)
+	if err != nil {
+		fail(os.Stdout, errCodeUsage, "bad -config", err)
+		exit(1)
+	}
+	startControl(&gofer.ControlServer{Receivers: server.BigFileReceivers()})
+	if webAddr != "" {
+		if _, err := gofer.NewWebServer(server).ListenAndServe(webAddr); err != nil {
+			fail(os.Stdout, errCodeUsage, "bad -web", err)
+			exit(1)
+		}
+	}
+	if httpAddr != "" || httpsAddr != "" {
+		gateway := gofer.NewHTTPGateway(server)
+		if httpAddr != "" {
+			if _, err := gateway.ListenAndServe(httpAddr); err != nil {
+				fail(os.Stdout, errCodeUsage, "bad -http", err)
+				exit(1)
+			}
+		}
+		if httpsAddr != "" {
+			if _, err := gateway.ListenAndServeTLS(httpsAddr); err != nil {
+				fail(os.Stdout, errCodeUsage, "bad -https", err)
+				exit(1)
+			}
+		}
+	}
+	if err := gofer.ListenAndServeTLS(serve, server); err != nil {
+		fail(os.Stdout, errCodeUsage, "bad -s", err)
+		exit(1)
+	}
+}
+
+func cmdGet() {
+	if flag.NArg() < 1 {
+		usage()
+		return
+	}
+	address, path := splitRemotePath(flag.Arg(0))
+	if path == "" {
+		usage()
+		return
+	}
+	client := gofer.NewGetClient(path)
+	if err := gofer.DialAndRunClientTLS(address, client); err != nil {
+		fail(os.Stdout, gofer.ErrCodeConnect, "get failed", err)
+		exit(1)
+	}
+}
+
+func cmdLs() {
+	if flag.NArg() < 1 {
+		usage()
+		return
+	}
+	address, path := splitRemotePath(flag.Arg(0))
+
+	client := gofer.NewListClient(path)
+	if err := gofer.DialAndRunClientTLS(address, client); err != nil {
+		fail(os.Stdout, gofer.ErrCodeConnect, "ls failed", err)
+		exit(1)
+	}
+	if client.Err != nil {
+		fail(os.Stdout, gofer.ErrorCode(client.Err), "ls failed", client.Err)
+		exit(1)
+	}
+	entries := client.Entries
+	if entries == nil {
+		entries = []gofer.ListEntry{}
+	}
+	setResult(entries)
+
+	switch {
+	case longFormat:
+		for _, e := range client.Entries {
+			fmt.Printf("%-7s %12d %s %-32s %s\n",
+				e.Type, e.Size, e.ModTime.Format("2006-01-02 15:04:05"), e.Hash, e.Name)
+		}
 	default:
-		panic("neither serve nor client")
+		for _, e := range client.Entries {
+			if e.Type == gofer.ListEntryDir {
+				fmt.Println(e.Name + "/")
+			} else {
+				fmt.Println(e.Name)
+			}
+		}
+	}
+}
+
+func cmdSync() {
+	if flag.NArg() != 2 { // 选项要写在 SRC 前面
+		usage()
+		return
+	}
+	src := flag.Arg(0)
+	address, dst := splitRemotePath(flag.Arg(1))
+
+	client := gofer.NewSyncClient(src, dst, gofer.SyncOptions{
+		Delete:   syncDelete,
+		DryRun:   syncDryRun,
+		Checksum: syncChecksum,
+		Filter:   gofer.SyncFilter{Include: syncInclude, Exclude: syncExclude},
+
+		Bidirectional: syncBoth,
+		Conflict:      syncConflict,
+		Ask:           askConflict,
+	})
+	client.StateKey = flag.Arg(1)
+	if err := gofer.DialAndRunClientTLS(address, client); err != nil {
+		fail(os.Stdout, gofer.ErrCodeConnect, "sync failed", err)
+		exit(1)
+	}
+	if client.Err != nil {
+		fail(os.Stdout, gofer.ErrorCode(client.Err), "sync failed", client.Err)
+		exit(1)
+	}
+	setResult(client.Plan)
+
+	if syncDryRun {
+		for _, a := range client.Plan {
+			fmt.Println(a)
+		}
+	}
+	fmt.Printf("sync: %d actions\n", len(client.Plan))
+}
+
+// askConflict 在终端上询问用户怎么解决双向同步的冲突
+func askConflict(c gofer.SyncConflict) string {
+	describe := func(e *gofer.ListEntry) string {
+		if e == nil {
+			return "deleted"
+		}
+		return fmt.Sprintf("%d Bytes, modified %s", e.Size, e.ModTime.Format("2006-01-02 15:04:05"))
+	}
+	fmt.Printf("conflict: %s\n  local:  %s\n  remote: %s\n", c.Path, describe(c.Local), describe(c.Remote))
+
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		fmt.Print("keep [l]ocal, [r]emote or [b]oth? ")
+		line, err := reader.ReadString('\n')
+		switch strings.TrimSpace(line) {
+		case "l":
+			return gofer.SyncResolveLocal
+		case "r":
+			return gofer.SyncResolveRemote
+		case "b":
+			return gofer.SyncResolveBoth
+		}
+		if err != nil { // stdin 关了, 没法问了
+			return ""
+		}
+	}
+}
+
+// splitRemotePath 把 "HOST:PORT:PATH" 分成地址 "HOST:PORT" 和路径 "PATH"。
+// HOST 可以是 "[IPv6]", 没有 ":PATH" 的话 path 为空。
+func splitRemotePath(remote string) (address string, path string) {
+	hostEnd := 0
+	if strings.HasPrefix(remote, "[") { // IPv6
+		if i := strings.Index(remote, "]"); i > 0 {
+			hostEnd = i
+		}
+	}
+	portStart := strings.Index(remote[hostEnd:], ":")
+	if portStart < 0 {
+		return remote, ""
+	}
+	portStart += hostEnd + 1
+	pathStart := strings.Index(remote[portStart:], ":")
+	if pathStart < 0 {
+		return remote, ""
 	}
+	pathStart += portStart
+	return remote[:pathStart], remote[pathStart+1:]
 }
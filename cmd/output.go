@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/cdfmlr/gofer/gofer"
+)
+
+// 给脚本看的输出！！
+// -output json 时, stdout 上只有一行一个的 JSON 对象 (newline-delimited JSON):
+//
+//  - gofer.DefaultEvents 的事件: {"event": "connected"|"retry"|"header"|"block"|"verified"|"message"|"failed", ...}
+//  - 每个传输结束时一个 {"event": "summary", "file": {进度}}
+//  - 最后一个 {"event": "result", "ok": true|false, ...}: 错误码, 所有传输的进度, 以及 ls, peers 等命令的结果
+//
+// 有 failed 事件, 或者有传输最后失败了 (断线重连以后成功了的不算), 结果就是失败, 错误码是第一个 failed 事件的。
+// 原来给人看的输出 (fmt.Print, 日志) 都改到 stderr。失败的话退出码不为 0。
+
+const (
+	outputHuman = "human"
+	outputJSON  = "json"
+)
+
+// 命令行自己的错误码, 其他的见 gofer.ErrCodeXxx
+const (
+	errCodeUsage       = "usage"
+	errCodeInterrupted = "interrupted"
+	errCodeTransfer    = "transfer_failed" // 有传输失败了, 又没有更具体的错误码
+)
+
+// jsonSummary 是一个传输结束时的事件
+type jsonSummary struct {
+	Time    time.Time          `json:"time"`
+	Event   string             `json:"event"` // "summary"
+	File    gofer.FileProgress `json:"file"`
+	Seconds float64            `json:"seconds"` // 用了多久
+}
+
+// jsonResult 是最后一行
+type jsonResult struct {
+	Time    time.Time            `json:"time"`
+	Event   string               `json:"event"` // "result"
+	Command string               `json:"command"`
+	OK      bool                 `json:"ok"`
+	Code    string               `json:"code,omitempty"`  // 失败的错误码
+	Error   string               `json:"error,omitempty"` // 失败的原因
+	Seconds float64              `json:"seconds"`
+	Files   []gofer.FileProgress `json:"files"`          // 所有传输的进度
+	Data    interface{}          `json:"data,omitempty"` // 命令的结果, 例如 ls 的文件列表
+}
+
+// jsonOutput 把事件和结果一行一个地写成 JSON
+type jsonOutput struct {
+	command string
+	started time.Time
+	cancel  []func()
+
+	mu   sync.Mutex
+	enc  *json.Encoder
+	code string // 第一个失败的错误码
+	err  string
+	data interface{}
+	done bool // result 已经写了
+}
+
+// output 在 -output json 时不为 nil
+var output *jsonOutput
+
+// startJSONOutput 开始把事件写到 stdout, 以后的 os.Stdout 是 stderr
+func startJSONOutput(command string) *jsonOutput {
+	o := &jsonOutput{command: command, started: time.Now(), enc: json.NewEncoder(os.Stdout)}
+	os.Stdout = os.Stderr
+
+	o.cancel = append(o.cancel, gofer.DefaultEvents.Subscribe(o.event))
+	o.cancel = append(o.cancel, gofer.DefaultProgress.Subscribe(o.progress))
+	return o
+}
+
+func (o *jsonOutput) write(v interface{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.done {
+		_ = o.enc.Encode(v)
+	}
+}
+
+func (o *jsonOutput) event(e gofer.Event) {
+	if e.Type == gofer.EventFailed {
+		o.fail(e.Code, e.Error)
+	}
+	o.write(e)
+}
+
+// progress 在传输结束时写一个 summary
+func (o *jsonOutput) progress(e gofer.ProgressEvent) {
+	if e.Type != gofer.ProgressDone && e.Type != gofer.ProgressFailed {
+		return
+	}
+	o.write(jsonSummary{
+		Time:    time.Now(),
+		Event:   "summary",
+		File:    e.File,
+		Seconds: time.Since(e.File.Started).Seconds(),
+	})
+}
+
+// fail 记下失败的错误码, 只记第一个
+func (o *jsonOutput) fail(code string, err string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.code == "" {
+		o.code, o.err = code, err
+	}
+}
+
+// ok 检查有没有失败过
+func (o *jsonOutput) ok() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.code == ""
+}
+
+// failTransfers 有传输最后失败了的话记下来
+func (o *jsonOutput) failTransfers(files []gofer.FileProgress) {
+	for _, f := range files {
+		if f.Finished && f.Err != "" {
+			o.fail(errCodeTransfer, fmt.Sprintf("%s %s: %s", f.Direction, f.Name, f.Err))
+			return
+		}
+	}
+}
+
+// setData 设置结果里的命令的结果
+func (o *jsonOutput) setData(data interface{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.data = data
+}
+
+// finish 写最后的 result, 之后不再写任何东西
+func (o *jsonOutput) finish() {
+	for _, cancel := range o.cancel {
+		cancel()
+	}
+	files := gofer.DefaultProgress.Files()
+	if files == nil {
+		files = []gofer.FileProgress{}
+	}
+	o.failTransfers(files)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.done {
+		return
+	}
+	_ = o.enc.Encode(jsonResult{
+		Time:    time.Now(),
+		Event:   "result",
+		Command: o.command,
+		OK:      o.code == "",
+		Code:    o.code,
+		Error:   o.err,
+		Seconds: time.Since(o.started).Seconds(),
+		Files:   files,
+		Data:    o.data,
+	})
+	o.done = true
+}
+
+// fail 报告命令失败了: 给人看的话打印到 w, 给脚本看的话记到结果里
+func fail(w io.Writer, code string, what string, err error) {
+	if output != nil {
+		output.fail(code, fmt.Sprintf("%s: %v", what, err))
+	}
+	_, _ = fmt.Fprintln(w, what+":", err)
+}
+
+// setResult 设置 -output json 的结果里命令的结果
+func setResult(data interface{}) {
+	if output != nil {
+		output.setData(data)
+	}
+}
+
+// jsonPeer 是 gofer peers 找到的一个接收端
+type jsonPeer struct {
+	Name         string   `json:"name"`
+	Addr         string   `json:"addr"`
+	Fingerprint  string   `json:"fingerprint"`
+	Capabilities []string `json:"capabilities"`
+}
+
+func peersResult(peers []*gofer.Announcement) []jsonPeer {
+	result := make([]jsonPeer, 0, len(peers))
+	for _, p := range peers {
+		result = append(result, jsonPeer{
+			Name: p.Name(), Addr: p.Addr, Fingerprint: p.Fingerprint, Capabilities: p.Capabilities,
+		})
+	}
+	return result
+}
+
+// crash 报告 main 或者 goSafe 的 goroutine 里 recover 到的 panic r:
+// -output json 的话记到结果里, 写结果, 退出码 2; 给人看的话照常 panic
+func crash(r interface{}) {
+	if output == nil {
+		panic(r)
+	}
+	output.fail(gofer.ErrCodeInternal, fmt.Sprint(r))
+	exit(2)
+}
+
+// goSafe 在新的 goroutine 里运行 f; f panic 了的话和 main 里的一样, 交给 crash
+func goSafe(f func()) {
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				crash(r)
+			}
+		}()
+		f()
+	}()
+}
+
+// exitOnInterrupt 在 Ctrl-C (或者被 kill) 时写结果, 退出
+func exitOnInterrupt() {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	<-interrupt
+	output.fail(errCodeInterrupted, "interrupted")
+	exit(130)
+}
+
+// exit 结束程序, -output json 的话先写结果; 有失败的话退出码至少为 1
+func exit(code int) {
+	if output != nil {
+		output.finish()
+		if code == 0 && !output.ok() {
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cdfmlr/gofer/gofer"
+)
+
+// 进度条！！
+// stdout 是终端的话, 在最后一行画一个进度条 (所有正在进行的传输加起来), 不停地刷新;
+// 不是终端 (例如重定向到文件) 的话, 每 progressLineInterval 给每个正在进行的传输打印一行。
+// 每个传输结束时打印一行结果。
+
+const (
+	progressBarInterval  = 200 * time.Millisecond
+	progressLineInterval = 5 * time.Second
+	progressBarWidth     = 30
+)
+
+// progressPrinter 把 gofer.DefaultProgress 的进度打印到 out
+type progressPrinter struct {
+	out io.Writer
+	tty bool
+
+	mu    sync.Mutex
+	drawn bool // 最后一行是没换行的进度条
+}
+
+// isTerminal 检查 f 是不是终端
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// startProgress 开始打印进度, 返回停止打印的函数
+func startProgress() (stop func()) {
+	p := &progressPrinter{out: os.Stdout, tty: isTerminal(os.Stdout)}
+	cancel := gofer.DefaultProgress.Subscribe(p.event)
+	if p.tty { // 日志打印前先擦掉进度条, 不然会接在进度条后面
+		_ = setLogger(&progressClearWriter{p: p, w: os.Stderr})
+	}
+
+	interval := progressLineInterval
+	if p.tty {
+		interval = progressBarInterval
+	}
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				p.tick()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		ticker.Stop()
+		close(done)
+		p.mu.Lock()
+		p.clear()
+		p.mu.Unlock()
+		_ = setLogger(os.Stderr)
+	}
+}
+
+// progressClearWriter 写之前先擦掉进度条
+type progressClearWriter struct {
+	p *progressPrinter
+	w io.Writer
+}
+
+func (c *progressClearWriter) Write(b []byte) (int, error) {
+	c.p.mu.Lock()
+	defer c.p.mu.Unlock()
+	c.p.clear()
+	return c.w.Write(b)
+}
+
+// event 在传输结束时打印一行结果
+func (p *progressPrinter) event(e gofer.ProgressEvent) {
+	if e.Type != gofer.ProgressDone && e.Type != gofer.ProgressFailed {
+		return
+	}
+	f := e.File
+	name := progressName(f)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.clear()
+	if e.Type == gofer.ProgressFailed {
+		_, _ = fmt.Fprintf(p.out, "%s %s failed: %s\n", f.Direction, name, f.Err)
+		return
+	}
+	line := fmt.Sprintf("%s %s done: %s in %v", f.Direction, name,
+		formatBytes(f.Total), time.Since(f.Started).Round(100*time.Millisecond))
+	if f.Rate > 0 {
+		line += fmt.Sprintf(" (%s/s)", formatBytes(uint64(f.Rate)))
+	}
+	_, _ = fmt.Fprintln(p.out, line)
+}
+
+// tick 刷新进度条, 或者打印一行行的进度
+func (p *progressPrinter) tick() {
+	var active []gofer.FileProgress
+	for _, f := range gofer.DefaultProgress.Files() {
+		if !f.Finished {
+			active = append(active, f)
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !p.tty {
+		for _, f := range active {
+			_, _ = fmt.Fprintln(p.out, progressLine(progressName(f), f))
+		}
+		return
+	}
+
+	p.clear()
+	if len(active) == 0 {
+		return
+	}
+	name := progressName(active[0])
+	if len(active) > 1 {
+		name = fmt.Sprintf("%d transfers", len(active))
+	}
+	agg := gofer.DefaultProgress.Aggregate()
+	_, _ = fmt.Fprint(p.out, progressBar(agg)+" "+progressLine(name, agg))
+	p.drawn = true
+}
+
+// clear 擦掉进度条, 调用者需持有锁
+func (p *progressPrinter) clear() {
+	if p.drawn {
+		_, _ = fmt.Fprint(p.out, "\r\x1b[K")
+		p.drawn = false
+	}
+}
+
+func progressName(f gofer.FileProgress) string {
+	if f.Direction == gofer.ProgressSend && f.Peer != "" {
+		return f.Name + " -> " + f.Peer
+	}
+	return f.Name
+}
+
+// progressLine 例如: big.iso 45.2% 12.3 MiB/27.0 MiB 3.4 MiB/s ETA 4s
+func progressLine(name string, f gofer.FileProgress) string {
+	rate, eta := "?", "?" // 还不知道
+	if f.Rate > 0 {
+		rate = formatBytes(uint64(f.Rate))
+	}
+	if d := f.ETA(); d >= 0 {
+		eta = d.Round(time.Second).String()
+	}
+	return fmt.Sprintf("%s %5.1f%% %s/%s %s/s ETA %s",
+		name, f.Percent(), formatBytes(f.Done), formatBytes(f.Total), rate, eta)
+}
+
+// progressBar 例如: [#############-----------------]
+func progressBar(f gofer.FileProgress) string {
+	n := int(f.Percent() * progressBarWidth / 100)
+	if n > progressBarWidth {
+		n = progressBarWidth
+	}
+	return "[" + strings.Repeat("#", n) + strings.Repeat("-", progressBarWidth-n) + "]"
+}
+
+// formatBytes 例如: 12.3 MiB
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -1,5 +1,8 @@
 module github.com/cdfmlr/gofer
 
-go 1.15
+go 1.22
 
-require github.com/rakyll/statik v0.1.7
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/rakyll/statik v0.1.7
+)
@@ -1,11 +1,11 @@
 package gofer
 
 import (
-	"crypto/md5"
 	"encoding/binary"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net"
 	"os"
 	"path"
@@ -18,6 +18,9 @@ import (
 
 var DefaultBlockSize uint64 = 1 * 1024 * 1024 // 1 MiB
 
+// MaxBlockSize 是块大小的上限: 对方请求的块再大, 也只读这么多 (块大小可以由环境变量改, 两端不一定一样)
+const MaxBlockSize uint64 = 16 * 1024 * 1024 // 16 MiB
+
 func init() {
 	val, ok := os.LookupEnv("GOFER_BIGFILE_BLOCK_BYTES")
 	if !ok {
@@ -25,11 +28,12 @@ func init() {
 	}
 
 	u, err := strconv.ParseUint(val, 10, 64)
-	if err != nil {
-		log.Fatalf("Failed to parse GOFER_BIGFILE_BLOCK_BYTES: not an int: %v\n", val)
+	if err != nil || u == 0 || u > MaxBlockSize {
+		logWarn("Ignore GOFER_BIGFILE_BLOCK_BYTES: not a positive int no more than MaxBlockSize", Field{"value", val})
+		return
 	}
 
-	log.Printf("Set GOFER_BIGFILE_BLOCK_BYTES by env: %v\n", u)
+	logInfo("Set GOFER_BIGFILE_BLOCK_BYTES by env", Field{"value", u})
 
     DefaultBlockSize = u
 }
@@ -297,29 +301,36 @@ func FileIDString(fileID []byte) string {
 type BigFileSender struct {
 	filePathMap sync.Map // {fileIDString: "path/to/file"}
 	headerMap   sync.Map // {fileIDString: BigFileHeader}
+	limiterMap  sync.Map // {fileIDString: *RateLimiter}, 每个文件的限速, 见 SetFileRate
+	canceled    sync.Map // {fileIDString: true}, 取消了的文件, 见 Cancel
+	paused      sync.Map // {fileIDString: true}, 暂停了的文件, 见 Pause
+
+	Bandwidth   *Bandwidth  // 全局和每个对方的限速, nil 表示用 DefaultBandwidth
+	Compression Compression // 接收端能解的话, 用这种方式压缩响应的块, 见 compress.go
+	Progress    *Progress   // 向它报告发给每个接收端的进度, nil 表示 DefaultProgress
+
+	cache      *blockCache                                              // 读过的块缓存在这里, nil 表示不缓存
+	onResponse func(conn net.Conn, resp *BigFileResponse, wireSize int) // 每发出一个响应调用一次, nil 表示不用
+	onPeerList func(conn net.Conn, list *PeerList)                      // 收到接收端宣告的分享地址时调用, nil 表示不理会
 }
 
 func NewBigFileSender() *BigFileSender {
-	return &BigFileSender{}
+	return &BigFileSender{Compression: DefaultCompression}
 }
 
-func (s *BigFileSender) AppendFile(filePath string) {
-	fileName := filepath.Base(filePath)
-	// Open file
-	file, err := os.Open(filePath)
-	if err != nil {
-		fmt.Println("Open file failed:", err)
-		return
-	}
-	defer file.Close()
+// AppendFile 把文件 filePath 加入发送列表, 返回它的 fileID
+func (s *BigFileSender) AppendFile(filePath string) (fileID []byte, err error) {
+	return s.AppendFileAs(filePath, filepath.Base(filePath))
+}
 
+// AppendFileAs 和 AppendFile 一样, 不过让接收端以 fileName 保存这个文件
+func (s *BigFileSender) AppendFileAs(filePath string, fileName string) (fileID []byte, err error) {
 	// Get hash and size
-	h := md5.New()
-	fileSize, err := io.Copy(h, file)
+	fileHash, fileSize, err := FileHash(filePath)
 	if err != nil {
-		log.Fatal(err)
+		logError("Open file failed", Field{"file", filePath}, fErr(err))
+		return nil, err
 	}
-	fileHash := h.Sum(nil)
 
 	// Store
 	fileIDString := FileIDString(fileHash)
@@ -328,30 +339,197 @@ func (s *BigFileSender) AppendFile(filePath string) {
 
 	s.filePathMap.Store(fileIDString, filePath)
 	s.headerMap.Store(fileIDString, *NewBigFileHeader(fileHash, fileName, uint64(fileSize)))
+	s.canceled.Delete(fileIDString) // 取消了又重新加入的, 再发
+
+	return fileHash, nil
+}
+
+// Cancel 取消发送文件 fileIDString: 不再发它的 header, 接收端再来请求时回 ErrorPacket (ErrCodeCanceled,
+// message 是 fileIDString); 同一个连接上的其他文件照常发送。没有这个文件返回 false。
+func (s *BigFileSender) Cancel(fileIDString string) bool {
+	if _, ok := s.headerMap.Load(fileIDString); !ok {
+		return false
+	}
+	s.canceled.Store(fileIDString, true)
+	return true
+}
+
+// isCanceled 检查文件 fileIDString 是否取消了
+func (s *BigFileSender) isCanceled(fileIDString string) bool {
+	_, ok := s.canceled.Load(fileIDString)
+	return ok
+}
+
+// Pause 暂停发送文件 fileIDString: 不再发它的 header, 接收端来请求时回 ErrorPacket (ErrCodePaused),
+// 接收端就停下来等着, 连接保持。没有这个文件返回 false。
+func (s *BigFileSender) Pause(fileIDString string) bool {
+	if _, ok := s.headerMap.Load(fileIDString); !ok {
+		return false
+	}
+	s.paused.Store(fileIDString, true)
+	return true
+}
+
+// Resume 继续发送暂停了的文件 fileIDString: 重新发它的 header, 接收端收到就接着请求。
+// 没有这个文件返回 false。
+func (s *BigFileSender) Resume(fileIDString string) bool {
+	if _, ok := s.headerMap.Load(fileIDString); !ok {
+		return false
+	}
+	s.paused.Delete(fileIDString)
+	return true
 }
 
-// Send 向 conn 发送一次头（sendHeader），然后调用 sendResponse 监听 conn,
+// isPaused 检查文件 fileIDString 是否暂停了
+func (s *BigFileSender) isPaused(fileIDString string) bool {
+	_, ok := s.paused.Load(fileIDString)
+	return ok
+}
+
+// SetFileRate 限制发送文件 fileID 的速率 (Bytes/s, 所有接收端加起来), <= 0 表示不限速。
+// 可以在发送中随时修改。
+func (s *BigFileSender) SetFileRate(fileID []byte, bytesPerSec int64) {
+	s.fileLimiter(fileID).SetRate(bytesPerSec)
+}
+
+// fileLimiter 返回文件 fileID 的限速器, 没有的话新建一个不限速的
+func (s *BigFileSender) fileLimiter(fileID []byte) *RateLimiter {
+	l, _ := s.limiterMap.LoadOrStore(FileIDString(fileID), NewRateLimiter(0))
+	return l.(*RateLimiter)
+}
+
+func (s *BigFileSender) bandwidth() *Bandwidth {
+	if s.Bandwidth == nil {
+		return DefaultBandwidth
+	}
+	return s.Bandwidth
+}
+
+// Send 向 conn 发送一次所有文件的头（sendHeader），然后调用 sendResponse 监听 conn,
 // 从里面读请求（BigFileRequest），写响应（BigFileResponse）；
-// 如果长时间没有请求则重新使用 sendHeader 发送 Header
-func (s BigFileSender) Send(conn net.Conn) {
+// 如果某个文件长时间没有请求则重新发送它的 Header。所有文件都发完了才返回。
+func (s *BigFileSender) Send(conn net.Conn) error {
+	if !s.send(conn, newSendState("")) {
+		return fmt.Errorf("send big files failed")
+	}
+	return nil
+}
+
+// SendFile 和 Send 一样, 不过只发送 fileID 这一个文件 (须先 AppendFile)。
+// 和 Send 不同, 它会告诉调用者有没有发成功。
+func (s *BigFileSender) SendFile(conn net.Conn, fileID []byte) error {
+	fileIDString := FileIDString(fileID)
+	if !s.send(conn, newSendState(fileIDString)) {
+		return fmt.Errorf("send big file %s failed", fileIDString)
+	}
+	return nil
+}
+
+// bigFileHeaderInterval 是一个文件多久没有请求就重发它的 header
+const bigFileHeaderInterval = 3 * time.Second
+
+// send 是 Send 和 SendFile 的具体实现, state 决定发送哪些文件。
+// 接收端回传了所有文件的 header (都发完了) 返回 true, 出错返回 false。
+func (s *BigFileSender) send(conn net.Conn, state *sendState) bool {
 	// TODO: 错误时通知请求者
-	s.sendHeader(conn)
-	resp := s.sendResponse(conn)
+	s.sendHeader(conn, state, 0)
+	resp := s.sendResponse(conn, state)
+	ticker := time.NewTicker(bigFileHeaderInterval)
+	defer ticker.Stop()
 	for {
 		select {
-		case ok := <-resp:
+		case ok, more := <-resp:
+			if !more { // sendResponse 出错退出了
+				return false
+			}
 			if ok {
-				return
+				return true
 			}
-		case <-time.After(3 * time.Second):
-			s.sendHeader(conn)
+		case <-ticker.C:
+			s.sendHeader(conn, state, bigFileHeaderInterval)
 		}
 	}
 }
 
+// sendState 是一个连接上要发的文件的状态: sendResponse 更新, send 据此决定重发哪些文件的 header
+type sendState struct {
+	only string // 只发这个文件, "" 表示发 headerMap 里所有的文件 (包括发送途中再加入的)
+
+	mu        sync.Mutex
+	finished  map[string]bool      // 接收端回传了 header 的文件
+	requested map[string]time.Time // 每个文件上一次收到请求的时间
+
+	canceled  bool                 // 有文件取消了: 别的文件都发完了, 这个连接也不算发成功
+
+	writeMu sync.Mutex // 响应是限速分块写的, 写的时候持有, 免得和定时重发的 header 交错
+}
+
+func newSendState(only string) *sendState {
+	return &sendState{only: only, finished: map[string]bool{}, requested: map[string]time.Time{}}
+}
+
+// wants 检查这个连接上要不要发文件 fileIDString
+func (t *sendState) wants(fileIDString string) bool {
+	return t.only == "" || t.only == fileIDString
+}
+
+// request 记下收到了文件 fileIDString 的请求
+func (t *sendState) request(fileIDString string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.requested[fileIDString] = time.Now()
+}
+
+// finish 记下文件 fileIDString 发完了
+func (t *sendState) finish(fileIDString string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.finished[fileIDString] = true
+}
+
+// cancel 记下文件 fileIDString 取消了: 不再发它, 当它结束了
+func (t *sendState) cancel(fileIDString string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.finished[fileIDString] = true
+	t.canceled = true
+}
+
+// succeeded 检查是不是没有文件取消
+func (t *sendState) succeeded() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return !t.canceled
+}
+
+// idle 检查文件 fileIDString 是不是还没发完, 而且 idle 这么久都没有请求了
+func (t *sendState) idle(fileIDString string, idle time.Duration) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return !t.finished[fileIDString] && time.Since(t.requested[fileIDString]) >= idle
+}
+
+// done 检查是不是所有要发的文件都发完了 (取消了的不算)
+func (s *BigFileSender) done(state *sendState) bool {
+	state.mu.Lock()
+	defer state.mu.Unlock()
+	done := true
+	s.headerMap.Range(func(key, _ interface{}) bool {
+		fileIDString := key.(string)
+		if state.wants(fileIDString) && !s.isCanceled(fileIDString) && !state.finished[fileIDString] {
+			done = false
+		}
+		return done
+	})
+	return done
+}
+
 // sendResponse 监听 conn, 从里面读请求（BigFileRequest），写响应（BigFileResponse）
-func (s BigFileSender) sendResponse(conn net.Conn) chan bool {
+// 出错时关闭返回的 chan
+func (s *BigFileSender) sendResponse(conn net.Conn, state *sendState) chan bool {
 	done := make(chan bool)
+	progress := progressOf(s.Progress)
+	started := map[string]time.Time{} // 在这个连接上开始发的文件 {进度 ID: 开始的时间}
 
 	go func() {
 		for {
@@ -359,39 +537,135 @@ func (s BigFileSender) sendResponse(conn net.Conn) chan bool {
 			packet, err := PacketFromReader(conn)
 			//log.Println("[DEBUG] sendResponse, got from conn:", packet.Header)
 			if err != nil {
-				log.Fatal(err)
+				logWarn("BigFileSender: read request failed", fPeer(conn), fErr(err))
+				for id, t := range started {
+					progress.Finish(ProgressSend, id, err)
+					observeTransfer(ProgressSend, t, err)
+				}
+				close(done)
+				return
 			}
+			metricPacketsReceived.Inc(packetTypeName(packet.Type))
+			metricBytesReceived.Add(float64(wireSize(packet)))
 			if packet.Type == PacketTypeBigFileHeader { // Receiver 回传 header，文件发送结束
 				header := PacketAsBigFileHeader(packet)
 				fileIDString := FileIDString(header.FileID())
 
-				log.Println("BigFileSender: over:", fileIDString)
+				logInfo("BigFileSender: over", fPeer(conn), Field{"fileID", fileIDString})
+				id := s.progressID(header.FileID(), conn)
+				if t, ok := started[id]; ok {
+					progress.Finish(ProgressSend, id, nil)
+					observeTransfer(ProgressSend, t, nil)
+					delete(started, id)
+				}
+				state.finish(fileIDString)
 
-				done <- true // 这才是真的发完了，回传 true，结束工作
+				if s.done(state) {
+					if !state.succeeded() { // 有文件取消了
+						close(done)
+						return
+					}
+					done <- true // 所有文件都发完了才是真的发完了，回传 true，结束工作
+					return
+				}
+				done <- false // 还有别的文件没发完
+				continue
+			}
+			if packet.Type == PacketTypePeerList { // Receiver 在分享收到的块, 见 peer_share.go
+				if list, err := PacketAsPeerList(packet); err == nil && s.onPeerList != nil {
+					s.onPeerList(conn, list)
+				}
+				continue
+			}
+			if packet.Type == PacketTypeError { // Receiver 出错了, 或者取消了
+				err := PacketAsErrorPacket(packet)
+				fileIDString := err.Message()
+				if _, ok := s.headerMap.Load(fileIDString); ok && err.Code() == ErrCodeCanceled && state.wants(fileIDString) {
+					// 接收端取消了这一个文件: 不再发它, 接着发别的
+					logInfo("BigFileSender: receiver canceled", fPeer(conn), Field{"fileID", fileIDString})
+					if s.cancelOn(conn, state, started, fileIDString) {
+						close(done)
+						return
+					}
+					done <- false
+					continue
+				}
+				logWarn("BigFileSender: receiver gave up", fPeer(conn), Field{"code", err.Code()}, fErr(err))
+				for id := range started {
+					progress.Finish(ProgressSend, id, err)
+				}
+				close(done)
 				return
 			}
-			if packet.Type != PacketTypeBigFileRequest {
-				log.Println("BigFileSender: req.Type != PacketTypeBigFileRequest:", packet.Header)
+			if packet.Type == PacketTypeDeltaSignature { // Receiver 有旧版本的文件，要增量传输
+				if err := s.sendDelta(conn, PacketAsDeltaSignature(packet)); err != nil {
+					logWarn("BigFileSender: delta failed", fPeer(conn), fErr(err))
+					close(done)
+					return
+				}
 				done <- false
+				continue
+			}
+			if packet.Type != PacketTypeBigFileRequest {
+				logWarn("BigFileSender: unexpected packet", fPeer(conn), Field{"type", packet.Type})
+				close(done)
 				return
 			}
 			req := PacketAsBigFileRequest(packet)
+			if s.isCanceled(FileIDString(req.FileID())) { // 只告诉接收端这个文件取消了, 同一个连接上别的文件接着发
+				logInfo("BigFileSender: canceled", fPeer(conn), fFileID(req.FileID()))
+				_, _ = NewErrorPacket(ErrCodeCanceled, FileIDString(req.FileID())).WriteTo(conn)
+				if s.cancelOn(conn, state, started, FileIDString(req.FileID())) {
+					close(done)
+					return
+				}
+				done <- false
+				continue
+			}
+			if s.isPaused(FileIDString(req.FileID())) { // 接收端收到后停下来, 等 Resume 以后再发的 header
+				_, _ = NewErrorPacket(ErrCodePaused, FileIDString(req.FileID())).WriteTo(conn)
+				continue
+			}
 
 			// 获取响应
+			state.request(FileIDString(req.FileID()))
 			resp, err := s.responseReq(req)
 			if err != nil {
-				log.Println("BigFile response failed:", err)
-				done <- false
+				logError("BigFileSender: response failed", fPeer(conn), fFileID(req.FileID()), fErr(err))
+				emitFailed(Event{Direction: ProgressSend, Peer: peerOf(conn), FileID: FileIDString(req.FileID())},
+					ErrCodeIO, err)
+				close(done)
 				return
 			}
 
 			//log.Println("[debug] sendResponse:", FileIDString(resp.FileID()), resp.DataSize)
 
-			// 发送响应
-			if n, err := resp.WriteTo(conn); err != nil {
-				fmt.Println("BigFile send failed:", err)
+			// 发送响应 (压缩, 限速)
+			id := s.progressID(resp.FileID(), conn)
+			if _, ok := started[id]; !ok {
+				started[id] = time.Now()
+				s.startProgress(progress, id, resp.FileID(), conn)
+			}
+			wire := resp.Packet
+			if req.AcceptsCompression(s.Compression) {
+				wire = resp.Compressed(s.Compression)
+			}
+			state.writeMu.Lock()
+			n, err := writePacketLimited(wire, conn, s.Bandwidth, s.fileLimiter(resp.FileID()))
+			state.writeMu.Unlock()
+			if err != nil {
+				logWarn("BigFileSender: send failed", fPeer(conn), fErr(err))
 			} else {
-				fmt.Println("BigFile sent successfully: length =", n)
+				if wire != resp.Packet {
+					logDebug("BigFileSender: sent", fPeer(conn), fFileID(resp.FileID()), Field{"length", n},
+						Field{"compression", s.Compression}, Field{"size", len(resp.FileContent())})
+				} else {
+					logDebug("BigFileSender: sent", fPeer(conn), fFileID(resp.FileID()), Field{"length", n})
+				}
+				progress.Add(ProgressSend, id, uint64(len(resp.FileContent())))
+				if s.onResponse != nil {
+					s.onResponse(conn, resp, n)
+				}
 			}
 
 			done <- false // 还有继续呀，所以是 false
@@ -401,8 +675,38 @@ func (s BigFileSender) sendResponse(conn net.Conn) chan bool {
 	return done
 }
 
+// cancelOn 在 conn 上不再发文件 fileIDString (有一方取消了它), 结束它的进度。
+// 返回这个连接上是不是没有别的要发的文件了。
+func (s *BigFileSender) cancelOn(conn net.Conn, state *sendState, started map[string]time.Time, fileIDString string) bool {
+	state.cancel(fileIDString)
+	if fileID, err := hex.DecodeString(fileIDString); err == nil {
+		id := s.progressID(fileID, conn)
+		if t, ok := started[id]; ok {
+			progressOf(s.Progress).Finish(ProgressSend, id, errTransferCanceled)
+			observeTransfer(ProgressSend, t, errTransferCanceled)
+			delete(started, id)
+		}
+	}
+	return s.done(state)
+}
+
+// progressID 是把文件 fileID 发给 conn 对方的进度 ID
+func (s *BigFileSender) progressID(fileID []byte, conn net.Conn) string {
+	return FileIDString(fileID) + " " + conn.RemoteAddr().String()
+}
+
+// startProgress 报告开始把文件 fileID 发给 conn 的对方
+func (s *BigFileSender) startProgress(progress *Progress, id string, fileID []byte, conn net.Conn) {
+	name, size := FileIDString(fileID), uint64(0)
+	if h, ok := s.headerMap.Load(FileIDString(fileID)); ok {
+		header := h.(BigFileHeader)
+		name, size = header.FileName(), header.FileSize()
+	}
+	progress.Start(ProgressSend, id, name, conn.RemoteAddr().String(), 0, size)
+}
+
 // responseReq 解析 BigFileRequest 的请求，构造 BigFileResponse
-func (s BigFileSender) responseReq(req *BigFileRequest) (*BigFileResponse, error) {
+func (s *BigFileSender) responseReq(req *BigFileRequest) (*BigFileResponse, error) {
 	//log.Println("[Debug] responseReq", req.FileID(), req.Start())
 	// Open file
 	filePath, ok := s.filePathMap.Load(FileIDString(req.FileID()))
@@ -410,34 +714,73 @@ func (s BigFileSender) responseReq(req *BigFileRequest) (*BigFileResponse, error
 		return nil, fmt.Errorf("bigFileSender: resource not found")
 	}
 
-	file, err := os.Open(filePath.(string))
+	// Read: 对方要多长都行的话, 一个请求就能让我们分配很大的内存
+	length := req.Length()
+	if length > MaxBlockSize {
+		length = MaxBlockSize
+	}
+	read := func() ([]byte, error) {
+		return readBlock(filePath.(string), req.Start(), length)
+	}
+	var content []byte
+	var err error
+	if s.cache != nil {
+		content, err = s.cache.get(blockKey{FileIDString(req.FileID()), req.Start(), length}, read)
+	} else {
+		content, err = read()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// make a response
+	resp := NewBigFileResponse(req.FileID(), req.Start(), content)
+
+	logDebug("[BigFileSender] response", Field{"file", filePath}, Field{"offset", req.Start()},
+		Field{"length", len(content)})
+
+	return resp, nil
+}
+
+// readBlock 读取文件 filePath 从 start 开始的 length 个字节 (到文件结尾为止)
+func readBlock(filePath string, start uint64, length uint64) ([]byte, error) {
+	file, err := os.Open(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("bigFileSender: resource not found: %v", err)
 	}
 	defer file.Close()
 
-	// Read
-	buf := make([]byte, req.Length())
-	n, err := file.ReadAt(buf, int64(req.Start()))
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("bigFileSender: read file error: %v", err)
+	}
+	if size := uint64(info.Size()); start >= size { // 文件末尾以后, 没有内容
+		length = 0
+	} else if length > size-start {
+		length = size - start
+	}
+	buf := make([]byte, length)
+	n, err := file.ReadAt(buf, int64(start))
 	if err != nil && err != io.EOF {
 		return nil, fmt.Errorf("bigFileSender: read file error: %v", err)
 	}
-
-	// make a response
-	resp := NewBigFileResponse(req.FileID(), req.Start(), buf[:n])
-
-	log.Printf("[bigFileSender] response: flie=%s offset=%v length=%v",
-		filePath, req.Start(), n)
-
-	return resp, nil
+	return buf[:n], nil
 }
 
-// sendHeader 向 conn 发送一次 BigFileHeader
-func (s BigFileSender) sendHeader(conn net.Conn) {
+// sendHeader 向 conn 发送 state 里要发的文件的 BigFileHeader:
+// 没发完、没取消、没暂停, 而且 idle 这么久都没有请求的 (idle 为 0 就是所有没发完的)
+func (s *BigFileSender) sendHeader(conn net.Conn, state *sendState, idle time.Duration) {
 	s.headerMap.Range(func(key, value interface{}) bool {
+		fileIDString := key.(string)
+		if !state.wants(fileIDString) || s.isCanceled(fileIDString) || s.isPaused(fileIDString) ||
+			!state.idle(fileIDString, idle) {
+			return true
+		}
 		header := value.(BigFileHeader)
 		//log.Printf("[Debug] BigFileSender.sendHeader: %v %v %v", header.FileID(), header.FileName(), header.FileSize())
+		state.writeMu.Lock()
 		_, _ = header.WriteTo(conn)
+		state.writeMu.Unlock()
 		return true
 	})
 }
@@ -449,7 +792,15 @@ func (s BigFileSender) sendHeader(conn net.Conn) {
 // BigFileReceiver 是 Master, 只是指派、管理工作;
 // 而具体的文件下载工作由 BigFileReceiverWorker 来做。
 type BigFileReceiver struct {
-	workerMap sync.Map // {FileIDString(fileID): BigFileReceiverWorker}
+	Dir         string       // 收到的文件保存到这个目录, "" 表示当前目录
+	Distributer *Distributer // worker 下载时读到的其他 Packet 交给它分发, nil 表示 DistributerInstance()
+	ShareAddr   string       // 不为空时, 告诉发送端自己在这个地址 (ShareServer) 分享收到的块, 见 peer_share.go
+	Progress    *Progress    // worker 向它报告进度, nil 表示 DefaultProgress
+
+	workerMap sync.Map   // {FileIDString(fileID): BigFileReceiverWorker}
+	workerMu  sync.Mutex // 新建 worker 时持有: 多个连接同时来了同一个文件的 header, 只新建一个 worker
+	completed sync.Map // 收完了的、发送端让分享的文件 {FileIDString(fileID): "path/to/file"}, 见 peer_share.go
+	canceled  sync.Map // 取消了的文件 {FileIDString(fileID): true}, 再来的 header 回 ErrorPacket
 	wg        sync.WaitGroup
 }
 
@@ -458,58 +809,164 @@ func NewBigFileReceiver() *BigFileReceiver {
 	return &BigFileReceiver{}
 }
 
+// NewBigFileReceiverIn 新建一个把文件保存到 dir 的 BigFileReceiver,
+// worker 下载时读到的其他 Packet 交给 distributer 分发
+func NewBigFileReceiverIn(dir string, distributer *Distributer) *BigFileReceiver {
+	return &BigFileReceiver{Dir: dir, Distributer: distributer}
+}
+
+// distributer 返回 r.Distributer, 没有设置的话就是 DistributerInstance()
+func (r *BigFileReceiver) distributer() *Distributer {
+	if r.Distributer != nil {
+		return r.Distributer
+	}
+	return DistributerInstance()
+}
+
 // Receive 处理接收到的 BigFileHeader 和 BigFileResponse
 // 分发给 handleBigFileHeader 和 handleBigFileResponse 方法处理
+//
+// 如果新建了 worker，返回的 chan 在 worker 结束后才有值
 func (r *BigFileReceiver) Receive(packet *Packet, conn net.Conn) chan bool {
 	done := make(chan bool, 1)
 
 	//log.Printf("[Debug] BigFileReceiver(%p).Receive: %v", r, packet)
 	switch packet.Type {
 	case PacketTypeBigFileHeader:
-		r.handleBigFileHeader(PacketAsBigFileHeader(packet), conn)
+		if workerDone := r.handleBigFileHeader(PacketAsBigFileHeader(packet), conn); workerDone != nil {
+			return workerDone // 有 worker 就还要继续
+		}
 	case PacketTypeBigFileResponse:
 		r.handleBigFileResponse(PacketAsBigFileResponse(packet), conn)
 	default:
-		log.Printf("BigFileReceiver got an unknown Packet: %#v", packet)
+		logWarn("BigFileReceiver got an unknown Packet", fPeer(conn), Field{"type", packet.Type})
 	}
 
-	go func() {
-		r.wg.Wait()
-		done <- true
-	}()
+	done <- true
+	return done
+}
 
-	return done // 有 worker 就还要继续
+// Wait 等待所有 worker 结束
+func (r *BigFileReceiver) Wait() {
+	r.wg.Wait()
+}
+
+// Cancel 取消接收文件 fileIDString: worker 通知发送端以后结束, 已保存的块留着;
+// 之后再收到这个文件的 header 都回 ErrorPacket (ErrCodeCanceled)。没有在收这个文件返回 false。
+func (r *BigFileReceiver) Cancel(fileIDString string) bool {
+	worker, ok := r.workerMap.Load(fileIDString)
+	if !ok {
+		return false
+	}
+	r.canceled.Store(fileIDString, true)
+	worker.(*BigFileReceiverWorker).Cancel()
+	return true
+}
+
+// Pause 暂停接收文件 fileIDString, 见 BigFileReceiverWorker.Pause。没有在收这个文件返回 false。
+func (r *BigFileReceiver) Pause(fileIDString string) bool {
+	worker, ok := r.workerMap.Load(fileIDString)
+	if ok {
+		worker.(*BigFileReceiverWorker).Pause()
+	}
+	return ok
+}
+
+// Resume 继续接收暂停了的文件 fileIDString。没有在收这个文件返回 false。
+func (r *BigFileReceiver) Resume(fileIDString string) bool {
+	worker, ok := r.workerMap.Load(fileIDString)
+	if ok {
+		worker.(*BigFileReceiverWorker).Resume()
+	}
+	return ok
 }
 
 // handleBigFileHeader 处理收到的大文件头:
 // 新建一个 worker 去处理，结束后删除 worker。
-func (r *BigFileReceiver) handleBigFileHeader(header *BigFileHeader, conn net.Conn) {
+// 返回的 chan 在新建的 worker 结束后有值; 没有新建 worker 则返回 nil。
+func (r *BigFileReceiver) handleBigFileHeader(header *BigFileHeader, conn net.Conn) chan bool {
 	fileID := FileIDString(header.FileID())
 
 	//log.Println("[DEBUG] BigFileReceiver handleBigFileHeader:", fileID)
 
-	_, ok := r.workerMap.Load(fileID)
-	if ok { // file is already exist
-		//log.Println("handleBigFileHeader: file is already on receiving")
-		return
+	if done, ok := r.attach(fileID, header, conn); ok { // file is already on receiving
+		return done
+	}
+
+	if _, ok := r.canceled.Load(fileID); ok {
+		_, _ = NewErrorPacket(ErrCodeCanceled, fileID).WriteTo(conn)
+		return nil
+	}
+
+	target, err := saveFilePath(r.Dir, header.FileName())
+	if err != nil {
+		logWarn("BigFileReceiver: refuse to receive", fPeer(conn), fErr(err))
+		emitFailed(Event{Direction: ProgressRecv, Peer: peerOf(conn), FileID: fileID, Name: header.FileName()},
+			ErrCodeBadRequest, err)
+		return nil
+	}
+	if hash, _, err := FileHash(target); err == nil && string(hash) == string(header.FileHash()) {
+		// 早就收完了 (例如发送端重发的 header 来晚了): 直接回传 header 通知发送端结束
+		_, _ = header.WriteTo(conn)
+		return nil
 	}
 
 	worker := NewBigFileReceiverWorker(header)
+	worker.dir = r.Dir
+	worker.distributer = r.distributer()
+	worker.progress = progressOf(r.Progress)
+
+	// 多个来源的 header 可能同时到: 查找和新建要一起做, 否则会有两个 worker 收同一个文件
+	r.workerMu.Lock()
+	if _, ok := r.workerMap.Load(fileID); ok {
+		r.workerMu.Unlock()
+		done, _ := r.attach(fileID, header, conn)
+		return done
+	}
+	// 交出去之前初始化: 初始化失败的 worker 不会出现在 workerMap 里, 别的连接也就不会 Attach 到它
+	if err := worker.init(); err != nil { // 没法保存, 不收了
+		r.workerMu.Unlock()
+		logError("[BigFileReceiverWorker] init failed", fFileID(header.FileID()), fErr(err))
+		emitFailed(worker.event("", conn, 0), ErrCodeIO, err)
+		done := make(chan bool, 1)
+		done <- false
+		return done
+	}
 	r.wg.Add(1)
 	r.workerMap.Store(fileID, worker)
+	r.workerMu.Unlock()
+
+	r.announceShare(conn, header.FileID())
 	//_h, _ok := r.workerMap.Load(fileID)
 	//log.Println("[DEBUG] handleBigFileHeader:", r.workerMap, r)
 	//log.Printf("[DEBUG] handleBigFileHeader: %p %p", &r.workerMap, r)
-	workerDone := worker.Run(conn)
+	done := worker.Run(conn)
 
 	go func() { // cleanup
-		select {
-		case f := <-workerDone:
-			//log.Println("[DEBUG] workerDone:", f)
-			r.workerMap.Delete(f)
-			r.wg.Done()
+		f := <-worker.done
+		//log.Println("[DEBUG] workerDone:", f)
+		if worker.received && worker.sharing() {
+			r.completed.Store(f, worker.targetPath())
 		}
+		r.workerMap.Delete(f)
+		r.wg.Done()
 	}()
+	return done
+}
+
+// attach 在已经有 worker 在收文件 fileID 时, 让它也从 conn 下载, 返回值意义同 BigFileReceiverWorker.Attach。
+// 没有这样的 worker 的话 ok 为 false。
+func (r *BigFileReceiver) attach(fileID string, header *BigFileHeader, conn net.Conn) (done chan bool, ok bool) {
+	worker, ok := r.workerMap.Load(fileID)
+	if !ok {
+		return nil, false
+	}
+	// 别的连接上也来了这个文件的 header (发送端断线重连了, 或者另一个来源): 让原来的 worker 也从这个连接下载
+	done = worker.(*BigFileReceiverWorker).Attach(conn)
+	if done != nil {
+		r.announceShare(conn, header.FileID())
+	}
+	return done, true
 }
 
 // handleBigFileResponse 处理收到的 BigFileResponse：
@@ -520,7 +977,7 @@ func (r *BigFileReceiver) handleBigFileResponse(response *BigFileResponse, conn
 	//log.Printf("[DEBUG] BigFileReceiver handleBigFileResponse: %p %p", &r.workerMap, r)
 	worker, ok := r.workerMap.Load(fileIDString)
 	if !ok { // worker is not exist
-		log.Println("BigFileReceiver: worker not found: fileID =", fileIDString)
+		logWarn("BigFileReceiver: worker not found", fPeer(conn), Field{"fileID", fileIDString})
 		return
 	}
 	worker.(*BigFileReceiverWorker).Receive(response)
@@ -531,47 +988,181 @@ func (r *BigFileReceiver) handleBigFileResponse(response *BigFileResponse, conn
 // 一个 Worker 只专注处理一个大文件。
 // BigFileReceiver 通过把 BigFileHeader 指派给 Worker，让 Worker 自行处理一个大文件的下载工作。
 //
-// Worker 会在 $PWD 新建一个以 ".{fileID}" 为名的目录（称为 saveDir），
+// Worker 会在保存目录 (默认为 $PWD) 新建一个以 ".{fileID}" 为名的目录（称为 saveDir），
 // 每次请求下载 blockSize 大小的文件片段, 保存到 saveDir, 文件名为 "{blockIndex}.block",
 // 把 savedBlock 中对应的块位置标记为 1。
 //
 // 重复下载过程，直到 savedBlock 全为 1，然后合并文件，计算 md5 和，检查是否正确。
-// 正确则 mv mergedFile $PWD/{fileName}, 不正确就丢弃。
+// 正确则 mv mergedFile $PWD/{fileName}, 不正确就丢弃。 (这里的 $PWD 都是指保存目录)
 //
 // 断点续传: Worker 并不是直接新建 saveDir。如果 saveDir 存在，则打开，
 // 从里面读取已保存的文件片段，更新 savedBlock，然后再开始下载缺失部分。
+//
+// 多个来源: 同一个文件 (同一个 fileID) 可以同时从多个连接下载, 例如好几台机器上都有这个文件。
+// 每个连接一个 fetch 循环, 空闲了就领一个没人领的缺失块去请求, 下得快的连接自然领得多;
+// 到最后没有块可领了, 快的连接会把慢的连接迟迟没下完的块抢过来再请求一次。
+//
+// 断线重连: 一个连接断了 (或者 BigFileReadTimeout 都没有响应), 它领了没下完的块退回去给别的连接下载。
+// 所有连接都断了的话, Worker 不会马上结束, 而是等 BigFileResumeTimeout,
+// 期间发送端重新连上来再发 header, master 就把新连接交给这个 Worker (Attach), 从 savedBlock 接着下载。
 type BigFileReceiverWorker struct {
-	header     *BigFileHeader // 大文件头
-	saveDir    string         // 临时目录的保存路径
-	blockSize  uint64         // 块大小, XXX: 第一个版本为了方便，固定 blockSize 为 DefaultBlockSize
-	numBlock   uint64         // 块数量
-	savedBlock []bool         // bitmap: 已保存块为 1，未保存的为 0
-	done       chan string    // worker 工作结束后通知 master (BigFileReceiver), 或 master 来终止 worker
-	wait       chan int       // 请求下载之后等待接收, 值是 blockIndex
-	allSaved   chan bool      // 所有部分都下载完成了
-	// XXX: 第一个版本并发度不高，暂时不加锁了，鸵鸟算法凑合一下
+	header      *BigFileHeader // 大文件头
+	dir         string         // 保存目录, "" 表示当前目录
+	distributer *Distributer   // 下载时读到的其他 Packet 交给它分发
+	saveDir     string         // 临时目录的保存路径
+	blockSize   uint64         // 块大小, XXX: 第一个版本为了方便，固定 blockSize 为 DefaultBlockSize
+	numBlock    uint64         // 块数量
+	savedBlock  []bool         // bitmap: 已保存块为 1，未保存的为 0
+	done        chan string    // worker 工作结束后通知 master (BigFileReceiver), 或 master 来终止 worker
+	running     bool           // Run 过了, 由 mu 保护
+
+	attach   chan *workerConn // Attach 交过来的新连接
+	fetched  chan *workerConn // fetch 循环结束了的连接
+	ended    chan struct{}    // worker 结束了
+	received bool             // 结束时文件收完了 (而且校验正确) 没有
+
+	mu       sync.Mutex
+	changed  *sync.Cond               // 有块保存了, 或者有块退回来了
+	conns    map[net.Conn]*workerConn // 正在下载的连接
+	sources  []*workerConn            // 所有下载过的连接, 最后打印各自下了多少
+	inflight map[int]*workerConn      // 请求了还没收到的块: {blockIndex: 领了这个块的连接}
+	saveMu   sync.Mutex               // 同一块从两个连接收到时, 只保存一次
+	hashes   *BlockHashes             // 每一块的 md5, 发送端给了才有, 见 peer_share.go
+	verified []bool                   // 用 hashes 校验过的块, 只分享这些块
+	peers    map[string]bool          // 连过的其他接收端的分享地址
+
+	requested []bool    // 请求过的块, 再请求一次就记到 gofer_bigfile_blocks_rerequested_total
+	started   time.Time // Run 的时间, 结束时记到 gofer_transfer_duration_seconds
+
+	cancel     chan struct{} // Cancel 关闭它
+	cancelOnce sync.Once
+	canceled   bool // 取消了, 由 mu 保护
+	paused     bool // 暂停了 (见 Pause), 由 mu 保护
+
+	rawBytes, wireBytes uint64              // 收到的块内容的大小, 以及它们在线上的大小 (压缩过的话是压缩后的)
+	compressions        map[Compression]int // 各种压缩方式的块数
+	progress            *Progress           // 向它报告进度, 见 progress.go
+}
+
+// BigFileResumeTimeout 是所有连接都断了以后, worker 等待发送端重连的时间。
+// 超时后 worker 结束, 已保存的块仍然留在 saveDir, 下次收这个文件时从断点续传。
+var BigFileResumeTimeout = 5 * time.Minute
+
+// BigFileReadTimeout 是请求了块以后一直读不到数据的最长时间, 超时就当作连接断了。
+// 响应在读的过程中每读到一点数据就重新计时, 限速很低、一个块要传很久也不会超时。
+var BigFileReadTimeout = 30 * time.Second
+
+// bigFileRequestsPerConn 是每个连接上最多同时请求几个块
+const bigFileRequestsPerConn = 2
+
+// workerConn 是 worker 用来下载的一个连接
+type workerConn struct {
+	conn net.Conn
+	done chan bool // worker 不再使用这个连接时有值: true 表示文件收完了, false 表示连接断了
+	err  error     // fetch 循环出错退出的原因
+
+	// 以下由 worker.mu 保护
+	pending map[int]time.Time // 这个连接上请求了还没收到的块: {blockIndex: 请求的时间}
+	rate    float64           // 观测到的下载速度 (Byte/s), 0 表示还不知道
+	blocks  int               // 从这个连接下载保存了几块
+	has     []bool            // 对方有哪些块, nil 表示都有 (发送端); 其他接收端的由 BlockBitmap 告知
+	asked   time.Time         // 上一次向对方要 BlockBitmap 的时间
+	paused  bool              // 发送端暂停了这个文件 (回了 ErrCodePaused), 等它再发 header 过来
+}
+
+func newWorkerConn(conn net.Conn) *workerConn {
+	return &workerConn{conn: conn, done: make(chan bool, 1), pending: map[int]time.Time{}}
 }
 
 func NewBigFileReceiverWorker(header *BigFileHeader) *BigFileReceiverWorker {
 	var blockSize uint64 = DefaultBlockSize
-	return &BigFileReceiverWorker{
-		header:    header,
-		blockSize: blockSize,
+	// 交给 master 之前就把所有的 chan 和 map 建好: 一交出去, 别的连接就可能来 Attach 了
+	w := &BigFileReceiverWorker{
+		header:       header,
+		blockSize:    blockSize,
+		distributer:  DistributerInstance(),
+		progress:     DefaultProgress,
+		cancel:       make(chan struct{}),
+		done:         make(chan string),
+		attach:       make(chan *workerConn),
+		fetched:      make(chan *workerConn),
+		ended:        make(chan struct{}),
+		conns:        map[net.Conn]*workerConn{},
+		inflight:     map[int]*workerConn{},
+		peers:        map[string]bool{},
+		compressions: map[Compression]int{},
+	}
+	w.changed = sync.NewCond(&w.mu)
+	return w
+}
+
+// errTransferCanceled 是取消了的传输的错误
+var errTransferCanceled = errors.New("transfer canceled")
+
+// Cancel 取消接收: 不再请求块, 在所有连接上回 ErrorPacket (ErrCodeCanceled) 通知对方, 然后 worker 结束。
+// 已保存的块留在 saveDir, 以后还能续传。
+func (w *BigFileReceiverWorker) Cancel() {
+	w.cancelOnce.Do(func() { close(w.cancel) })
+}
+
+// Pause 暂停接收: 不再请求新的块, 已经请求了的收完就停下来等着; 连接、已保存的块和 bitmap 都保留。
+// 用 Resume 继续, 不用重新握手。
+func (w *BigFileReceiverWorker) Pause() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.paused {
+		return
+	}
+	w.paused = true
+	logInfo("[BigFile] paused", fName(w.header.FileName()))
+	DefaultEvents.Emit(w.event(EventPaused, nil, 0))
+}
+
+// Resume 继续暂停了的接收
+func (w *BigFileReceiverWorker) Resume() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.paused {
+		return
+	}
+	w.paused = false
+	logInfo("[BigFile] resumed", fName(w.header.FileName()))
+	DefaultEvents.Emit(w.event(EventResumed, nil, 0))
+	w.changed.Broadcast()
+}
+
+// isPaused 返回是否暂停了: 自己暂停了, 或者所有来源都暂停了
+func (w *BigFileReceiverWorker) isPaused() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.paused {
+		return true
+	}
+	for _, c := range w.conns {
+		if !c.paused {
+			return false
+		}
 	}
+	return len(w.conns) > 0
 }
 
 // init 读取/新建 saveDir, 设置 numBlock、savedBlock bitmap
-func (w *BigFileReceiverWorker) init() {
+func (w *BigFileReceiverWorker) init() error {
 	// 初始化 numBlock、savedBlock
 	w.numBlock = w._numBlock()
 	w.savedBlock = make([]bool, w.numBlock)
+	w.verified = make([]bool, w.numBlock)
+	w.requested = make([]bool, w.numBlock)
 
 	// 检查 saveDir, 读取 or 新建
 	w.saveDir = w._saveDir()
-	w.prepareSaveDir()
+	if err := w.prepareSaveDir(); err != nil {
+		return err
+	}
 
 	// 同步 savedBlock 和 saveDir 里的真实情况
 	w.checkSaved()
+	return nil
 }
 
 // _numBlock 计算正确的块数 NumBlock，返回结果。
@@ -589,27 +1180,36 @@ func (w *BigFileReceiverWorker) _numBlock() uint64 {
 // _saveDir 计算正确的临时保存路径 saveDir，返回结果。
 // 注意，这个方法不设置 saveDir 字段, 要设置的话请手动赋值.
 func (w *BigFileReceiverWorker) _saveDir() string {
-	return fmt.Sprintf(".%s", FileIDString(w.header.FileID()))
+	return filepath.Join(w.dir, fmt.Sprintf(".%s", FileIDString(w.header.FileID())))
+}
+
+// targetPath 返回最终保存文件的路径: {dir}/{fileName}
+func (w *BigFileReceiverWorker) targetPath() string {
+	target, _ := saveFilePath(w.dir, w.header.FileName()) // BigFileReceiver 新建 worker 前已经检查过了
+	return target
 }
 
 // prepareSaveDir 准备 w.saveDir
 // 也就是检查目录存不存在啦，不存在就新建
-func (w *BigFileReceiverWorker) prepareSaveDir() {
+func (w *BigFileReceiverWorker) prepareSaveDir() error {
 	s, err := os.Stat(w.saveDir)
-	if err != nil && os.IsNotExist(err) { // 不存在
+	switch {
+	case os.IsNotExist(err): // 不存在
 		if err = os.Mkdir(w.saveDir, 0755); err != nil { // 新建
-			log.Fatal("BigFileReceiverWorker failed to make saveDir:", err)
+			return fmt.Errorf("failed to make saveDir: %v", err)
 		}
-	} else if !s.IsDir() {
-		log.Fatalf("BigFileReceiverWorker failed to use saveDir:"+
-			" Please remove this file first: %s", w.saveDir)
+	case err != nil:
+		return fmt.Errorf("failed to use saveDir: %v", err)
+	case !s.IsDir():
+		return fmt.Errorf("failed to use saveDir: please remove this file first: %s", w.saveDir)
 	}
+	return nil
 }
 
 // checkSaved 遍历 w.saveDir 里的文件，找出已经下载了那些文件片段，标记到 w.savedBlock
 func (w *BigFileReceiverWorker) checkSaved() {
 	filepath.Walk(w.saveDir, func(path string, info os.FileInfo, err error) error {
-		if info.IsDir() {
+		if err != nil || info.IsDir() {
 			return nil
 		}
 		if strings.HasSuffix(path, ".block") {
@@ -618,92 +1218,572 @@ func (w *BigFileReceiverWorker) checkSaved() {
 			if p < len(w.savedBlock) {
 				w.savedBlock[p] = true
 			} else {
-				log.Printf("Unexpected saved block: %d (numBlock=%d)", p, w.numBlock)
+				logWarn("Unexpected saved block", fFileID(w.header.FileID()), fBlock(p), Field{"numBlock", w.numBlock})
 			}
 		}
 		return nil
 	})
 }
 
-// Run 初始化 Worker，从 conn 请求下载所有文件片段。
-// 全部下载完成后，做 merge，最后把 fileID 发到该函数返回的 chan，并回传 header 通知发送端结束工作，。
-func (w *BigFileReceiverWorker) Run(conn net.Conn) chan string {
-	if w.done != nil { // running
-		return w.done
+// Run 初始化 Worker，从 conn 请求下载所有文件片段 (之后还可以 Attach 更多连接一起下载)。
+// 全部下载完成后，做 merge，并回传 header 通知发送端结束工作，最后把 fileID 发到 w.done 通知 master。
+//
+// 返回的 chan 在 worker 不再使用 conn 时有值: true 表示收完了, false 表示连接断了。
+func (w *BigFileReceiverWorker) Run(conn net.Conn) chan bool {
+	w.mu.Lock()
+	running := w.running
+	w.running = true
+	w.mu.Unlock()
+	if running {
+		return w.Attach(conn)
+	}
+
+	w.started = time.Now()
+	metricBigFileWorkers.Inc()
+
+	c := newWorkerConn(conn)
+	if w.savedBlock == nil { // BigFileReceiver 交出 worker 之前就初始化了, 单独用的 worker 在这里初始化
+		if err := w.init(); err != nil { // 没法保存, 不收了
+			logError("[BigFileReceiverWorker] init failed", fFileID(w.header.FileID()), fErr(err))
+			emitFailed(w.event("", conn, 0), ErrCodeIO, err)
+			go w.finish(nil, err)
+			c.done <- false
+			return c.done
+		}
 	}
+	DefaultEvents.Emit(w.event(EventHeader, conn, w.header.FileSize()))
+	w.progress.Start(ProgressRecv, FileIDString(w.header.FileID()), w.header.FileName(),
+		conn.RemoteAddr().String(), w.savedBytes(), w.header.FileSize())
+
+	w.mu.Lock()
+	w.conns[conn] = c
+	w.mu.Unlock()
+	go w.run(c)
+
+	return c.done
+}
 
-	w.done = make(chan string)
-	w.wait = make(chan int, 1) // Bug：这里不知道为什么会死锁，带上缓冲能解决；同时还收获一个 feature：缓冲给多大就同时请求几个
-	w.allSaved = make(chan bool)
+// run 是 worker 的主循环: 管理下载的连接, 全部下载完了就 merge
+func (w *BigFileReceiverWorker) run(first *workerConn) {
+	name := w.header.FileName()
 
-	w.init()
+	if w.receiveDelta(first.conn) { // 增量传输成功了, 就不用一块一块地下载了
+		logInfo("[BigFile] receive successfully (delta)", fName(name))
+		DefaultEvents.Emit(w.event(EventVerified, first.conn, w.header.FileSize()))
+		w.finish([]*workerConn{first}, nil)
+		return
+	}
 
-	go w.requestAllMissing(conn, w.wait, w.allSaved)
+	w.startFetch(first)
+	active := 1
+	var finished []*workerConn            // 下载完了正常结束的连接, 最后在上面回传 header
+	var reconnect <-chan time.Time        // 所有连接都断了以后, 等待重连的超时
+	cancel := w.cancel                    // 取消以后置为 nil, 只处理一次
+	ticker := time.NewTicker(time.Second) // 定时叫醒没块可领的 fetch, 看看能不能抢块
+	defer ticker.Stop()
 
-	go func() { // 等待下载全部完成后做 merge
+	for {
 		select {
-		case <-w.allSaved:
-			w.merge()
-			correct := w.checkFinalSum()
-			if correct {
-				fmt.Println("[BigFile] receive successfully:", w.header.FileName())
+		case c := <-w.attach:
+			if active == 0 {
+				logInfo("[BigFile] resume", fName(name), fPeer(c.conn))
 			} else {
-				fmt.Println("[BigFile] receive finished, but the file is BROKEN. "+
-					"Please remove it and try again:", w.header.FileName())
+				logInfo("[BigFile] also download", fName(name), fPeer(c.conn))
 			}
-
-			go func() { // emmmm, 读多余的数据，防止发送端一直等待无效的发送
-				_ = conn.SetReadDeadline(time.Now().Add(time.Second))
-				for {
-					_, err := PacketFromReader(conn)
-					if err != nil {
-						break
+			w.startFetch(c)
+			active++
+			reconnect = nil
+		case c := <-w.fetched:
+			active--
+			if c.err != nil {
+				if cancel != nil { // 取消了的话, 是被叫醒的
+					logWarn("[BigFileReceiverWorker] connection lost", fPeer(c.conn), fErr(c.err))
+				}
+				c.done <- false
+			} else {
+				finished = append(finished, c)
+				w.mu.Lock()
+				for conn, p := range w.conns { // 叫醒在等发送端 Resume 的 fetch
+					if p.paused {
+						_ = conn.SetReadDeadline(time.Now())
 					}
 				}
-				_ = conn.SetReadDeadline(time.Time{})
-			}()
+				w.mu.Unlock()
+			}
+		case <-ticker.C:
+			w.changed.Broadcast()
+		case <-cancel:
+			logInfo("[BigFile] canceled, saved blocks are kept for resuming", fName(name))
+			cancel = nil
+			w.mu.Lock()
+			w.canceled = true
+			for conn := range w.conns { // 通知对方, 并叫醒在读的 fetch
+				_, _ = NewErrorPacket(ErrCodeCanceled, FileIDString(w.header.FileID())).WriteTo(conn)
+				_ = conn.SetReadDeadline(time.Now())
+			}
+			w.changed.Broadcast()
+			w.mu.Unlock()
+		case <-reconnect:
+			logError("[BigFile] sender did not reconnect, saved blocks are kept for resuming", fName(name))
+			err := fmt.Errorf("sender did not reconnect")
+			emitFailed(w.event("", nil, 0), ErrCodeDisconnected, err)
+			w.finish(nil, err)
+			return
+		}
 
-			//n, err := w.header.WriteTo(conn) // 回传 header 通知发送端结束工作
-			//log.Println("[DEBUG] header -> sender:", n, err)
-			_, _ = w.header.WriteTo(conn)
+		if active > 0 {
+			continue
+		}
+		w.mu.Lock()
+		complete, canceled := w.complete(), w.canceled
+		w.mu.Unlock()
+		if canceled {
+			emitFailed(w.event("", nil, 0), ErrCodeCanceled, errTransferCanceled)
+			w.finish(nil, errTransferCanceled)
+			return
+		}
+		if complete {
+			break
+		}
+		if reconnect == nil {
+			logWarn("[BigFile] connection lost, waiting for the sender to reconnect", fName(name))
+			reconnect = time.After(BigFileResumeTimeout)
+		}
+	}
 
-			w.done <- FileIDString(w.header.FileID())
+	if len(w.sources) > 1 {
+		for _, c := range w.sources {
+			logInfo("[BigFile] blocks from source", fName(name), fPeer(c.conn), Field{"blocks", c.blocks})
 		}
-	}()
+	}
+	if w.wireBytes > 0 && w.wireBytes < w.rawBytes {
+		logInfo("[BigFile] compressed on the wire", fName(name), Field{"received", w.rawBytes},
+			Field{"wire", w.wireBytes}, Field{"percent", fmt.Sprintf("%.1f%%", float64(w.wireBytes)*100/float64(w.rawBytes))},
+			Field{"blocks", w.compressions})
+	}
+
+	w.mu.Lock() // merge 会删除块文件, 就不再分享了
+	w.verified = make([]bool, w.numBlock)
+	w.mu.Unlock()
 
-	return w.done
+	ok, err := false, w.merge()
+	if err == nil {
+		ok, err = w.checkFinalSum()
+	}
+	switch {
+	case err != nil:
+		logError("[BigFile] receive finished, but failed to save the file", fName(name), fErr(err))
+		emitFailed(w.event("", nil, 0), ErrCodeIO, err)
+		w.finish(finished, err)
+	case ok:
+		logInfo("[BigFile] receive successfully", fName(name))
+		DefaultEvents.Emit(w.event(EventVerified, nil, w.header.FileSize()))
+		w.finish(finished, nil)
+	default:
+		logError("[BigFile] receive finished, but the file is BROKEN. Please remove it and try again", fName(name))
+		err := fmt.Errorf("file is broken")
+		metricHashFailures.Inc("file")
+		emitFailed(w.event("", nil, 0), ErrCodeChecksum, err)
+		w.finish(finished, err)
+	}
 }
 
-// requestAllMissing 通过 conn 请求下载所有缺失（未下载）的文件段。
-// 每请求一个就把 blockIndex 放到 wait 信道里，等待有人 (w.Receive 啦) 把值取走；
-// 如果 wait 为 nil 则不等待。
-func (w *BigFileReceiverWorker) requestAllMissing(conn net.Conn, wait chan int, allSaved chan bool) {
-	var err error
-	for m := w.missingBlockIndices(); len(m) > 0; m = w.missingBlockIndices() {
-		for _, i := range m {
-			if !w.savedBlock[i] {
-				err = w.requestDownload(i, conn)
+// event 返回这个文件的一个事件, conn 和 size 可以为空
+func (w *BigFileReceiverWorker) event(typ string, conn net.Conn, size uint64) Event {
+	return Event{
+		Type:      typ,
+		Direction: ProgressRecv,
+		Peer:      peerOf(conn),
+		FileID:    FileIDString(w.header.FileID()),
+		Name:      w.header.FileName(),
+		Size:      size,
+		Blocks:    w.numBlock,
+	}
+}
+
+// startFetch 开始从 c 下载
+func (w *BigFileReceiverWorker) startFetch(c *workerConn) {
+	w.mu.Lock()
+	w.sources = append(w.sources, c)
+	w.mu.Unlock()
+	go w.fetch(c)
+}
+
+// finish 结束 worker: 在 conns 上回传 header 通知发送端结束工作, 然后通知 master 和这些连接的使用者。
+// err 为 nil 表示文件收完了 (而且校验正确)。
+func (w *BigFileReceiverWorker) finish(conns []*workerConn, err error) {
+	// 发送端多发的数据 (比如重发的 header) 交给接着读这个 conn 的人处理,
+	// 例如 Receiver.ReceiveAndHandleAll: 已经收完的文件的 header 会被直接回传。
+
+	//n, err := w.header.WriteTo(conn) // 回传 header 通知发送端结束工作
+	//log.Println("[DEBUG] header -> sender:", n, err)
+	for _, c := range conns {
+		_, _ = w.header.WriteTo(c.conn)
+	}
+
+	w.mu.Lock()
+	w.received = err == nil
+	w.conns = map[net.Conn]*workerConn{}
+	w.mu.Unlock()
+	close(w.ended)
+	w.progress.Finish(ProgressRecv, FileIDString(w.header.FileID()), err)
+	metricBigFileWorkers.Dec()
+	observeTransfer(ProgressRecv, w.started, err)
+
+	w.done <- FileIDString(w.header.FileID())
+	for _, c := range conns {
+		c.done <- true
+	}
+}
+
+// Attach 让 worker 也从 conn 下载 (多个来源同时下载, 或者断线重连)。返回的 chan 意义同 Run。
+// conn 已经在下载了 (发送端定时重发的 header) 的话返回 nil;
+// 还没来得及用上 conn 文件就收完了 (或者 worker 放弃了), 返回的 chan 里马上就有结果。
+func (w *BigFileReceiverWorker) Attach(conn net.Conn) chan bool {
+	return w.attachConn(newWorkerConn(conn))
+}
+
+// AttachPeer 和 Attach 一样, 不过 conn 连的是另一个接收端的 ShareServer: 只请求对方有的块
+func (w *BigFileReceiverWorker) AttachPeer(conn net.Conn) chan bool {
+	c := newWorkerConn(conn)
+	c.has = []bool{}
+	return w.attachConn(c)
+}
+
+func (w *BigFileReceiverWorker) attachConn(c *workerConn) chan bool {
+	w.mu.Lock()
+	if _, ok := w.conns[c.conn]; ok {
+		w.mu.Unlock()
+		return nil
+	}
+	w.conns[c.conn] = c
+	w.mu.Unlock()
+
+	select {
+	case w.attach <- c:
+	case <-w.ended:
+		w.mu.Lock()
+		c.done <- w.received
+		w.mu.Unlock()
+	}
+	return c.done
+}
+
+// fetch 是一个连接的下载循环: 领块, 请求, 接收, 直到文件所有的块都保存了 (c.err 为 nil), 或者连接出错
+func (w *BigFileReceiverWorker) fetch(c *workerConn) {
+	defer func() {
+		_ = c.conn.SetReadDeadline(time.Time{})
+		w.release(c)
+		w.fetched <- c
+	}()
+
+	for {
+		w.mu.Lock()
+		if w.canceled {
+			c.err = errTransferCanceled
+			w.mu.Unlock()
+			return
+		}
+		var requests []int
+		for len(c.pending) < bigFileRequestsPerConn && !w.paused && !c.paused {
+			i, ok := w.claim(c)
+			if !ok {
+				break
+			}
+			c.pending[i] = time.Now()
+			requests = append(requests, i)
+			if w.requested[i] {
+				metricBlocksRerequested.Inc()
+			}
+			w.requested[i] = true
+		}
+		askBitmap := false // 对方是接收端, 没有块可领的话, 隔一会儿问问它又有了哪些块
+		if len(c.pending) == 0 && c.has != nil && !w.paused && !w.complete() && time.Since(c.asked) > peerBitmapInterval {
+			askBitmap, c.asked = true, time.Now()
+		}
+		if len(c.pending) == 0 && !askBitmap { // 没有块可领了
+			if w.complete() {
+				w.mu.Unlock()
+				return
 			}
-			if (err == nil) && (wait != nil) {
-			WAIT:
-				for {
-					select {
-					case wait <- i:
-						break WAIT
-					case <-time.After(1 * time.Millisecond):
-						//conn.SetReadDeadline(time.Now().Add(1 * time.Millisecond))
-						p, err := PacketFromReader(conn)
-						//conn.SetReadDeadline(time.Time{})
-						if err == nil {
-							DistributerInstance().Receive(p, conn)
-						}
+			if c.paused { // 发送端暂停了: 一直读, 直到它 Resume 以后再发 header 过来
+				w.mu.Unlock()
+				if c.err = w.receiveOne(c, 0); c.err != nil {
+					w.mu.Lock()
+					if w.complete() { // 别的来源下完了, 是被叫醒的
+						c.err = nil
 					}
+					w.mu.Unlock()
+					return
 				}
+				continue
+			}
+			w.changed.Wait() // 等别的连接下完, 或者退回块来, 或者 Resume
+			w.mu.Unlock()
+			continue
+		}
+		w.mu.Unlock()
+
+		for _, i := range requests {
+			if c.err = w.requestDownload(i, c.conn); c.err != nil {
+				return
+			}
+		}
+		if askBitmap {
+			if _, c.err = NewBlockBitmap(w.header.FileID(), nil).WriteTo(c.conn); c.err != nil {
+				return
+			}
+		}
+		if c.err = w.receiveOne(c, BigFileReadTimeout); c.err != nil {
+			return
+		}
+	}
+}
+
+// claim 给连接 c 领一个要请求的块 (调用时持有 w.mu)。
+// 优先领没人领的缺失块; 没有的话, 抢一个别的连接领了很久还没下完的块:
+// 它在那个连接上等的时间已经够 c 下好几块了 (按观测到的速度算), 说明那个连接太慢, 或者断了还没发现。
+func (w *BigFileReceiverWorker) claim(c *workerConn) (blockIndex int, ok bool) {
+	for i, saved := range w.savedBlock {
+		if _, claimed := w.inflight[i]; !saved && !claimed && c.hasBlock(i) {
+			w.inflight[i] = c
+			return i, true
+		}
+	}
+
+	expected := time.Second // 还不知道 c 有多快
+	if c.rate > 0 {
+		expected = time.Duration(float64(w.blockSize) / c.rate * float64(time.Second))
+	}
+	for i, owner := range w.inflight {
+		if _, mine := c.pending[i]; mine || owner == c || !c.hasBlock(i) {
+			continue
+		}
+		if time.Since(owner.pending[i]) > 3*expected {
+			w.inflight[i] = c // 原来的连接的响应后到了也不要紧, 只会保存一次
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// idleTimeoutReader 每次读之前把 conn 的读超时设为 timeout 以后: 一直有数据就不会超时
+type idleTimeoutReader struct {
+	conn    net.Conn
+	timeout time.Duration
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	_ = r.conn.SetReadDeadline(time.Now().Add(r.timeout))
+	return r.conn.Read(p)
+}
+
+// receiveOne 从 c 读一个 Packet: 是这个文件的块就保存, 其他的交给 distributer。
+// 一直读不到数据最多等 timeout, 0 表示一直等。
+func (w *BigFileReceiverWorker) receiveOne(c *workerConn, timeout time.Duration) error {
+	var reader io.Reader = c.conn
+	if timeout > 0 {
+		reader = &idleTimeoutReader{conn: c.conn, timeout: timeout}
+	} else {
+		_ = c.conn.SetReadDeadline(time.Time{})
+	}
+	packet, err := PacketFromReader(reader)
+	if err != nil {
+		return err
+	}
+	if fileID := peerPacketFileID(packet); fileID != nil && FileIDString(fileID) == FileIDString(w.header.FileID()) {
+		switch packet.Type {
+		case PacketTypeBlockBitmap: // 对方是接收端, 告诉我们它有哪些块 (请求了它没有的块也会回这个)
+			w.setHas(c, PacketAsBlockBitmap(packet))
+		case PacketTypeBlockHashes: // 只信发送端给的
+			if c.has == nil {
+				w.setHashes(PacketAsBlockHashes(packet))
+			}
+		case PacketTypePeerList:
+			if list, err := PacketAsPeerList(packet); err == nil {
+				w.addPeers(list.Addrs)
 			}
 		}
-		w.checkSaved()
+		return nil
+	}
+	if packet.Type == PacketTypeError && PacketAsErrorPacket(packet).Code() == ErrCodeCanceled &&
+		PacketAsErrorPacket(packet).Message() == FileIDString(w.header.FileID()) { // 发送端取消了这个文件
+		logInfo("[BigFileReceiverWorker] sender canceled the file", fPeer(c.conn), fFileID(w.header.FileID()))
+		w.Cancel()
+		return errTransferCanceled
+	}
+	if packet.Type == PacketTypeError && PacketAsErrorPacket(packet).Code() == ErrCodePaused &&
+		PacketAsErrorPacket(packet).Message() == FileIDString(w.header.FileID()) { // 发送端暂停了
+		w.pauseConn(c)
+		return nil
+	}
+	if packet.Type == PacketTypeBigFileHeader &&
+		FileIDString(PacketAsBigFileHeader(packet).FileID()) == FileIDString(w.header.FileID()) {
+		w.resumeConn(c) // 发送端定时重发的 header; 暂停了的话, 说明它 Resume 了
+	}
+	if packet.Type != PacketTypeBigFileResponse {
+		w.distributer.Receive(packet, c.conn)
+		return nil
+	}
+	response := PacketAsBigFileResponse(packet)
+	if FileIDString(response.FileID()) != FileIDString(w.header.FileID()) {
+		w.distributer.Receive(packet, c.conn)
+		return nil
+	}
+	metricPacketsReceived.Inc(packetTypeName(packet.Type)) // 没有经过 distributer, 自己记
+	metricBytesReceived.Add(float64(wireSize(packet)))
+
+	i := int(response.Start() / w.blockSize)
+	w.mu.Lock()
+	if requested, ok := c.pending[i]; ok {
+		delete(c.pending, i)
+		if seconds := time.Since(requested).Seconds(); seconds > 0 {
+			rate := float64(len(response.FileContent())) / seconds
+			if c.rate == 0 {
+				c.rate = rate
+			} else {
+				c.rate = 0.7*c.rate + 0.3*rate
+			}
+		}
+	}
+	if w.inflight[i] == c {
+		delete(w.inflight, i)
+	}
+	w.mu.Unlock()
+
+	saved, err := w.save(i, response.FileContent())
+	if err != nil && c.has != nil { // 其他接收端给了坏的块, 不再从它那里下载
+		return err
+	}
+	if saved {
+		w.mu.Lock()
+		c.blocks++
+		w.rawBytes += uint64(len(response.FileContent()))
+		w.wireBytes += uint64(packet.WireDataSize())
+		if compression := packet.WireCompression(); compression != CompressionNone {
+			w.compressions[compression]++
+		}
+		w.mu.Unlock()
+	}
+	return nil
+}
+
+// pauseConn 在发送端暂停了文件后, 让 c 不再请求块, 把它领了没下完的块退回去 (别的来源还可以下)
+func (w *BigFileReceiverWorker) pauseConn(c *workerConn) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if c.paused {
+		return
+	}
+	logInfo("[BigFileReceiverWorker] sender paused the file", fPeer(c.conn), fFileID(w.header.FileID()))
+	DefaultEvents.Emit(w.event(EventPaused, c.conn, 0))
+	c.paused = true
+	for i := range c.pending {
+		if w.inflight[i] == c {
+			delete(w.inflight, i)
+		}
+	}
+	c.pending = map[int]time.Time{}
+	w.changed.Broadcast()
+}
+
+// resumeConn 在发送端继续发文件后, 让 c 接着请求块
+func (w *BigFileReceiverWorker) resumeConn(c *workerConn) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !c.paused {
+		return
 	}
-	allSaved <- true
+	logInfo("[BigFileReceiverWorker] sender resumed the file", fPeer(c.conn), fFileID(w.header.FileID()))
+	DefaultEvents.Emit(w.event(EventResumed, c.conn, 0))
+	c.paused = false
+}
+
+// release 在 c 的 fetch 循环结束后, 把它领了没下完的块退回去
+func (w *BigFileReceiverWorker) release(c *workerConn) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := range c.pending {
+		if w.inflight[i] == c {
+			delete(w.inflight, i)
+		}
+	}
+	c.pending = map[int]time.Time{}
+	delete(w.conns, c.conn)
+	w.changed.Broadcast()
+}
+
+// save 保存收到的块, 返回是否真的保存了: 已经保存过的块 (重复请求的) 就不管了, 保存失败的块以后重新领。
+// 有 w.hashes 的话先校验, 校验不通过返回错误。
+func (w *BigFileReceiverWorker) save(blockIndex int, content []byte) (saved bool, err error) {
+	if blockIndex < 0 || blockIndex >= len(w.savedBlock) {
+		logWarn("Unexpected block", fFileID(w.header.FileID()), fBlock(blockIndex), Field{"numBlock", w.numBlock})
+		return false, nil
+	}
+
+	w.saveMu.Lock()
+	defer w.saveMu.Unlock()
+
+	w.mu.Lock()
+	saved, hashes := w.savedBlock[blockIndex], w.hashes
+	w.mu.Unlock()
+	if saved {
+		return false, nil
+	}
+	if hashes != nil && !hashes.Verify(blockIndex, content) {
+		logWarn("[BigFileReceiverWorker] block is corrupted, dropped", fFileID(w.header.FileID()), fBlock(blockIndex))
+		metricHashFailures.Inc("block")
+		return false, errCorruptedBlock
+	}
+
+	if err := w.saveBlock(uint64(blockIndex), content); err != nil {
+		return false, nil
+	}
+
+	w.mu.Lock()
+	w.savedBlock[blockIndex] = true
+	w.verified[blockIndex] = hashes != nil
+	w.changed.Broadcast()
+	w.mu.Unlock()
+	w.progress.Add(ProgressRecv, FileIDString(w.header.FileID()), uint64(len(content)))
+	event := w.event(EventBlock, nil, uint64(len(content)))
+	block := uint64(blockIndex)
+	event.Block = &block
+	DefaultEvents.Emit(event)
+	return true, nil
+}
+
+// savedBytes 返回已保存的块一共多少字节
+func (w *BigFileReceiverWorker) savedBytes() uint64 {
+	var n uint64
+	for i, saved := range w.savedBlock {
+		if !saved {
+			continue
+		}
+		if i == len(w.savedBlock)-1 { // 最后一块可能不满
+			n += w.header.FileSize() - w.blockSize*uint64(i)
+		} else {
+			n += w.blockSize
+		}
+	}
+	return n
+}
+
+// blockCounts 返回一共几块, 已经保存了几块
+func (w *BigFileReceiverWorker) blockCounts() (blocks uint64, saved uint64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, ok := range w.savedBlock {
+		if ok {
+			saved++
+		}
+	}
+	return w.numBlock, saved
+}
+
+// complete 返回是不是所有块都保存了 (调用时持有 w.mu)
+func (w *BigFileReceiverWorker) complete() bool {
+	return len(w.missingBlockIndices()) == 0
 }
 
 // missingBlockIndices 返回所有没下载的块索引
@@ -724,6 +1804,7 @@ func (w *BigFileReceiverWorker) requestDownload(blockIndex int, conn net.Conn) e
 	start := w.blockSize * uint64(blockIndex) // offset of file
 
 	req := NewBigFileRequest(w.header.FileID(), start, w.blockSize)
+	req.SetAcceptCompression(SupportedCompressions...) // 发送端愿意的话, 压缩了发过来
 
 	if _, err := req.WriteTo(conn); err != nil {
 		//log.Println("BigFileRequest send failed:", err)
@@ -732,32 +1813,17 @@ func (w *BigFileReceiverWorker) requestDownload(blockIndex int, conn net.Conn) e
 	return nil
 }
 
-// Receive 接收一个该 Worker 负责的文件的 BigFileResponse
+// Receive 接收一个该 Worker 负责的文件的 BigFileResponse (不是在 fetch 循环里读到的, 比如断线前请求的块后到了)
 func (w *BigFileReceiverWorker) Receive(response *BigFileResponse) {
 	//log.Println("[DEBUG] BigFileReceiverWorker.Receive", FileIDString(response.FileID()), response.Start())
 	if FileIDString(response.FileID()) != FileIDString(w.header.FileID()) {
 		// 不是这个 worker 负责的啊，分发错了，master 不对劲🤨
-		log.Fatalf("BigFileReceiverWorker (for %x) got an unexpected Response (for %x)",
-			w.header.FileID(), response.FileID())
+		logError("BigFileReceiverWorker got an unexpected Response",
+			fFileID(w.header.FileID()), Field{"responseFileID", FileIDString(response.FileID())})
 		return
 	}
 
-	block := response.Start() / w.blockSize
-
-	err := w.saveBlock(block, response.FileContent())
-	if err == nil { // 无错: 保存成功
-		w.savedBlock[block] = true
-	}
-
-	// 唤醒 requestAllMissing, 继续请求
-	if w.wait != nil {
-		select {
-		case <-w.wait:
-			return
-		case <-time.After(10 * time.Second): // timeout, 这个应该是个错误
-			log.Println("BigFileReceiverWorker Error: Receive <-w.wait timeout")
-		}
-	}
+	_, _ = w.save(int(response.Start()/w.blockSize), response.FileContent())
 }
 
 // saveBlock 保存一个文件块
@@ -766,30 +1832,35 @@ func (w *BigFileReceiverWorker) saveBlock(block uint64, fileContent []byte) erro
 
 	file, err := os.OpenFile(name, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
 	if err != nil {
-		log.Printf("[BigFileReceiverWorker] block %v save failed: %v\n", block, err)
+		logError("[BigFileReceiverWorker] block save failed", fFileID(w.header.FileID()), fBlock(block), fErr(err))
 		return err
 	}
 	defer file.Close()
 
-	if n, err := file.Write(fileContent); err != nil {
-		log.Printf("[BigFileReceiverWorker] block %v save failed: %v\n", block, err)
+	n, err := file.Write(fileContent)
+	if err != nil {
+		logError("[BigFileReceiverWorker] block save failed", fFileID(w.header.FileID()), fBlock(block), fErr(err))
 		return err
-	} else {
-		log.Printf("[BigFileReceiverWorker] block %v/%v: %d Bytes saved.\n", block, w.numBlock-1, n)
 	}
+	logDebug("[BigFileReceiverWorker] block saved", fFileID(w.header.FileID()),
+		fBlock(fmt.Sprintf("%d/%d", block, w.numBlock-1)), Field{"size", n})
 	return nil
 }
 
 // merge 合并文件:
 // 把所有块文件逐个追加入 0.block, 然后删除, 完成后只会剩下 0.block 一个文件,
 // 最后 mv saveDir/0.block $PWD/{FileName}
-func (w *BigFileReceiverWorker) merge() {
+func (w *BigFileReceiverWorker) merge() error {
 	filePath0 := w.BlockTmpFilePath(0)
+	if w.numBlock == 0 { // 空文件, 一块也没有
+		if err := os.WriteFile(filePath0, nil, 0644); err != nil {
+			return fmt.Errorf("merge: %v", err)
+		}
+	}
 
 	mergedFile, err := os.OpenFile(filePath0, os.O_APPEND|os.O_WRONLY, os.ModeAppend)
 	if err != nil {
-		log.Fatalf("BigFileReceiverWorker merge fileID=%x failed: failed to open 0.block: %v",
-			w.header.FileID(), err)
+		return fmt.Errorf("merge: failed to open 0.block: %v", err)
 	}
 
 	for i := uint64(1); i < w.numBlock; i++ {
@@ -797,63 +1868,66 @@ func (w *BigFileReceiverWorker) merge() {
 		file, err := os.Open(filePath)
 		if err != nil {
 			_ = mergedFile.Close()
-			log.Fatalf("BigFileReceiverWorker merge fileID=%x failed: failed to open %d.block: %v",
-				w.header.FileID(), i, err)
+			return fmt.Errorf("merge: failed to open %d.block: %v", i, err)
 		}
 		_, err = io.Copy(mergedFile, file)
 		if err != nil {
 			_ = file.Close()
 			_ = mergedFile.Close()
-			log.Fatalf("BigFileReceiverWorker merge fileID=%x failed: failed to merge %d.block: %v",
-				w.header.FileID(), i, err)
+			return fmt.Errorf("merge: failed to merge %d.block: %v", i, err)
 		}
 
 		_ = file.Close()
 		_ = os.Remove(filePath)
 	}
 
-	log.Printf("[BigFileReceiverWorker] big file merge: %s => %s",
-		FileIDString(w.header.FileID()), w.header.FileName())
+	logInfo("[BigFileReceiverWorker] big file merge", fFileID(w.header.FileID()), fName(w.header.FileName()))
 
-	_ = mergedFile.Close()
+	if err := mergedFile.Close(); err != nil {
+		return fmt.Errorf("merge: %v", err)
+	}
 
-	err = os.Rename(filePath0, w.header.FileName())
-	if err != nil {
-		log.Fatalln(err)
+	target := w.targetPath()
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("merge: %v", err)
+	}
+	if err := os.Rename(filePath0, target); err != nil {
+		return fmt.Errorf("merge: %v", err)
 	}
 	os.RemoveAll(w.saveDir)
+	return nil
 }
 
 // checkFinalSum 检查最终 merge 得到的文件 ($PWD/{FileName}) 的 md5
-// 匹配则返回 true，否则 false
-func (w *BigFileReceiverWorker) checkFinalSum() (ok bool) {
-	f, err := os.Open(w.header.FileName())
+// 匹配则返回 true，否则 false; 读不了文件返回错误
+func (w *BigFileReceiverWorker) checkFinalSum() (ok bool, err error) {
+	sum, _, err := FileHash(w.targetPath()) // 顺便缓存一下, 发送端重发 header 时就不用再算了
 	if err != nil {
-		log.Fatalln("BigFileReceiverWorker checkFinalSum:", err)
+		return false, fmt.Errorf("checkFinalSum: %v", err)
 	}
-	defer f.Close()
 
-	h := md5.New()
-	if _, err := io.Copy(h, f); err != nil {
-		log.Fatal(err)
-	}
-	sum := h.Sum(nil)
-
-	return string(sum) == string(w.header.FileHash())
+	return string(sum) == string(w.header.FileHash()), nil
 }
 
 // BlockTmpFilePath 获取一个文件的一个块的临时文件路径。
 // returns "{fileIDString}/{block}.block"
-func (w BigFileReceiverWorker) BlockTmpFilePath(block uint64) string {
+func (w *BigFileReceiverWorker) BlockTmpFilePath(block uint64) string {
 	return path.Join(
 		w.saveDir,
 		fmt.Sprintf("%d.block", block),
 	)
 }
 
+// 注册在 DistributerInstance() 上的 BigFileReceiver
+var _bigFileReceiver = NewBigFileReceiver()
+
+// BigFileReceiverInstance 获取注册在 DistributerInstance() 上的 BigFileReceiver
+func BigFileReceiverInstance() *BigFileReceiver {
+	return _bigFileReceiver
+}
+
 // 注册 BigFileReceiver
 func init() {
-	bigFileReceiver := NewBigFileReceiver()
-	DistributerInstance().Register(PacketTypeBigFileHeader, bigFileReceiver)
-	DistributerInstance().Register(PacketTypeBigFileResponse, bigFileReceiver)
+	DistributerInstance().Register(PacketTypeBigFileHeader, _bigFileReceiver)
+	DistributerInstance().Register(PacketTypeBigFileResponse, _bigFileReceiver)
 }
@@ -1,12 +1,18 @@
 package gofer
 
 import (
+	"bytes"
 	"crypto/md5"
+	"crypto/rand"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"os"
+	"path/filepath"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestMD5(t *testing.T) {
@@ -23,3 +29,251 @@ func TestMD5(t *testing.T) {
 
 	fmt.Printf("%x", h.Sum(nil))
 }
+
+func TestBigFileReceiverWorkerClaim(t *testing.T) {
+	w := &BigFileReceiverWorker{
+		blockSize:  10,
+		savedBlock: []bool{true, false, false},
+		inflight:   map[int]*workerConn{},
+		conns:      map[net.Conn]*workerConn{},
+	}
+	w.changed = sync.NewCond(&w.mu)
+	a, b := newWorkerConn(nil), newWorkerConn(nil)
+
+	// 没人领的缺失块, 先到先得
+	if i, ok := w.claim(a); !ok || i != 1 {
+		t.Fatalf("a claim = %v, %v, want 1", i, ok)
+	}
+	a.pending[1] = time.Now()
+	if i, ok := w.claim(b); !ok || i != 2 {
+		t.Fatalf("b claim = %v, %v, want 2", i, ok)
+	}
+	b.pending[2] = time.Now()
+
+	// a 刚请求的块不抢
+	if i, ok := w.claim(b); ok {
+		t.Fatalf("b should not steal %v", i)
+	}
+	// a 等了太久了, 抢过来
+	a.pending[1] = time.Now().Add(-time.Minute)
+	if i, ok := w.claim(b); !ok || i != 1 || w.inflight[1] != b {
+		t.Fatalf("b steal = %v, %v, want 1", i, ok)
+	}
+
+	// a 断了, 不影响 b 抢过去的块
+	w.release(a)
+	if w.inflight[1] != b || len(a.pending) != 0 {
+		t.Errorf("release(a): inflight = %v", w.inflight)
+	}
+}
+
+// startBigFileSenders 起 n 个发送 file 的 SendServer, 返回它们的地址
+func startBigFileSenders(t *testing.T, file string, n int) []string {
+	var addrs []string
+	for i := 0; i < n; i++ {
+		sender := NewBigFileSender()
+		if _, err := sender.AppendFile(file); err != nil {
+			t.Fatal(err)
+		}
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { listener.Close() })
+		go (&server{Handler: NewSendServer(sender)}).Serve(listener)
+		addrs = append(addrs, listener.Addr().String())
+	}
+	return addrs
+}
+
+func TestBigFileReceiverMultipleSources(t *testing.T) {
+	defer func(size uint64) { DefaultBlockSize = size }(DefaultBlockSize)
+	DefaultBlockSize = 1024
+
+	src, dst := t.TempDir(), t.TempDir()
+	content := make([]byte, 64*1024+100)
+	if _, err := rand.Read(content); err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(src, "big.bin")
+	if err := os.WriteFile(file, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	distributer := &Distributer{}
+	receiver := NewBigFileReceiverIn(dst, distributer)
+	distributer.Register(PacketTypeBigFileHeader, receiver)
+	distributer.Register(PacketTypeBigFileResponse, receiver)
+
+	// 好几个来源的 header 同时到, 只能有一个 worker
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	for _, addr := range startBigFileSenders(t, file, 8) {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			<-(&Receiver{Distributer: distributer}).ReceiveAndHandle(conn)
+		}()
+	}
+	time.Sleep(100 * time.Millisecond) // 等 header 都到了, 一起处理
+	close(start)
+	wg.Wait()
+	receiver.Wait()
+
+	got, err := os.ReadFile(filepath.Join(dst, "big.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Error("received file differs")
+	}
+}
+
+func TestBigFileReceiverInitFailed(t *testing.T) {
+	dst := t.TempDir()
+	fileID := md5.Sum([]byte("big.bin"))
+	header := NewBigFileHeader(fileID[:], "big.bin", 100)
+	// saveDir 的位置被一个文件占了, 没法初始化
+	if err := os.WriteFile(filepath.Join(dst, "."+FileIDString(fileID[:])), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	receiver := NewBigFileReceiverIn(dst, &Distributer{})
+	done := receiver.handleBigFileHeader(header, a)
+	if done == nil || <-done {
+		t.Fatal("handleBigFileHeader should fail")
+	}
+	if _, ok := receiver.workerMap.Load(FileIDString(fileID[:])); ok {
+		t.Error("worker that failed to init should not be in workerMap")
+	}
+}
+
+func TestBigFileReceiverWorkerPauseResume(t *testing.T) {
+	blockSize := DefaultBlockSize
+	DefaultBlockSize = 1024
+	defer func() { DefaultBlockSize = blockSize }()
+
+	content := make([]byte, 3*1024+100)
+	_, _ = rand.Read(content)
+	fileID := md5.Sum(content)
+	header := NewBigFileHeader(fileID[:], "big.bin", uint64(len(content)))
+
+	dst := t.TempDir()
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	receiver := NewBigFileReceiverIn(dst, &Distributer{})
+
+	// 假的发送端: 一直读, net.Pipe 的写是同步的
+	packets := make(chan *Packet, 64)
+	go func() {
+		defer close(packets)
+		for {
+			packet, err := PacketFromReader(b)
+			if err != nil {
+				return
+			}
+			packets <- packet
+		}
+	}()
+	nextRequest := func(timeout time.Duration) *BigFileRequest {
+		deadline := time.After(timeout)
+		for {
+			select {
+			case packet, ok := <-packets:
+				if !ok {
+					t.Fatal("connection closed")
+				}
+				if packet.Type == PacketTypeBigFileRequest {
+					return PacketAsBigFileRequest(packet)
+				}
+			case <-deadline:
+				return nil
+			}
+		}
+	}
+
+	done := receiver.handleBigFileHeader(header, a)
+	if done == nil {
+		t.Fatal("handleBigFileHeader returned nil")
+	}
+
+	// 暂停: 先收下一轮的请求, 回 ErrCodePaused 以后不应该再来请求
+	for i := 0; i < bigFileRequestsPerConn; i++ {
+		if nextRequest(5*time.Second) == nil {
+			t.Fatal("no BigFileRequest before pause")
+		}
+	}
+	if _, err := NewErrorPacket(ErrCodePaused, FileIDString(fileID[:])).WriteTo(b); err != nil {
+		t.Fatal(err)
+	}
+	if req := nextRequest(500 * time.Millisecond); req != nil {
+		t.Fatalf("BigFileRequest %v sent while paused", req.Start())
+	}
+
+	// 继续: 重发 header, 在同一个连接上接着下载, 直到收到回传的 header
+	if _, err := header.WriteTo(b); err != nil {
+		t.Fatal(err)
+	}
+	for finished := false; !finished; {
+		select {
+		case packet, ok := <-packets:
+			if !ok {
+				t.Fatal("connection closed before the download completed")
+			}
+			switch packet.Type {
+			case PacketTypeBigFileRequest:
+				req := PacketAsBigFileRequest(packet)
+				end := req.Start() + req.Length()
+				if end > uint64(len(content)) {
+					end = uint64(len(content))
+				}
+				if _, err := NewBigFileResponse(fileID[:], req.Start(), content[req.Start():end]).WriteTo(b); err != nil {
+					t.Fatal(err)
+				}
+			case PacketTypeBigFileHeader:
+				finished = true
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("download did not complete after resume")
+		}
+	}
+
+	if !<-done {
+		t.Fatal("worker failed")
+	}
+	got, err := os.ReadFile(filepath.Join(dst, "big.bin"))
+	if err != nil || !bytes.Equal(got, content) {
+		t.Errorf("received file differs: %v", err)
+	}
+}
+
+func TestBigFileSenderClampsRequestLength(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "small.bin")
+	if err := os.WriteFile(file, []byte("gofer"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewBigFileSender()
+	fileID, err := s.AppendFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 要一个很大的块, 只读文件里有的
+	resp, err := s.responseReq(NewBigFileRequest(fileID, 1, 1<<40))
+	if err != nil || string(resp.FileContent()) != "ofer" {
+		t.Errorf("responseReq = %v, %v, want %q", resp, err, "ofer")
+	}
+	if resp, err := s.responseReq(NewBigFileRequest(fileID, 100, 1<<40)); err != nil || len(resp.FileContent()) != 0 {
+		t.Errorf("responseReq past the end = %v, %v, want empty", resp, err)
+	}
+}
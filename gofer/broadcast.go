@@ -0,0 +1,348 @@
+package gofer
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// 广播！！
+// gofer send -bigfile FILE -s ADDRESS 一个发送端, 同时发给连进来的很多接收端:
+//
+//  - 所有接收端共用一个块缓存 (blockCache): 大家差不多同时请求同一块时, 只读一次磁盘
+//  - 记录每个接收端 (每个连接) 的进度, 结束时给出谁收完了、谁失败了的汇总
+//  - Expect > 0 时, Expect 个接收端确认收完以后 Done() 关闭, 发送端就可以退出了
+//  - 接收端宣告了分享地址的话, 给它每一块的 md5 和其他接收端的地址, 让它们互相下载 (见 peer_share.go)
+
+// DefaultBroadcastCacheSize 是广播时块缓存的大小 (字节)
+var DefaultBroadcastCacheSize = 64 * 1024 * 1024 // 64 MiB
+
+// 广播时一个接收端的状态
+const (
+	BroadcastReceiving = "receiving"
+	BroadcastCompleted = "completed"
+	BroadcastFailed    = "failed"
+)
+
+// BroadcastReceiver 是广播时一个接收端 (一个连接) 的进度
+type BroadcastReceiver struct {
+	Addr     string    `json:"addr"`
+	Status   string    `json:"status"`          // BroadcastReceiving, BroadcastCompleted or BroadcastFailed
+	Sent     uint64    `json:"sent"`            // 这个发送端已经发给它的文件内容字节数 (不算它从其他接收端下载的)
+	Wire     uint64    `json:"wire"`            // 这些响应在线上的字节数 (压缩了的话比 Sent 小)
+	Share    string    `json:"share,omitempty"` // 它分享收到的块的地址
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Err      string    `json:"error,omitempty"`
+}
+
+// Percent 返回已发送的百分比, 重传的块也算在内, 所以最多算到 100
+func (r BroadcastReceiver) Percent(size uint64) float64 {
+	if size == 0 || r.Sent >= size {
+		return 100
+	}
+	return float64(r.Sent) * 100 / float64(size)
+}
+
+// BroadcastServer 把 Sender 里的大文件发给每一个连进来的接收端, 实现 Server 接口
+type BroadcastServer struct {
+	Sender *BigFileSender
+	Expect int    // 这么多接收端收完以后关闭 Done(), 0 表示一直发下去
+	Size   uint64 // 要发的文件的总大小
+
+	mu        sync.Mutex
+	receivers []*BroadcastReceiver
+	byConn    map[net.Conn]*BroadcastReceiver
+	sharers   map[net.Conn]sharer // 宣告了分享地址的接收端
+	completed int
+	done      chan struct{}
+
+	hashMu sync.Mutex
+	hashes map[string][]byte // {fileIDString: 每一块的 md5}, 第一个接收端宣告分享时才计算
+}
+
+// sharer 是一个分享着 fileID 这个文件的接收端
+type sharer struct {
+	fileID []byte
+	addr   string
+}
+
+// NewBroadcastServer 新建一个广播 sender 里的文件的 BroadcastServer, 给 sender 装上共用的块缓存
+func NewBroadcastServer(sender *BigFileSender, expect int) *BroadcastServer {
+	b := &BroadcastServer{
+		Sender:  sender,
+		Expect:  expect,
+		byConn:  map[net.Conn]*BroadcastReceiver{},
+		sharers: map[net.Conn]sharer{},
+		done:    make(chan struct{}),
+		hashes:  map[string][]byte{},
+	}
+	sender.headerMap.Range(func(key, value interface{}) bool {
+		header := value.(BigFileHeader)
+		b.Size += header.FileSize()
+		return true
+	})
+	sender.cache = newBlockCache(DefaultBroadcastCacheSize)
+	sender.onResponse = b.sent
+	sender.onPeerList = b.peerList
+	return b
+}
+
+// ServeConn 给连进来的接收端发文件, 记录它的进度
+func (b *BroadcastServer) ServeConn(conn net.Conn) {
+	defer conn.Close()
+
+	r := &BroadcastReceiver{
+		Addr:    conn.RemoteAddr().String(),
+		Status:  BroadcastReceiving,
+		Started: time.Now(),
+	}
+	b.mu.Lock()
+	b.receivers = append(b.receivers, r)
+	b.byConn[conn] = r
+	b.mu.Unlock()
+	logInfo("Broadcast: send", fAddr(r.Addr))
+	DefaultEvents.Emit(Event{Type: EventConnected, Direction: ProgressSend, Peer: r.Addr})
+
+	err := b.Sender.Send(conn)
+
+	b.mu.Lock()
+	delete(b.byConn, conn)
+	delete(b.sharers, conn)
+	r.Finished = time.Now()
+	if err != nil {
+		r.Status, r.Err = BroadcastFailed, err.Error()
+	} else {
+		r.Status = BroadcastCompleted
+		b.completed++
+		if b.completed == b.Expect {
+			close(b.done)
+		}
+	}
+	completed := b.completed
+	b.mu.Unlock()
+
+	if err != nil {
+		logWarn("Broadcast: failed", fAddr(r.Addr), fErr(err))
+	} else {
+		logInfo("Broadcast: completed", fAddr(r.Addr),
+			Field{"elapsed", r.Finished.Sub(r.Started).Round(time.Millisecond)}, Field{"completed", completed})
+	}
+}
+
+// sent 记录发给 conn 的一个响应, 它在线上有 wireSize 字节
+func (b *BroadcastServer) sent(conn net.Conn, resp *BigFileResponse, wireSize int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if r, ok := b.byConn[conn]; ok {
+		r.Sent += uint64(len(resp.FileContent()))
+		r.Wire += uint64(wireSize)
+	}
+}
+
+// peerList 处理接收端宣告的分享地址: 回给它每一块的 md5, 然后把新的分享者告诉其他分享着同一个文件的接收端
+func (b *BroadcastServer) peerList(conn net.Conn, list *PeerList) {
+	if len(list.Addrs) == 0 {
+		return
+	}
+	addr := list.Addrs[0]
+	if host, port, err := net.SplitHostPort(addr); err == nil {
+		if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) { // 地址和连接发送端的一样
+			remoteHost, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+			addr = net.JoinHostPort(remoteHost, port)
+		}
+	}
+
+	hashes, err := b.blockHashes(list.FileID())
+	if err != nil {
+		logError("Broadcast: block hashes failed", fFileID(list.FileID()), fErr(err))
+		return
+	}
+	if _, err := NewBlockHashes(list.FileID(), DefaultBlockSize, hashes).WriteTo(conn); err != nil {
+		return
+	}
+
+	b.mu.Lock()
+	b.sharers[conn] = sharer{fileID: list.FileID(), addr: addr}
+	if r, ok := b.byConn[conn]; ok {
+		r.Share = addr
+	}
+	b.mu.Unlock()
+	logInfo("Broadcast: receiver shares blocks", fPeer(conn), Field{"share", addr})
+
+	b.sendPeerLists(list.FileID())
+}
+
+// sendPeerLists 给每一个分享着 fileID 的接收端发一个 PeerList:
+// 大家排成一圈, 每个接收端拿到它后面的 MaxSharePeers 个 (不会所有人都连所有人)
+func (b *BroadcastServer) sendPeerLists(fileID []byte) {
+	b.mu.Lock()
+	var conns []net.Conn
+	var addrs []string
+	for _, r := range b.receivers { // 按连进来的顺序排
+		for conn, s := range b.sharers {
+			if b.byConn[conn] == r && FileIDString(s.fileID) == FileIDString(fileID) {
+				conns = append(conns, conn)
+				addrs = append(addrs, s.addr)
+			}
+		}
+	}
+	b.mu.Unlock()
+
+	for i, conn := range conns {
+		var peers []string
+		for j := 1; j < len(addrs) && j <= MaxSharePeers; j++ {
+			peers = append(peers, addrs[(i+j)%len(addrs)])
+		}
+		if len(peers) > 0 {
+			_, _ = NewPeerList(fileID, peers).WriteTo(conn)
+		}
+	}
+}
+
+// blockHashes 返回 fileID 这个文件每一块的 md5, 第一次调用时计算
+func (b *BroadcastServer) blockHashes(fileID []byte) ([]byte, error) {
+	b.hashMu.Lock()
+	defer b.hashMu.Unlock()
+
+	key := FileIDString(fileID)
+	if hashes, ok := b.hashes[key]; ok {
+		return hashes, nil
+	}
+	filePath, ok := b.Sender.filePathMap.Load(key)
+	if !ok {
+		return nil, fmt.Errorf("file %s not found", key)
+	}
+	hashes, err := computeBlockHashes(filePath.(string), DefaultBlockSize)
+	if err != nil {
+		return nil, err
+	}
+	b.hashes[key] = hashes
+	return hashes, nil
+}
+
+// Done 在 Expect 个接收端收完以后关闭
+func (b *BroadcastServer) Done() <-chan struct{} {
+	return b.done
+}
+
+// Receivers 返回所有接收端的进度 (副本), 按连进来的顺序
+func (b *BroadcastServer) Receivers() []BroadcastReceiver {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	receivers := make([]BroadcastReceiver, len(b.receivers))
+	for i, r := range b.receivers {
+		receivers[i] = *r
+	}
+	return receivers
+}
+
+// WriteProgress 把还在接收的接收端的进度写到 w, 没有的话什么也不写
+func (b *BroadcastServer) WriteProgress(w io.Writer) {
+	for _, r := range b.Receivers() {
+		if r.Status == BroadcastReceiving {
+			_, _ = fmt.Fprintf(w, "Broadcast: %s %.1f%%\n", r.Addr, r.Percent(b.Size))
+		}
+	}
+}
+
+// WriteSummary 把每个接收端的结果汇总写到 w
+func (b *BroadcastServer) WriteSummary(w io.Writer) {
+	receivers := b.Receivers()
+	completed := 0
+	for _, r := range receivers {
+		if r.Status == BroadcastCompleted {
+			completed++
+		}
+	}
+	_, _ = fmt.Fprintf(w, "Broadcast summary: %d/%d receivers completed\n", completed, len(receivers))
+	for _, r := range receivers {
+		line := fmt.Sprintf("  %-21s %-9s %5.1f%%", r.Addr, r.Status, r.Percent(b.Size))
+		if !r.Finished.IsZero() {
+			line += fmt.Sprintf("  %v", r.Finished.Sub(r.Started).Round(time.Millisecond))
+		}
+		if r.Wire > 0 && r.Wire < r.Sent {
+			line += fmt.Sprintf("  %.1f%% on the wire", float64(r.Wire)*100/float64(r.Sent))
+		}
+		if r.Err != "" {
+			line += "  " + r.Err
+		}
+		_, _ = fmt.Fprintln(w, line)
+	}
+}
+
+// blockKey 标识文件的一个块
+type blockKey struct {
+	fileID string
+	start  uint64
+	length uint64
+}
+
+// blockCache 缓存最近读过的块, 多个接收端请求同一块时只读一次磁盘。
+// 缓存满了就丢掉最早放进来的块: 接收端都是从前往后请求的, 最早的块最不可能再被请求。
+type blockCache struct {
+	mu      sync.Mutex
+	max     int // 最多缓存多少字节
+	size    int
+	order   []blockKey
+	data    map[blockKey][]byte
+	loading map[blockKey]*blockLoad // 正在读的块, 同时请求它的等着读完
+}
+
+// blockLoad 是一次正在进行的读块, 读完后关闭 done
+type blockLoad struct {
+	done    chan struct{}
+	content []byte
+	err     error
+}
+
+func newBlockCache(max int) *blockCache {
+	return &blockCache{max: max, data: map[blockKey][]byte{}, loading: map[blockKey]*blockLoad{}}
+}
+
+// get 返回块 key 的内容, 不在缓存里的话用 load 读取并放进缓存。
+// 同时有好几个 get 要同一个不在缓存里的块, 只有第一个调用 load, 其他的等它的结果。
+func (c *blockCache) get(key blockKey, load func() ([]byte, error)) ([]byte, error) {
+	c.mu.Lock()
+	if content, ok := c.data[key]; ok {
+		c.mu.Unlock()
+		return content, nil
+	}
+	if l, ok := c.loading[key]; ok {
+		c.mu.Unlock()
+		<-l.done
+		return l.content, l.err
+	}
+	l := &blockLoad{done: make(chan struct{})}
+	c.loading[key] = l
+	c.mu.Unlock()
+
+	l.content, l.err = load()
+
+	c.mu.Lock()
+	delete(c.loading, key)
+	if l.err == nil {
+		c.put(key, l.content)
+	}
+	c.mu.Unlock()
+	close(l.done)
+	return l.content, l.err
+}
+
+// put 把块放进缓存, 满了就丢掉最早的块 (调用时持有 c.mu)
+func (c *blockCache) put(key blockKey, content []byte) {
+	if _, ok := c.data[key]; ok || len(content) > c.max {
+		return
+	}
+	for c.size+len(content) > c.max {
+		oldest := c.order[0]
+		c.order = c.order[1:]
+		c.size -= len(c.data[oldest])
+		delete(c.data, oldest)
+	}
+	c.data[key] = content
+	c.order = append(c.order, key)
+	c.size += len(content)
+}
@@ -0,0 +1,203 @@
+package gofer
+
+import (
+	"bytes"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestBlockCache(t *testing.T) {
+	c := newBlockCache(10)
+	loads := 0
+	load := func(content string) func() ([]byte, error) {
+		return func() ([]byte, error) {
+			loads++
+			return []byte(content), nil
+		}
+	}
+
+	a := blockKey{"f", 0, 4}
+	b := blockKey{"f", 4, 4}
+	d := blockKey{"f", 8, 4}
+
+	for i := 0; i < 3; i++ { // 多个接收端请求同一块, 只读一次
+		got, err := c.get(a, load("aaaa"))
+		if err != nil || !bytes.Equal(got, []byte("aaaa")) {
+			t.Fatalf("get(a) = %q, %v", got, err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("loads = %d, want 1", loads)
+	}
+
+	_, _ = c.get(b, load("bbbb"))
+	_, _ = c.get(d, load("dddd")) // 满了: 丢掉最早的 a
+	if _, ok := c.data[a]; ok {
+		t.Error("oldest block a should be evicted")
+	}
+	if c.size != 8 {
+		t.Errorf("size = %d, want 8", c.size)
+	}
+	_, _ = c.get(b, load("bbbb"))
+	if loads != 3 {
+		t.Errorf("loads = %d, want 3", loads)
+	}
+}
+
+func TestBlockCacheConcurrentMiss(t *testing.T) {
+	c := newBlockCache(10)
+	var loads int32
+	release := make(chan struct{})
+	load := func() ([]byte, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return []byte("aaaa"), nil
+	}
+
+	key := blockKey{"f", 0, 4}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ { // 同时请求同一个不在缓存里的块, 只读一次
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if got, err := c.get(key, load); err != nil || string(got) != "aaaa" {
+				t.Errorf("get = %q, %v", got, err)
+			}
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Errorf("loads = %d, want 1", n)
+	}
+}
+
+func TestBigFileSenderWaitsForEveryFile(t *testing.T) {
+	dir := t.TempDir()
+	sender := NewBigFileSender()
+	var headers []*BigFileHeader
+	for _, name := range []string{"a", "b"} {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fileID, err := sender.AppendFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		headers = append(headers, NewBigFileHeader(fileID, name, 1))
+	}
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	go func() { // 对面读走发过来的 header
+		for {
+			if _, err := PacketFromReader(peer); err != nil {
+				return
+			}
+		}
+	}()
+	sent := make(chan error, 1)
+	go func() { sent <- sender.Send(conn) }()
+
+	// 只回传第一个文件的 header, 还没发完
+	if _, err := headers[0].WriteTo(peer); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-sent:
+		t.Fatalf("Send returned %v before every file is received", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if _, err := headers[1].WriteTo(peer); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-sent:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send did not return after every file is received")
+	}
+}
+
+func TestBigFileSenderCancelsOneFile(t *testing.T) {
+	dir := t.TempDir()
+	sender := NewBigFileSender()
+	var fileIDs [][]byte
+	for _, name := range []string{"a", "b"} {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		fileID, err := sender.AppendFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fileIDs = append(fileIDs, fileID)
+	}
+	sender.Cancel(FileIDString(fileIDs[0]))
+
+	conn, peer := net.Pipe()
+	defer peer.Close()
+	packets := make(chan *Packet, 16)
+	go func() { // 对面读走发过来的东西, header 不管
+		for {
+			p, err := PacketFromReader(peer)
+			if err != nil {
+				return
+			}
+			if p.Type != PacketTypeBigFileHeader {
+				packets <- p
+			}
+		}
+	}()
+	sent := make(chan error, 1)
+	go func() { sent <- sender.Send(conn) }()
+	next := func() *Packet {
+		select {
+		case p := <-packets:
+			return p
+		case <-time.After(5 * time.Second):
+			t.Fatal("no reply")
+			return nil
+		}
+	}
+
+	// 取消了的文件回 ErrCodeCanceled, 带着它的 fileID
+	if _, err := NewBigFileRequest(fileIDs[0], 0, 1024).WriteTo(peer); err != nil {
+		t.Fatal(err)
+	}
+	if p := next(); p.Type != PacketTypeError || PacketAsErrorPacket(p).Code() != ErrCodeCanceled ||
+		PacketAsErrorPacket(p).Message() != FileIDString(fileIDs[0]) {
+		t.Fatalf("reply to canceled file = %v %q", p.Type, p.Data)
+	}
+	// 同一个连接上别的文件照常发
+	if _, err := NewBigFileRequest(fileIDs[1], 0, 1024).WriteTo(peer); err != nil {
+		t.Fatal(err)
+	}
+	if p := next(); p.Type != PacketTypeBigFileResponse || string(PacketAsBigFileResponse(p).FileContent()) != "b" {
+		t.Fatalf("reply to other file = %v %q", p.Type, p.Data)
+	}
+
+	// 接收端也取消了另一个文件: 没有要发的了, 不算发成功
+	if _, err := NewErrorPacket(ErrCodeCanceled, FileIDString(fileIDs[1])).WriteTo(peer); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-sent:
+		if err == nil {
+			t.Error("Send should fail when files are canceled")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send did not return after every file is canceled")
+	}
+}
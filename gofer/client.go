@@ -5,6 +5,7 @@ import (
 	"crypto/x509"
 	"fmt"
 	"net"
+	"time"
 )
 
 // Client 是客户端接口
@@ -12,29 +13,119 @@ type Client interface {
 	Do(conn net.Conn) chan bool // Do 完成对服务端的请求, 结束后往返回的通道扔值
 }
 
-// DialAndRunClient 连接服务器，完成 client 的 Do
-func DialAndRunClient(serverAddress string, client Client) {
-	conn, err := net.Dial("tcp", serverAddress)
+// DialAndRunClient 连接服务器，完成 client 的 Do, 连不上返回错误
+// serverAddress 是 ws://HOST:PORT/PATH 或者 wss://... 的话, 通过 WebSocket 连接。
+func DialAndRunClient(serverAddress string, client Client) error {
+	conn, err := dial(serverAddress)
 	if err != nil {
-		panic(err)
+		emitFailed(Event{Peer: serverAddress}, ErrCodeConnect, err)
+		return err
 	}
 
-	<-client.Do(conn)
+	<-runClient(client, conn)
+	return nil
 }
 
 // DialAndRunClientTLS 作用和 DialAndRunClient 一样，不过使用更安全的 TLS 连接
-func DialAndRunClientTLS(serverAddress string, client Client) {
+func DialAndRunClientTLS(serverAddress string, client Client) error {
+	conn, err := DialTLS(serverAddress)
+	if err != nil {
+		emitFailed(Event{Peer: serverAddress}, ErrCodeConnect, err)
+		return err
+	}
+
+	<-runClient(client, conn)
+	return nil
+}
+
+// runClient 报告连上了, 然后在 conn 上做 client 的 Do
+func runClient(client Client, conn net.Conn) chan bool {
+	DefaultEvents.Emit(Event{Type: EventConnected, Peer: peerOf(conn)})
+	return client.Do(conn)
+}
+
+// DialTLS 以客户端的身份建立到服务器的 TLS 连接, 连不上返回错误而不是 panic
+func DialTLS(serverAddress string) (*tls.Conn, error) {
+	config, err := clientTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	if !IsWebSocketAddress(serverAddress) {
+		return tls.Dial("tcp", serverAddress, config)
+	}
+
+	conn, err := DialWebSocket(serverAddress)
+	if err != nil {
+		return nil, err
+	}
+	tlsConn := tls.Client(conn, config)
+	if err := tlsConn.Handshake(); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("websocket: TLS handshake failed: %v", err)
+	}
+	return tlsConn, nil
+}
+
+// dial 连接 TCP 地址 serverAddress, 或者 ws:// wss:// 开头的 WebSocket 地址
+func dial(serverAddress string) (net.Conn, error) {
+	if IsWebSocketAddress(serverAddress) {
+		return DialWebSocket(serverAddress)
+	}
+	return net.Dial("tcp", serverAddress)
+}
+
+// RetryDialAndRunClientTLS 和 DialAndRunClientTLS 一样, 不过连不上或者 client 的 Do 失败 (往通道扔 false) 时,
+// 等一会儿重新连接再来一次, 直到 Do 成功。
+// 等待的时间从 1 秒开始每次翻倍, 最多 maxBackoff; 一个连接用了超过 maxBackoff 才断的话重新从 1 秒开始。
+// 连续失败 maxAttempts 次就放弃, 报告并返回最后的错误; maxAttempts <= 0 表示一直重试。
+func RetryDialAndRunClientTLS(serverAddress string, client Client, maxBackoff time.Duration, maxAttempts int) error {
+	backoff, attempts := time.Second, 0
+	for {
+		start := time.Now()
+		conn, err := DialTLS(serverAddress)
+		code := ErrCodeConnect
+		if err == nil {
+			ok := <-runClient(client, conn)
+			_ = conn.Close()
+			if ok {
+				return nil
+			}
+			err, code = fmt.Errorf("connection lost"), ErrCodeNetwork
+		}
+
+		if time.Since(start) > maxBackoff {
+			backoff, attempts = time.Second, 0
+		}
+		if attempts++; maxAttempts > 0 && attempts >= maxAttempts {
+			err = fmt.Errorf("gave up after %d attempts: %v", attempts, err)
+			emitFailed(Event{Peer: serverAddress}, code, err)
+			return err
+		}
+		logWarn("connection failed, reconnect later", fAddr(serverAddress), fErr(err), Field{"backoff", backoff})
+		DefaultEvents.Emit(Event{Type: EventRetry, Peer: serverAddress, Code: code, Error: err.Error()})
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// clientTLSConfig 构造客户端的 TLS 配置: 使用 client 证书
+func clientTLSConfig() (*tls.Config, error) {
 	//pemCert, pemKey, _, err := GeneratePEM([]string{serverAddress, "www.random.com"})
 	//if err != nil {
 	//	panic(fmt.Errorf("failed to generate PEM: %#v", err))
 	//}
 	//pemCert, pemKey, rootPEM := GeneratePEMWithRoot()
 
-	pemCert, pemKey := GetCert(ClientCert)
+	pemCert, pemKey, err := GetCert(ClientCert)
+	if err != nil {
+		return nil, fmt.Errorf("client: read cert: %v", err)
+	}
 	cert, err := tls.X509KeyPair(pemCert, pemKey)
 	//cert, err := tls.LoadX509KeyPair("certs/client.pem", "certs/client.key")
 	if err != nil {
-		panic(fmt.Errorf("server: loadkeys: %s", err))
+		return nil, fmt.Errorf("client: loadkeys: %s", err)
 	}
 
 	//pemCert, err := ioutil.ReadFile("certs/client.pem")
@@ -44,20 +135,14 @@ func DialAndRunClientTLS(serverAddress string, client Client) {
 
 	clientCertPool := x509.NewCertPool()
 	if ok := clientCertPool.AppendCertsFromPEM(pemCert); !ok {
-		panic("failed to parse root certificate")
+		return nil, fmt.Errorf("failed to parse root certificate")
 	}
 
-	conf := tls.Config{
+	return &tls.Config{
 		InsecureSkipVerify: true,
 		RootCAs:            clientCertPool,
 		Certificates:       []tls.Certificate{cert},
-	}
-	conn, err := tls.Dial("tcp", serverAddress, &conf)
-	if err != nil {
-		panic(err)
-	}
-
-	<-client.Do(conn)
+	}, nil
 }
 
 // SendClient 是发送的客户端
@@ -70,13 +155,12 @@ func NewSendClient(s Sender) *SendClient {
 }
 
 func (s SendClient) Do(conn net.Conn) chan bool {
-	fmt.Println("SendClient: send to", conn.RemoteAddr().String())
+	logInfo("SendClient: send", fPeer(conn))
 
 	done := make(chan bool)
 
 	go func() {
-		s.Send(conn)
-		done <- true
+		done <- s.Send(conn) == nil
 	}()
 
 	return done
@@ -93,6 +177,6 @@ func NewReceiveClient() *ReceiveClient {
 }
 
 func (r ReceiveClient) Do(conn net.Conn) chan bool {
-	fmt.Println("ReceiveClient: connect", conn.RemoteAddr().String())
+	logInfo("ReceiveClient: connect", fPeer(conn))
 	return r.ReceiveAndHandle(conn)
 }
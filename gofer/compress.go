@@ -0,0 +1,223 @@
+package gofer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// 压缩！！
+// Packet Header 的 Flags (原来的保留字段) 标记压缩:
+//
+//  - 低 4 位: 这个 Packet 的 Data 用哪种 Compression 压缩了, 0 表示没压缩
+//  - 高 8 位: (请求中) 发请求的一方能解哪些 Compression, 第 8+c 位表示能解 c
+//
+// 大文件按传输协商: 接收端在每个 BigFileRequest 里标上它能解的, 发送端只在对方能解的时候
+// 用自己设置的 BigFileSender.Compression 压缩响应的块。老版本的接收端什么都不标, 就不压缩。
+// SimpleFile 发过去之前对方没有说话的机会, 没法协商, 所以不压缩。
+//
+// 压缩以后没有变小 (比如已经压缩过的文件) 的 Data 就原样发送。
+// PacketFromReader 读到压缩过的 Packet 会自动解压, 清掉压缩标记, 上层看到的和没压缩一样;
+// 解压出来的数据不能比应有的大: 大文件的块最多 DefaultBlockSize, 其他的最多 MaxDecompressedSize。
+// 线上实际的大小和压缩方式可以用 WireDataSize, WireCompression 查看, 用于统计。
+
+// Compression 是 Packet Data 的压缩方式
+type Compression uint16
+
+const (
+	CompressionNone Compression = 0
+	CompressionGzip Compression = 1
+	CompressionZstd Compression = 2
+)
+
+const (
+	packetFlagCompressionMask = 0x000f // Flags 低 4 位: Data 的压缩方式
+	packetFlagAcceptShift     = 8      // Flags 第 8+c 位: 能解压缩方式 c
+)
+
+// DefaultCompression 是 NewBigFileSender 和 NewShareServer 新建的发送者用的压缩方式
+var DefaultCompression = CompressionNone
+
+// SupportedCompressions 是本版本能解的压缩方式
+var SupportedCompressions = []Compression{CompressionGzip, CompressionZstd}
+
+// MaxDecompressedSize 是大文件的块以外的 Packet 解压后 Data 的最大长度, 超过了当作出错
+var MaxDecompressedSize uint64 = 64 * 1024 * 1024
+
+// ParseCompression 解析压缩方式的名字: none, gzip 或 zstd
+func ParseCompression(name string) (Compression, error) {
+	switch strings.ToLower(name) {
+	case "", "none":
+		return CompressionNone, nil
+	case "gzip":
+		return CompressionGzip, nil
+	case "zstd":
+		return CompressionZstd, nil
+	}
+	return CompressionNone, fmt.Errorf("unknown compression %q: want none, gzip or zstd", name)
+}
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	}
+	return fmt.Sprintf("compression(%d)", uint16(c))
+}
+
+// wireStat 记录一个 Packet 在线上的样子
+type wireStat struct {
+	compression Compression
+	dataSize    uint32
+	read        bool // 是从 reader 读到的
+}
+
+// SetAcceptCompression 在 Flags 里标上发送这个 Packet 的一方能解 cs 这些压缩方式
+func (p *Packet) SetAcceptCompression(cs ...Compression) {
+	for _, c := range cs {
+		if c != CompressionNone {
+			p.Flags |= 1 << (packetFlagAcceptShift + uint(c))
+		}
+	}
+}
+
+// AcceptsCompression 检查发送这个 Packet 的一方能不能解 c
+func (p *Packet) AcceptsCompression(c Compression) bool {
+	return c == CompressionNone || p.Flags&(1<<(packetFlagAcceptShift+uint(c))) != 0
+}
+
+// Compressed 返回 Data 用 c 压缩过的 Packet (p 本身不变)。
+// c 为 CompressionNone, 或者压缩以后没有变小的话, 返回 p 本身。
+func (p *Packet) Compressed(c Compression) *Packet {
+	if c == CompressionNone || len(p.Data) == 0 {
+		return p
+	}
+	data, err := compressData(c, p.Data)
+	if err != nil || len(data) >= len(p.Data) {
+		return p
+	}
+	compressed := NewPacket(p.Type, p.Info, data)
+	compressed.Flags = p.Flags&^packetFlagCompressionMask | uint16(c)
+	return compressed
+}
+
+// WireCompression 返回从 reader 读到这个 Packet 时, 它的 Data 在线上用的压缩方式
+func (p *Packet) WireCompression() Compression {
+	return p.wire.compression
+}
+
+// WireDataSize 返回从 reader 读到这个 Packet 时, 它的 Data 在线上的大小 (压缩后的); 不是读到的就是 DataSize
+func (p *Packet) WireDataSize() uint32 {
+	if !p.wire.read {
+		return p.DataSize
+	}
+	return p.wire.dataSize
+}
+
+// decompress 解压刚读到的 Packet 的 Data, 清掉压缩标记
+func (p *Packet) decompress() error {
+	c := Compression(p.Flags & packetFlagCompressionMask)
+	p.wire = wireStat{compression: c, dataSize: p.DataSize, read: true}
+	if c == CompressionNone {
+		return nil
+	}
+
+	max := MaxDecompressedSize
+	if p.Type == PacketTypeBigFileResponse {
+		max = DefaultBlockSize
+	}
+	data, err := decompressData(c, p.Data, max)
+	if err != nil {
+		return fmt.Errorf("decompress %v packet: %v", c, err)
+	}
+	p.Data = data
+	p.DataSize = uint32(len(data))
+	p.Flags &^= packetFlagCompressionMask
+	return nil
+}
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdErr     error
+)
+
+// zstdWindowSize 是 zstd 编码器默认的窗口大小
+const zstdWindowSize = 8 << 20
+
+// zstdCodec 返回共用的 zstd 编码器 (EncodeAll 可以并发调用)
+func zstdCodec() (*zstd.Encoder, error) {
+	zstdOnce.Do(func() {
+		zstdEncoder, zstdErr = zstd.NewWriter(nil)
+	})
+	return zstdEncoder, zstdErr
+}
+
+func compressData(c Compression, data []byte) ([]byte, error) {
+	switch c {
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		encoder, err := zstdCodec()
+		if err != nil {
+			return nil, err
+		}
+		return encoder.EncodeAll(data, nil), nil
+	}
+	return nil, fmt.Errorf("unknown compression %v", c)
+}
+
+// decompressData 解压 data, 解压出来超过 max 字节就出错 (不会多读)
+func decompressData(c Compression, data []byte, max uint64) ([]byte, error) {
+	var r io.Reader
+	switch c {
+	case CompressionGzip:
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
+	case CompressionZstd:
+		window := max + 1 // 窗口大小是向上取整的, 至少给编码器默认的窗口大小
+		if window < zstdWindowSize {
+			window = zstdWindowSize
+		}
+		zr, err := zstd.NewReader(bytes.NewReader(data),
+			zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(window))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	default:
+		return nil, fmt.Errorf("unknown compression %v", c)
+	}
+
+	out, err := ioutil.ReadAll(io.LimitReader(r, int64(max)+1))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(out)) > max {
+		return nil, fmt.Errorf("decompressed data larger than %d bytes", max)
+	}
+	return out, nil
+}
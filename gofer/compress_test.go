@@ -0,0 +1,74 @@
+package gofer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func TestPacketCompressed(t *testing.T) {
+	data := bytes.Repeat([]byte("0,2026-10-18,GET /api/v1/items,200\n"), 1000)
+	for _, c := range SupportedCompressions {
+		p := NewPacket(PacketTypeSimpleFile, []byte("log.csv"), data)
+		compressed := p.Compressed(c)
+		if compressed == p || compressed.DataSize >= p.DataSize {
+			t.Fatalf("%v: data not compressed", c)
+		}
+
+		got, err := PacketFromReader(bytes.NewReader(compressed.ToBytes()))
+		if err != nil {
+			t.Fatalf("%v: %v", c, err)
+		}
+		if !bytes.Equal(got.Data, data) || string(got.Info) != "log.csv" || got.Flags != 0 {
+			t.Errorf("%v: decompressed packet differs: %v", c, got.Header)
+		}
+		if got.WireCompression() != c || got.WireDataSize() != compressed.DataSize {
+			t.Errorf("%v: wire = %v %d, want %v %d", c,
+				got.WireCompression(), got.WireDataSize(), c, compressed.DataSize)
+		}
+	}
+
+	random := make([]byte, 4096)
+	_, _ = rand.Read(random)
+	p := NewPacket(PacketTypeSimpleFile, nil, random)
+	if p.Compressed(CompressionZstd) != p { // 不会变小, 原样发送
+		t.Error("incompressible data should be sent as is")
+	}
+}
+
+func TestAcceptCompression(t *testing.T) {
+	req := NewBigFileRequest([]byte("id"), 0, 1024)
+	if req.AcceptsCompression(CompressionZstd) {
+		t.Error("request without flags should not accept zstd")
+	}
+	req.SetAcceptCompression(CompressionZstd)
+	got, err := PacketFromReader(bytes.NewReader(req.ToBytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !got.AcceptsCompression(CompressionZstd) || got.AcceptsCompression(CompressionGzip) {
+		t.Errorf("accepts zstd = %v, gzip = %v, want true, false",
+			got.AcceptsCompression(CompressionZstd), got.AcceptsCompression(CompressionGzip))
+	}
+	if !got.AcceptsCompression(CompressionNone) {
+		t.Error("every packet accepts no compression")
+	}
+}
+
+func TestDecompressBounded(t *testing.T) {
+	old := DefaultBlockSize
+	DefaultBlockSize = 1024
+	defer func() { DefaultBlockSize = old }()
+
+	for _, c := range SupportedCompressions {
+		block := NewBigFileResponse([]byte("id"), 0, make([]byte, 1024)).Compressed(c)
+		if _, err := PacketFromReader(bytes.NewReader(block.ToBytes())); err != nil {
+			t.Errorf("%v: a full block should decompress: %v", c, err)
+		}
+
+		bomb := NewBigFileResponse([]byte("id"), 0, make([]byte, 1025)).Compressed(c) // 比一块大
+		if _, err := PacketFromReader(bytes.NewReader(bomb.ToBytes())); err == nil {
+			t.Errorf("%v: a block larger than DefaultBlockSize should fail", c)
+		}
+	}
+}
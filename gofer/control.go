@@ -0,0 +1,420 @@
+package gofer
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 控制接口！！
+// 常驻的 gofer (gofer recv -s, gofer send -bigfile -s, gofer serve, gofer outbox run) 可以在一个 Unix socket 上
+// 提供控制接口 (JSON over HTTP), 让别的程序 (例如 gofer ctl) 查看和控制它:
+//
+//  - GET  /transfers: 正在进行的传输 (Progress), 以及各个 BigFileSender 提供的文件
+//  - POST /transfers/{fileID}/cancel: 取消收发这个大文件 (BigFileReceiver.Cancel, BigFileSender.Cancel)
+//  - POST /transfers/{fileID}/pause, /resume: 暂停、继续收发这个大文件, 连接保持, 不用重新握手
+//  - GET  /rate, PUT /rate: 查看、修改限速 (全局, 每个对方, 时间表, 每个文件)
+//  - POST /send: 让 BigFileSender 再提供一个文件, 或者 (有 to 的话) 放进发件箱
+//
+// 出错时回 {"code": 错误码, "error": 原因}, 错误码和 ErrorPacket 的一样。
+// socket 只有自己能读写 (0600), 不另外做认证。
+
+// ControlServer 是本地控制接口, 控制的对象都是可选的
+type ControlServer struct {
+	Receivers []*BigFileReceiver // 可以取消、暂停正在接收的大文件
+	Senders   []*BigFileSender   // 可以取消、暂停正在发送的大文件, 或者再提供一个文件
+	Outbox    *Outbox            // POST /send 有 to 时放进这里
+	Bandwidth *Bandwidth         // nil 表示 DefaultBandwidth
+	Progress  *Progress          // nil 表示 DefaultProgress
+}
+
+// ControlTransfer 是 GET /transfers 里的一个正在进行的传输
+type ControlTransfer struct {
+	FileProgress
+	FileID      string `json:"file_id,omitempty"`      // 大文件的 FileIDString
+	Blocks      uint64 `json:"blocks,omitempty"`       // 正在接收的大文件一共几块
+	SavedBlocks uint64 `json:"saved_blocks,omitempty"` // 正在接收的大文件已经保存了几块
+	Paused      bool   `json:"paused,omitempty"`       // 暂停了
+}
+
+// ControlFile 是 BigFileSender 提供的一个文件
+type ControlFile struct {
+	FileID   string `json:"file_id"`
+	Name     string `json:"name"`
+	Size     uint64 `json:"size"`
+	Canceled bool   `json:"canceled,omitempty"`
+	Paused   bool   `json:"paused,omitempty"`
+}
+
+// ControlTransfers 是 GET /transfers 的结果
+type ControlTransfers struct {
+	Transfers []ControlTransfer `json:"transfers"`
+	Offered   []ControlFile     `json:"offered"`
+}
+
+// ControlRate 是 GET /rate 的结果, 也是 PUT /rate 的请求: 请求里为 nil 的不修改
+type ControlRate struct {
+	Rate     *int64  `json:"rate,omitempty"`      // 全局速率
+	Schedule *string `json:"schedule,omitempty"`  // 全局速率的时间表, 格式见 ParseRateSchedule, "" 表示去掉
+	Peer     string  `json:"peer,omitempty"`      // PeerRate 是哪个对方的, "" 表示没有单独设置的
+	PeerRate *int64  `json:"peer_rate,omitempty"` // 对方的速率
+	FileID   string  `json:"file_id,omitempty"`   // FileRate 是哪个文件的
+	FileRate *int64  `json:"file_rate,omitempty"` // 发送这个文件的速率
+}
+
+// ControlSend 是 POST /send 的请求
+type ControlSend struct {
+	Path    string `json:"path,omitempty"`    // 要发的文件
+	To      string `json:"to,omitempty"`      // 不为空时放进发件箱, 发给 to
+	Info    string `json:"info,omitempty"`    // 有 To 时可以发消息
+	Message string `json:"message,omitempty"` // 有 To 时可以发消息
+}
+
+// ControlSent 是 POST /send 的结果
+type ControlSent struct {
+	FileID string      `json:"file_id,omitempty"` // 由 BigFileSender 提供
+	Queued *OutboxItem `json:"queued,omitempty"`  // 放进了发件箱
+}
+
+// controlError 是出错时的回复
+type controlError struct {
+	Code  string `json:"code"`
+	Error string `json:"error"`
+}
+
+// DefaultControlSocket 返回默认的控制接口 socket: ~/.gofer/control.sock
+func DefaultControlSocket() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".gofer", "control.sock")
+	}
+	return filepath.Join(home, ".gofer", "control.sock")
+}
+
+// ListenAndServe 在 Unix socket socketPath 上提供控制接口 (后台运行), 关闭返回的 listener 就停止。
+// 留下的旧 socket 会被删掉; 已经有别的进程在上面提供的话返回错误。
+func (c *ControlServer) ListenAndServe(socketPath string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0700); err != nil {
+		return nil, err
+	}
+	if conn, err := net.Dial("unix", socketPath); err == nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("%s: another gofer is serving the control API", socketPath)
+	}
+	_ = os.Remove(socketPath)
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(socketPath, 0600); err != nil {
+		_ = listener.Close()
+		return nil, err
+	}
+	go func() {
+		_ = http.Serve(listener, c.Handler())
+	}()
+	logInfo("Serving control API", Field{"socket", socketPath})
+	return listener, nil
+}
+
+// Handler 返回控制接口的 http.Handler
+func (c *ControlServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /transfers", func(w http.ResponseWriter, r *http.Request) {
+		writeControl(w, http.StatusOK, c.transfers())
+	})
+	mux.HandleFunc("POST /transfers/{fileID}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		fileID := r.PathValue("fileID")
+		if !c.cancel(fileID) {
+			writeControlError(w, http.StatusNotFound, ErrCodeNotFound, fileID+": no such transfer")
+			return
+		}
+		writeControl(w, http.StatusOK, map[string]string{"canceled": fileID})
+	})
+	mux.HandleFunc("POST /transfers/{fileID}/pause", func(w http.ResponseWriter, r *http.Request) {
+		fileID := r.PathValue("fileID")
+		if !c.pause(fileID, true) {
+			writeControlError(w, http.StatusNotFound, ErrCodeNotFound, fileID+": no such transfer")
+			return
+		}
+		writeControl(w, http.StatusOK, map[string]string{"paused": fileID})
+	})
+	mux.HandleFunc("POST /transfers/{fileID}/resume", func(w http.ResponseWriter, r *http.Request) {
+		fileID := r.PathValue("fileID")
+		if !c.pause(fileID, false) {
+			writeControlError(w, http.StatusNotFound, ErrCodeNotFound, fileID+": no such transfer")
+			return
+		}
+		writeControl(w, http.StatusOK, map[string]string{"resumed": fileID})
+	})
+	mux.HandleFunc("GET /rate", func(w http.ResponseWriter, r *http.Request) {
+		writeControl(w, http.StatusOK, c.rate(r.URL.Query().Get("peer")))
+	})
+	mux.HandleFunc("PUT /rate", func(w http.ResponseWriter, r *http.Request) {
+		var req ControlRate
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeControlError(w, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+			return
+		}
+		if err := c.setRate(req); err != nil {
+			writeControlError(w, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+			return
+		}
+		writeControl(w, http.StatusOK, c.rate(req.Peer))
+	})
+	mux.HandleFunc("POST /send", func(w http.ResponseWriter, r *http.Request) {
+		var req ControlSend
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeControlError(w, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+			return
+		}
+		sent, err := c.send(req)
+		if e, ok := err.(*ErrorPacket); ok {
+			writeControlError(w, http.StatusBadRequest, e.Code(), e.Message())
+			return
+		} else if err != nil {
+			writeControlError(w, http.StatusInternalServerError, ErrCodeInternal, err.Error())
+			return
+		}
+		writeControl(w, http.StatusOK, sent)
+	})
+	return mux
+}
+
+func writeControl(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeControlError(w http.ResponseWriter, status int, code string, message string) {
+	writeControl(w, status, controlError{Code: code, Error: message})
+}
+
+// workers 返回所有 Receivers 正在接收的大文件 {fileIDString: worker}
+func (c *ControlServer) workers() map[string]*BigFileReceiverWorker {
+	workers := map[string]*BigFileReceiverWorker{}
+	for _, r := range c.Receivers {
+		r.workerMap.Range(func(key, value interface{}) bool {
+			workers[key.(string)] = value.(*BigFileReceiverWorker)
+			return true
+		})
+	}
+	return workers
+}
+
+// offered 返回所有 Senders 提供的文件 {fileIDString: ControlFile}
+func (c *ControlServer) offered() map[string]ControlFile {
+	files := map[string]ControlFile{}
+	for _, s := range c.Senders {
+		s.headerMap.Range(func(key, value interface{}) bool {
+			header := value.(BigFileHeader)
+			files[key.(string)] = ControlFile{
+				FileID:   key.(string),
+				Name:     header.FileName(),
+				Size:     header.FileSize(),
+				Canceled: s.isCanceled(key.(string)),
+				Paused:   s.isPaused(key.(string)),
+			}
+			return true
+		})
+	}
+	return files
+}
+
+// transfers 返回正在进行的传输: 大文件的进度 ID 是 "fileID" (接收) 或者 "fileID peer" (发送)
+func (c *ControlServer) transfers() ControlTransfers {
+	workers, offered := c.workers(), c.offered()
+
+	result := ControlTransfers{Transfers: []ControlTransfer{}, Offered: []ControlFile{}}
+	for _, f := range progressOf(c.Progress).Files() {
+		if f.Finished {
+			continue
+		}
+		t := ControlTransfer{FileProgress: f}
+		fileID := strings.SplitN(f.ID, " ", 2)[0]
+		if w, ok := workers[fileID]; ok && f.Direction == ProgressRecv {
+			t.FileID = fileID
+			t.Blocks, t.SavedBlocks = w.blockCounts()
+			t.Paused = w.isPaused()
+		}
+		if o, ok := offered[fileID]; ok && f.Direction == ProgressSend {
+			t.FileID = fileID
+			t.Paused = o.Paused
+		}
+		result.Transfers = append(result.Transfers, t)
+	}
+	for _, f := range offered {
+		result.Offered = append(result.Offered, f)
+	}
+	sort.Slice(result.Offered, func(i, j int) bool { return result.Offered[i].Name < result.Offered[j].Name })
+	return result
+}
+
+// cancel 取消收发大文件 fileID, 没有这个文件返回 false
+func (c *ControlServer) cancel(fileID string) bool {
+	found := false
+	for _, r := range c.Receivers {
+		found = r.Cancel(fileID) || found
+	}
+	for _, s := range c.Senders {
+		found = s.Cancel(fileID) || found
+	}
+	return found
+}
+
+// pause 暂停 (pause 为 true) 或者继续收发大文件 fileID, 没有这个文件返回 false
+func (c *ControlServer) pause(fileID string, pause bool) bool {
+	found := false
+	for _, r := range c.Receivers {
+		if pause {
+			found = r.Pause(fileID) || found
+		} else {
+			found = r.Resume(fileID) || found
+		}
+	}
+	for _, s := range c.Senders {
+		if pause {
+			found = s.Pause(fileID) || found
+		} else {
+			found = s.Resume(fileID) || found
+		}
+	}
+	return found
+}
+
+func (c *ControlServer) bandwidth() *Bandwidth {
+	if c.Bandwidth == nil {
+		return DefaultBandwidth
+	}
+	return c.Bandwidth
+}
+
+// rate 返回现在的全局速率和对方 peer 的速率
+func (c *ControlServer) rate(peer string) ControlRate {
+	b := c.bandwidth()
+	rate, peerRate := b.Rate(), b.PeerRate(peer)
+	return ControlRate{Rate: &rate, Peer: peer, PeerRate: &peerRate}
+}
+
+// setRate 修改 req 里不为 nil 的速率
+func (c *ControlServer) setRate(req ControlRate) error {
+	b := c.bandwidth()
+	if req.Schedule != nil {
+		schedule, err := ParseRateSchedule(*req.Schedule)
+		if err != nil {
+			return err
+		}
+		b.SetSchedule(schedule)
+	}
+	if req.Rate != nil {
+		b.SetRate(*req.Rate)
+	}
+	if req.PeerRate != nil {
+		b.SetPeerRate(req.Peer, *req.PeerRate)
+	}
+	if req.FileRate != nil {
+		fileID, err := hex.DecodeString(req.FileID)
+		if err != nil || req.FileID == "" {
+			return fmt.Errorf("bad file_id %q", req.FileID)
+		}
+		if _, ok := c.offered()[req.FileID]; !ok {
+			return fmt.Errorf("%s: no such file", req.FileID)
+		}
+		for _, s := range c.Senders {
+			s.SetFileRate(fileID, *req.FileRate)
+		}
+	}
+	return nil
+}
+
+// send 让 Senders 再提供一个文件, 或者放进发件箱
+func (c *ControlServer) send(req ControlSend) (*ControlSent, error) {
+	if req.To != "" {
+		if c.Outbox == nil {
+			return nil, NewErrorPacket(ErrCodeBadRequest, "no outbox in this gofer")
+		}
+		var item *OutboxItem
+		var err error
+		if req.Message != "" {
+			item, err = c.Outbox.EnqueueMessage(req.To, req.Info, req.Message)
+		} else {
+			item, err = c.Outbox.EnqueueFile(req.To, req.Path)
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &ControlSent{Queued: item}, nil
+	}
+
+	if len(c.Senders) == 0 {
+		return nil, NewErrorPacket(ErrCodeBadRequest, "no big file sender in this gofer, send with a \"to\" to queue it")
+	}
+	if req.Path == "" {
+		return nil, NewErrorPacket(ErrCodeBadRequest, "nothing to send")
+	}
+	sent := &ControlSent{}
+	for _, s := range c.Senders {
+		fileID, err := s.AppendFile(req.Path)
+		if err != nil {
+			return nil, NewErrorPacket(ErrCodeNotFound, err.Error())
+		}
+		sent.FileID = FileIDString(fileID)
+	}
+	return sent, nil
+}
+
+// ControlClient 调用 Unix socket 上的控制接口
+type ControlClient struct {
+	client *http.Client
+}
+
+func NewControlClient(socketPath string) *ControlClient {
+	return &ControlClient{client: &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		},
+	}}}
+}
+
+// Do 发一个请求: body 不为 nil 时编码成 JSON 发送, 回复解码到 result (可以为 nil)。
+// 控制接口回的错误以 *ErrorPacket 返回, 可以用 ErrorCode 取错误码。
+func (c *ControlClient) Do(method, path string, body interface{}, result interface{}) error {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, "http://gofer"+path, &buf)
+	if err != nil {
+		return err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var e controlError
+		if err := json.NewDecoder(resp.Body).Decode(&e); err != nil {
+			return fmt.Errorf("control API: %s", resp.Status)
+		}
+		return NewErrorPacket(e.Code, e.Error)
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
@@ -0,0 +1,70 @@
+package gofer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestControlServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofer-control")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "a.bin")
+	if err := ioutil.WriteFile(file, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sender := NewBigFileSender()
+	server := &ControlServer{Senders: []*BigFileSender{sender}, Bandwidth: NewBandwidth(), Progress: NewProgress()}
+	listener, err := server.ListenAndServe(filepath.Join(dir, "control.sock"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	client := NewControlClient(filepath.Join(dir, "control.sock"))
+
+	var sent ControlSent
+	if err := client.Do("POST", "/send", ControlSend{Path: file}, &sent); err != nil || sent.FileID == "" {
+		t.Fatalf("send: %+v, %v", sent, err)
+	}
+	if err := client.Do("POST", "/send", ControlSend{}, nil); ErrorCode(err) != ErrCodeBadRequest {
+		t.Errorf("send nothing: got %v, want %s", err, ErrCodeBadRequest)
+	}
+
+	if err := client.Do("POST", "/transfers/"+sent.FileID+"/pause", nil, nil); err != nil || !sender.isPaused(sent.FileID) {
+		t.Fatalf("pause: %v, paused %v", err, sender.isPaused(sent.FileID))
+	}
+	if err := client.Do("POST", "/transfers/"+sent.FileID+"/resume", nil, nil); err != nil || sender.isPaused(sent.FileID) {
+		t.Fatalf("resume: %v, paused %v", err, sender.isPaused(sent.FileID))
+	}
+	if err := client.Do("POST", "/transfers/nope/pause", nil, nil); ErrorCode(err) != ErrCodeNotFound {
+		t.Errorf("pause unknown: got %v, want %s", err, ErrCodeNotFound)
+	}
+
+	if err := client.Do("POST", "/transfers/"+sent.FileID+"/cancel", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Do("POST", "/transfers/nope/cancel", nil, nil); ErrorCode(err) != ErrCodeNotFound {
+		t.Errorf("cancel unknown: got %v, want %s", err, ErrCodeNotFound)
+	}
+	var transfers ControlTransfers
+	if err := client.Do("GET", "/transfers", nil, &transfers); err != nil {
+		t.Fatal(err)
+	}
+	if len(transfers.Offered) != 1 || transfers.Offered[0].Name != "a.bin" || !transfers.Offered[0].Canceled {
+		t.Errorf("offered: %+v, want a.bin canceled", transfers.Offered)
+	}
+
+	rate := int64(1000)
+	var got ControlRate
+	if err := client.Do("PUT", "/rate", ControlRate{Rate: &rate}, &got); err != nil {
+		t.Fatal(err)
+	}
+	if *got.Rate != 1000 || server.Bandwidth.Rate() != 1000 {
+		t.Errorf("rate: got %d, bandwidth %d, want 1000", *got.Rate, server.Bandwidth.Rate())
+	}
+}
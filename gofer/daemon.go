@@ -0,0 +1,472 @@
+package gofer
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// 常驻服务！！
+// 之前每个 gofer 进程只能扮演一个固定的角色: 要么发 (send -s), 要么收 (recv -s)。
+// Daemon 一个进程同时做好几件事:
+//
+//  - 导出 (export) 若干目录, 回答 GetRequest 和 ListRequest (和 FileServer 一样)
+//  - 提供收件箱 (inbox), 接收客户端推送过来的 Message、SimpleFile 和 BigFile
+//  - 回答 ManifestRequest 和 SyncOp, 让客户端把目录同步到收件箱里 (见 sync.go)
+//
+// 所有 Packet 都由同一个 Distributer 分发, 而每个客户端能做什么、推送的东西放到哪个收件箱,
+// 由 DaemonConfig 里的 Clients 规则决定。
+
+// 客户端的权限
+const (
+	PermissionGet  = "get"  // 下载导出的文件
+	PermissionList = "list" // 浏览导出的目录
+	PermissionPush = "push" // 推送消息、文件到收件箱
+	PermissionSync = "sync" // 读取收件箱的文件清单, 删除收件箱里的文件、修改其时间 (gofer sync)
+)
+
+// ErrCodeForbidden 是没有权限时回复的错误码
+const ErrCodeForbidden = "forbidden"
+
+// DaemonConfig 是 Daemon 的配置, 一般从 JSON 文件读取 (见 LoadDaemonConfig):
+//
+//  {
+//    "exports": {"": "/srv/pub", "docs": "/srv/docs"},
+//    "inboxes": {"": "/srv/inbox", "alice": "/srv/alice"},
+//    "clients": [
+//      {"match": "10.0.0.8", "permissions": ["get", "list", "push", "sync"], "inbox": "alice"},
+//      {"match": "10.0.0.0/8", "permissions": ["get", "list"]},
+//      {"match": "*", "permissions": ["push"]}
+//    ]
+//  }
+type DaemonConfig struct {
+	// Exports: {name: dir}, 导出的目录。
+	// 客户端用 "name/path/in/dir" 访问; name 为 "" 的导出目录直接用 "path/in/dir" 访问。
+	Exports map[string]string `json:"exports"`
+	// Inboxes: {name: dir}, 收件箱。客户端推送的东西放到哪个收件箱由 ClientRule.Inbox 决定。
+	Inboxes map[string]string `json:"inboxes"`
+	// Clients: 客户端规则, 按顺序匹配, 第一个匹配的生效。
+	// 为空时所有客户端只能 get 和 list (见 defaultPermissions), 要推送、同步必须显式地配置规则;
+	// 不为空时没有匹配的客户端会被拒绝。
+	Clients []ClientRule `json:"clients"`
+}
+
+// ClientRule 描述一类客户端的权限
+type ClientRule struct {
+	// Match: "*", IP, CIDR, 或 TLS 客户端证书的 CommonName
+	Match string `json:"match"`
+	// Permissions: PermissionGet, PermissionList, PermissionPush, PermissionSync 中的若干个
+	Permissions []string `json:"permissions"`
+	// Inbox: 推送的东西放到哪个收件箱, 默认为 ""
+	Inbox string `json:"inbox"`
+}
+
+// LoadDaemonConfig 从 JSON 文件读取 DaemonConfig
+func LoadDaemonConfig(filename string) (*DaemonConfig, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	config := &DaemonConfig{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("bad config %s: %v", filename, err)
+	}
+	return config, nil
+}
+
+// matches 检查规则是否适用于 IP 为 ip、证书 CommonName 为 commonName 的客户端
+func (c ClientRule) matches(ip net.IP, commonName string) bool {
+	switch {
+	case c.Match == "*":
+		return true
+	case strings.Contains(c.Match, "/"):
+		_, network, err := net.ParseCIDR(c.Match)
+		return err == nil && ip != nil && network.Contains(ip)
+	case net.ParseIP(c.Match) != nil:
+		return ip != nil && net.ParseIP(c.Match).Equal(ip)
+	default:
+		return commonName != "" && c.Match == commonName
+	}
+}
+
+// allows 检查规则是否包含权限 permission
+func (c ClientRule) allows(permission string) bool {
+	for _, p := range c.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// defaultPermissions 是没有配置 Clients 时, 所有客户端使用的规则: 只读。
+// 客户端证书是打包在程序里的, 谁都有, 不能因为连得上就让人往收件箱里写、删东西。
+var defaultPermissions = ClientRule{
+	Match:       "*",
+	Permissions: []string{PermissionGet, PermissionList},
+}
+
+// Daemon 是常驻服务, 实现 Server 接口
+type Daemon struct {
+	Config      *DaemonConfig
+	Distributer *Distributer // 处理所有连接上的所有 Packet
+
+	exports  map[string]*FileServer // {name: FileServer}
+	inboxes  map[string]*inbox      // {name: inbox}
+	sessions sync.Map               // {net.Conn: *daemonSession}
+}
+
+// inbox 是一个收件箱, 里面是把东西收到收件箱目录的各种 PacketReceiver
+type inbox struct {
+	dir   string
+	files *FileServer // 双向同步时把收件箱里的文件发给客户端
+
+	message    *MessageReceiver
+	simpleFile *SimpleFileReceiver
+	bigFile    *BigFileReceiver
+}
+
+// daemonSession 是一个客户端连接的状态
+type daemonSession struct {
+	peer string     // 客户端的描述, 用于日志
+	rule ClientRule // 匹配到的规则
+}
+
+func NewDaemon(config *DaemonConfig) (*Daemon, error) {
+	d := &Daemon{
+		Config:      config,
+		Distributer: &Distributer{},
+		exports:     map[string]*FileServer{},
+		inboxes:     map[string]*inbox{},
+	}
+
+	for name, dir := range config.Exports {
+		if strings.Contains(name, "/") {
+			return nil, fmt.Errorf("bad export name %q: must not contain '/'", name)
+		}
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("bad export %q: %s is not a directory", name, dir)
+		}
+		d.exports[name] = NewFileServer(dir)
+	}
+	for name, dir := range config.Inboxes {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("bad inbox %q: %v", name, err)
+		}
+		d.inboxes[name] = &inbox{
+			dir:        dir,
+			files:      NewFileServer(dir),
+			message:    NewMessageReceiverIn(dir),
+			simpleFile: NewSimpleFileReceiverIn(dir),
+			bigFile:    NewBigFileReceiverIn(dir, d.Distributer),
+		}
+	}
+
+	d.Distributer.Register(PacketTypeGetRequest, d.handle(PermissionGet, d.receiveGet))
+	d.Distributer.Register(PacketTypeListRequest, d.handle(PermissionList, d.receiveList))
+	d.Distributer.Register(PacketTypeMessage, d.handle(PermissionPush, d.receiveIntoInbox))
+	d.Distributer.Register(PacketTypeSimpleFile, d.handle(PermissionPush, d.receiveIntoInbox))
+	d.Distributer.Register(PacketTypeBigFileHeader, d.handle(PermissionPush, d.receiveIntoInbox))
+	d.Distributer.Register(PacketTypeBigFileResponse, d.handle(PermissionPush, d.receiveIntoInbox))
+	d.Distributer.Register(PacketTypeManifestRequest, d.handle(PermissionSync, d.receiveManifest))
+	d.Distributer.Register(PacketTypeSyncOp, d.handle(PermissionSync, d.receiveSyncOp))
+
+	return d, nil
+}
+
+// BigFileReceivers 返回所有收件箱接收大文件的 BigFileReceiver, 例如给 ControlServer 用
+func (d *Daemon) BigFileReceivers() []*BigFileReceiver {
+	receivers := make([]*BigFileReceiver, 0, len(d.inboxes))
+	for _, inbox := range d.inboxes {
+		receivers = append(receivers, inbox.bigFile)
+	}
+	return receivers
+}
+
+// ServeConn 识别客户端, 然后不断接收 Packet, 交给 d.Distributer 处理, 直到连接断开
+func (d *Daemon) ServeConn(conn net.Conn) {
+	defer conn.Close()
+
+	session, err := d.newSession(conn)
+	if err != nil {
+		logWarn("Daemon: reject", fPeer(conn), fErr(err))
+		metricConnectionsRejected.Inc(ErrCodeForbidden)
+		emitFailed(Event{Peer: peerOf(conn)}, ErrCodeForbidden, err)
+		_, _ = NewErrorPacket(ErrCodeForbidden, err.Error()).WriteTo(conn)
+		return
+	}
+	d.sessions.Store(conn, session)
+	defer d.sessions.Delete(conn)
+
+	logInfo("Daemon: connect", fPeer(conn), Field{"client", session.peer})
+	DefaultEvents.Emit(Event{Type: EventConnected, Peer: peerOf(conn)})
+	(&Receiver{Distributer: d.Distributer}).ReceiveAndHandleAll(conn)
+}
+
+// newSession 识别客户端, 找到适用的规则
+func (d *Daemon) newSession(conn net.Conn) (*daemonSession, error) {
+	ip, commonName := PeerIdentity(conn)
+	session := &daemonSession{peer: conn.RemoteAddr().String()}
+	if commonName != "" {
+		session.peer = fmt.Sprintf("%s (%s)", session.peer, commonName)
+	}
+
+	rule, err := d.ruleFor(ip, commonName)
+	if err != nil {
+		return nil, err
+	}
+	session.rule = rule
+	return session, nil
+}
+
+// ruleFor 找到适用于 IP 为 ip、证书 CommonName 为 commonName 的客户端的规则
+func (d *Daemon) ruleFor(ip net.IP, commonName string) (ClientRule, error) {
+	if len(d.Config.Clients) == 0 {
+		return defaultPermissions, nil
+	}
+	for _, rule := range d.Config.Clients {
+		if rule.matches(ip, commonName) {
+			return rule, nil
+		}
+	}
+	return ClientRule{}, fmt.Errorf("no matching client rule")
+}
+
+// PeerIdentity 返回连接对方的 IP, 以及 TLS 客户端证书的 CommonName (不是 TLS 连接则为 "")
+func PeerIdentity(conn net.Conn) (ip net.IP, commonName string) {
+	if addr, ok := conn.RemoteAddr().(*net.TCPAddr); ok {
+		ip = addr.IP
+	}
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := tlsConn.Handshake(); err == nil {
+			if certs := tlsConn.ConnectionState().PeerCertificates; len(certs) > 0 {
+				commonName = certs[0].Subject.CommonName
+			}
+		}
+	}
+	return ip, commonName
+}
+
+// handle 包装 receive: 先检查连接对应的客户端有没有 permission 权限
+func (d *Daemon) handle(permission string,
+	receive func(session *daemonSession, packet *Packet, conn net.Conn) chan bool) PacketReceiver {
+	return PacketReceiverFunc(func(packet *Packet, conn net.Conn) chan bool {
+		done := make(chan bool, 1)
+
+		value, ok := d.sessions.Load(conn)
+		if !ok {
+			logWarn("Daemon: packet from an unknown connection", fPeer(conn))
+			done <- false
+			return done
+		}
+		session := value.(*daemonSession)
+
+		if !session.rule.allows(permission) {
+			logWarn("Daemon: permission denied", Field{"client", session.peer}, Field{"permission", permission})
+			_, _ = NewErrorPacket(ErrCodeForbidden, "permission denied: "+permission).WriteTo(conn)
+			done <- false
+			return done
+		}
+		return receive(session, packet, conn)
+	})
+}
+
+// receiveGet 处理 GetRequest: 找到对应的导出目录, 发送文件
+func (d *Daemon) receiveGet(session *daemonSession, packet *Packet, conn net.Conn) chan bool {
+	done := make(chan bool, 1)
+
+	req := PacketAsGetRequest(packet)
+	export, rel, ok := d.export(req.Path())
+	if !ok {
+		_, _ = NewErrorPacket(ErrCodeNotFound, req.Path()+": no such file or directory").WriteTo(conn)
+		done <- false
+		return done
+	}
+	export.serveGet(conn, rel)
+
+	done <- true
+	return done
+}
+
+// receiveList 处理 ListRequest: 找到对应的导出目录, 列出目录项
+func (d *Daemon) receiveList(session *daemonSession, packet *Packet, conn net.Conn) chan bool {
+	done := make(chan bool, 1)
+
+	req := PacketAsListRequest(packet)
+	export, rel, ok := d.export(req.Path())
+	switch {
+	case ok:
+		export.serveList(conn, rel, req.Offset(), req.Limit())
+	case strings.Trim(req.Path(), "/") == "": // 没有 "" 导出目录时, 根目录下列出所有导出目录
+		_, _ = NewListResponse(req.Path(), d.exportsPage()).WriteTo(conn)
+	default:
+		_, _ = NewErrorPacket(ErrCodeNotFound, req.Path()+": no such file or directory").WriteTo(conn)
+		done <- false
+		return done
+	}
+
+	done <- true
+	return done
+}
+
+// export 找到 p 所在的导出目录, 返回它以及 p 在其中的相对路径
+func (d *Daemon) export(p string) (export *FileServer, rel string, ok bool) {
+	clean := strings.TrimPrefix(path.Clean("/"+p), "/")
+	parts := strings.SplitN(clean, "/", 2)
+	if export, ok := d.exports[parts[0]]; ok && parts[0] != "" {
+		if len(parts) == 2 {
+			rel = parts[1]
+		}
+		return export, rel, true
+	}
+	export, ok = d.exports[""]
+	return export, clean, ok
+}
+
+// exportsPage 把所有导出目录作为目录项列出来
+func (d *Daemon) exportsPage() ListPage {
+	page := ListPage{Entries: []ListEntry{}}
+	for name, export := range d.exports {
+		if info, err := os.Stat(export.Root); err == nil {
+			e := listEntryFromFileInfo(info, export.Root)
+			e.Name = name
+			page.Entries = append(page.Entries, e)
+		}
+	}
+	page.Total = uint64(len(page.Entries))
+	return page
+}
+
+// receiveIntoInbox 把推送来的 Message、SimpleFile、BigFile 交给客户端对应的收件箱
+func (d *Daemon) receiveIntoInbox(session *daemonSession, packet *Packet, conn net.Conn) chan bool {
+	box, ok := d.inbox(session, conn)
+	if !ok {
+		done := make(chan bool, 1)
+		done <- false
+		return done
+	}
+
+	switch packet.Type {
+	case PacketTypeMessage:
+		return box.message.Receive(packet, conn)
+	case PacketTypeSimpleFile:
+		return box.simpleFile.Receive(packet, conn)
+	default: // BigFileHeader, BigFileResponse
+		return box.bigFile.Receive(packet, conn)
+	}
+}
+
+// inbox 返回客户端对应的收件箱, 没有的话回复错误
+func (d *Daemon) inbox(session *daemonSession, conn net.Conn) (*inbox, bool) {
+	box, ok := d.inboxes[session.rule.Inbox]
+	if !ok {
+		logWarn("Daemon: no inbox", Field{"client", session.peer}, Field{"inbox", session.rule.Inbox})
+		_, _ = NewErrorPacket(ErrCodeForbidden, "no inbox").WriteTo(conn)
+	}
+	return box, ok
+}
+
+// receiveManifest 处理 ManifestRequest: 列出收件箱里 path 下的所有文件。
+// path 不存在时回复空的清单, 这样第一次同步也能进行。
+func (d *Daemon) receiveManifest(session *daemonSession, packet *Packet, conn net.Conn) chan bool {
+	done := make(chan bool, 1)
+
+	box, ok := d.inbox(session, conn)
+	if !ok {
+		done <- false
+		return done
+	}
+
+	req := PacketAsManifestRequest(packet)
+	var entries []ListEntry
+	if dir, err := resolveInRoot(box.dir, req.Path()); err == nil {
+		if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+			_, _ = NewErrorPacket(ErrCodeBadRequest, req.Path()+": not a directory").WriteTo(conn)
+			done <- false
+			return done
+		}
+		entries, err = buildManifest(dir, req.Flags()&ManifestWithHash != 0, nil)
+		if err != nil {
+			_, _ = NewErrorPacket(ErrCodeInternal, err.Error()).WriteTo(conn)
+			done <- false
+			return done
+		}
+	}
+	_, _ = NewManifestResponse(req.Path(), entries).WriteTo(conn)
+
+	done <- true
+	return done
+}
+
+// receiveSyncOp 处理 SyncOp: 删除收件箱里的文件或者设置其修改时间, 成功的话回传 SyncOp
+func (d *Daemon) receiveSyncOp(session *daemonSession, packet *Packet, conn net.Conn) chan bool {
+	done := make(chan bool, 1)
+
+	box, ok := d.inbox(session, conn)
+	if !ok {
+		done <- false
+		return done
+	}
+
+	op, err := PacketAsSyncOp(packet)
+	if err == nil {
+		err = box.syncOp(op, conn)
+	}
+	if err != nil {
+		logWarn("Daemon: sync failed", Field{"client", session.peer}, fErr(err))
+		_, _ = NewErrorPacket(ErrCodeBadRequest, err.Error()).WriteTo(conn)
+		done <- false
+		return done
+	}
+	logInfo("Daemon: sync", Field{"client", session.peer}, Field{"op", op.Op()}, Field{"path", op.Path})
+	_, _ = op.WriteTo(conn)
+
+	done <- true
+	return done
+}
+
+// syncOp 在收件箱里执行 op, SyncOpGet 会把文件发到 conn
+func (b *inbox) syncOp(op *SyncOp, conn net.Conn) error {
+	p, err := b.path(op.Path)
+	if err != nil {
+		return err
+	}
+	switch op.Op() {
+	case SyncOpGet:
+		if info, err := os.Stat(p); err != nil || !info.Mode().IsRegular() {
+			return fmt.Errorf("%s: not a regular file", op.Path)
+		}
+		return b.files.sendFile(conn, p, op.Name)
+	case SyncOpDelete:
+		if _, err := os.Lstat(p); err != nil {
+			return fmt.Errorf("%s: no such file or directory", op.Path)
+		}
+		return os.RemoveAll(p)
+	case SyncOpChtimes:
+		return os.Chtimes(p, op.ModTime, op.ModTime)
+	default:
+		return fmt.Errorf("unknown sync op %q", op.Op())
+	}
+}
+
+// path 把相对路径 rel 转换为收件箱里的真实路径。
+// 只解析上级目录里的符号链接, 不解析 rel 自己, 这样删除一个符号链接删的是链接本身。
+// 不能是收件箱本身。
+func (b *inbox) path(rel string) (string, error) {
+	clean := strings.TrimPrefix(path.Clean("/"+rel), "/")
+	if clean == "" {
+		return "", fmt.Errorf("%q: not allowed", rel)
+	}
+	parent, err := resolveInRoot(b.dir, path.Dir(clean))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(parent, path.Base(clean)), nil
+}
@@ -0,0 +1,76 @@
+package gofer
+
+import (
+	"net"
+	"testing"
+)
+
+func TestClientRuleMatches(t *testing.T) {
+	ip := net.ParseIP("10.1.2.3")
+	cases := []struct {
+		match string
+		want  bool
+	}{
+		{"*", true},
+		{"10.0.0.0/8", true},
+		{"192.168.0.0/16", false},
+		{"10.1.2.3", true},
+		{"10.1.2.4", false},
+		{"alice", true},
+		{"bob", false},
+	}
+	for _, c := range cases {
+		if got := (ClientRule{Match: c.match}).matches(ip, "alice"); got != c.want {
+			t.Errorf("ClientRule{Match: %q}.matches() = %v, want %v", c.match, got, c.want)
+		}
+	}
+}
+
+func TestDaemonExport(t *testing.T) {
+	d := &Daemon{exports: map[string]*FileServer{
+		"":     NewFileServer("/srv/root"),
+		"docs": NewFileServer("/srv/docs"),
+	}}
+
+	cases := []struct {
+		path, root, rel string
+	}{
+		{"docs/a/b.txt", "/srv/docs", "a/b.txt"},
+		{"/docs", "/srv/docs", ""},
+		{"other/c.txt", "/srv/root", "other/c.txt"},
+		{"../docs/../x", "/srv/root", "x"},
+	}
+	for _, c := range cases {
+		export, rel, ok := d.export(c.path)
+		if !ok || export.Root != c.root || rel != c.rel {
+			t.Errorf("export(%q) = %v %q %v, want %q %q", c.path, export, rel, ok, c.root, c.rel)
+		}
+	}
+}
+
+func TestSaveFilePath(t *testing.T) {
+	for _, name := range []string{"a.txt", "sub/a.txt", "sub/../a.txt"} {
+		if _, err := saveFilePath("inbox", name); err != nil {
+			t.Errorf("saveFilePath(%q) failed: %v", name, err)
+		}
+	}
+	for _, name := range []string{"", ".", "..", "../a.txt", "/etc/passwd", "sub/../../a.txt"} {
+		if p, err := saveFilePath("inbox", name); err == nil {
+			t.Errorf("saveFilePath(%q) = %q, want error", name, p)
+		}
+	}
+}
+
+func TestDaemonDefaultRuleIsReadOnly(t *testing.T) {
+	d := &Daemon{Config: &DaemonConfig{}}
+	rule, err := d.ruleFor(net.ParseIP("10.0.0.8"), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !rule.allows(PermissionGet) || !rule.allows(PermissionList) {
+		t.Errorf("default rule %v should allow get and list", rule.Permissions)
+	}
+	if rule.allows(PermissionPush) || rule.allows(PermissionSync) {
+		t.Errorf("default rule %v should not allow push or sync", rule.Permissions)
+	}
+}
@@ -0,0 +1,549 @@
+package gofer
+
+import (
+	"bufio"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 增量传输！！
+// 接收端已经有一个旧版本的文件时 (同名, 但 md5 不同), 没必要把整个新文件都下载一遍。
+// 仿照 rsync 的做法:
+//
+//  1. BigFileReceiverWorker 把旧文件按 DeltaBlockSize 分块, 计算每块的
+//     弱校验和 (滚动校验和, 可以 O(1) 地往后挪一个字节) 和强校验和 (md5),
+//     作为 DeltaSignature 发给 BigFileSender
+//  2. BigFileSender 在新文件上滑动窗口, 用弱校验和快速找候选块, 再用强校验和确认,
+//     把新文件描述成一串 "复制旧文件的某一段" 或 "这是一段新数据" 的指令,
+//     用若干个 DeltaInstruction 发回去, 最后一个指令是 deltaOpEnd
+//  3. BigFileReceiverWorker 按指令从旧文件和新数据重建出新文件,
+//     用 BigFileHeader 里的 hash 校验; 校验失败就退回到普通的分块下载
+//
+// 增量传输默认关闭, 设置 EnableDelta = true (命令行: -delta) 开启。
+
+// EnableDelta 为 true 时, BigFileReceiverWorker 遇到本地已有旧版本的文件会尝试增量传输
+var EnableDelta = false
+
+// DeltaBlockSize 是增量传输计算签名时的块大小
+var DeltaBlockSize uint32 = 64 * 1024
+
+// deltaMaxLiteral 是一个 DeltaInstruction 中新数据的最大长度
+const deltaMaxLiteral = 1 * 1024 * 1024
+
+// DeltaSignature 是接收端对旧文件计算的签名, 发给发送端
+//
+// DeltaSignature is Packet that:
+//  - Type: 13
+//  - Info: fileID (of the new file)
+//  - Data: blockSize (const 4 Byte), [weak (const 4 Byte), strong (const 16 Byte)]...
+type DeltaSignature struct {
+	*Packet
+	fileID    []byte // just a name, do not use this, call Getter/Setter instead
+	blockSize uint32 // just a name, do not use this, call Getter/Setter instead
+}
+
+const PacketTypeDeltaSignature uint16 = 13
+
+const deltaSignatureEntrySize = 4 + md5.Size
+
+// 对方发来的签名要在这个范围里, 否则一个 4 字节的 blockSize 就能让我们分配几个 GiB 的内存
+const (
+	deltaMinBlockSize     = 1024
+	deltaMaxSignatureSize = 1 << 20 // 签名里最多多少块 (签名最大约 20 MiB)
+)
+
+// NewDeltaSignature 读取旧文件 old, 按 blockSize 分块计算签名。
+// 只有完整的块才计算签名, 最后不足一块的部分会在新文件里当作新数据。
+func NewDeltaSignature(fileID []byte, old io.Reader, blockSize uint32) (*DeltaSignature, error) {
+	data := make([]byte, 4)
+	binary.BigEndian.PutUint32(data, blockSize)
+
+	block := make([]byte, blockSize)
+	for {
+		if _, err := io.ReadFull(old, block); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return nil, err
+		}
+		entry := make([]byte, deltaSignatureEntrySize)
+		binary.BigEndian.PutUint32(entry[:4], weakSum(block).sum())
+		strong := md5.Sum(block)
+		copy(entry[4:], strong[:])
+		data = append(data, entry...)
+	}
+
+	return &DeltaSignature{Packet: NewPacket(PacketTypeDeltaSignature, fileID, data)}, nil
+}
+
+// PacketAsDeltaSignature convert packet to DeltaSignature
+// Notice: only for packets whose Type==PacketTypeDeltaSignature
+func PacketAsDeltaSignature(packet *Packet) *DeltaSignature {
+	return &DeltaSignature{Packet: packet}
+}
+
+func (d DeltaSignature) FileID() []byte {
+	return d.Info
+}
+
+func (d DeltaSignature) BlockSize() uint32 {
+	if len(d.Data) < 4 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(d.Data[:4])
+}
+
+// NumBlock 返回签名中的块数
+func (d DeltaSignature) NumBlock() int {
+	if len(d.Data) < 4 {
+		return 0
+	}
+	return (len(d.Data) - 4) / deltaSignatureEntrySize
+}
+
+// validate 检查对方发来的签名: 块大小在 [deltaMinBlockSize, MaxBlockSize] 里, 块数不超过 deltaMaxSignatureSize
+func (d DeltaSignature) validate() error {
+	if len(d.Data) < 4 || (len(d.Data)-4)%deltaSignatureEntrySize != 0 {
+		return fmt.Errorf("bad delta signature: malformed data")
+	}
+	if blockSize := d.BlockSize(); blockSize < deltaMinBlockSize || uint64(blockSize) > MaxBlockSize {
+		return fmt.Errorf("bad delta signature: block size %d", blockSize)
+	}
+	if d.NumBlock() > deltaMaxSignatureSize {
+		return fmt.Errorf("bad delta signature: too many blocks: %d", d.NumBlock())
+	}
+	return nil
+}
+
+// Block 返回第 i 块的弱校验和与强校验和
+func (d DeltaSignature) Block(i int) (weak uint32, strong []byte) {
+	entry := d.Data[4+i*deltaSignatureEntrySize : 4+(i+1)*deltaSignatureEntrySize]
+	return binary.BigEndian.Uint32(entry[:4]), entry[4:]
+}
+
+// DeltaInstruction 是发送端发给接收端的一批重建指令
+//
+// DeltaInstruction is Packet that:
+//  - Type: 14
+//  - Info: fileID
+//  - Data: ops:
+//      deltaOpCopy    (1 Byte), offset in old file (8 Byte), length (8 Byte)
+//      deltaOpLiteral (1 Byte), length (4 Byte), data
+//      deltaOpEnd     (1 Byte), size of new file (8 Byte)
+type DeltaInstruction struct {
+	*Packet
+	fileID []byte // just a name, do not use this, call Getter/Setter instead
+	ops    []byte // just a name, do not use this, call Getter/Setter instead
+}
+
+const PacketTypeDeltaInstruction uint16 = 14
+
+const (
+	deltaOpCopy    byte = 'C'
+	deltaOpLiteral byte = 'L'
+	deltaOpEnd     byte = 'E'
+)
+
+func NewDeltaInstruction(fileID []byte, ops []byte) *DeltaInstruction {
+	return &DeltaInstruction{Packet: NewPacket(PacketTypeDeltaInstruction, fileID, ops)}
+}
+
+// PacketAsDeltaInstruction convert packet to DeltaInstruction
+// Notice: only for packets whose Type==PacketTypeDeltaInstruction
+func PacketAsDeltaInstruction(packet *Packet) *DeltaInstruction {
+	return &DeltaInstruction{Packet: packet}
+}
+
+func (d DeltaInstruction) FileID() []byte {
+	return d.Info
+}
+
+func (d DeltaInstruction) Ops() []byte {
+	return d.Data
+}
+
+// rollingSum 是 rsync 的弱校验和: a = Σx, b = Σ(L-i)·x, 都取低 16 位
+type rollingSum struct {
+	a, b uint32
+	n    uint32 // 窗口长度 L
+}
+
+func weakSum(block []byte) rollingSum {
+	r := rollingSum{n: uint32(len(block))}
+	for i, x := range block {
+		r.a += uint32(x)
+		r.b += uint32(len(block)-i) * uint32(x)
+	}
+	return r
+}
+
+// roll 窗口往后挪一个字节: 移出 out, 移入 in
+func (r *rollingSum) roll(out, in byte) {
+	r.a = r.a - uint32(out) + uint32(in)
+	r.b = r.b - r.n*uint32(out) + r.a
+}
+
+func (r rollingSum) sum() uint32 {
+	return (r.a & 0xffff) | (r.b&0xffff)<<16
+}
+
+// deltaEncoder 把复制/新数据指令攒成 DeltaInstruction 写到 conn
+type deltaEncoder struct {
+	conn   io.Writer
+	fileID []byte
+	ops    []byte
+
+	copyOffset, copyLength uint64 // 还没写入 ops 的复制指令, 相邻的会合并
+
+	copied, literal uint64 // 统计
+
+	wait func(n int) // 写出 n 字节之前调用, 用来限速, nil 表示不限速
+}
+
+func (e *deltaEncoder) copyBlock(offset uint64, length uint64) error {
+	if e.copyLength > 0 && e.copyOffset+e.copyLength == offset {
+		e.copyLength += length
+		return nil
+	}
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	e.copyOffset, e.copyLength = offset, length
+	return nil
+}
+
+func (e *deltaEncoder) flushCopy() error {
+	if e.copyLength == 0 {
+		return nil
+	}
+	op := make([]byte, 17)
+	op[0] = deltaOpCopy
+	binary.BigEndian.PutUint64(op[1:9], e.copyOffset)
+	binary.BigEndian.PutUint64(op[9:], e.copyLength)
+	e.ops = append(e.ops, op...)
+	e.copied += e.copyLength
+	e.copyLength = 0
+	return e.flushIfFull()
+}
+
+func (e *deltaEncoder) literalData(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	op := make([]byte, 5)
+	op[0] = deltaOpLiteral
+	binary.BigEndian.PutUint32(op[1:], uint32(len(data)))
+	e.ops = append(e.ops, op...)
+	e.ops = append(e.ops, data...)
+	e.literal += uint64(len(data))
+	return e.flushIfFull()
+}
+
+func (e *deltaEncoder) end(size uint64) error {
+	if err := e.flushCopy(); err != nil {
+		return err
+	}
+	op := make([]byte, 9)
+	op[0] = deltaOpEnd
+	binary.BigEndian.PutUint64(op[1:], size)
+	e.ops = append(e.ops, op...)
+	return e.flush()
+}
+
+func (e *deltaEncoder) flushIfFull() error {
+	if len(e.ops) < deltaMaxLiteral {
+		return nil
+	}
+	return e.flush()
+}
+
+func (e *deltaEncoder) flush() error {
+	if len(e.ops) == 0 {
+		return nil
+	}
+	packet := NewDeltaInstruction(e.fileID, e.ops)
+	if e.wait != nil {
+		e.wait(int(12 + packet.InfoSize + packet.DataSize))
+	}
+	_, err := packet.WriteTo(e.conn)
+	e.ops = nil
+	return err
+}
+
+// computeDelta 在新文件 r 上滑动窗口, 对照签名 sig 生成重建指令, 交给 e
+func computeDelta(r io.Reader, sig *DeltaSignature, e *deltaEncoder) (size uint64, err error) {
+	if err := sig.validate(); err != nil {
+		return 0, err
+	}
+	blockSize := int(sig.BlockSize())
+
+	// 弱校验和 -> 块号
+	table := make(map[uint32][]int, sig.NumBlock())
+	for i := 0; i < sig.NumBlock(); i++ {
+		weak, _ := sig.Block(i)
+		table[weak] = append(table[weak], i)
+	}
+
+	reader := bufio.NewReaderSize(r, 1024*1024)
+	bufSize := 4 * 1024 * 1024
+	if bufSize < 4*blockSize {
+		bufSize = 4 * blockSize
+	}
+	buf := make([]byte, 0, bufSize)
+	eof := false
+
+	pos, litStart := 0, 0 // 窗口起点, 还没发出去的新数据的起点
+	var rolling rollingSum
+	rollingValid := false
+
+	for {
+		if len(buf)-pos < blockSize && !eof { // 数据不够一个窗口, 腾地方、读更多
+			n := copy(buf[:cap(buf)], buf[litStart:])
+			buf, pos, litStart = buf[:n], pos-litStart, 0
+			m, err := io.ReadFull(reader, buf[n:cap(buf)])
+			buf = buf[:n+m]
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				eof = true
+			} else if err != nil {
+				return size, err
+			}
+			rollingValid = false
+		}
+		if len(buf)-pos < blockSize {
+			break
+		}
+
+		if !rollingValid {
+			rolling = weakSum(buf[pos : pos+blockSize])
+			rollingValid = true
+		}
+
+		if matched := matchBlock(sig, table[rolling.sum()], buf[pos:pos+blockSize]); matched >= 0 {
+			if err := e.literalData(buf[litStart:pos]); err != nil {
+				return size, err
+			}
+			if err := e.copyBlock(uint64(matched)*uint64(blockSize), uint64(blockSize)); err != nil {
+				return size, err
+			}
+			size += uint64(pos-litStart) + uint64(blockSize)
+			pos += blockSize
+			litStart = pos
+			rollingValid = false
+			continue
+		}
+
+		// 没匹配上, 窗口往后挪一个字节
+		if pos+blockSize < len(buf) {
+			rolling.roll(buf[pos], buf[pos+blockSize])
+		} else {
+			rollingValid = false
+		}
+		pos++
+
+		if pos-litStart >= deltaMaxLiteral {
+			if err := e.literalData(buf[litStart:pos]); err != nil {
+				return size, err
+			}
+			size += uint64(pos - litStart)
+			litStart = pos
+		}
+	}
+
+	// 剩下的都是新数据
+	if err := e.literalData(buf[litStart:]); err != nil {
+		return size, err
+	}
+	size += uint64(len(buf) - litStart)
+
+	return size, e.end(size)
+}
+
+// matchBlock 在候选块 candidates 里找强校验和与 window 一致的, 没有则返回 -1
+func matchBlock(sig *DeltaSignature, candidates []int, window []byte) int {
+	if len(candidates) == 0 {
+		return -1
+	}
+	strong := md5.Sum(window)
+	for _, i := range candidates {
+		if _, s := sig.Block(i); string(s) == string(strong[:]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// sendDelta 处理接收端发来的 DeltaSignature: 计算并发送重建指令
+func (s *BigFileSender) sendDelta(conn net.Conn, sig *DeltaSignature) error {
+	filePath, ok := s.filePathMap.Load(FileIDString(sig.FileID()))
+	if !ok {
+		return fmt.Errorf("bigFileSender: resource not found")
+	}
+
+	file, err := os.Open(filePath.(string))
+	if err != nil {
+		return fmt.Errorf("bigFileSender: resource not found: %v", err)
+	}
+	defer file.Close()
+
+	e := &deltaEncoder{conn: conn, fileID: sig.FileID()}
+	e.wait = func(n int) {
+		s.bandwidth().WaitN(conn, s.fileLimiter(sig.FileID()), n)
+	}
+	if _, err := computeDelta(file, sig, e); err != nil {
+		return err
+	}
+
+	logInfo("[BigFileSender] delta", Field{"file", filePath}, Field{"copied", e.copied}, Field{"literal", e.literal})
+	return nil
+}
+
+// receiveDelta 尝试增量传输: 本地已有旧版本的文件时, 发送签名, 按收到的指令重建新文件。
+// 成功 (重建出的文件校验正确) 则返回 true; 没有尝试或失败返回 false, 之后应该走普通的分块下载。
+func (w *BigFileReceiverWorker) receiveDelta(conn net.Conn) bool {
+	if !EnableDelta || len(w.missingBlockIndices()) < len(w.savedBlock) { // 已经下载了一部分块, 就接着下载
+		return false
+	}
+	target := w.targetPath()
+	old, err := os.Open(target)
+	if err != nil {
+		return false
+	}
+	defer old.Close()
+	if info, err := old.Stat(); err != nil || !info.Mode().IsRegular() || info.Size() == 0 ||
+		uint64(info.Size())/uint64(DeltaBlockSize) > deltaMaxSignatureSize { // 签名太大, 发送端不会收
+		return false
+	}
+	defer conn.SetDeadline(time.Time{})
+
+	sig, err := NewDeltaSignature(w.header.FileID(), old, DeltaBlockSize)
+	if err != nil {
+		logWarn("[BigFileReceiverWorker] delta: signature failed", fName(w.header.FileName()), fErr(err))
+		return false
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(BigFileReadTimeout))
+	if _, err := sig.WriteTo(conn); err != nil {
+		logWarn("[BigFileReceiverWorker] delta: send signature failed", fPeer(conn), fErr(err))
+		return false
+	}
+
+	tmpPath := filepath.Join(w.saveDir, "delta.tmp")
+	if err := w.applyDelta(conn, old, tmpPath); err != nil {
+		logWarn("[BigFileReceiverWorker] delta failed", fPeer(conn), fName(w.header.FileName()), fErr(err))
+		_ = os.Remove(tmpPath)
+		return false
+	}
+
+	hash, _, err := FileHash(tmpPath)
+	if err != nil || string(hash) != string(w.header.FileHash()) {
+		logWarn("[BigFileReceiverWorker] delta: reconstructed file is BROKEN, fallback to full transfer",
+			fName(w.header.FileName()))
+		_ = os.Remove(tmpPath)
+		return false
+	}
+
+	if err := os.Rename(tmpPath, target); err != nil {
+		logWarn("[BigFileReceiverWorker] delta: rename failed", fName(w.header.FileName()), fErr(err))
+		return false
+	}
+	_ = os.RemoveAll(w.saveDir)
+	return true
+}
+
+// applyDelta 从 conn 读取 DeltaInstruction, 用旧文件 old 和新数据重建新文件, 写到 tmpPath
+func (w *BigFileReceiverWorker) applyDelta(conn net.Conn, old io.ReaderAt, tmpPath string) error {
+	tmp, err := os.OpenFile(tmpPath, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer tmp.Close()
+
+	d := &deltaDecoder{out: bufio.NewWriter(tmp), old: old}
+	reader := &idleTimeoutReader{conn: conn, timeout: BigFileReadTimeout} // 和分块下载一样, 一直没数据就放弃
+	for !d.ended {
+		packet, err := PacketFromReader(reader)
+		if err != nil {
+			return err
+		}
+		if packet.Type != PacketTypeDeltaInstruction {
+			w.distributer.Receive(packet, conn) // 例如发送端重发的 header
+			continue
+		}
+		ins := PacketAsDeltaInstruction(packet)
+		if FileIDString(ins.FileID()) != FileIDString(w.header.FileID()) {
+			return fmt.Errorf("unexpected delta instruction for %x", ins.FileID())
+		}
+		if err := d.apply(ins.Ops()); err != nil {
+			return err
+		}
+	}
+
+	if d.size != w.header.FileSize() {
+		return fmt.Errorf("bad delta: size mismatch: %d, %d", d.size, w.header.FileSize())
+	}
+	logInfo("[BigFileReceiverWorker] delta", fName(w.header.FileName()),
+		Field{"reused", d.copied}, Field{"downloaded", d.written - d.copied})
+	return d.out.Flush()
+}
+
+// deltaDecoder 执行重建指令: 从旧文件 old 复制, 或者写入新数据, 结果写到 out
+type deltaDecoder struct {
+	out *bufio.Writer
+	old io.ReaderAt
+
+	written, copied uint64 // 统计
+	size            uint64 // deltaOpEnd 声明的新文件大小
+	ended           bool   // 是否已经执行到 deltaOpEnd
+}
+
+// apply 执行一个 DeltaInstruction 中的所有指令
+func (d *deltaDecoder) apply(ops []byte) error {
+	for len(ops) > 0 {
+		if d.ended {
+			return fmt.Errorf("bad delta instruction: op after end")
+		}
+		switch {
+		case ops[0] == deltaOpCopy && len(ops) >= 17:
+			offset := binary.BigEndian.Uint64(ops[1:9])
+			length := binary.BigEndian.Uint64(ops[9:17])
+			n, err := io.Copy(d.out, io.NewSectionReader(d.old, int64(offset), int64(length)))
+			if err != nil {
+				return err
+			}
+			if uint64(n) != length {
+				return fmt.Errorf("bad delta instruction: copy out of range")
+			}
+			d.written += length
+			d.copied += length
+			ops = ops[17:]
+		case ops[0] == deltaOpLiteral && len(ops) >= 5:
+			length := int(binary.BigEndian.Uint32(ops[1:5]))
+			if len(ops) < 5+length {
+				return fmt.Errorf("bad delta instruction: literal too short")
+			}
+			if _, err := d.out.Write(ops[5 : 5+length]); err != nil {
+				return err
+			}
+			d.written += uint64(length)
+			ops = ops[5+length:]
+		case ops[0] == deltaOpEnd && len(ops) >= 9:
+			d.size = binary.BigEndian.Uint64(ops[1:9])
+			if d.size != d.written {
+				return fmt.Errorf("bad delta: size mismatch: %d, %d", d.size, d.written)
+			}
+			d.ended = true
+			ops = ops[9:]
+		default:
+			return fmt.Errorf("bad delta instruction: op %q", ops[0])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package gofer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+)
+
+func TestRollingSum(t *testing.T) {
+	data := make([]byte, 300)
+	rand.New(rand.NewSource(1)).Read(data)
+
+	const window = 64
+	r := weakSum(data[:window])
+	for i := 1; i+window <= len(data); i++ {
+		r.roll(data[i-1], data[i-1+window])
+		if want := weakSum(data[i : i+window]).sum(); r.sum() != want {
+			t.Fatalf("rolled sum at %d = %x, want %x", i, r.sum(), want)
+		}
+	}
+}
+
+func TestDeltaRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	old := make([]byte, 100*1024)
+	rnd.Read(old)
+
+	// 新文件: 中间插入一段, 末尾改掉一段
+	insert := make([]byte, 3000)
+	rnd.Read(insert)
+	newer := append(append(append([]byte{}, old[:40000]...), insert...), old[40000:90000]...)
+	newer = append(newer, []byte("a brand new tail")...)
+
+	sig, err := NewDeltaSignature([]byte("id"), bytes.NewReader(old), 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var packets bytes.Buffer
+	e := &deltaEncoder{conn: &packets, fileID: []byte("id")}
+	size, err := computeDelta(bytes.NewReader(newer), sig, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != uint64(len(newer)) {
+		t.Errorf("size = %d, want %d", size, len(newer))
+	}
+	if e.literal >= uint64(len(insert))+2*4096+16 {
+		t.Errorf("too much literal data: %d", e.literal)
+	}
+
+	var out bytes.Buffer
+	d := &deltaDecoder{out: bufio.NewWriter(&out), old: bytes.NewReader(old)}
+	for !d.ended {
+		p, err := PacketFromReader(&packets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := d.apply(PacketAsDeltaInstruction(p).Ops()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = d.out.Flush()
+
+	if !bytes.Equal(out.Bytes(), newer) {
+		t.Error("reconstructed file differs")
+	}
+}
+
+func TestDeltaSignatureValidate(t *testing.T) {
+	sig := func(blockSize uint32, numBlock int) *DeltaSignature {
+		data := make([]byte, 4+numBlock*deltaSignatureEntrySize)
+		binary.BigEndian.PutUint32(data, blockSize)
+		return PacketAsDeltaSignature(NewPacket(PacketTypeDeltaSignature, []byte("id"), data))
+	}
+	if err := sig(4096, 10).validate(); err != nil {
+		t.Errorf("valid signature: %v", err)
+	}
+	// 一个 4 字节的 blockSize 不能让发送端分配很大的缓冲区
+	for _, bad := range []*DeltaSignature{sig(0, 1), sig(1<<31, 1), sig(4096, deltaMaxSignatureSize+1)} {
+		if _, err := computeDelta(bytes.NewReader(nil), bad, &deltaEncoder{conn: &bytes.Buffer{}}); err == nil {
+			t.Errorf("signature with block size %d, %d blocks: no error", bad.BlockSize(), bad.NumBlock())
+		}
+	}
+	malformed := sig(4096, 1)
+	malformed.Data = malformed.Data[:len(malformed.Data)-1]
+	if err := malformed.validate(); err == nil {
+		t.Error("malformed signature: no error")
+	}
+}
@@ -0,0 +1,255 @@
+package gofer
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 局域网发现！！
+// 手敲 IP:Port 太麻烦了，所以接收端可以在局域网里 UDP 组播自我介绍 (Announcement)，
+// 发送端监听组播，按名字找到接收端，直接连过去。
+//
+// Announcement 里带着接收端服务证书的指纹 (fingerprint)，发送端连接的时候会检查
+// 对方的证书和这个指纹一致, 只是为了确认连上的是兼容的 gofer。
+//
+// ⚠️ 注意：这不是认证。服务证书是打包在 statik 里的, 所有同一版本的 gofer 用的都是同一张证书,
+// 所以指纹只能说明对方是用同样的证书编译出来的 gofer, 并不能认出是哪一台机器;
+// Announcement 本身也谁都能发。防不住局域网里冒名顶替的人, 要确认对方是谁请用 -relay -code。
+
+// DiscoveryAddress 是局域网发现使用的 UDP 组播地址
+var DiscoveryAddress = "239.255.71.70:23339"
+
+// Announcement 是接收端在局域网里广播的自我介绍
+//
+// Announcement is Packet that:
+//  - Type: 8
+//  - Info: name
+//  - Data: json: {port, fingerprint, capabilities}
+type Announcement struct {
+	*Packet
+	name string // just a name, do not use this, call Getter/Setter instead
+
+	announcementData
+
+	// Addr 是收到 Announcement 时填的对方地址 (IP:Port), 不参与编码
+	Addr string
+}
+
+// announcementData 是 Announcement 中 Data 部分的内容
+type announcementData struct {
+	Port         int      `json:"port"`
+	Fingerprint  string   `json:"fingerprint"`
+	Capabilities []string `json:"capabilities"`
+}
+
+const PacketTypeAnnouncement uint16 = 8
+
+func NewAnnouncement(name string, port int, fingerprint string, capabilities []string) *Announcement {
+	a := &Announcement{
+		Packet: NewPacket(PacketTypeAnnouncement, []byte(name), make([]byte, 0)),
+		announcementData: announcementData{
+			Port:         port,
+			Fingerprint:  fingerprint,
+			Capabilities: capabilities,
+		},
+	}
+	a.encodeData()
+	return a
+}
+
+// PacketAsAnnouncement convert packet to Announcement
+// Notice: only for packets whose Type==PacketTypeAnnouncement
+func PacketAsAnnouncement(packet *Packet) (*Announcement, error) {
+	a := &Announcement{Packet: packet}
+	if err := json.Unmarshal(packet.Data, &a.announcementData); err != nil {
+		return nil, fmt.Errorf("bad announcement: %v", err)
+	}
+	return a, nil
+}
+
+func (a *Announcement) encodeData() {
+	a.Data, _ = json.Marshal(a.announcementData)
+	a.DataSize = uint32(len(a.Data))
+}
+
+func (a Announcement) Name() string {
+	return string(a.Info)
+}
+
+func (a *Announcement) SetName(name string) {
+	a.Info = []byte(name)
+	a.InfoSize = uint32(len(a.Info))
+}
+
+// HasCapability 检查对方是否声明了某项能力, 例如 "bigfile"
+func (a Announcement) HasCapability(capability string) bool {
+	for _, c := range a.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Announce 每隔 interval 在局域网里组播一次 announcement, 直到 stop 被关闭
+func Announce(announcement *Announcement, interval time.Duration, stop <-chan struct{}) error {
+	group, err := net.ResolveUDPAddr("udp4", DiscoveryAddress)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialUDP("udp4", nil, group)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	for {
+		if _, err := announcement.WriteTo(conn); err != nil {
+			logWarn("Announce failed", fErr(err))
+		}
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Discover 监听局域网里的 Announcement, timeout 后返回收到的所有接收端 (按名字去重)
+func Discover(timeout time.Duration) ([]*Announcement, error) {
+	var found []*Announcement
+	err := discover(timeout, func(a *Announcement) bool {
+		for i, f := range found {
+			if f.Name() == a.Name() {
+				found[i] = a
+				return true
+			}
+		}
+		found = append(found, a)
+		return true
+	})
+	return found, err
+}
+
+// DiscoverPeer 在 timeout 内寻找名为 name 的接收端, 找到就立即返回
+func DiscoverPeer(name string, timeout time.Duration) (*Announcement, error) {
+	var peer *Announcement
+	err := discover(timeout, func(a *Announcement) bool {
+		if a.Name() == name {
+			peer = a
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	if peer == nil {
+		return nil, fmt.Errorf("peer %q not found", name)
+	}
+	return peer, nil
+}
+
+// discover 监听组播, 把收到的每个 Announcement 交给 found, found 返回 false 则提前结束
+func discover(timeout time.Duration, found func(a *Announcement) bool) error {
+	group, err := net.ResolveUDPAddr("udp4", DiscoveryAddress)
+	if err != nil {
+		return err
+	}
+	conn, err := net.ListenMulticastUDP("udp4", nil, group)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 64*1024)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				return nil
+			}
+			return err
+		}
+
+		packet, err := PacketFromBytes(buf[:n])
+		if err != nil || packet.Type != PacketTypeAnnouncement {
+			continue
+		}
+		// PacketFromBytes 复用 buf, 要拷贝一份
+		packet = NewPacket(packet.Type, append([]byte{}, packet.Info...), append([]byte{}, packet.Data...))
+		a, err := PacketAsAnnouncement(packet)
+		if err != nil {
+			continue
+		}
+		a.Addr = net.JoinHostPort(from.IP.String(), strconv.Itoa(a.Port))
+
+		if !found(a) {
+			return nil
+		}
+	}
+}
+
+// ServerCertFingerprint 返回本程序使用的服务端证书的指纹: hex(sha256(DER))。
+// 证书是编译进程序的, 所以这个指纹只标识 gofer 的构建, 不标识某一台机器。
+func ServerCertFingerprint() (string, error) {
+	pemCert, pemKey, err := GetCert(ServerCert)
+	if err != nil {
+		return "", fmt.Errorf("server: read cert: %v", err)
+	}
+	cert, err := tls.X509KeyPair(pemCert, pemKey)
+	if err != nil {
+		return "", fmt.Errorf("server: loadkeys: %s", err)
+	}
+	return CertFingerprint(cert.Certificate[0]), nil
+}
+
+// CertFingerprint 计算 DER 编码的证书的指纹: hex(sha256(DER))
+func CertFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// DialAndRunClientTLSSameBuild 作用和 DialAndRunClientTLS 一样,
+// 不过要求服务端证书的指纹等于 fingerprint, 否则拒绝连接并返回错误。
+// 指纹一致只说明对方用的是同一个构建的证书 (见 ServerCertFingerprint), 不说明对方是谁, 不能当认证用。
+func DialAndRunClientTLSSameBuild(serverAddress string, fingerprint string, client Client) error {
+	conf, err := clientTLSConfig()
+	if err != nil {
+		return err
+	}
+	conf.VerifyPeerCertificate = fingerprintVerifier(fingerprint)
+
+	conn, err := tls.Dial("tcp", serverAddress, conf)
+	if err != nil {
+		emitFailed(Event{Peer: serverAddress}, ErrCodeConnect, err)
+		return err
+	}
+
+	<-runClient(client, conn)
+	return nil
+}
+
+// fingerprintVerifier 返回一个 tls.Config.VerifyPeerCertificate,
+// 检查对方证书的指纹是否为 fingerprint
+func fingerprintVerifier(fingerprint string) func([][]byte, [][]*x509.Certificate) error {
+	fingerprint = strings.ToLower(fingerprint)
+	return func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return fmt.Errorf("no peer certificate")
+		}
+		if got := CertFingerprint(rawCerts[0]); got != fingerprint {
+			return fmt.Errorf("peer certificate fingerprint mismatch: got %s, want %s", got, fingerprint)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,36 @@
+package gofer
+
+import (
+	"testing"
+)
+
+func TestAnnouncement(t *testing.T) {
+	a := NewAnnouncement("alice", 2333, "abcd", []string{"file", "bigfile"})
+
+	p, err := PacketFromBytes(a.ToBytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := PacketAsAnnouncement(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b.Name() != "alice" || b.Port != 2333 || b.Fingerprint != "abcd" {
+		t.Errorf("got %s %d %s", b.Name(), b.Port, b.Fingerprint)
+	}
+	if !b.HasCapability("bigfile") || b.HasCapability("message") {
+		t.Errorf("bad capabilities: %v", b.Capabilities)
+	}
+}
+
+func TestFingerprintVerifier(t *testing.T) {
+	der := []byte("not really a certificate")
+	verify := fingerprintVerifier(CertFingerprint(der))
+
+	if err := verify([][]byte{der}, nil); err != nil {
+		t.Error(err)
+	}
+	if err := verify([][]byte{[]byte("another one")}, nil); err == nil {
+		t.Error("expected fingerprint mismatch")
+	}
+}
@@ -1,7 +1,6 @@
 package gofer
 
 import (
-	"log"
 	"net"
 	"sync"
 )
@@ -22,10 +21,12 @@ func (d *Distributer) Register(packetType uint16, packetReceiver PacketReceiver)
 // Receive 完成 Distributer 的分发工作
 func (d *Distributer) Receive(packet *Packet, conn net.Conn) chan bool {
 	done := make(chan bool, 1)
+	metricPacketsReceived.Inc(packetTypeName(packet.Type))
+	metricBytesReceived.Add(float64(wireSize(packet)))
 
 	packetReceiver, ok := d.packetReceivers.Load(packet.Type)
 	if !ok { // 没有接收的处理器，默认处理
-		log.Printf("Got an unknown Packet: %#v", packet)
+		logWarn("Got an unknown Packet", fPeer(conn), Field{"type", packet.Type})
 		done <- false
 		return done
 	}
@@ -0,0 +1,87 @@
+package gofer
+
+import (
+	"fmt"
+	"net"
+)
+
+// ErrorPacket 是服务端回给客户端的错误, 例如请求的文件不存在
+//
+// ErrorPacket is Packet that:
+//  - Type: 10
+//  - Info: string, error `code`, e.g. "not_found"
+//  - Data: string, human readable error `message`
+type ErrorPacket struct {
+	*Packet
+	code    string // just a name, do not use this, call Getter/Setter instead
+	message string // just a name, do not use this, call Getter/Setter instead
+}
+
+const PacketTypeError uint16 = 10
+
+// 错误码
+const (
+	ErrCodeBadRequest = "bad_request"
+	ErrCodeNotFound   = "not_found"
+	ErrCodeInternal   = "internal"
+	ErrCodeCanceled   = "canceled" // 对方取消了这个传输, message 是文件的 FileIDString
+	ErrCodePaused     = "paused"   // 对方暂停了这个传输, message 是文件的 FileIDString
+)
+
+func NewErrorPacket(code string, message string) *ErrorPacket {
+	return &ErrorPacket{
+		Packet: NewPacket(PacketTypeError, []byte(code), []byte(message)),
+	}
+}
+
+// PacketAsErrorPacket convert packet to ErrorPacket
+// Notice: only for packets whose Type==PacketTypeError
+func PacketAsErrorPacket(packet *Packet) *ErrorPacket {
+	return &ErrorPacket{Packet: packet}
+}
+
+func (e ErrorPacket) Code() string {
+	return string(e.Info)
+}
+
+func (e *ErrorPacket) SetCode(code string) {
+	e.Info = []byte(code)
+	e.InfoSize = uint32(len(e.Info))
+}
+
+func (e ErrorPacket) Message() string {
+	return string(e.Data)
+}
+
+func (e *ErrorPacket) SetMessage(message string) {
+	e.Data = []byte(message)
+	e.DataSize = uint32(len(e.Data))
+}
+
+// Error 实现 error 接口
+func (e ErrorPacket) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code(), e.Message())
+}
+
+// ErrorPacketReceiver 处理对方发来的 ErrorPacket: 打印出来, 然后以失败结束
+type ErrorPacketReceiver struct{}
+
+func NewErrorPacketReceiver() *ErrorPacketReceiver {
+	return &ErrorPacketReceiver{}
+}
+
+func (r ErrorPacketReceiver) Receive(packet *Packet, conn net.Conn) chan bool {
+	done := make(chan bool, 1)
+
+	e := PacketAsErrorPacket(packet)
+	logError("[Error] peer replied an error", fPeer(conn), Field{"code", e.Code()}, Field{"message", e.Message()})
+	emitFailed(Event{Peer: peerOf(conn)}, e.Code(), fmt.Errorf("%s", e.Message()))
+
+	done <- false
+	return done
+}
+
+// 注册 ErrorPacketReceiver
+func init() {
+	DistributerInstance().Register(PacketTypeError, NewErrorPacketReceiver())
+}
@@ -0,0 +1,135 @@
+package gofer
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// 事件！！
+// 传输过程中发生的事 (连上了, 收到文件头, 存了一块, 校验通过, 失败了...) 除了打印给人看, 还作为 Event 发给
+// DefaultEvents 的订阅者, 例如 gofer -output json 把它们一行一个地打印成 JSON, 给脚本解析:
+//
+//  - EventConnected: 和对方建立了连接
+//  - EventRetry: 连不上或者断了, 等一会儿重连 (还没有失败)
+//  - EventHeader: 收到了要接收的文件的信息 (大文件的 BigFileHeader, 或者整个 SimpleFile)
+//  - EventBlock: 大文件的一块保存好了
+//  - EventVerified: 大文件收完了, md5 校验正确
+//  - EventMessage: 收到 (或者发出了) 一条消息
+//  - EventPaused, EventResumed: 大文件的接收暂停了 (自己暂停的, 或者发送端暂停了), 又继续了
+//  - EventFailed: 失败了, Code 是错误码 (ErrCodeXxx, 或者对方 ErrorPacket 的错误码)
+//
+// 每个传输的字节数、速度等在 Progress 里, 见 progress.go。
+
+// 事件的种类
+const (
+	EventConnected = "connected"
+	EventRetry     = "retry"
+	EventHeader    = "header"
+	EventBlock     = "block"
+	EventVerified  = "verified"
+	EventMessage   = "message"
+	EventPaused    = "paused"
+	EventResumed   = "resumed"
+	EventFailed    = "failed"
+)
+
+// 事件里的错误码, 除了 ErrorPacket 的那些 (ErrCodeNotFound 等)
+const (
+	ErrCodeConnect      = "connect_failed"    // 连不上对方
+	ErrCodeNetwork      = "network_error"     // 连接上的读写出错, 或者连接断了
+	ErrCodeDisconnected = "disconnected"      // 连接断了, 对方一直没有重连
+	ErrCodeChecksum     = "checksum_mismatch" // 收完的文件 md5 不对
+	ErrCodeIO           = "io_error"          // 读写本地文件出错
+)
+
+// Event 是传输过程中发生的一件事, 没用到的字段为空
+type Event struct {
+	Time      time.Time `json:"time"`
+	Type      string    `json:"event"`               // EventXxx
+	Direction string    `json:"direction,omitempty"` // ProgressSend or ProgressRecv
+	Peer      string    `json:"peer,omitempty"`      // 对方的地址
+	FileID    string    `json:"file_id,omitempty"`   // 大文件的 FileIDString
+	Name      string    `json:"name,omitempty"`      // 文件名
+	Size      uint64    `json:"size,omitempty"`      // 文件 (EventHeader) 或者块 (EventBlock) 的大小
+	Block     *uint64   `json:"block,omitempty"`     // EventBlock: 第几块
+	Blocks    uint64    `json:"blocks,omitempty"`    // EventHeader, EventBlock: 大文件一共几块
+	Info      string    `json:"info,omitempty"`      // EventMessage: 消息的 info
+	Message   string    `json:"message,omitempty"`   // EventMessage: 消息内容
+	Code      string    `json:"code,omitempty"`      // EventFailed, EventRetry: 错误码
+	Error     string    `json:"error,omitempty"`     // EventFailed, EventRetry: 错误信息
+}
+
+// DefaultEvents 是各处报告事件的地方
+var DefaultEvents = NewEvents()
+
+// Events 把事件发给订阅者
+type Events struct {
+	mu        sync.Mutex
+	listeners map[int]func(Event)
+	nextID    int
+}
+
+func NewEvents() *Events {
+	return &Events{listeners: map[int]func(Event){}}
+}
+
+// Subscribe 订阅事件, 返回取消订阅的函数。
+// listener 在发生事件的 goroutine 里同步调用, 不要阻塞。
+func (e *Events) Subscribe(listener func(Event)) (cancel func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	id := e.nextID
+	e.nextID++
+	e.listeners[id] = listener
+	return func() {
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		delete(e.listeners, id)
+	}
+}
+
+// Emit 把事件发给所有订阅者, 没有设置 Time 的话设置为现在
+func (e *Events) Emit(event Event) {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+
+	e.mu.Lock()
+	listeners := make([]func(Event), 0, len(e.listeners))
+	for _, l := range e.listeners {
+		listeners = append(listeners, l)
+	}
+	e.mu.Unlock()
+
+	for _, l := range listeners {
+		l(event)
+	}
+}
+
+// ErrorCode 返回 err 的错误码: 对方回的 ErrorPacket 就是它的错误码, 否则是 ErrCodeInternal
+func ErrorCode(err error) string {
+	var e *ErrorPacket
+	if errors.As(err, &e) {
+		return e.Code()
+	}
+	return ErrCodeInternal
+}
+
+// emitFailed 报告一个失败事件
+func emitFailed(event Event, code string, err error) {
+	event.Type, event.Code = EventFailed, code
+	if err != nil {
+		event.Error = err.Error()
+	}
+	DefaultEvents.Emit(event)
+}
+
+// peerOf 返回 conn 对方的地址, conn 为 nil 时返回 ""
+func peerOf(conn net.Conn) string {
+	if conn == nil {
+		return ""
+	}
+	return conn.RemoteAddr().String()
+}
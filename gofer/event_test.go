@@ -0,0 +1,64 @@
+package gofer
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	events := NewEvents()
+	var got []Event
+	cancel := events.Subscribe(func(e Event) { got = append(got, e) })
+
+	events.Emit(Event{Type: EventConnected, Peer: "peer"})
+	cancel()
+	events.Emit(Event{Type: EventConnected, Peer: "peer"}) // 取消订阅了, 收不到
+
+	if len(got) != 1 || got[0].Peer != "peer" || got[0].Time.IsZero() {
+		t.Errorf("got %+v, want one event with Time set", got)
+	}
+}
+
+func TestErrorCode(t *testing.T) {
+	if code := ErrorCode(PacketAsErrorPacket(NewErrorPacket(ErrCodeNotFound, "x").Packet)); code != ErrCodeNotFound {
+		t.Errorf("ErrorCode(ErrorPacket) = %q, want %q", code, ErrCodeNotFound)
+	}
+	if code := ErrorCode(fmt.Errorf("wrapped: %w", NewErrorPacket(ErrCodeBadRequest, "x"))); code != ErrCodeBadRequest {
+		t.Errorf("ErrorCode(wrapped) = %q, want %q", code, ErrCodeBadRequest)
+	}
+	if code := ErrorCode(fmt.Errorf("other")); code != ErrCodeInternal {
+		t.Errorf("ErrorCode(other) = %q, want %q", code, ErrCodeInternal)
+	}
+}
+
+func TestRetryDialGivesUp(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	_ = listener.Close() // 连不上
+
+	var mu sync.Mutex
+	var types []string
+	cancel := DefaultEvents.Subscribe(func(e Event) {
+		if e.Peer == addr {
+			mu.Lock()
+			types = append(types, e.Type)
+			mu.Unlock()
+		}
+	})
+	defer cancel()
+
+	if err := RetryDialAndRunClientTLS(addr, NewReceiveClient(), time.Second, 2); err == nil {
+		t.Fatal("RetryDialAndRunClientTLS should give up")
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if got := fmt.Sprint(types); got != fmt.Sprint([]string{EventRetry, EventFailed}) {
+		t.Errorf("events = %v", types)
+	}
+}
@@ -0,0 +1,263 @@
+package gofer
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 远程列目录！！
+// 客户端发送 ListRequest (路径 + 分页), FileServer 回一个 ListResponse (一页目录项)。
+// 目录很大时客户端一页一页地请求, 直到 offset 追上 total。
+
+// ListRequest 是客户端请求列出导出目录下某个路径的 Packet
+//
+// ListRequest is Packet that:
+//  - Type: 11
+//  - Info: string, `path` relative to the export root
+//  - Data: offset (const 8 Byte), limit (const 4 Byte)
+type ListRequest struct {
+	*Packet
+	path   string // just a name, do not use this, call Getter/Setter instead
+	offset uint64 // just a name, do not use this, call Getter/Setter instead
+	limit  uint32 // just a name, do not use this, call Getter/Setter instead
+}
+
+const PacketTypeListRequest uint16 = 11
+
+// DefaultListPageSize 是默认的每页目录项数, 也是服务端允许的最大值
+var DefaultListPageSize uint32 = 256
+
+func NewListRequest(path string, offset uint64, limit uint32) *ListRequest {
+	r := &ListRequest{Packet: NewPacket(PacketTypeListRequest, make([]byte, 0), make([]byte, 12))}
+	r.SetPath(path)
+	r.SetOffset(offset)
+	r.SetLimit(limit)
+	return r
+}
+
+// PacketAsListRequest convert packet to ListRequest
+// Notice: only for packets whose Type==PacketTypeListRequest
+func PacketAsListRequest(packet *Packet) *ListRequest {
+	return &ListRequest{Packet: packet}
+}
+
+func (r ListRequest) Path() string {
+	return string(r.Info)
+}
+
+func (r *ListRequest) SetPath(path string) {
+	r.Info = []byte(path)
+	r.InfoSize = uint32(len(r.Info))
+}
+
+func (r ListRequest) Offset() uint64 {
+	if len(r.Data) < 12 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(r.Data[:8])
+}
+
+func (r *ListRequest) SetOffset(offset uint64) {
+	r.ensureData()
+	binary.BigEndian.PutUint64(r.Data[:8], offset)
+}
+
+func (r ListRequest) Limit() uint32 {
+	if len(r.Data) < 12 {
+		return 0
+	}
+	return binary.BigEndian.Uint32(r.Data[8:12])
+}
+
+func (r *ListRequest) SetLimit(limit uint32) {
+	r.ensureData()
+	binary.BigEndian.PutUint32(r.Data[8:12], limit)
+}
+
+func (r *ListRequest) ensureData() {
+	if len(r.Data) < 12 {
+		r.Data = make([]byte, 12)
+		r.DataSize = 12
+	}
+}
+
+// ListEntry 是一个目录项
+type ListEntry struct {
+	Name    string    `json:"name"`
+	Type    string    `json:"type"` // "file", "dir", "symlink" or "other"
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mtime"`
+	Hash    string    `json:"hash,omitempty"` // md5, 只有服务端算过 (缓存着) 才有
+}
+
+// 目录项类型
+const (
+	ListEntryFile    = "file"
+	ListEntryDir     = "dir"
+	ListEntrySymlink = "symlink"
+	ListEntryOther   = "other"
+)
+
+// listEntryFromFileInfo 从 os.FileInfo 构造 ListEntry, fullPath 用来查 hash 缓存
+func listEntryFromFileInfo(info os.FileInfo, fullPath string) ListEntry {
+	e := ListEntry{
+		Name:    info.Name(),
+		Size:    info.Size(),
+		ModTime: info.ModTime(),
+	}
+	switch mode := info.Mode(); {
+	case mode.IsRegular():
+		e.Type = ListEntryFile
+		if hash, ok := CachedFileHash(fullPath, info); ok {
+			e.Hash = FileIDString(hash)
+		}
+	case mode.IsDir():
+		e.Type = ListEntryDir
+	case mode&os.ModeSymlink != 0:
+		e.Type = ListEntrySymlink
+	default:
+		e.Type = ListEntryOther
+	}
+	return e
+}
+
+// ListResponse 是 FileServer 回复的一页目录项
+//
+// ListResponse is Packet that:
+//  - Type: 12
+//  - Info: string, `path`
+//  - Data: json: {offset, total, entries}
+type ListResponse struct {
+	*Packet
+	path string // just a name, do not use this, call Getter/Setter instead
+
+	ListPage
+}
+
+// ListPage 是 ListResponse 中 Data 部分的内容
+type ListPage struct {
+	Offset  uint64      `json:"offset"`  // 本页第一项的序号
+	Total   uint64      `json:"total"`   // 目录项总数
+	Entries []ListEntry `json:"entries"` // 本页的目录项
+}
+
+const PacketTypeListResponse uint16 = 12
+
+func NewListResponse(path string, page ListPage) *ListResponse {
+	r := &ListResponse{
+		Packet:   NewPacket(PacketTypeListResponse, []byte(path), make([]byte, 0)),
+		ListPage: page,
+	}
+	r.Data, _ = json.Marshal(r.ListPage)
+	r.DataSize = uint32(len(r.Data))
+	return r
+}
+
+// PacketAsListResponse convert packet to ListResponse
+// Notice: only for packets whose Type==PacketTypeListResponse
+func PacketAsListResponse(packet *Packet) (*ListResponse, error) {
+	r := &ListResponse{Packet: packet}
+	if err := json.Unmarshal(packet.Data, &r.ListPage); err != nil {
+		return nil, fmt.Errorf("bad list response: %v", err)
+	}
+	return r, nil
+}
+
+func (r ListResponse) Path() string {
+	return string(r.Info)
+}
+
+// listDir 列出 root 下 rel 的一页目录项。如果 rel 是文件, 就只有它自己一项。
+func listDir(root string, rel string, offset uint64, limit uint32) (ListPage, error) {
+	if limit == 0 || limit > DefaultListPageSize {
+		limit = DefaultListPageSize
+	}
+
+	full, err := resolveInRoot(root, rel)
+	if err != nil {
+		return ListPage{}, err
+	}
+	info, err := os.Stat(full)
+	if err != nil {
+		return ListPage{}, err
+	}
+	if !info.IsDir() {
+		return ListPage{Total: 1, Entries: []ListEntry{listEntryFromFileInfo(info, full)}}, nil
+	}
+
+	infos, err := ioutil.ReadDir(full) // sorted by name
+	if err != nil {
+		return ListPage{}, fmt.Errorf("%s: %v", rel, err)
+	}
+
+	page := ListPage{Offset: offset, Total: uint64(len(infos)), Entries: []ListEntry{}}
+	for i := offset; i < page.Total && i < offset+uint64(limit); i++ {
+		page.Entries = append(page.Entries, listEntryFromFileInfo(infos[i], filepath.Join(full, infos[i].Name())))
+	}
+	return page, nil
+}
+
+// ListClient 向 FileServer 请求列出 Path 下的所有目录项 (自动翻页)
+//
+// 完成后结果在 Entries 里, 出错的话 Err 不为 nil。
+type ListClient struct {
+	Path     string
+	PageSize uint32
+
+	Entries []ListEntry
+	Err     error
+}
+
+func NewListClient(path string) *ListClient {
+	return &ListClient{Path: path, PageSize: DefaultListPageSize}
+}
+
+func (l *ListClient) Do(conn net.Conn) chan bool {
+	done := make(chan bool, 1)
+
+	go func() {
+		l.Entries, l.Err = l.list(conn)
+		done <- l.Err == nil
+	}()
+
+	return done
+}
+
+// list 一页一页地请求, 直到取完所有目录项
+func (l *ListClient) list(conn net.Conn) ([]ListEntry, error) {
+	var entries []ListEntry
+	for offset := uint64(0); ; {
+		if _, err := NewListRequest(l.Path, offset, l.PageSize).WriteTo(conn); err != nil {
+			return entries, err
+		}
+
+		packet, err := PacketFromReader(conn)
+		if err != nil {
+			return entries, err
+		}
+		switch packet.Type {
+		case PacketTypeError:
+			return entries, PacketAsErrorPacket(packet)
+		case PacketTypeListResponse:
+		default:
+			return entries, fmt.Errorf("unexpected packet: %v", packet.Header)
+		}
+
+		resp, err := PacketAsListResponse(packet)
+		if err != nil {
+			return entries, err
+		}
+		entries = append(entries, resp.Entries...)
+
+		offset = resp.Offset + uint64(len(resp.Entries))
+		if offset >= resp.Total || len(resp.Entries) == 0 {
+			return entries, nil
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package gofer
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// 拉取模式！！
+// 之前都是发送端推 (push) 什么, 接收端就收什么。
+// 拉取模式下, 服务端以只读方式导出 (export) 一个目录, 客户端点名要哪个文件:
+//
+//  1. 客户端发送 GetRequest, 里面是相对于导出目录的路径
+//  2. FileServer 检查路径是否合法 (不能跑出导出目录)
+//  3. 小文件: FileServer 直接回一个 SimpleFile
+//     大文件: FileServer 用 BigFileSender 走 BigFileHeader / BigFileRequest 那一套
+//  4. 出错: FileServer 回一个 ErrorPacket
+//
+// 此外客户端还可以发送 ListRequest 浏览导出的目录, 见 file_list.go。
+//
+// 一个连接上可以连续请求多次, FileServer 一直服务到客户端断开。
+
+// GetRequest 是客户端请求下载一个文件的 Packet
+//
+// GetRequest is Packet that:
+//  - Type: 9
+//  - Info: string, `path` relative to the export root
+//  - Data: (empty)
+type GetRequest struct {
+	*Packet
+	path string // just a name, do not use this, call Getter/Setter instead
+}
+
+const PacketTypeGetRequest uint16 = 9
+
+func NewGetRequest(path string) *GetRequest {
+	return &GetRequest{
+		Packet: NewPacket(PacketTypeGetRequest, []byte(path), make([]byte, 0)),
+	}
+}
+
+// PacketAsGetRequest convert packet to GetRequest
+// Notice: only for packets whose Type==PacketTypeGetRequest
+func PacketAsGetRequest(packet *Packet) *GetRequest {
+	return &GetRequest{Packet: packet}
+}
+
+func (g GetRequest) Path() string {
+	return string(g.Info)
+}
+
+func (g *GetRequest) SetPath(path string) {
+	g.Info = []byte(path)
+	g.InfoSize = uint32(len(g.Info))
+}
+
+// FileServer 以只读方式导出目录 Root, 实现 Server 接口
+type FileServer struct {
+	Root              string // 导出的目录
+	SimpleFileMaxSize int64  // 不超过这个大小的文件用 SimpleFile 发, 否则用 BigFile
+
+	bigFileSender *BigFileSender
+}
+
+func NewFileServer(root string) *FileServer {
+	return &FileServer{
+		Root:              root,
+		SimpleFileMaxSize: int64(DefaultBlockSize),
+		bigFileSender:     NewBigFileSender(),
+	}
+}
+
+// ServeConn 不断从 conn 读取请求并处理, 直到连接断开
+func (s *FileServer) ServeConn(conn net.Conn) {
+	defer conn.Close()
+	logInfo("FileServer: connect", fPeer(conn))
+
+	for {
+		packet, err := PacketFromReader(conn)
+		if err != nil {
+			if err != io.EOF {
+				logWarn("FileServer: read request failed", fPeer(conn), fErr(err))
+			}
+			return
+		}
+
+		switch packet.Type {
+		case PacketTypeGetRequest:
+			s.serveGet(conn, PacketAsGetRequest(packet).Path())
+		case PacketTypeListRequest:
+			req := PacketAsListRequest(packet)
+			s.serveList(conn, req.Path(), req.Offset(), req.Limit())
+		default:
+			logWarn("FileServer got an unexpected Packet", fPeer(conn), Field{"type", packet.Type})
+			_, _ = NewErrorPacket(ErrCodeBadRequest, "unexpected packet").WriteTo(conn)
+		}
+	}
+}
+
+// serveGet 处理 GetRequest: 发送请求的文件 rel
+func (s *FileServer) serveGet(conn net.Conn, rel string) {
+	filePath, err := s.resolve(rel)
+	if err != nil {
+		_, _ = NewErrorPacket(ErrCodeNotFound, err.Error()).WriteTo(conn)
+		return
+	}
+	info, err := os.Stat(filePath)
+	if err != nil || !info.Mode().IsRegular() {
+		_, _ = NewErrorPacket(ErrCodeNotFound, fmt.Sprintf("%s: not a regular file", rel)).WriteTo(conn)
+		return
+	}
+
+	logInfo("FileServer: get", fPeer(conn), Field{"path", rel})
+
+	if err := s.sendFile(conn, filePath, filepath.Base(filePath)); err != nil {
+		logWarn("FileServer: send failed", fPeer(conn), Field{"path", rel}, fErr(err))
+	}
+}
+
+// sendFile 把文件 filePath 发给对方, 让对方以 name 保存:
+// 小文件用 SimpleFile, 大文件用 BigFile
+func (s *FileServer) sendFile(conn net.Conn, filePath string, name string) error {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		_, _ = NewErrorPacket(ErrCodeNotFound, err.Error()).WriteTo(conn)
+		return err
+	}
+
+	if info.Size() <= s.SimpleFileMaxSize {
+		content, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			_, _ = NewErrorPacket(ErrCodeInternal, err.Error()).WriteTo(conn)
+			return err
+		}
+		_, err = NewPacket(PacketTypeSimpleFile, []byte(name), content).WriteTo(conn)
+		return err
+	}
+
+	fileID, err := s.bigFileSender.AppendFileAs(filePath, name)
+	if err != nil {
+		_, _ = NewErrorPacket(ErrCodeInternal, err.Error()).WriteTo(conn)
+		return err
+	}
+	return s.bigFileSender.SendFile(conn, fileID)
+}
+
+// serveList 处理 ListRequest: 回复 rel 的一页目录项
+func (s *FileServer) serveList(conn net.Conn, rel string, offset uint64, limit uint32) {
+	page, err := listDir(s.Root, rel, offset, limit)
+	if err != nil {
+		_, _ = NewErrorPacket(ErrCodeNotFound, err.Error()).WriteTo(conn)
+		return
+	}
+	_, _ = NewListResponse(rel, page).WriteTo(conn)
+}
+
+// resolve 把客户端给的相对路径转换为导出目录下的真实路径。
+// 不允许通过 ".." 或符号链接跑到导出目录外面去。
+func (s *FileServer) resolve(rel string) (string, error) {
+	return resolveInRoot(s.Root, rel)
+}
+
+// resolveInRoot 把相对路径 rel 转换为 root 下的真实路径, 不允许跑到 root 外面
+func resolveInRoot(root string, rel string) (string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", err
+	}
+
+	// 先当作以 root 为根的绝对路径 Clean 一下, 消掉所有 ".."
+	clean := filepath.Clean(string(filepath.Separator) + filepath.FromSlash(rel))
+	full := filepath.Join(realRoot, clean)
+
+	real, err := filepath.EvalSymlinks(full)
+	if err != nil {
+		return "", fmt.Errorf("%s: no such file or directory", rel)
+	}
+	if real != realRoot && !strings.HasPrefix(real, realRoot+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s: no such file or directory", rel)
+	}
+	return real, nil
+}
+
+// GetClient 向 FileServer 请求下载一个文件, 保存到当前目录
+type GetClient struct {
+	*Receiver
+	Path string
+}
+
+func NewGetClient(path string) *GetClient {
+	return &GetClient{Receiver: NewReceiver(), Path: path}
+}
+
+func (g GetClient) Do(conn net.Conn) chan bool {
+	logInfo("GetClient: get", fPeer(conn), Field{"path", g.Path})
+
+	if _, err := NewGetRequest(g.Path).WriteTo(conn); err != nil {
+		logWarn("GetClient: request failed", fPeer(conn), fErr(err))
+		done := make(chan bool, 1)
+		done <- false
+		return done
+	}
+	return g.ReceiveAndHandle(conn)
+}
@@ -0,0 +1,62 @@
+package gofer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveInRoot(t *testing.T) {
+	root, err := ioutil.TempDir("", "gofer-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	_ = os.MkdirAll(filepath.Join(root, "sub"), 0755)
+	_ = ioutil.WriteFile(filepath.Join(root, "sub", "a.txt"), []byte("a"), 0644)
+	_ = os.Symlink(os.TempDir(), filepath.Join(root, "escape"))
+
+	ok := []string{"sub/a.txt", "/sub/a.txt", "sub/../sub/a.txt", "../sub/a.txt", ""}
+	for _, rel := range ok {
+		if _, err := resolveInRoot(root, rel); err != nil {
+			t.Errorf("resolveInRoot(%q) failed: %v", rel, err)
+		}
+	}
+
+	bad := []string{"missing.txt", "escape", "escape/gofer-export"}
+	for _, rel := range bad {
+		if p, err := resolveInRoot(root, rel); err == nil {
+			t.Errorf("resolveInRoot(%q) = %q, want error", rel, p)
+		}
+	}
+}
+
+func TestListDirPaging(t *testing.T) {
+	root, err := ioutil.TempDir("", "gofer-export")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	for _, name := range []string{"a", "b", "c", "d", "e"} {
+		_ = ioutil.WriteFile(filepath.Join(root, name), []byte(name), 0644)
+	}
+
+	page, err := listDir(root, "", 3, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 5 || len(page.Entries) != 2 || page.Entries[0].Name != "d" {
+		t.Errorf("unexpected page: %+v", page)
+	}
+
+	page, err = listDir(root, "e", 0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 || page.Entries[0].Type != ListEntryFile || page.Entries[0].Size != 1 {
+		t.Errorf("unexpected page for a file: %+v", page)
+	}
+}
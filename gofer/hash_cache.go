@@ -0,0 +1,60 @@
+package gofer
+
+import (
+	"crypto/md5"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// 算大文件的 md5 很慢, 同一个文件被反复请求时 (比如文件服务器), 没必要每次都重新算。
+// fileHashCache 以 文件路径 为键缓存 md5, 文件的 大小 或 修改时间 变了就作废。
+
+type hashCacheEntry struct {
+	size    int64
+	modTime time.Time
+	hash    []byte
+}
+
+var fileHashCache sync.Map // {path: hashCacheEntry}
+
+// CachedFileHash 返回缓存中 path 的 md5, 如果没缓存或者文件已经变了, ok 为 false
+func CachedFileHash(path string, info os.FileInfo) (hash []byte, ok bool) {
+	v, ok := fileHashCache.Load(path)
+	if !ok {
+		return nil, false
+	}
+	e := v.(hashCacheEntry)
+	if e.size != info.Size() || !e.modTime.Equal(info.ModTime()) {
+		return nil, false
+	}
+	return e.hash, true
+}
+
+// FileHash 计算 (或从缓存中取得) 文件 path 的 md5 和文件大小
+func FileHash(path string) (hash []byte, size int64, err error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, 0, err
+	}
+	if hash, ok := CachedFileHash(path, info); ok {
+		return hash, info.Size(), nil
+	}
+
+	h := md5.New()
+	size, err = io.Copy(h, file)
+	if err != nil {
+		return nil, 0, err
+	}
+	hash = h.Sum(nil)
+
+	fileHashCache.Store(path, hashCacheEntry{size: info.Size(), modTime: info.ModTime(), hash: hash})
+	return hash, size, nil
+}
@@ -0,0 +1,501 @@
+package gofer
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HTTP 网关！！
+// 只有 curl 的机器也能往 Daemon 的收件箱传文件, 从导出目录下载文件 (gofer serve -http ADDR, -https ADDR):
+//
+//  - PUT /inbox/<name>: 请求体以 name 保存到收件箱。
+//    小文件走 SimpleFileReceiver; 大文件 (或者分段上传的) 一块一块地直接写进 BigFileReceiverWorker 的块文件, 最后 merge,
+//    和原生的 BigFile 接收用同一套东西, 所以断了以后已保存的块还在, 可以续传
+//  - GET /export/<path>: 下载导出的文件, 通过 BigFileSender 读块 (responseReq), 支持 Range, If-Range 和 HEAD
+//
+// 续传 (和 Google 的 resumable upload 差不多):
+//
+//  - 分段上传时带上 Content-Range: bytes START-END/TOTAL, START 要是块大小的整数倍
+//  - 还没传完时回 308, Range: bytes=0-N 是已经从头连续保存了的部分, 下一段从 N+1 开始;
+//    不知道传到哪儿了可以 PUT 一个空的请求体, 带上 Content-Range: bytes */TOTAL 问一下
+//  - 传完了回 201。分段上传要在请求头 X-Gofer-File-Md5 给出整个文件的 md5 (hex): 它就是续传用的 fileID, 最后还会校验。
+//    一次传完的可以不给, 不给的话这个上传只有这一个请求, 没传完就把块文件删掉
+//  - 文件最大 MaxHTTPUploadSize, 超过了回 413
+//
+// 权限和原生的客户端一样由 DaemonConfig 的 Clients 规则决定: PUT 要 push, GET 要 get;
+// 按 IP 匹配, HTTPS 的客户端给了证书的话也按证书的 CommonName 匹配。
+
+// HTTPGateway 是 Daemon 的 HTTP 网关
+type HTTPGateway struct {
+	Daemon *Daemon
+
+	mu      sync.Mutex
+	uploads map[string]*httpUpload // 正在进行的分段上传 {收件箱目录 + fileID: 上传}
+}
+
+func NewHTTPGateway(daemon *Daemon) *HTTPGateway {
+	return &HTTPGateway{Daemon: daemon, uploads: map[string]*httpUpload{}}
+}
+
+// MaxHTTPUploadSize 是 HTTP 网关上传一个文件最大多少字节, 新建上传前检查: 块文件的记录是按 TOTAL 一次分配的
+var MaxHTTPUploadSize uint64 = 64 * 1024 * 1024 * 1024
+
+// HTTPGatewayFileMd5Header 是上传时给出整个文件的 md5 (hex) 的请求头, 给了的话传完会校验
+const HTTPGatewayFileMd5Header = "X-Gofer-File-Md5"
+
+// ListenAndServe 监听 addr, 在后台提供 HTTP 网关, 关闭返回的 listener 就停止
+func (g *HTTPGateway) ListenAndServe(addr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	g.serve(listener, "http")
+	return listener, nil
+}
+
+// ListenAndServeTLS 和 ListenAndServe 一样, 不过用 HTTPS (gofer 自带的服务端证书)。
+// 客户端证书可以不给, 给了的话要能通过验证, 它的 CommonName 用来匹配 Clients 规则。
+func (g *HTTPGateway) ListenAndServeTLS(addr string) (net.Listener, error) {
+	config, err := serverTLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	config.ClientAuth = tls.VerifyClientCertIfGiven
+	listener, err := tls.Listen("tcp", addr, config)
+	if err != nil {
+		return nil, err
+	}
+	g.serve(listener, "https")
+	return listener, nil
+}
+
+func (g *HTTPGateway) serve(listener net.Listener, scheme string) {
+	go func() {
+		_ = newHTTPServer(g.Handler()).Serve(listener)
+	}()
+	logInfo("Serving HTTP gateway", Field{"addr", scheme + "://" + listener.Addr().String() + "/"})
+}
+
+// Handler 返回 HTTP 网关的 http.Handler
+func (g *HTTPGateway) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /inbox/{name...}", g.put)
+	mux.HandleFunc("GET /export/{path...}", g.get)
+	return mux
+}
+
+// rule 返回适用于发请求的客户端的规则, 没有 permission 权限的话返回错误
+func (g *HTTPGateway) rule(r *http.Request, permission string) (ClientRule, error) {
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	commonName := ""
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		commonName = r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	rule, err := g.Daemon.ruleFor(net.ParseIP(host), commonName)
+	if err != nil {
+		return rule, NewErrorPacket(ErrCodeForbidden, err.Error())
+	}
+	if !rule.allows(permission) {
+		return rule, NewErrorPacket(ErrCodeForbidden, "permission denied: "+permission)
+	}
+	return rule, nil
+}
+
+// get 处理 GET /export/<path>
+func (g *HTTPGateway) get(w http.ResponseWriter, r *http.Request) {
+	if _, err := g.rule(r, PermissionGet); err != nil {
+		writeWebError(w, err)
+		return
+	}
+	p := r.PathValue("path")
+	export, rel, ok := g.Daemon.export(p)
+	if !ok {
+		writeWebError(w, NewErrorPacket(ErrCodeNotFound, p+": no such file or directory"))
+		return
+	}
+	filePath, err := export.resolve(rel)
+	if err != nil {
+		writeWebError(w, NewErrorPacket(ErrCodeNotFound, err.Error()))
+		return
+	}
+	info, err := os.Stat(filePath)
+	if err != nil || !info.Mode().IsRegular() {
+		writeWebError(w, NewErrorPacket(ErrCodeNotFound, p+": not a regular file"))
+		return
+	}
+	fileID, err := export.bigFileSender.AppendFileAs(filePath, info.Name())
+	if err != nil {
+		writeWebError(w, err)
+		return
+	}
+
+	logInfo("HTTP gateway: get", Field{"client", r.RemoteAddr}, Field{"path", p}, Field{"range", r.Header.Get("Range")})
+	progress, id := progressOf(export.bigFileSender.Progress), FileIDString(fileID)+" "+r.RemoteAddr
+	progress.Start(ProgressSend, id, info.Name(), r.RemoteAddr, 0, uint64(info.Size()))
+	reader := &bigFileReader{sender: export.bigFileSender, fileID: fileID, size: info.Size(), progress: progress, id: id}
+
+	w.Header().Set("ETag", `"`+FileIDString(fileID)+`"`)
+	http.ServeContent(w, r, info.Name(), info.ModTime(), reader)
+	progress.Finish(ProgressSend, id, reader.err)
+}
+
+// bigFileReader 通过 BigFileSender 一块一块地读文件 (有缓存的话用缓存), 给 http.ServeContent 用。
+// io.Copy 每次只读 32 KiB, 所以读到的块留着, offset 出了这一块才读下一块。
+type bigFileReader struct {
+	sender *BigFileSender
+	fileID []byte
+	size   int64
+	offset int64
+
+	block      []byte // 当前的块
+	blockStart uint64 // 当前的块在文件里的位置
+
+	progress *Progress // 读了多少报告给它
+	id       string    // 在 progress 里的 ID
+	err      error     // 读块出的错
+}
+
+func (b *bigFileReader) Read(p []byte) (int, error) {
+	if b.offset >= b.size {
+		return 0, io.EOF
+	}
+	offset := uint64(b.offset)
+	if b.block == nil || offset < b.blockStart || offset >= b.blockStart+uint64(len(b.block)) {
+		start := offset / DefaultBlockSize * DefaultBlockSize
+		resp, err := b.sender.responseReq(NewBigFileRequest(b.fileID, start, DefaultBlockSize))
+		if err != nil {
+			b.err = err
+			return 0, err
+		}
+		b.block, b.blockStart = resp.FileContent(), start
+		if offset-start >= uint64(len(b.block)) { // 文件变短了
+			b.block = nil
+			b.err = io.ErrUnexpectedEOF
+			return 0, b.err
+		}
+	}
+	n := copy(p, b.block[offset-b.blockStart:])
+	b.offset += int64(n)
+	b.progress.Add(ProgressSend, b.id, uint64(n))
+	return n, nil
+}
+
+func (b *bigFileReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += b.offset
+	case io.SeekEnd:
+		offset += b.size
+	default:
+		return 0, fmt.Errorf("seek: bad whence %d", whence)
+	}
+	if offset < 0 {
+		return 0, fmt.Errorf("seek: negative position")
+	}
+	b.offset = offset
+	return offset, nil
+}
+
+// contentRange 是 PUT 的 Content-Range: bytes START-END/TOTAL, 或者问进度的 bytes */TOTAL
+type contentRange struct {
+	start, end, total uint64
+	query             bool // bytes */TOTAL
+}
+
+func parseContentRange(s string) (contentRange, error) {
+	var cr contentRange
+	spec := strings.TrimPrefix(s, "bytes ")
+	slash := strings.LastIndex(spec, "/")
+	if spec == s || slash < 0 {
+		return cr, fmt.Errorf("bad Content-Range %q", s)
+	}
+	total, err := strconv.ParseUint(spec[slash+1:], 10, 64)
+	if err != nil {
+		return cr, fmt.Errorf("bad Content-Range %q: need the total size", s)
+	}
+	cr.total = total
+	if spec[:slash] == "*" {
+		cr.query = true
+		return cr, nil
+	}
+	parts := strings.SplitN(spec[:slash], "-", 2)
+	if len(parts) != 2 {
+		return cr, fmt.Errorf("bad Content-Range %q", s)
+	}
+	cr.start, err = strconv.ParseUint(parts[0], 10, 64)
+	if err == nil {
+		cr.end, err = strconv.ParseUint(parts[1], 10, 64)
+	}
+	if err != nil || cr.start > cr.end || cr.end >= cr.total {
+		return cr, fmt.Errorf("bad Content-Range %q", s)
+	}
+	return cr, nil
+}
+
+// put 处理 PUT /inbox/<name>
+func (g *HTTPGateway) put(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if _, err := saveFilePath("", name); err != nil {
+		writeWebError(w, NewErrorPacket(ErrCodeBadRequest, err.Error()))
+		return
+	}
+	rule, err := g.rule(r, PermissionPush)
+	if err != nil {
+		writeWebError(w, err)
+		return
+	}
+	box, ok := g.Daemon.inboxes[rule.Inbox]
+	if !ok {
+		writeWebError(w, NewErrorPacket(ErrCodeForbidden, "no inbox"))
+		return
+	}
+
+	cr := contentRange{}
+	ranged := r.Header.Get("Content-Range") != ""
+	if ranged {
+		if cr, err = parseContentRange(r.Header.Get("Content-Range")); err != nil {
+			writeWebError(w, NewErrorPacket(ErrCodeBadRequest, err.Error()))
+			return
+		}
+	} else {
+		if r.ContentLength < 0 {
+			writeControlError(w, http.StatusLengthRequired, ErrCodeBadRequest, "need Content-Length or Content-Range")
+			return
+		}
+		cr = contentRange{end: uint64(r.ContentLength) - 1, total: uint64(r.ContentLength)}
+	}
+
+	if cr.total > MaxHTTPUploadSize {
+		writeControlError(w, http.StatusRequestEntityTooLarge, ErrCodeBadRequest,
+			fmt.Sprintf("file too large: max %d bytes", MaxHTTPUploadSize))
+		return
+	}
+
+	fileMd5 := r.Header.Get(HTTPGatewayFileMd5Header)
+	if ranged && fileMd5 == "" {
+		writeWebError(w, NewErrorPacket(ErrCodeBadRequest, "resumable uploads need "+HTTPGatewayFileMd5Header))
+		return
+	}
+	if !ranged && fileMd5 == "" && cr.total <= DefaultBlockSize { // 一次传完的小文件
+		g.putSimpleFile(w, r, box, name)
+		return
+	}
+
+	upload, err := g.upload(box, name, cr.total, fileMd5, r.RemoteAddr)
+	if err != nil {
+		writeWebError(w, err)
+		return
+	}
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+	if upload.done { // 刚好被别的请求传完了
+		writeControl(w, http.StatusCreated, map[string]interface{}{"name": name, "size": cr.total})
+		return
+	}
+	upload.expire.Reset(BigFileResumeTimeout)
+
+	if !cr.query && cr.total > 0 {
+		if cr.start%DefaultBlockSize != 0 {
+			upload.writeRange(w)
+			writeControlError(w, http.StatusRequestedRangeNotSatisfiable, ErrCodeBadRequest,
+				fmt.Sprintf("start must be a multiple of the block size %d", DefaultBlockSize))
+			return
+		}
+		if err := upload.write(io.LimitReader(r.Body, int64(cr.end-cr.start+1)), cr.start); err != nil {
+			logWarn("HTTP gateway: upload interrupted", Field{"client", r.RemoteAddr}, fName(name), fErr(err))
+		}
+	}
+
+	received := upload.received()
+	if received < cr.total && !upload.verify { // 没有 md5 的上传没法续传, 不留块文件
+		err := NewErrorPacket(ErrCodeBadRequest, name+": upload incomplete")
+		g.remove(upload, err)
+		_ = os.RemoveAll(upload.worker.saveDir)
+		writeWebError(w, err)
+		return
+	}
+	if received < cr.total {
+		upload.writeRange(w)
+		writeControl(w, http.StatusPermanentRedirect, map[string]interface{}{"name": name, "size": cr.total, "received": received})
+		return
+	}
+	if err := g.finish(upload); err != nil {
+		writeWebError(w, err)
+		return
+	}
+	logInfo("HTTP gateway: uploaded", Field{"client", r.RemoteAddr}, fName(name), Field{"size", cr.total})
+	writeControl(w, http.StatusCreated, map[string]interface{}{"name": name, "size": cr.total})
+}
+
+// putSimpleFile 把整个请求体作为 SimpleFile 交给收件箱的 SimpleFileReceiver
+func (g *HTTPGateway) putSimpleFile(w http.ResponseWriter, r *http.Request, box *inbox, name string) {
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeWebError(w, NewErrorPacket(ErrCodeBadRequest, err.Error()))
+		return
+	}
+	if !<-box.simpleFile.Receive(NewPacket(PacketTypeSimpleFile, []byte(name), content), nil) {
+		writeWebError(w, NewErrorPacket(ErrCodeIO, name+": failed to save"))
+		return
+	}
+	logInfo("HTTP gateway: uploaded", Field{"client", r.RemoteAddr}, fName(name), Field{"size", len(content)})
+	writeControl(w, http.StatusCreated, map[string]interface{}{"name": name, "size": len(content)})
+}
+
+// httpUpload 是一个 (可能分好几个请求的) 大文件上传, 块的保存和 merge 用 BigFileReceiverWorker 的
+type httpUpload struct {
+	mu     sync.Mutex // 同一个上传的请求一个一个来
+	key    string
+	worker *BigFileReceiverWorker
+	verify bool        // 客户端给了文件的 md5, 传完要校验; 没给的话只有一个请求, 不能续传
+	expire *time.Timer // 客户端很久没有再传, 就不等了 (已保存的块还在, 再来时接着传)
+	done   bool        // 传完了 (不管成功没有), 由 mu 保护
+}
+
+// upload 找到 (或者新建) 往收件箱 box 里传 name 的上传。
+// 有 fileMd5 的话它就是 fileID (和原生的 BigFile 一样); 否则每次都新建一个随机 fileID 的上传,
+// 免得混进以前同名同大小的上传留下的块。
+func (g *HTTPGateway) upload(box *inbox, name string, size uint64, fileMd5 string, peer string) (*httpUpload, error) {
+	fileID, err := hex.DecodeString(fileMd5)
+	if err != nil || (fileMd5 != "" && len(fileID) != md5.Size) {
+		return nil, NewErrorPacket(ErrCodeBadRequest, "bad "+HTTPGatewayFileMd5Header)
+	}
+	if fileMd5 == "" {
+		fileID = make([]byte, md5.Size)
+		if _, err := rand.Read(fileID); err != nil {
+			return nil, err
+		}
+	}
+	key := box.dir + "\x00" + FileIDString(fileID)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if upload, ok := g.uploads[key]; ok {
+		return upload, nil
+	}
+
+	worker := NewBigFileReceiverWorker(NewBigFileHeader(fileID, name, size))
+	worker.dir = box.dir
+	worker.progress = progressOf(box.bigFile.Progress)
+	worker.started = time.Now()
+	if err := worker.init(); err != nil {
+		return nil, err
+	}
+	upload := &httpUpload{key: key, worker: worker, verify: fileMd5 != ""}
+	upload.expire = time.AfterFunc(BigFileResumeTimeout, func() { g.abandon(upload) })
+	g.uploads[key] = upload
+
+	metricBigFileWorkers.Inc()
+	DefaultEvents.Emit(worker.event(EventHeader, nil, size))
+	worker.progress.Start(ProgressRecv, FileIDString(fileID), name, peer, worker.savedBytes(), size)
+	return upload, nil
+}
+
+// write 把从 start (块大小的整数倍) 开始的数据一块一块地保存下来, 最后不满一块的部分丢掉
+func (u *httpUpload) write(body io.Reader, start uint64) error {
+	w := u.worker
+	buf := make([]byte, w.blockSize)
+	for i := start / w.blockSize; i < w.numBlock; i++ {
+		n := w.blockSize
+		if i == w.numBlock-1 {
+			n = w.header.FileSize() - i*w.blockSize
+		}
+		if _, err := io.ReadFull(body, buf[:n]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF { // 这一段传完了
+				return nil
+			}
+			return err
+		}
+		if _, err := w.save(int(i), buf[:n]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// received 返回从头开始连续保存了多少字节
+func (u *httpUpload) received() uint64 {
+	w := u.worker
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i, saved := range w.savedBlock {
+		if !saved {
+			return uint64(i) * w.blockSize
+		}
+	}
+	return w.header.FileSize()
+}
+
+// writeRange 在回复里写上已经保存了的部分 (Range: bytes=0-N), 一点都没有的话不写
+func (u *httpUpload) writeRange(w http.ResponseWriter) {
+	if received := u.received(); received > 0 {
+		w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", received-1))
+	}
+}
+
+// errHTTPUploadAbandoned 是客户端很久没有接着传的上传的错误
+var errHTTPUploadAbandoned = errors.New("upload abandoned, saved blocks are kept for resuming")
+
+// finish 在所有块都保存了以后 merge (和校验), 然后结束上传 (调用时持有 upload.mu)
+func (g *HTTPGateway) finish(upload *httpUpload) error {
+	w := upload.worker
+	ok, err := false, w.merge()
+	if err == nil && upload.verify {
+		ok, err = w.checkFinalSum()
+		if err == nil && !ok {
+			metricHashFailures.Inc("file")
+			err = NewErrorPacket(ErrCodeChecksum, w.header.FileName()+": md5 mismatch, the file is broken")
+		}
+	}
+	switch {
+	case err == nil:
+		DefaultEvents.Emit(w.event(EventVerified, nil, w.header.FileSize()))
+	case ErrorCode(err) == ErrCodeChecksum:
+		emitFailed(w.event("", nil, 0), ErrCodeChecksum, err)
+	default:
+		logError("HTTP gateway: failed to save the file", fName(w.header.FileName()), fErr(err))
+		emitFailed(w.event("", nil, 0), ErrCodeIO, err)
+		err = NewErrorPacket(ErrCodeIO, err.Error())
+	}
+	g.remove(upload, err)
+	return err
+}
+
+// abandon 在客户端很久没有接着传时结束上传
+func (g *HTTPGateway) abandon(upload *httpUpload) {
+	upload.mu.Lock()
+	defer upload.mu.Unlock()
+	if upload.done {
+		return
+	}
+	logWarn("HTTP gateway: upload abandoned", fName(upload.worker.header.FileName()))
+	g.remove(upload, errHTTPUploadAbandoned)
+}
+
+// remove 结束上传 (调用时持有 upload.mu)
+func (g *HTTPGateway) remove(upload *httpUpload, err error) {
+	upload.done = true
+	upload.expire.Stop()
+	g.mu.Lock()
+	delete(g.uploads, upload.key)
+	g.mu.Unlock()
+
+	w := upload.worker
+	w.progress.Finish(ProgressRecv, FileIDString(w.header.FileID()), err)
+	metricBigFileWorkers.Dec()
+	observeTransfer(ProgressRecv, w.started, err)
+}
@@ -0,0 +1,117 @@
+package gofer
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestHTTPGateway(t *testing.T) {
+	daemon, big, inboxDir := newTestDaemon(t)
+	server := httptest.NewServer(NewHTTPGateway(daemon).Handler())
+	defer server.Close()
+
+	// Range 下载
+	req, _ := http.NewRequest("GET", server.URL+"/export/big.bin", nil)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", DefaultBlockSize-10, DefaultBlockSize+9))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if want := big[DefaultBlockSize-10 : DefaultBlockSize+10]; resp.StatusCode != http.StatusPartialContent || !bytes.Equal(got, want) {
+		t.Errorf("get range: status %d, got %q, want %q", resp.StatusCode, got, want)
+	}
+
+	// 分两段上传: 第一段多传了半块, 只保存整块的部分
+	sum := md5.Sum(big)
+	put := func(body []byte, contentRange string, fileMd5 string) *http.Response {
+		req, _ := http.NewRequest("PUT", server.URL+"/inbox/sub/up.bin", bytes.NewReader(body))
+		if contentRange != "" {
+			req.Header.Set("Content-Range", contentRange)
+		}
+		if fileMd5 != "" {
+			req.Header.Set(HTTPGatewayFileMd5Header, fileMd5)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+	fileMd5 := hex.EncodeToString(sum[:])
+	first := DefaultBlockSize + DefaultBlockSize/2
+	resp = put(big[:first], fmt.Sprintf("bytes 0-%d/%d", first-1, len(big)), fileMd5)
+	if want := fmt.Sprintf("bytes=0-%d", DefaultBlockSize-1); resp.StatusCode != http.StatusPermanentRedirect || resp.Header.Get("Range") != want {
+		t.Fatalf("put first part: status %d, Range %q, want 308 %q", resp.StatusCode, resp.Header.Get("Range"), want)
+	}
+	resp = put(big[DefaultBlockSize:], fmt.Sprintf("bytes %d-%d/%d", DefaultBlockSize, len(big)-1, len(big)), fileMd5)
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("put second part: status %d, want 201", resp.StatusCode)
+	}
+	if got, err := ioutil.ReadFile(filepath.Join(inboxDir, "sub", "up.bin")); err != nil || !bytes.Equal(got, big) {
+		t.Errorf("uploaded: %d bytes, %v, want %d bytes", len(got), err, len(big))
+	}
+
+	if resp := put(big[1:], fmt.Sprintf("bytes 1-%d/%d", len(big)-1, len(big)), fileMd5); resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("put unaligned: status %d, want 416", resp.StatusCode)
+	}
+
+	// 分段上传一定要给 md5, 不然不知道接着的是哪个上传
+	if resp := put(big[:DefaultBlockSize], fmt.Sprintf("bytes 0-%d/%d", DefaultBlockSize-1, len(big)), ""); resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("put part without md5: status %d, want 400", resp.StatusCode)
+	}
+	// 没有 md5 的大文件一次传完
+	if resp := put(big, "", ""); resp.StatusCode != http.StatusCreated {
+		t.Errorf("put without md5: status %d, want 201", resp.StatusCode)
+	}
+
+	maxSize := MaxHTTPUploadSize
+	MaxHTTPUploadSize = uint64(len(big)) - 1
+	if resp := put(nil, fmt.Sprintf("bytes */%d", len(big)), fileMd5); resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("put too large: status %d, want 413", resp.StatusCode)
+	}
+	MaxHTTPUploadSize = maxSize
+}
+
+func TestBigFileReaderKeepsBlock(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "big.bin")
+	content := bytes.Repeat([]byte("a"), int(DefaultBlockSize)+10)
+	if err := ioutil.WriteFile(file, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sender := NewBigFileSender()
+	fileID, err := sender.AppendFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := &bigFileReader{sender: sender, fileID: fileID, size: int64(len(content)), progress: NewProgress(), id: "test"}
+
+	buf := make([]byte, 32*1024)
+	if _, err := reader.Read(buf); err != nil {
+		t.Fatal(err)
+	}
+	// 文件改了, 当前块里剩下的部分还是读到的那一块, 没有再读盘
+	if err := ioutil.WriteFile(file, bytes.Repeat([]byte("b"), len(content)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := reader.Read(buf); err != nil || buf[n-1] != 'a' {
+		t.Errorf("read in the same block: %v, got %q, want the kept block", err, buf[n-1])
+	}
+	// 出了这一块才读下一块
+	if _, err := reader.Seek(int64(DefaultBlockSize), io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := reader.Read(buf); err != nil || n != 10 || buf[0] != 'b' {
+		t.Errorf("read the next block: %d, %v, got %q", n, err, buf[:n])
+	}
+}
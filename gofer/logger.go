@@ -0,0 +1,152 @@
+package gofer
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// 日志！！
+// gofer 包里的日志都交给 Logger, 不直接打印, 也不会因为出错退出整个程序 (出错的都返回 error):
+//
+//  - 日志有级别 (LogDebug, LogInfo, LogWarn, LogError) 和结构化的字段 (peer, fileID, block, error...)
+//  - 默认是 TextLogger, 把 LogInfo 及以上的日志一行一条写到 stderr, 例如:
+//    2006/01/02 15:04:05 INFO [BigFile] receive successfully name=a.iso fileID=3359fef3...
+//  - SetLogger 换成自己的 Logger (例如接到自己的日志系统), SetLogger(nil) 不打日志
+//
+// 每一块的收发是 LogDebug, 默认不打印。
+
+// LogLevel 是日志的级别
+type LogLevel int
+
+const (
+	LogDebug LogLevel = iota
+	LogInfo
+	LogWarn
+	LogError
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LogDebug:
+		return "DEBUG"
+	case LogInfo:
+		return "INFO"
+	case LogWarn:
+		return "WARN"
+	case LogError:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LEVEL(%d)", int(l))
+}
+
+// ParseLogLevel 解析日志级别的名字: debug, info, warn 或 error
+func ParseLogLevel(name string) (LogLevel, error) {
+	for l := LogDebug; l <= LogError; l++ {
+		if strings.EqualFold(name, l.String()) {
+			return l, nil
+		}
+	}
+	return LogInfo, fmt.Errorf("unknown log level %q: want debug, info, warn or error", name)
+}
+
+// Field 是日志里的一个字段
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger 打印 gofer 的日志, 会被多个 goroutine 同时调用
+type Logger interface {
+	Log(level LogLevel, msg string, fields ...Field)
+}
+
+// nopLogger 什么都不打印
+type nopLogger struct{}
+
+func (nopLogger) Log(LogLevel, string, ...Field) {}
+
+// loggerHolder 让 atomic.Value 里总是存同一种类型
+type loggerHolder struct{ Logger }
+
+// currentLogger 在变量初始化时就设好, 各文件的 init 里也能打日志
+var currentLogger = func() *atomic.Value {
+	v := &atomic.Value{}
+	v.Store(loggerHolder{NewTextLogger(os.Stderr, LogInfo)})
+	return v
+}()
+
+// SetLogger 设置 gofer 打日志用的 Logger, nil 表示不打日志
+func SetLogger(l Logger) {
+	if l == nil {
+		l = nopLogger{}
+	}
+	currentLogger.Store(loggerHolder{l})
+}
+
+// GetLogger 返回 gofer 现在打日志用的 Logger
+func GetLogger() Logger {
+	return currentLogger.Load().(loggerHolder).Logger
+}
+
+// TextLogger 把 Level 及以上的日志一行一条写到 w
+type TextLogger struct {
+	mu    sync.Mutex
+	w     io.Writer
+	level LogLevel
+}
+
+func NewTextLogger(w io.Writer, level LogLevel) *TextLogger {
+	return &TextLogger{w: w, level: level}
+}
+
+func (t *TextLogger) Log(level LogLevel, msg string, fields ...Field) {
+	if level < t.level {
+		return
+	}
+	var b strings.Builder
+	b.WriteString(time.Now().Format("2006/01/02 15:04:05 "))
+	b.WriteString(level.String())
+	b.WriteByte(' ')
+	b.WriteString(msg)
+	for _, f := range fields {
+		b.WriteByte(' ')
+		b.WriteString(f.Key)
+		b.WriteByte('=')
+		b.WriteString(formatLogValue(f.Value))
+	}
+	b.WriteByte('\n')
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	_, _ = io.WriteString(t.w, b.String())
+}
+
+// formatLogValue 把字段的值写成一个词, 有空格之类的就加上引号
+func formatLogValue(v interface{}) string {
+	s := fmt.Sprint(v)
+	if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func logDebug(msg string, fields ...Field) { GetLogger().Log(LogDebug, msg, fields...) }
+func logInfo(msg string, fields ...Field)  { GetLogger().Log(LogInfo, msg, fields...) }
+func logWarn(msg string, fields ...Field)  { GetLogger().Log(LogWarn, msg, fields...) }
+func logError(msg string, fields ...Field) { GetLogger().Log(LogError, msg, fields...) }
+
+// 常用的字段
+
+func fPeer(conn net.Conn) Field      { return Field{"peer", peerOf(conn)} }
+func fAddr(addr string) Field        { return Field{"peer", addr} }
+func fFileID(fileID []byte) Field    { return Field{"fileID", FileIDString(fileID)} }
+func fName(name string) Field        { return Field{"name", name} }
+func fBlock(block interface{}) Field { return Field{"block", block} }
+func fErr(err error) Field           { return Field{"error", err} }
@@ -0,0 +1,47 @@
+package gofer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTextLogger(t *testing.T) {
+	var b strings.Builder
+	l := NewTextLogger(&b, LogInfo)
+
+	l.Log(LogDebug, "hidden")
+	l.Log(LogWarn, "[BigFile] block failed", fName("a b.iso"), fBlock(3), fErr(errors.New("EOF")))
+
+	out := b.String()
+	if strings.Contains(out, "hidden") {
+		t.Errorf("debug log printed at info level: %q", out)
+	}
+	want := ` WARN [BigFile] block failed name="a b.iso" block=3 error=EOF` + "\n"
+	if !strings.HasSuffix(out, want) {
+		t.Errorf("got %q, want suffix %q", out, want)
+	}
+}
+
+func TestSetLogger(t *testing.T) {
+	defer SetLogger(GetLogger())
+
+	var b strings.Builder
+	SetLogger(NewTextLogger(&b, LogDebug))
+	logDebug("shown")
+	SetLogger(nil)
+	logError("silenced")
+
+	if out := b.String(); !strings.Contains(out, "shown") || strings.Contains(out, "silenced") {
+		t.Errorf("got %q, want only the log before SetLogger(nil)", out)
+	}
+}
+
+func TestParseLogLevel(t *testing.T) {
+	if l, err := ParseLogLevel("warn"); err != nil || l != LogWarn {
+		t.Errorf("ParseLogLevel(warn) = %v, %v", l, err)
+	}
+	if _, err := ParseLogLevel("loud"); err == nil {
+		t.Error("ParseLogLevel(loud) should fail")
+	}
+}
@@ -2,8 +2,10 @@ package gofer
 
 import (
 	"fmt"
-	"log"
 	"net"
+	"os"
+	"path/filepath"
+	"time"
 )
 
 // Message 表示一条即时通讯的消息
@@ -61,35 +63,71 @@ func NewMessageSender(msgInfo string, msgContent string) *MessageSender {
 	}
 }
 
-func (m MessageSender) Send(conn net.Conn) {
+func (m MessageSender) Send(conn net.Conn) error {
 	n, err := m.message.WriteTo(conn)
 
 	if err != nil {
-		fmt.Println("message send failed:", err)
+		logWarn("message send failed", fPeer(conn), fErr(err))
+		emitFailed(Event{Direction: ProgressSend, Peer: peerOf(conn)}, ErrCodeNetwork, err)
 	} else {
-		fmt.Println("message sent successfully: length =", n)
+		logInfo("message sent successfully", fPeer(conn), Field{"length", n})
+		DefaultEvents.Emit(Event{Type: EventMessage, Direction: ProgressSend, Peer: peerOf(conn),
+			Info: m.message.GetInfo(), Message: m.message.GetContent()})
 	}
+	return err
 }
 
 // MessageReceiver 是接收一条消息并处理的东西
-type MessageReceiver struct{}
+type MessageReceiver struct {
+	Dir string // 如果设置了, 收到的消息还会追加到 {Dir}/messages.log
+}
 
 func NewMessageReceiver() *MessageReceiver {
 	return &MessageReceiver{}
 }
 
+// NewMessageReceiverIn 新建一个把消息记录到 {dir}/messages.log 的 MessageReceiver
+func NewMessageReceiverIn(dir string) *MessageReceiver {
+	return &MessageReceiver{Dir: dir}
+}
+
 func (m MessageReceiver) Receive(packet *Packet, conn net.Conn) chan bool {
+	done := make(chan bool, 1)
 	if packet.Type != PacketTypeMessage {
-		log.Fatal("MessageReceiver got a no message packet:", packet.Header)
+		logError("MessageReceiver got a no message packet", fPeer(conn), Field{"type", packet.Type})
+		done <- false
+		return done
 	}
 	msg := PacketAsMessage(packet)
-	fmt.Printf("[Message] %s: %s\n", msg.GetInfo(), msg.GetContent())
-
-	done := make(chan bool, 1)
+	logInfo("[Message] received", fPeer(conn), Field{"info", msg.GetInfo()}, Field{"content", msg.GetContent()})
+	DefaultEvents.Emit(Event{Type: EventMessage, Direction: ProgressRecv, Peer: peerOf(conn),
+		Info: msg.GetInfo(), Message: msg.GetContent()})
+
+	if m.Dir != "" {
+		if err := m.appendToLog(conn, msg); err != nil {
+			logError("[Message] save failed", fPeer(conn), fErr(err))
+			emitFailed(Event{Direction: ProgressRecv, Peer: peerOf(conn)}, ErrCodeIO, err)
+			done <- false
+			return done
+		}
+	}
 	done <- true
 	return done
 }
 
+// appendToLog 把消息追加到 {Dir}/messages.log
+func (m MessageReceiver) appendToLog(conn net.Conn, msg *Message) error {
+	f, err := os.OpenFile(filepath.Join(m.Dir, "messages.log"), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = fmt.Fprintf(f, "%s\t%s\t%s\t%s\n", time.Now().Format(time.RFC3339),
+		conn.RemoteAddr().String(), msg.GetInfo(), msg.GetContent())
+	return err
+}
+
 // 注册 MessageReceiver
 func init() {
 	DistributerInstance().Register(PacketTypeMessage, NewMessageReceiver())
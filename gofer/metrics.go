@@ -0,0 +1,288 @@
+package gofer
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 监控指标！！
+// 长期运行的服务 (gofer recv -s, serve, relay...) 用 Prometheus 的文本格式暴露监控指标, 不依赖 Prometheus 的客户端库:
+//
+//  - Counter, Gauge, Histogram 三种指标, 可以带 label
+//  - DefaultMetrics 里是 gofer 自己的指标 (gofer_xxx), 在 server.Serve, Distributer.Receive 和大文件的收发里统计
+//  - Metrics 是一个 http.Handler; ListenAndServeMetrics 在 http://ADDR/metrics 上提供 DefaultMetrics
+//
+// 嵌入 gofer 的程序也可以用 DefaultMetrics.NewCounter 之类的加上自己的指标。
+
+// DefaultMetrics 是 gofer 的指标
+var DefaultMetrics = NewMetrics()
+
+// gofer 的指标
+var (
+	metricConnectionsAccepted = DefaultMetrics.NewCounter("gofer_connections_accepted_total",
+		"Connections accepted by servers.")
+	metricConnectionsRejected = DefaultMetrics.NewCounter("gofer_connections_rejected_total",
+		"Connections failed to accept or rejected by servers.", "reason")
+	metricPacketsReceived = DefaultMetrics.NewCounter("gofer_packets_received_total",
+		"Packets received and distributed, by packet type.", "type")
+	metricBytesSent = DefaultMetrics.NewCounter("gofer_bytes_sent_total",
+		"Bytes of file packets sent, as on the wire.")
+	metricBytesReceived = DefaultMetrics.NewCounter("gofer_bytes_received_total",
+		"Bytes of packets received, as on the wire.")
+	metricBigFileWorkers = DefaultMetrics.NewGauge("gofer_bigfile_workers_active",
+		"Big files being received.")
+	metricBlocksRerequested = DefaultMetrics.NewCounter("gofer_bigfile_blocks_rerequested_total",
+		"Big file blocks requested again: from a faster connection, after a lost connection, or after a hash failure.")
+	metricHashFailures = DefaultMetrics.NewCounter("gofer_bigfile_hash_failures_total",
+		"Received blocks or whole big files whose hash did not match.", "kind")
+	metricTransferDuration = DefaultMetrics.NewHistogram("gofer_transfer_duration_seconds",
+		"Duration of big file transfers.", []float64{0.1, 0.5, 1, 5, 10, 30, 60, 300, 900, 3600},
+		"direction", "result")
+)
+
+// packetTypeNames 是 gofer_packets_received_total 的 type, 不在这里的 type 都记作 "unknown"
+var packetTypeNames = map[uint16]string{
+	PacketTypeMessage:          "message",
+	PacketTypeSimpleFile:       "simple_file",
+	PacketTypeBigFileHeader:    "bigfile_header",
+	PacketTypeBigFileRequest:   "bigfile_request",
+	PacketTypeBigFileResponse:  "bigfile_response",
+	PacketTypeRelayHello:       "relay_hello",
+	PacketTypeAnnouncement:     "announcement",
+	PacketTypeGetRequest:       "get_request",
+	PacketTypeError:            "error",
+	PacketTypeListRequest:      "list_request",
+	PacketTypeListResponse:     "list_response",
+	PacketTypeDeltaSignature:   "delta_signature",
+	PacketTypeDeltaInstruction: "delta_instruction",
+	PacketTypeManifestRequest:  "manifest_request",
+	PacketTypeManifestResponse: "manifest_response",
+	PacketTypeSyncOp:           "sync_op",
+	PacketTypePeerList:         "peer_list",
+	PacketTypeBlockBitmap:      "block_bitmap",
+	PacketTypeBlockHashes:      "block_hashes",
+}
+
+func packetTypeName(typ uint16) string {
+	if name, ok := packetTypeNames[typ]; ok {
+		return name
+	}
+	return "unknown" // type 是对方说了算的, 不认识的都算一个, 不然 label 的取值可以无限多
+}
+
+// wireSize 返回 packet 在线上的大小
+func wireSize(packet *Packet) int {
+	return 12 + int(packet.InfoSize) + int(packet.WireDataSize())
+}
+
+// observeTransfer 记下一个传输用了多久
+func observeTransfer(direction string, started time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "failed"
+	}
+	metricTransferDuration.Observe(time.Since(started).Seconds(), direction, result)
+}
+
+// ListenAndServeMetrics 监听 addr, 在后台用 HTTP 提供 /metrics, 关闭返回的 listener 就停止
+func ListenAndServeMetrics(addr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", DefaultMetrics)
+	go func() {
+		_ = http.Serve(listener, mux)
+	}()
+	logInfo("Serving metrics", Field{"addr", "http://" + listener.Addr().String() + "/metrics"})
+	return listener, nil
+}
+
+// Metrics 是一组指标
+type Metrics struct {
+	mu      sync.Mutex
+	metrics []*metricVec
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{}
+}
+
+// WriteText 把所有指标按 Prometheus 的文本格式写到 w
+func (m *Metrics) WriteText(w io.Writer) error {
+	m.mu.Lock()
+	metrics := append([]*metricVec(nil), m.metrics...)
+	m.mu.Unlock()
+	sort.Slice(metrics, func(i, j int) bool { return metrics[i].name < metrics[j].name })
+
+	var b strings.Builder
+	for _, v := range metrics {
+		v.writeText(&b)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// ServeHTTP 让 Metrics 可以直接作为 /metrics 的 handler
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = m.WriteText(w)
+}
+
+func (m *Metrics) add(name, help, typ string, buckets []float64, labels []string) *metricVec {
+	v := &metricVec{name: name, help: help, typ: typ, buckets: buckets, labels: labels, series: map[string]*series{}}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.metrics = append(m.metrics, v)
+	return v
+}
+
+// NewCounter 登记一个只增不减的指标, labels 是 label 的名字
+func (m *Metrics) NewCounter(name, help string, labels ...string) *Counter {
+	return &Counter{m.add(name, help, "counter", nil, labels)}
+}
+
+// NewGauge 登记一个可增可减的指标
+func (m *Metrics) NewGauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{m.add(name, help, "gauge", nil, labels)}
+}
+
+// NewHistogram 登记一个直方图, buckets 是从小到大的上界 (不含 +Inf)
+func (m *Metrics) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return &Histogram{m.add(name, help, "histogram", buckets, labels)}
+}
+
+// Counter 只增不减。各方法的 labelValues 和登记时的 labels 一一对应。
+type Counter struct{ *metricVec }
+
+func (c *Counter) Inc(labelValues ...string) { c.Add(1, labelValues...) }
+
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	c.update(labelValues, func(s *series) { s.value += delta })
+}
+
+// Gauge 可增可减
+type Gauge struct{ *metricVec }
+
+func (g *Gauge) Inc(labelValues ...string) { g.Add(1, labelValues...) }
+func (g *Gauge) Dec(labelValues ...string) { g.Add(-1, labelValues...) }
+
+func (g *Gauge) Add(delta float64, labelValues ...string) {
+	g.update(labelValues, func(s *series) { s.value += delta })
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.update(labelValues, func(s *series) { s.value = value })
+}
+
+// Histogram 统计观测值落在各个 bucket 里的个数, 以及总和
+type Histogram struct{ *metricVec }
+
+func (h *Histogram) Observe(value float64, labelValues ...string) {
+	h.update(labelValues, func(s *series) {
+		for i, le := range h.buckets {
+			if value <= le {
+				s.counts[i]++
+			}
+		}
+		s.sum += value
+		s.count++
+	})
+}
+
+// metricVec 是一个指标的所有 label 组合
+type metricVec struct {
+	name, help, typ string
+	buckets         []float64
+	labels          []string
+
+	mu     sync.Mutex
+	series map[string]*series // {label 的值用 \xff 连起来: series}
+}
+
+// series 是一组 label 的值对应的数据
+type series struct {
+	labelValues []string
+	value       float64  // counter, gauge
+	counts      []uint64 // histogram: 每个 bucket 累计的个数
+	sum         float64
+	count       uint64
+}
+
+func (v *metricVec) update(labelValues []string, f func(s *series)) {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s: want %d label values, got %d", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string(nil), labelValues...), counts: make([]uint64, len(v.buckets))}
+		v.series[key] = s
+	}
+	f(s)
+}
+
+func (v *metricVec) writeText(b *strings.Builder) {
+	_, _ = fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", v.name, v.help, v.name, v.typ)
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	keys := make([]string, 0, len(v.series))
+	for k := range v.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	if len(keys) == 0 && len(v.labels) == 0 && v.typ != "histogram" { // 没有 label 的指标一开始就是 0
+		_, _ = fmt.Fprintf(b, "%s 0\n", v.name)
+	}
+
+	for _, k := range keys {
+		s := v.series[k]
+		if v.typ != "histogram" {
+			_, _ = fmt.Fprintf(b, "%s%s %s\n", v.name, formatLabels(v.labels, s.labelValues), formatMetricValue(s.value))
+			continue
+		}
+		bucket := func(le string) string { // 加上 le 的 label, 不要改到 v.labels 和 s.labelValues
+			names := append(append([]string(nil), v.labels...), "le")
+			return formatLabels(names, append(append([]string(nil), s.labelValues...), le))
+		}
+		for i, le := range v.buckets {
+			_, _ = fmt.Fprintf(b, "%s_bucket%s %d\n", v.name, bucket(formatMetricValue(le)), s.counts[i])
+		}
+		_, _ = fmt.Fprintf(b, "%s_bucket%s %d\n", v.name, bucket("+Inf"), s.count)
+		_, _ = fmt.Fprintf(b, "%s_sum%s %s\n", v.name, formatLabels(v.labels, s.labelValues), formatMetricValue(s.sum))
+		_, _ = fmt.Fprintf(b, "%s_count%s %d\n", v.name, formatLabels(v.labels, s.labelValues), s.count)
+	}
+}
+
+// formatLabels 返回 {name="value",...}, 没有 label 时返回 ""
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	for i, name := range names {
+		pairs[i] = name + `="` + escaper.Replace(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatMetricValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
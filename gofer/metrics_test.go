@@ -0,0 +1,56 @@
+package gofer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics()
+	packets := m.NewCounter("test_packets_total", "Packets.", "type")
+	workers := m.NewGauge("test_workers", "Workers.")
+	duration := m.NewHistogram("test_duration_seconds", "Duration.", []float64{1, 10}, "result")
+
+	packets.Inc("message")
+	packets.Add(2, `a"b`)
+	workers.Inc()
+	workers.Inc()
+	workers.Dec()
+	duration.Observe(0.5, "ok")
+	duration.Observe(5, "ok")
+
+	var b strings.Builder
+	if err := m.WriteText(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_duration_seconds Duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{result="ok",le="1"} 1
+test_duration_seconds_bucket{result="ok",le="10"} 2
+test_duration_seconds_bucket{result="ok",le="+Inf"} 2
+test_duration_seconds_sum{result="ok"} 5.5
+test_duration_seconds_count{result="ok"} 2
+# HELP test_packets_total Packets.
+# TYPE test_packets_total counter
+test_packets_total{type="a\"b"} 2
+test_packets_total{type="message"} 1
+# HELP test_workers Workers.
+# TYPE test_workers gauge
+test_workers 1
+`
+	if got := b.String(); got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestPacketTypeName(t *testing.T) {
+	if name := packetTypeName(PacketTypeMessage); name != "message" {
+		t.Errorf("packetTypeName(message) = %q", name)
+	}
+	// 对方随便发的 type 不能变成新的 label 值
+	for _, typ := range []uint16{0, 999, 65535} {
+		if name := packetTypeName(typ); name != "unknown" {
+			t.Errorf("packetTypeName(%d) = %q, want unknown", typ, name)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package gofer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 发件箱！！
+// 对方不在线的时候, DialAndRunClientTLS 只会返回错误。
+// gofer send -queue 把要发的东西放进本地的发件箱 (一个目录), 由 gofer outbox run 在后台投递:
+//
+//  - 投递失败就等一会儿再试, 等待时间指数增长 (最多 MaxBackoff), 试了 MaxAttempts 次还不行就放弃
+//  - 大文件的接收端会保留已经收到的块, 重新投递时只请求缺的块, 也就是从断点续传
+//  - 每一项的最终状态 (delivered / failed) 记在发件箱里, gofer outbox list 可以查看
+//
+// 发件箱目录里, 每一项是一个 {id}.json; 小文件的内容另存一份为 {id}.data, 投递的就是这一份。
+// 大文件太大了, 不复制, 投递前检查它没有被改过。
+//
+// 发完以后客户端关闭写的一半, 等对方处理完所有 Packet 关闭连接, 才算投递成功。
+
+// 发件箱里的东西的种类
+const (
+	OutboxMessage = "message"
+	OutboxFile    = "file"
+	OutboxBigFile = "bigfile"
+)
+
+// 发件箱里的东西的状态
+const (
+	OutboxPending   = "pending"   // 等待投递
+	OutboxDelivered = "delivered" // 投递成功了
+	OutboxFailed    = "failed"    // 放弃了
+)
+
+// OutboxItem 是发件箱里的一项
+type OutboxItem struct {
+	ID      string    `json:"id"`
+	Kind    string    `json:"kind"` // OutboxMessage, OutboxFile or OutboxBigFile
+	To      string    `json:"to"`   // 对方地址 HOST:PORT
+	Created time.Time `json:"created"`
+
+	Info    string `json:"info,omitempty"`    // OutboxMessage: 消息的 info
+	Message string `json:"message,omitempty"` // OutboxMessage: 消息内容
+	Path    string `json:"path,omitempty"`    // OutboxFile, OutboxBigFile: 文件的绝对路径
+	Name    string `json:"name,omitempty"`    // OutboxFile, OutboxBigFile: 让对方保存为的文件名
+	Size    int64  `json:"size,omitempty"`    // OutboxFile, OutboxBigFile: 文件大小
+	Hash    string `json:"hash,omitempty"`    // OutboxBigFile: 放进发件箱时文件的 md5
+
+	Status      string    `json:"status"` // OutboxPending, OutboxDelivered or OutboxFailed
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	NextAttempt time.Time `json:"next_attempt"`
+	Delivered   time.Time `json:"delivered"`
+}
+
+// Describe 返回这一项的简短描述, 例如文件名
+func (item OutboxItem) Describe() string {
+	if item.Kind == OutboxMessage {
+		return fmt.Sprintf("%s: %s", item.Info, item.Message)
+	}
+	return fmt.Sprintf("%s (%d Bytes)", item.Name, item.Size)
+}
+
+// Outbox 是本地的发件箱
+type Outbox struct {
+	Dir            string
+	MaxAttempts    int           // 最多尝试投递几次
+	MaxBackoff     time.Duration // 两次尝试之间最多等多久
+	ConfirmTimeout time.Duration // 发完以后最多等多久对方确认 (处理完所有 Packet 关闭连接)
+	PollInterval   time.Duration // Run 多久看一次有没有新放进来的东西
+}
+
+// DefaultOutboxDir 返回默认的发件箱目录: ~/.gofer/outbox
+func DefaultOutboxDir() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(".gofer", "outbox")
+	}
+	return filepath.Join(home, ".gofer", "outbox")
+}
+
+// OpenOutbox 打开 (必要时新建) 目录 dir 作为发件箱
+func OpenOutbox(dir string) (*Outbox, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Outbox{
+		Dir:            dir,
+		MaxAttempts:    50,
+		MaxBackoff:     time.Hour,
+		ConfirmTimeout: time.Minute,
+		PollInterval:   5 * time.Second,
+	}, nil
+}
+
+// EnqueueMessage 把一条消息放进发件箱, 发给 to
+func (o *Outbox) EnqueueMessage(to string, info string, message string) (*OutboxItem, error) {
+	item := o.newItem(OutboxMessage, to)
+	item.Info, item.Message = info, message
+	return item, o.save(item)
+}
+
+// EnqueueFile 把文件 filePath 放进发件箱, 发给 to。
+// 不超过 DefaultBlockSize 的文件用 SimpleFile 发, 内容复制一份到发件箱里; 否则用 BigFile 发。
+func (o *Outbox) EnqueueFile(to string, filePath string) (*OutboxItem, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s: not a regular file", filePath)
+	}
+
+	item := o.newItem(OutboxFile, to)
+	item.Path, item.Name, item.Size = absPath, filepath.Base(absPath), info.Size()
+
+	if info.Size() > int64(DefaultBlockSize) {
+		item.Kind = OutboxBigFile
+		hash, _, err := FileHash(absPath)
+		if err != nil {
+			return nil, err
+		}
+		item.Hash = FileIDString(hash)
+	} else {
+		content, err := ioutil.ReadFile(absPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(o.dataPath(item), content, 0600); err != nil {
+			return nil, err
+		}
+	}
+	return item, o.save(item)
+}
+
+func (o *Outbox) newItem(kind string, to string) *OutboxItem {
+	now := time.Now()
+	return &OutboxItem{
+		ID:          fmt.Sprintf("%x", now.UnixNano()),
+		Kind:        kind,
+		To:          to,
+		Created:     now,
+		Status:      OutboxPending,
+		NextAttempt: now,
+	}
+}
+
+func (o *Outbox) itemPath(item *OutboxItem) string {
+	return filepath.Join(o.Dir, item.ID+".json")
+}
+
+func (o *Outbox) dataPath(item *OutboxItem) string {
+	return filepath.Join(o.Dir, item.ID+".data")
+}
+
+// save 把 item 写到发件箱里 (先写临时文件再改名, 不会写坏, List 也不会读到一半)
+func (o *Outbox) save(item *OutboxItem) error {
+	data, err := json.MarshalIndent(item, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := o.itemPath(item) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, o.itemPath(item))
+}
+
+// List 返回发件箱里的所有东西, 按放进来的时间排序
+func (o *Outbox) List() ([]*OutboxItem, error) {
+	infos, err := ioutil.ReadDir(o.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []*OutboxItem
+	for _, info := range infos {
+		if !strings.HasSuffix(info.Name(), ".json") {
+			continue
+		}
+		data, err := ioutil.ReadFile(filepath.Join(o.Dir, info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		item := &OutboxItem{}
+		if err := json.Unmarshal(data, item); err != nil {
+			logWarn("Outbox: bad item", Field{"file", info.Name()}, fErr(err))
+			continue
+		}
+		items = append(items, item)
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Created.Before(items[j].Created) })
+	return items, nil
+}
+
+// Run 一直投递发件箱里的东西, 直到 stop 关闭
+func (o *Outbox) Run(stop <-chan struct{}) error {
+	for {
+		items, err := o.List()
+		if err != nil {
+			return err
+		}
+
+		wakeup := time.Now().Add(o.PollInterval)
+		for _, item := range items {
+			if item.Status != OutboxPending {
+				continue
+			}
+			if time.Now().Before(item.NextAttempt) {
+				if item.NextAttempt.Before(wakeup) {
+					wakeup = item.NextAttempt
+				}
+				continue
+			}
+			if err := o.attempt(item); err != nil {
+				return err
+			}
+			if item.Status == OutboxPending && item.NextAttempt.Before(wakeup) {
+				wakeup = item.NextAttempt
+			}
+		}
+
+		select {
+		case <-stop:
+			return nil
+		case <-time.After(time.Until(wakeup)):
+		}
+	}
+}
+
+// attempt 尝试投递一次 item, 然后记下结果。只有记录结果失败才返回错误。
+func (o *Outbox) attempt(item *OutboxItem) error {
+	item.Attempts++
+	logInfo("Outbox: deliver", Field{"id", item.ID}, Field{"attempt", item.Attempts},
+		Field{"kind", item.Kind}, Field{"item", item.Describe()}, fAddr(item.To))
+
+	err := o.deliver(item)
+	switch {
+	case err == nil:
+		logInfo("Outbox: delivered", Field{"id", item.ID})
+		item.Status, item.Delivered, item.LastError = OutboxDelivered, time.Now(), ""
+		_ = os.Remove(o.dataPath(item))
+	case isOutboxPermanent(err) || item.Attempts >= o.MaxAttempts:
+		logError("Outbox: failed, give up", Field{"id", item.ID}, fErr(err))
+		item.Status, item.LastError = OutboxFailed, err.Error()
+	default:
+		item.LastError = err.Error()
+		item.NextAttempt = time.Now().Add(o.backoff(item.Attempts))
+		logWarn("Outbox: failed, retry later", Field{"id", item.ID}, fErr(err),
+			Field{"retry", item.NextAttempt.Format("15:04:05")})
+	}
+	return o.save(item)
+}
+
+// backoff 返回第 attempts 次尝试失败后要等多久: 1s, 2s, 4s, ... 最多 MaxBackoff
+func (o *Outbox) backoff(attempts int) time.Duration {
+	if attempts > 30 {
+		return o.MaxBackoff
+	}
+	d := time.Second << uint(attempts-1)
+	if d > o.MaxBackoff || d <= 0 {
+		d = o.MaxBackoff
+	}
+	return d
+}
+
+// outboxPermanentError 是再试也没用的错误, 例如文件没了
+type outboxPermanentError struct {
+	error
+}
+
+func isOutboxPermanent(err error) bool {
+	_, ok := err.(outboxPermanentError)
+	return ok
+}
+
+// deliver 连接对方, 发送 item, 等待对方确认
+func (o *Outbox) deliver(item *OutboxItem) error {
+	sender, err := o.sender(item)
+	if err != nil {
+		return outboxPermanentError{err}
+	}
+
+	conn, err := DialTLS(item.To)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := sender.Send(conn); err != nil {
+		return err
+	}
+	if err := conn.CloseWrite(); err != nil {
+		return err
+	}
+	return waitPeerDone(conn, o.ConfirmTimeout)
+}
+
+// sender 构造发送 item 的 Sender
+func (o *Outbox) sender(item *OutboxItem) (Sender, error) {
+	switch item.Kind {
+	case OutboxMessage:
+		return NewMessageSender(item.Info, item.Message), nil
+	case OutboxFile:
+		content, err := ioutil.ReadFile(o.dataPath(item))
+		if err != nil {
+			return nil, err
+		}
+		f := &SimpleFile{Packet: NewPacket(PacketTypeSimpleFile, []byte(item.Name), content)}
+		return &SimpleFileSender{simpleFile: f}, nil
+	case OutboxBigFile:
+		hash, _, err := FileHash(item.Path)
+		if err != nil {
+			return nil, err
+		}
+		if FileIDString(hash) != item.Hash {
+			return nil, fmt.Errorf("%s: file changed since queued", item.Path)
+		}
+		s := NewBigFileSender()
+		if _, err := s.AppendFileAs(item.Path, item.Name); err != nil {
+			return nil, err
+		}
+		return s, nil
+	default:
+		return nil, fmt.Errorf("unknown kind %q", item.Kind)
+	}
+}
+
+// waitPeerDone 等对方处理完所有 Packet 关闭连接。
+// 对方回了 ErrorPacket 的话返回这个错误, BigFile 传输残留的 header 回传会被忽略。
+func waitPeerDone(conn net.Conn, timeout time.Duration) error {
+	_ = conn.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		packet, err := PacketFromReader(conn)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("not confirmed: %v", err)
+		}
+		if packet.Type == PacketTypeError {
+			return PacketAsErrorPacket(packet)
+		}
+	}
+}
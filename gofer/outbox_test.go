@@ -0,0 +1,78 @@
+package gofer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestOutboxEnqueue(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofer-outbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	outbox, err := OpenOutbox(filepath.Join(dir, "outbox"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "a.txt")
+	if err := ioutil.WriteFile(file, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := outbox.EnqueueMessage("localhost:2333", "info", "msg"); err != nil {
+		t.Fatal(err)
+	}
+	item, err := outbox.EnqueueFile("localhost:2333", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Kind != OutboxFile || item.Name != "a.txt" || item.Size != 5 {
+		t.Errorf("EnqueueFile: %+v", item)
+	}
+	// 小文件复制了一份, 原文件改了也不影响
+	if err := ioutil.WriteFile(file, []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	items, err := outbox.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(items) != 2 || items[0].Kind != OutboxMessage || items[1].ID != item.ID {
+		t.Fatalf("List: %+v", items)
+	}
+	if items[1].Status != OutboxPending {
+		t.Errorf("status = %s, want %s", items[1].Status, OutboxPending)
+	}
+
+	sender, err := outbox.sender(items[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(sender.(*SimpleFileSender).simpleFile.Packet.Data); got != "hello" {
+		t.Errorf("queued content = %q, want %q", got, "hello")
+	}
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	o := &Outbox{MaxBackoff: time.Minute}
+	for _, c := range []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{4, 8 * time.Second},
+		{7, time.Minute},
+		{100, time.Minute},
+	} {
+		if got := o.backoff(c.attempts); got != c.want {
+			t.Errorf("backoff(%d) = %v, want %v", c.attempts, got, c.want)
+		}
+	}
+}
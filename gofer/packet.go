@@ -12,11 +12,11 @@ import (
 //
 //  |      |                 Header                 |         Body        |
 //  | ---- | ---- - -------- - -------- - --------- | -------- - -------- |
-//  | PART | Type | InfoSize | DataSize | RESERVED* |   Info   |   Data   |
+//  | PART | Type | InfoSize | DataSize |  Flags*   |   Info   |   Data   |
 //  | ---- | ---- | -------- | -------- | --------- | -------- | -------- |
 //  | SIZE |  2B  |    4B    |    4B    |    2B     | InfoSize | DataSize |
 //
-//  * RESERVED: 保留字段, 暂时没用. 只是让 Header 对齐到 8/2 的整数倍。
+//  * Flags: 原来是保留字段, 只是让 Header 对齐到 8/2 的整数倍。现在用来标记压缩, 见 compress.go。
 //
 // Packet 主要由两部分数据组成: Header 和 Body:
 //
@@ -29,11 +29,14 @@ import (
 type Packet struct {
 	Header
 	Body
+
+	wire wireStat // 从 reader 读到时, 在线上的样子 (压缩过的话已经解压了), 见 compress.go
 }
 
 // Header 是 Packet 中固定长度 (20 Byte) 的描述区域:
 //  - Type 描述数据的类型, 例如 2 表示消息, 3 表示文件
 //  - InfoSize 和 DataSize, 描述 Info 和 Data 的长度 (in Bytes)
+//  - Flags 标记 Data 的压缩方式, 以及 (请求中) 能接受的压缩方式
 type Header struct {
 	// Type: 数据类型, 固定 2 Byte
 	Type uint16
@@ -41,6 +44,8 @@ type Header struct {
 	InfoSize uint32
 	// DataSize: 数据的大小, 固定 4 Byte
 	DataSize uint32
+	// Flags: 标志位, 固定 2 Byte
+	Flags uint16
 }
 
 // Body 是 Packet 中长度不确定的数据区域:
@@ -81,7 +86,8 @@ func (p *Packet) ToBytes() []byte {
 	// DataSize: [6, 10)
 	binary.BigEndian.PutUint32(buf[6:10], p.DataSize)
 
-	// RESERVED: [10, 12)
+	// Flags: [10, 12)
+	binary.BigEndian.PutUint16(buf[10:12], p.Flags)
 
 	// Info: [12, 12+p.InfoSize)
 	copy(buf[12:12+p.InfoSize], p.Info)
@@ -106,6 +112,7 @@ func (p *Packet) fillHeaderFromBytes(header []byte) error {
 	p.Type = binary.BigEndian.Uint16(header[:2])
 	p.InfoSize = binary.BigEndian.Uint32(header[2:6])
 	p.DataSize = binary.BigEndian.Uint32(header[6:10])
+	p.Flags = binary.BigEndian.Uint16(header[10:12])
 
 	return nil
 }
@@ -129,6 +136,10 @@ func PacketFromBytes(b []byte) (*Packet, error) {
 	p.Info = b[12 : 12+p.InfoSize]
 	p.Data = b[12+p.InfoSize : 12+p.InfoSize+p.DataSize]
 
+	if err := p.decompress(); err != nil {
+		return nil, err
+	}
+
 	return p, nil
 }
 
@@ -161,5 +172,10 @@ func PacketFromReader(reader io.Reader) (*Packet, error) {
 	}
 	p.Data = data
 
+	// 压缩过的 Data 解压回来, 上层不用管
+	if err := p.decompress(); err != nil {
+		return p, err
+	}
+
 	return p, nil
 }
@@ -0,0 +1,449 @@
+package gofer
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+// 接收端互相帮忙！！
+// 一个大文件要发给很多台机器时, 发送端的上行带宽是瓶颈。
+// gofer recv -share ADDRESS 让接收端一边下载, 一边把已经校验过的块分享给其他接收端:
+//
+//  1. 接收端收到 BigFileHeader 后, 给发送端发一个 PeerList, 里面只有自己的分享地址
+//  2. 发送端 (BroadcastServer) 回一个 BlockHashes: 每一块的 md5。
+//     接收端用它校验每一块, 不管是从谁那里收到的; 只分享校验过的块
+//  3. 发送端把其他分享着这个文件的接收端的地址 (PeerList) 发给每一个分享的接收端, 有新的加入就再发
+//  4. 接收端连接 PeerList 里的其他接收端的 ShareServer (走 TLS),
+//     像从发送端下载一样请求块 (BigFileRequest, 见 BigFileReceiverWorker.AttachPeer):
+//     对方有这一块就回 BigFileResponse, 没有就回 BlockBitmap 告诉它自己有哪些块
+//
+// 从其他接收端收到的块校验不通过的话, 丢掉这个块, 断开这个连接, 以后也不再连它。
+//
+// ⚠️ 注意：TLS 用的证书是编译进每一个 gofer 里的, 只加密, 认不出对方是谁: 任何 gofer 都能连上 ShareServer。
+// 所以 ShareServer 只分享发送端让分享的文件 (发送端回了 BlockHashes 的), 不会把收到的别的文件给出去。
+
+// MaxSharePeers 是发送端给每个接收端的 PeerList 里最多有几个其他接收端
+var MaxSharePeers = 8
+
+// peerBitmapInterval 是没有块可以从其他接收端下载时, 隔多久再问它有了哪些块
+const peerBitmapInterval = 2 * time.Second
+
+// errCorruptedBlock 是收到的块校验不通过
+var errCorruptedBlock = errors.New("corrupted block")
+
+// PeerList 是分享着一个大文件的接收端的地址列表
+//
+// PeerList is Packet that:
+//  - Type: 18
+//  - Info: fileID
+//  - Data: json: ["HOST:PORT", ...]
+//
+// 接收端发给发送端时, 列表里只有它自己的分享地址 (HOST 为空表示就是连接发送端用的地址)。
+type PeerList struct {
+	*Packet
+	fileID []byte // just a name, do not use this, call Getter/Setter instead
+
+	Addrs []string
+}
+
+const PacketTypePeerList uint16 = 18
+
+func NewPeerList(fileID []byte, addrs []string) *PeerList {
+	if addrs == nil {
+		addrs = []string{}
+	}
+	l := &PeerList{
+		Packet: NewPacket(PacketTypePeerList, fileID, make([]byte, 0)),
+		Addrs:  addrs,
+	}
+	l.Data, _ = json.Marshal(l.Addrs)
+	l.DataSize = uint32(len(l.Data))
+	return l
+}
+
+// PacketAsPeerList convert packet to PeerList
+// Notice: only for packets whose Type==PacketTypePeerList
+func PacketAsPeerList(packet *Packet) (*PeerList, error) {
+	l := &PeerList{Packet: packet}
+	if err := json.Unmarshal(packet.Data, &l.Addrs); err != nil {
+		return nil, fmt.Errorf("bad peer list: %v", err)
+	}
+	return l, nil
+}
+
+func (l PeerList) FileID() []byte {
+	return l.Info
+}
+
+// BlockBitmap 是一个接收端已经有 (而且校验过) 的块
+//
+// BlockBitmap is Packet that:
+//  - Type: 19
+//  - Info: fileID
+//  - Data: bitmap, 第 i 块对应第 i/8 个字节从高位数第 i%8 位; 请求对方的 BlockBitmap 时为空
+type BlockBitmap struct {
+	*Packet
+	fileID []byte // just a name, do not use this, call Getter/Setter instead
+	bitmap []byte // just a name, do not use this, call Getter/Setter instead
+}
+
+const PacketTypeBlockBitmap uint16 = 19
+
+func NewBlockBitmap(fileID []byte, blocks []bool) *BlockBitmap {
+	var bitmap []byte
+	if len(blocks) > 0 {
+		bitmap = make([]byte, (len(blocks)+7)/8)
+		for i, ok := range blocks {
+			if ok {
+				bitmap[i/8] |= 0x80 >> uint(i%8)
+			}
+		}
+	}
+	return &BlockBitmap{
+		Packet: NewPacket(PacketTypeBlockBitmap, fileID, bitmap),
+	}
+}
+
+// PacketAsBlockBitmap convert packet to BlockBitmap
+// Notice: only for packets whose Type==PacketTypeBlockBitmap
+func PacketAsBlockBitmap(packet *Packet) *BlockBitmap {
+	return &BlockBitmap{Packet: packet}
+}
+
+func (b BlockBitmap) FileID() []byte {
+	return b.Info
+}
+
+// Blocks 返回前 n 块有没有
+func (b BlockBitmap) Blocks(n int) []bool {
+	blocks := make([]bool, n)
+	for i := range blocks {
+		if i/8 < len(b.Data) {
+			blocks[i] = b.Data[i/8]&(0x80>>uint(i%8)) != 0
+		}
+	}
+	return blocks
+}
+
+// BlockHashes 是一个大文件每一块的 md5
+//
+// BlockHashes is Packet that:
+//  - Type: 20
+//  - Info: blockSize (const 8 Byte), fileID
+//  - Data: md5 of block 0, md5 of block 1, ... (16 Byte each)
+type BlockHashes struct {
+	*Packet
+	blockSize uint64 // just a name, do not use this, call Getter/Setter instead
+	fileID    []byte // just a name, do not use this, call Getter/Setter instead
+}
+
+const PacketTypeBlockHashes uint16 = 20
+
+func NewBlockHashes(fileID []byte, blockSize uint64, hashes []byte) *BlockHashes {
+	info := make([]byte, 8+len(fileID))
+	binary.BigEndian.PutUint64(info[:8], blockSize)
+	copy(info[8:], fileID)
+	return &BlockHashes{
+		Packet: NewPacket(PacketTypeBlockHashes, info, hashes),
+	}
+}
+
+// PacketAsBlockHashes convert packet to BlockHashes
+// Notice: only for packets whose Type==PacketTypeBlockHashes
+func PacketAsBlockHashes(packet *Packet) *BlockHashes {
+	return &BlockHashes{Packet: packet}
+}
+
+func (h BlockHashes) BlockSize() uint64 {
+	if len(h.Info) < 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(h.Info[:8])
+}
+
+func (h BlockHashes) FileID() []byte {
+	if len(h.Info) < 8 {
+		return nil
+	}
+	return h.Info[8:]
+}
+
+// NumBlock 返回有几块的 md5
+func (h BlockHashes) NumBlock() int {
+	return len(h.Data) / md5.Size
+}
+
+// Verify 检查第 i 块的内容是否正确
+func (h BlockHashes) Verify(i int, content []byte) bool {
+	if i < 0 || i >= h.NumBlock() {
+		return false
+	}
+	sum := md5.Sum(content)
+	return bytes.Equal(sum[:], h.Data[i*md5.Size:(i+1)*md5.Size])
+}
+
+// computeBlockHashes 计算文件 filePath 每 blockSize 一块的 md5, 首尾相接
+func computeBlockHashes(filePath string, blockSize uint64) ([]byte, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var hashes []byte
+	buf := make([]byte, blockSize)
+	for {
+		n, err := io.ReadFull(file, buf)
+		if n > 0 {
+			sum := md5.Sum(buf[:n])
+			hashes = append(hashes, sum[:]...)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return hashes, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// peerPacketFileID 返回分享相关的 Packet (PeerList, BlockBitmap, BlockHashes) 是关于哪个文件的, 别的 Packet 返回 nil
+func peerPacketFileID(packet *Packet) []byte {
+	switch packet.Type {
+	case PacketTypePeerList:
+		return PeerList{Packet: packet}.FileID()
+	case PacketTypeBlockBitmap:
+		return PacketAsBlockBitmap(packet).FileID()
+	case PacketTypeBlockHashes:
+		return PacketAsBlockHashes(packet).FileID()
+	}
+	return nil
+}
+
+// hasBlock 返回对方有没有第 i 块 (调用时持有 worker.mu)
+func (c *workerConn) hasBlock(i int) bool {
+	return c.has == nil || (i < len(c.has) && c.has[i])
+}
+
+// setHas 记下连接 c 的对方有哪些块, 退回请求了但对方没有的块
+func (w *BigFileReceiverWorker) setHas(c *workerConn, bitmap *BlockBitmap) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	c.has = bitmap.Blocks(int(w.numBlock))
+	for i := range c.pending {
+		if !c.has[i] {
+			delete(c.pending, i)
+			if w.inflight[i] == c {
+				delete(w.inflight, i)
+			}
+		}
+	}
+	w.changed.Broadcast()
+}
+
+// setHashes 记下每一块的 md5, 之后收到的块都要校验。
+// 之前就保存了的块 (包括断点续传留下的) 现在补上校验, 不对的删掉重新下载。
+func (w *BigFileReceiverWorker) setHashes(hashes *BlockHashes) {
+	if hashes.BlockSize() != w.blockSize || hashes.NumBlock() != int(w.numBlock) {
+		logWarn("[BigFileReceiverWorker] block hashes ignored", fFileID(w.header.FileID()),
+			Field{"blockSize", hashes.BlockSize()}, Field{"numBlock", hashes.NumBlock()},
+			Field{"wantBlockSize", w.blockSize}, Field{"wantNumBlock", w.numBlock})
+		return
+	}
+
+	w.saveMu.Lock()
+	defer w.saveMu.Unlock()
+
+	w.mu.Lock()
+	w.hashes = hashes
+	saved := append([]bool{}, w.savedBlock...)
+	w.mu.Unlock()
+
+	for i, ok := range saved {
+		if !ok {
+			continue
+		}
+		content, err := readBlock(w.BlockTmpFilePath(uint64(i)), 0, w.blockSize)
+		correct := err == nil && hashes.Verify(i, content)
+		if !correct {
+			logWarn("[BigFileReceiverWorker] saved block is corrupted, download again",
+				fFileID(w.header.FileID()), fBlock(i))
+			_ = os.Remove(w.BlockTmpFilePath(uint64(i)))
+		}
+		w.mu.Lock()
+		w.verified[i], w.savedBlock[i] = correct, correct
+		w.mu.Unlock()
+	}
+
+	w.mu.Lock()
+	w.changed.Broadcast()
+	w.mu.Unlock()
+}
+
+// addPeers 连接 addrs 里还没连过的其他接收端, 也从它们那里下载
+func (w *BigFileReceiverWorker) addPeers(addrs []string) {
+	for _, addr := range addrs {
+		w.mu.Lock()
+		dialed := w.peers[addr]
+		w.peers[addr] = true
+		w.mu.Unlock()
+		if dialed {
+			continue
+		}
+
+		go func(addr string) {
+			conn, err := DialTLS(addr)
+			if err != nil {
+				logWarn("[BigFileReceiverWorker] connect peer failed", fAddr(addr), fErr(err))
+				w.forgetPeer(addr)
+				return
+			}
+			defer conn.Close()
+
+			c := newWorkerConn(conn)
+			c.has = []bool{}
+			if done := w.attachConn(c); done != nil {
+				<-done
+			}
+			if c.err != errCorruptedBlock { // 给了坏块的就不再连了
+				w.forgetPeer(addr)
+			}
+		}(addr)
+	}
+}
+
+// forgetPeer 忘记连过 addr, 下次 PeerList 里还有它的话再连
+func (w *BigFileReceiverWorker) forgetPeer(addr string) {
+	w.mu.Lock()
+	delete(w.peers, addr)
+	w.mu.Unlock()
+}
+
+// sharedBlock 返回可以分享出去的第 i 块 (校验过的)
+func (w *BigFileReceiverWorker) sharedBlock(i int) ([]byte, bool) {
+	w.mu.Lock()
+	ok := i >= 0 && i < len(w.verified) && w.verified[i]
+	w.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	content, err := readBlock(w.BlockTmpFilePath(uint64(i)), 0, w.blockSize)
+	if err != nil {
+		return nil, false
+	}
+	return content, true
+}
+
+// sharing 检查发送端有没有让分享这个文件: 宣告了分享地址以后, 发送端会回每一块的 md5 (BlockHashes)
+func (w *BigFileReceiverWorker) sharing() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.hashes != nil
+}
+
+// verifiedBitmap 返回可以分享出去的块
+func (w *BigFileReceiverWorker) verifiedBitmap() *BlockBitmap {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return NewBlockBitmap(w.header.FileID(), w.verified)
+}
+
+// announceShare 告诉发送端自己在 r.ShareAddr 分享 fileID 这个文件的块 (没有设置 ShareAddr 就什么也不做)
+func (r *BigFileReceiver) announceShare(conn net.Conn, fileID []byte) {
+	if r.ShareAddr == "" {
+		return
+	}
+	if _, err := NewPeerList(fileID, []string{r.ShareAddr}).WriteTo(conn); err != nil {
+		logWarn("BigFileReceiver: announce share failed", fPeer(conn), fFileID(fileID), fErr(err))
+	}
+}
+
+// sharedBlock 返回 fileID 这个文件从 start 开始的一块, 正在收的文件只给校验过的块, 收完了的文件都给。
+// 只分享发送端让分享的文件。
+func (r *BigFileReceiver) sharedBlock(fileID []byte, start uint64, length uint64) ([]byte, bool) {
+	if worker, ok := r.workerMap.Load(FileIDString(fileID)); ok {
+		w := worker.(*BigFileReceiverWorker)
+		if !w.sharing() || start%w.blockSize != 0 || length != w.blockSize {
+			return nil, false
+		}
+		return w.sharedBlock(int(start / w.blockSize))
+	}
+	if filePath, ok := r.completed.Load(FileIDString(fileID)); ok {
+		content, err := readBlock(filePath.(string), start, length)
+		return content, err == nil && len(content) > 0
+	}
+	return nil, false
+}
+
+// blockBitmap 返回 fileID 这个文件可以分享的块
+func (r *BigFileReceiver) blockBitmap(fileID []byte) *BlockBitmap {
+	if worker, ok := r.workerMap.Load(FileIDString(fileID)); ok {
+		if w := worker.(*BigFileReceiverWorker); w.sharing() {
+			return w.verifiedBitmap()
+		}
+		return NewBlockBitmap(fileID, nil)
+	}
+	if filePath, ok := r.completed.Load(FileIDString(fileID)); ok {
+		if info, err := os.Stat(filePath.(string)); err == nil {
+			blocks := make([]bool, (uint64(info.Size())+DefaultBlockSize-1)/DefaultBlockSize)
+			for i := range blocks {
+				blocks[i] = true
+			}
+			return NewBlockBitmap(fileID, blocks)
+		}
+	}
+	return NewBlockBitmap(fileID, nil)
+}
+
+// ShareServer 把 Receiver 正在收 (和已经收完) 的大文件的块分享给其他接收端, 实现 Server 接口
+type ShareServer struct {
+	Receiver    *BigFileReceiver
+	Compression Compression // 对方能解的话, 用这种方式压缩块
+}
+
+func NewShareServer(receiver *BigFileReceiver) *ShareServer {
+	return &ShareServer{Receiver: receiver, Compression: DefaultCompression}
+}
+
+// ServeConn 回应其他接收端的 BigFileRequest 和 BlockBitmap 请求, 直到对方断开
+func (s *ShareServer) ServeConn(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := PacketFromReader(conn)
+		if err != nil {
+			return
+		}
+
+		var reply *Packet
+		switch packet.Type {
+		case PacketTypeBigFileRequest:
+			req := PacketAsBigFileRequest(packet)
+			if content, ok := s.Receiver.sharedBlock(req.FileID(), req.Start(), req.Length()); ok {
+				reply = NewBigFileResponse(req.FileID(), req.Start(), content).Packet
+				if req.AcceptsCompression(s.Compression) {
+					reply = reply.Compressed(s.Compression)
+				}
+			} else { // 没有这一块: 告诉对方我们有哪些
+				reply = s.Receiver.blockBitmap(req.FileID()).Packet
+			}
+		case PacketTypeBlockBitmap:
+			reply = s.Receiver.blockBitmap(PacketAsBlockBitmap(packet).FileID()).Packet
+		case PacketTypeBigFileHeader: // 对方收完了, 回传的 header
+			continue
+		default:
+			logWarn("ShareServer: unexpected packet", fPeer(conn), Field{"type", packet.Type})
+			return
+		}
+		if _, err := writePacketLimited(reply, conn, nil, nil); err != nil { // 分享也占上行带宽, 受 DefaultBandwidth 限制
+			return
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package gofer
+
+import (
+	"crypto/md5"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestBlockBitmap(t *testing.T) {
+	blocks := []bool{true, false, true, true, false, false, false, false, true, false}
+	b := PacketAsBlockBitmap(NewBlockBitmap([]byte("id"), blocks).Packet)
+	if got := b.Blocks(len(blocks)); !reflect.DeepEqual(got, blocks) {
+		t.Errorf("Blocks() = %v, want %v", got, blocks)
+	}
+	if string(b.FileID()) != "id" {
+		t.Errorf("FileID() = %q, want %q", b.FileID(), "id")
+	}
+	if len(NewBlockBitmap([]byte("id"), nil).Data) != 0 { // 请求
+		t.Error("bitmap request should have empty data")
+	}
+}
+
+func TestBlockHashes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofer-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filePath := filepath.Join(dir, "f")
+	if err := ioutil.WriteFile(filePath, []byte("aaaabbbbcc"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	hashes, err := computeBlockHashes(filePath, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := PacketAsBlockHashes(NewBlockHashes([]byte("id"), 4, hashes).Packet)
+	if h.BlockSize() != 4 || string(h.FileID()) != "id" || h.NumBlock() != 3 {
+		t.Fatalf("BlockSize() = %d, FileID() = %q, NumBlock() = %d", h.BlockSize(), h.FileID(), h.NumBlock())
+	}
+	if !h.Verify(1, []byte("bbbb")) || !h.Verify(2, []byte("cc")) {
+		t.Error("correct blocks should be verified")
+	}
+	if h.Verify(0, []byte("aaab")) || h.Verify(3, []byte("")) {
+		t.Error("corrupted or nonexistent blocks should not be verified")
+	}
+}
+
+func TestBigFileReceiverSharesOnlyToldFiles(t *testing.T) {
+	dir := t.TempDir()
+	content := []byte("aaaabbbb")
+	sum := md5.Sum(content)
+	r := NewBigFileReceiverIn(dir, &Distributer{})
+
+	w := NewBigFileReceiverWorker(NewBigFileHeader(sum[:], "f", uint64(len(content))))
+	w.dir, w.blockSize = dir, 4
+	if err := w.init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.saveBlock(0, content[:4]); err != nil {
+		t.Fatal(err)
+	}
+	w.savedBlock[0], w.verified[0] = true, true
+	r.workerMap.Store(FileIDString(sum[:]), w)
+
+	// 发送端没有让分享 (没给 BlockHashes) 的文件, 一块也不给
+	if _, ok := r.sharedBlock(sum[:], 0, 4); ok {
+		t.Error("should not share a file the sender did not ask to share")
+	}
+	if got := r.blockBitmap(sum[:]).Blocks(2); got[0] {
+		t.Errorf("bitmap = %v, want nothing shared", got)
+	}
+
+	w.hashes = PacketAsBlockHashes(NewBlockHashes(sum[:], 4, nil).Packet)
+	if got, ok := r.sharedBlock(sum[:], 0, 4); !ok || string(got) != "aaaa" {
+		t.Errorf("sharedBlock = %q, %v, want aaaa", got, ok)
+	}
+}
@@ -0,0 +1,120 @@
+package gofer
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// 内存连接！！
+// 进程内的程序 (例如网页界面 web.go) 要和 Daemon 说原生协议时, 用 bufferedPipe 得到一对连接,
+// 一头交给 Daemon.ServeConn, 另一头当作客户端用, 这样走的就是和网络上来的客户端一样的处理和权限检查。
+//
+// 和 net.Pipe 不同, 写不等对方读 (写进缓冲区就返回): BigFile 的两边会同时写请求和响应,
+// 用 net.Pipe 会互相等着对方读而卡死。读支持 deadline (BigFileReceiverWorker 要用)。
+
+// bufferedPipe 返回一对相连的内存连接, 第一个的 RemoteAddr 是 remote, 第二个的是 local
+func bufferedPipe(local, remote net.Addr) (net.Conn, net.Conn) {
+	a, b := newPipeBuffer(), newPipeBuffer()
+	return &pipeConn{r: a, w: b, local: local, remote: remote},
+		&pipeConn{r: b, w: a, local: remote, remote: local}
+}
+
+// pipeBuffer 是一个方向上的数据
+type pipeBuffer struct {
+	mu       sync.Mutex
+	changed  *sync.Cond // 有数据了, 关闭了, 或者 deadline 变了
+	buf      bytes.Buffer
+	closed   bool
+	deadline time.Time   // 读的 deadline
+	timer    *time.Timer // 到 deadline 时叫醒读的人
+}
+
+func newPipeBuffer() *pipeBuffer {
+	p := &pipeBuffer{}
+	p.changed = sync.NewCond(&p.mu)
+	return p
+}
+
+func (p *pipeBuffer) read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for {
+		switch {
+		case p.buf.Len() > 0:
+			return p.buf.Read(b)
+		case p.closed:
+			return 0, io.EOF
+		case !p.deadline.IsZero() && !time.Now().Before(p.deadline):
+			return 0, os.ErrDeadlineExceeded
+		}
+		p.changed.Wait()
+	}
+}
+
+func (p *pipeBuffer) write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return 0, io.ErrClosedPipe
+	}
+	p.changed.Broadcast()
+	return p.buf.Write(b)
+}
+
+func (p *pipeBuffer) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.closed = true
+	p.changed.Broadcast()
+}
+
+func (p *pipeBuffer) setDeadline(t time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.deadline = t
+	if p.timer != nil {
+		p.timer.Stop()
+		p.timer = nil
+	}
+	if !t.IsZero() {
+		p.timer = time.AfterFunc(time.Until(t), func() {
+			p.mu.Lock()
+			p.changed.Broadcast()
+			p.mu.Unlock()
+		})
+	}
+	p.changed.Broadcast()
+}
+
+// pipeConn 是 bufferedPipe 的一头, 实现 net.Conn
+type pipeConn struct {
+	r, w          *pipeBuffer
+	local, remote net.Addr
+}
+
+func (c *pipeConn) Read(b []byte) (int, error)  { return c.r.read(b) }
+func (c *pipeConn) Write(b []byte) (int, error) { return c.w.write(b) }
+
+// Close 关闭两个方向: 对方读完缓冲区里剩下的数据以后读到 EOF
+func (c *pipeConn) Close() error {
+	c.r.close()
+	c.w.close()
+	return nil
+}
+
+func (c *pipeConn) LocalAddr() net.Addr  { return c.local }
+func (c *pipeConn) RemoteAddr() net.Addr { return c.remote }
+
+func (c *pipeConn) SetDeadline(t time.Time) error { return c.SetReadDeadline(t) }
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.r.setDeadline(t)
+	return nil
+}
+
+// SetWriteDeadline 什么也不做: 写从来不会等
+func (c *pipeConn) SetWriteDeadline(time.Time) error { return nil }
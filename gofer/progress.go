@@ -0,0 +1,267 @@
+package gofer
+
+import (
+	"sync"
+	"time"
+)
+
+// 进度！！
+// BigFileReceiverWorker, BigFileSender, SimpleFileSender, SimpleFileReceiver 把每个传输的进度报告给 Progress
+// (默认是 DefaultProgress):
+//
+//  - 传输开始时一个 ProgressStart 事件, 之后每收到/发出一块一个 ProgressUpdate, 最后 ProgressDone 或 ProgressFailed
+//  - Subscribe 订阅这些事件; Files 和 Aggregate 随时查看每个传输和所有传输加起来的进度
+//
+// 一个传输由方向和 ID 标识: 接收是 fileID (SimpleFile 是文件名), 发送还要加上对方的地址 (同一个文件可以发给好几个人)。
+// 结束了的传输只保留最近的 ProgressHistory 个, 长时间运行的服务不会越攒越多。
+
+// 进度事件的种类
+const (
+	ProgressStart  = "start"
+	ProgressUpdate = "update"
+	ProgressDone   = "done"
+	ProgressFailed = "failed"
+)
+
+// 传输的方向
+const (
+	ProgressSend = "send"
+	ProgressRecv = "recv"
+)
+
+// progressRateInterval 是计算速度的采样间隔
+const progressRateInterval = time.Second
+
+// ProgressHistory 是 Progress 保留的结束了的传输的个数, 更早结束的丢掉
+var ProgressHistory = 100
+
+// DefaultProgress 是 Progress 为 nil 的发送者和接收者报告进度的地方
+var DefaultProgress = NewProgress()
+
+func progressOf(p *Progress) *Progress {
+	if p == nil {
+		return DefaultProgress
+	}
+	return p
+}
+
+// FileProgress 是一个传输 (或者所有传输加起来) 的进度
+type FileProgress struct {
+	Direction string    `json:"direction"` // ProgressSend or ProgressRecv
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Peer      string    `json:"peer,omitempty"`
+	Done      uint64    `json:"done"`  // 已经传了的字节数
+	Total     uint64    `json:"total"` // 总字节数
+	Rate      float64   `json:"rate"`  // 最近的速度, Bytes/s
+	Started   time.Time `json:"started"`
+	Finished  bool      `json:"finished"`
+	Err       string    `json:"error,omitempty"`
+
+	resumed     uint64    // 开始时已经有了的字节数 (断点续传), 不算进速度
+	sampleTime  time.Time // 上一次采样速度的时间
+	sampleBytes uint64    // 上一次采样时的 Done
+}
+
+// Percent 返回完成的百分比
+func (f FileProgress) Percent() float64 {
+	if f.Total == 0 {
+		if f.Finished {
+			return 100
+		}
+		return 0
+	}
+	return float64(f.Done) * 100 / float64(f.Total)
+}
+
+// ETA 返回按现在的速度还要多久传完, 不知道的话返回 -1
+func (f FileProgress) ETA() time.Duration {
+	if f.Finished || f.Done >= f.Total {
+		return 0
+	}
+	if f.Rate <= 0 {
+		return -1
+	}
+	return time.Duration(float64(f.Total-f.Done) / f.Rate * float64(time.Second))
+}
+
+// ProgressEvent 是一个进度事件
+type ProgressEvent struct {
+	Type string       `json:"type"` // ProgressStart, ProgressUpdate, ProgressDone or ProgressFailed
+	File FileProgress `json:"file"` // 事件发生后这个传输的进度
+}
+
+// Progress 记录所有传输的进度, 把进度事件发给订阅者
+type Progress struct {
+	mu        sync.Mutex
+	files     map[string]*FileProgress // {direction + " " + id: 进度}
+	order     []string                 // 开始的顺序
+	listeners map[int]func(ProgressEvent)
+	nextID    int
+}
+
+func NewProgress() *Progress {
+	return &Progress{
+		files:     map[string]*FileProgress{},
+		listeners: map[int]func(ProgressEvent){},
+	}
+}
+
+// Subscribe 订阅进度事件, 返回取消订阅的函数。
+// listener 在报告进度的 goroutine 里同步调用, 不要阻塞。
+func (p *Progress) Subscribe(listener func(ProgressEvent)) (cancel func()) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id := p.nextID
+	p.nextID++
+	p.listeners[id] = listener
+	return func() {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		delete(p.listeners, id)
+	}
+}
+
+// Files 返回每个传输的进度 (副本), 按开始的顺序
+func (p *Progress) Files() []FileProgress {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	files := make([]FileProgress, 0, len(p.order))
+	for _, key := range p.order {
+		files = append(files, *p.files[key])
+	}
+	return files
+}
+
+// Aggregate 返回所有还没结束的传输加起来的进度, 没有的话返回一个空的、Finished 的进度
+func (p *Progress) Aggregate() FileProgress {
+	agg := FileProgress{ID: "all", Finished: true}
+	for _, f := range p.Files() {
+		if f.Finished {
+			continue
+		}
+		agg.Done += f.Done
+		agg.Total += f.Total
+		agg.Rate += f.Rate
+		agg.Finished = false
+		if agg.Started.IsZero() || f.Started.Before(agg.Started) {
+			agg.Started = f.Started
+		}
+	}
+	return agg
+}
+
+// Start 报告一个传输开始了, 一共 total 字节, 已经有了 done 字节 (断点续传)。
+// 同一个传输再次 Start (例如重连后) 会重新开始计算。
+func (p *Progress) Start(direction, id, name, peer string, done, total uint64) {
+	now := time.Now()
+	f := &FileProgress{
+		Direction:   direction,
+		ID:          id,
+		Name:        name,
+		Peer:        peer,
+		Done:        done,
+		Total:       total,
+		Started:     now,
+		resumed:     done,
+		sampleTime:  now,
+		sampleBytes: done,
+	}
+
+	p.mu.Lock()
+	key := direction + " " + id
+	if _, ok := p.files[key]; !ok {
+		p.order = append(p.order, key)
+	}
+	p.files[key] = f
+	p.mu.Unlock()
+
+	p.emit(ProgressStart, *f)
+}
+
+// Add 报告一个传输又传了 n 字节
+func (p *Progress) Add(direction, id string, n uint64) {
+	p.mu.Lock()
+	f, ok := p.files[direction+" "+id]
+	if !ok || f.Finished {
+		p.mu.Unlock()
+		return
+	}
+	f.Done += n
+	if f.Done > f.Total { // 重传的块
+		f.Done = f.Total
+	}
+
+	now := time.Now()
+	if elapsed := now.Sub(f.sampleTime); elapsed >= progressRateInterval {
+		rate := float64(f.Done-f.sampleBytes) / elapsed.Seconds()
+		if f.Rate == 0 {
+			f.Rate = rate
+		} else {
+			f.Rate = 0.5*f.Rate + 0.5*rate
+		}
+		f.sampleTime, f.sampleBytes = now, f.Done
+	}
+	snapshot := *f
+	p.mu.Unlock()
+
+	p.emit(ProgressUpdate, snapshot)
+}
+
+// Finish 报告一个传输结束了, err 为 nil 表示成功
+func (p *Progress) Finish(direction, id string, err error) {
+	p.mu.Lock()
+	f, ok := p.files[direction+" "+id]
+	if !ok || f.Finished {
+		p.mu.Unlock()
+		return
+	}
+	f.Finished = true
+	typ := ProgressDone
+	if err != nil {
+		typ, f.Err = ProgressFailed, err.Error()
+	} else {
+		f.Done = f.Total
+	}
+	if seconds := time.Since(f.Started).Seconds(); seconds > 0 { // 结束了, 速度就是平均速度
+		f.Rate = float64(f.Done-f.resumed) / seconds
+	}
+	snapshot := *f
+	p.evict()
+	p.mu.Unlock()
+
+	p.emit(typ, snapshot)
+}
+
+// evict 丢掉最早的结束了的传输, 只留 ProgressHistory 个, 调用者需持有锁
+func (p *Progress) evict() {
+	finished := 0
+	for _, key := range p.order {
+		if p.files[key].Finished {
+			finished++
+		}
+	}
+	order := p.order[:0]
+	for _, key := range p.order {
+		if finished > ProgressHistory && p.files[key].Finished {
+			delete(p.files, key)
+			finished--
+			continue
+		}
+		order = append(order, key)
+	}
+	p.order = order
+}
+
+func (p *Progress) emit(typ string, f FileProgress) {
+	p.mu.Lock()
+	listeners := make([]func(ProgressEvent), 0, len(p.listeners))
+	for _, l := range p.listeners {
+		listeners = append(listeners, l)
+	}
+	p.mu.Unlock()
+
+	for _, l := range listeners {
+		l(ProgressEvent{Type: typ, File: f})
+	}
+}
@@ -0,0 +1,72 @@
+package gofer
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestProgress(t *testing.T) {
+	p := NewProgress()
+	var events []ProgressEvent
+	cancel := p.Subscribe(func(e ProgressEvent) { events = append(events, e) })
+	defer cancel()
+
+	p.Start(ProgressRecv, "a", "a.bin", "", 100, 1000) // 断点续传, 已经有 100
+	p.Start(ProgressSend, "b", "b.bin", "peer", 0, 500)
+	p.Add(ProgressRecv, "a", 400)
+	p.Add(ProgressSend, "b", 600) // 重传的块不会超过总数
+
+	files := p.Files()
+	if len(files) != 2 || files[0].Done != 500 || files[1].Done != 500 {
+		t.Fatalf("Files() = %+v", files)
+	}
+	if got := files[0].Percent(); got != 50 {
+		t.Errorf("Percent() = %v, want 50", got)
+	}
+	if agg := p.Aggregate(); agg.Done != 1000 || agg.Total != 1500 || agg.Finished {
+		t.Errorf("Aggregate() = %+v", agg)
+	}
+
+	p.Finish(ProgressSend, "b", nil)
+	p.Finish(ProgressRecv, "a", errors.New("broken"))
+	if agg := p.Aggregate(); !agg.Finished || agg.Total != 0 { // 只算还没结束的
+		t.Errorf("Aggregate() after finish = %+v", agg)
+	}
+
+	var types []string
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	want := []string{ProgressStart, ProgressStart, ProgressUpdate, ProgressUpdate, ProgressDone, ProgressFailed}
+	if len(types) != len(want) {
+		t.Fatalf("events = %v, want %v", types, want)
+	}
+	for i := range want {
+		if types[i] != want[i] {
+			t.Fatalf("events = %v, want %v", types, want)
+		}
+	}
+	if last := events[len(events)-1].File; last.Err != "broken" || last.Done != 500 {
+		t.Errorf("failed event = %+v", last)
+	}
+}
+
+func TestProgressHistory(t *testing.T) {
+	old := ProgressHistory
+	ProgressHistory = 2
+	defer func() { ProgressHistory = old }()
+
+	p := NewProgress()
+	p.Start(ProgressRecv, "running", "running.bin", "", 0, 100)
+	for i := 0; i < 5; i++ {
+		id := fmt.Sprint(i)
+		p.Start(ProgressRecv, id, id+".bin", "", 0, 100)
+		p.Finish(ProgressRecv, id, nil)
+	}
+
+	files := p.Files()
+	if len(files) != 3 || files[0].ID != "running" || files[1].ID != "3" || files[2].ID != "4" {
+		t.Errorf("Files() = %+v, want running, 3 and 4", files)
+	}
+}
@@ -0,0 +1,366 @@
+package gofer
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimiter 是一个令牌桶限速器, 单位是 Bytes/s。
+//
+// 桶的容量 (burst) 等于一秒的流量。取令牌时允许"透支":
+// 一次要取的令牌比桶里的多也没关系, 先扣成负数, 然后睡到还清为止。
+// 这样一次写很大的块也不会卡死, 长期来看速率还是对的。
+//
+// rate <= 0 表示不限速。RateLimiter 可以在使用中随时 SetRate。
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64   // 速率: Bytes/s
+	tokens float64   // 当前令牌数, 可以为负 (透支)
+	last   time.Time // 上次补充令牌的时间
+}
+
+func NewRateLimiter(bytesPerSec int64) *RateLimiter {
+	return &RateLimiter{
+		rate:   float64(bytesPerSec),
+		tokens: float64(bytesPerSec),
+		last:   time.Now(),
+	}
+}
+
+// Rate 返回当前速率 (Bytes/s), <= 0 表示不限速
+func (l *RateLimiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(l.rate)
+}
+
+// SetRate 修改速率 (Bytes/s), <= 0 表示不限速
+func (l *RateLimiter) SetRate(bytesPerSec int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	l.rate = float64(bytesPerSec)
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+}
+
+// refill 按流逝的时间补充令牌, 调用者需持有锁
+func (l *RateLimiter) refill(now time.Time) {
+	if l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.rate { // burst: 最多攒一秒
+			l.tokens = l.rate
+		}
+	}
+	l.last = now
+}
+
+// WaitN 取 n 个令牌, 不够就阻塞等待
+func (l *RateLimiter) WaitN(n int) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return
+	}
+	l.refill(time.Now())
+	l.tokens -= float64(n)
+
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	if wait > 0 {
+		time.Sleep(wait)
+	}
+}
+
+// rateLimitChunk 是限速写时每次写入的最大字节数。
+// 分小块写, 速率才平滑, 改了速率也能尽快生效。
+const rateLimitChunk = 32 * 1024
+
+// limitedWriter 是写之前要先从所有 limiters 取令牌的 io.Writer
+type limitedWriter struct {
+	writer   io.Writer
+	limiters []*RateLimiter
+}
+
+// NewLimitedWriter 包装 writer, 写入受所有 limiters 的限制
+func NewLimitedWriter(writer io.Writer, limiters ...*RateLimiter) io.Writer {
+	return &limitedWriter{writer: writer, limiters: limiters}
+}
+
+func (w *limitedWriter) Write(p []byte) (written int, err error) {
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > rateLimitChunk {
+			chunk = chunk[:rateLimitChunk]
+		}
+		for _, l := range w.limiters {
+			l.WaitN(len(chunk))
+		}
+
+		n, err := w.writer.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// 发送限速！！
+// Bandwidth 限制 BigFileSender 的响应和 SimpleFileSender 发出的文件, 分三层, 每一层都是一个 RateLimiter:
+//
+//  - 全局: 所有连接共用一个桶, 速率可以按一天中的时间表变化 (例如工作时间限速)
+//  - 每个对方: 按对方的 IP 或者 TLS 证书的 CommonName 区分, 同一个对方的所有连接共用一个桶
+//  - 每个传输: 一个大文件 (BigFileSender.SetFileRate) 或者一个 SimpleFileSender (SetRate)
+//
+// Packet 按 rateLimitChunk 分小块写出, 每一块写之前从每一层取令牌, 这样速率再低, 对方也一直有数据可读,
+// 不会因为等一整个 Packet 的令牌太久而读超时。同一个连接上有别的 goroutine 也在写的话, 调用者要自己加锁。
+// 所有速率都可以在使用中随时修改, 从下一个 Packet 开始生效。
+// 对方的桶闲置 peerIdleTimeout 以后就丢掉, 不会随着对方越来越多一直攒着。
+
+// DefaultBandwidth 是 Bandwidth 为 nil 的发送者使用的限速, 默认不限速
+var DefaultBandwidth = NewBandwidth()
+
+// RateWindow 是时间表里的一段: 每天 Start 到 End 之间全局速率为 Rate
+type RateWindow struct {
+	Start time.Duration // 从 00:00 算起
+	End   time.Duration // 从 00:00 算起, 比 Start 小表示跨过午夜
+	Rate  int64         // Bytes/s, <= 0 表示这段时间不限速
+}
+
+// contains 检查一天中的时刻 t (从 00:00 算起) 是否在这一段里
+func (w RateWindow) contains(t time.Duration) bool {
+	if w.Start <= w.End {
+		return t >= w.Start && t < w.End
+	}
+	return t >= w.Start || t < w.End
+}
+
+// ParseRateSchedule 解析时间表, 格式为逗号分隔的 "HH:MM-HH:MM=BYTES_PER_SEC",
+// 例如 "09:00-18:00=1048576,22:00-06:00=0"
+func ParseRateSchedule(s string) ([]RateWindow, error) {
+	var windows []RateWindow
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		eq := strings.Index(item, "=")
+		dash := strings.Index(item, "-")
+		if eq < 0 || dash < 0 || dash > eq {
+			return nil, fmt.Errorf("bad schedule %q: want HH:MM-HH:MM=BYTES_PER_SEC", item)
+		}
+		start, err := parseClock(item[:dash])
+		if err != nil {
+			return nil, err
+		}
+		end, err := parseClock(item[dash+1 : eq])
+		if err != nil {
+			return nil, err
+		}
+		rate, err := strconv.ParseInt(item[eq+1:], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad rate in schedule %q: %v", item, err)
+		}
+		windows = append(windows, RateWindow{Start: start, End: end, Rate: rate})
+	}
+	return windows, nil
+}
+
+// parseClock 解析 "HH:MM", 返回从 00:00 算起的时间
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("bad time %q: want HH:MM", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// Bandwidth 是全局和每个对方的发送限速, 每个传输的限速见 BigFileSender.SetFileRate 和 SimpleFileSender.SetRate
+type Bandwidth struct {
+	mu        sync.Mutex
+	rate      int64        // 时间表以外的全局速率
+	schedule  []RateWindow // 全局速率的时间表, 靠前的优先
+	global    *RateLimiter
+	peerRate  int64                  // 没有单独设置的对方的速率
+	peerRates map[string]int64       // 单独设置的对方的速率: {IP 或 CommonName: Bytes/s}
+	peers     map[string]*peerBucket // {IP 或 CommonName: 这个对方的桶}
+	swept     time.Time              // 上次清理闲置的桶的时间
+
+	now func() time.Time // 测试时替换
+}
+
+// peerIdleTimeout 是对方的桶闲置多久以后丢掉
+const peerIdleTimeout = 10 * time.Minute
+
+// peerBucket 是一个对方的桶和它上次被用到的时间
+type peerBucket struct {
+	limiter *RateLimiter
+	used    time.Time
+}
+
+// NewBandwidth 新建一个不限速的 Bandwidth
+func NewBandwidth() *Bandwidth {
+	return &Bandwidth{
+		global:    NewRateLimiter(0),
+		peerRates: map[string]int64{},
+		peers:     map[string]*peerBucket{},
+		now:       time.Now,
+	}
+}
+
+// SetRate 设置全局速率 (Bytes/s), 时间表以外的时间使用, <= 0 表示不限速
+func (b *Bandwidth) SetRate(bytesPerSec int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.rate = bytesPerSec
+	b.updateGlobal()
+}
+
+// SetSchedule 设置全局速率的时间表, nil 表示一直用 SetRate 设置的速率
+func (b *Bandwidth) SetSchedule(schedule []RateWindow) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.schedule = schedule
+	b.updateGlobal()
+}
+
+// Rate 返回现在的全局速率 (Bytes/s), <= 0 表示不限速
+func (b *Bandwidth) Rate() int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.scheduledRate()
+}
+
+// scheduledRate 返回时间表上现在的全局速率, 调用者需持有锁
+func (b *Bandwidth) scheduledRate() int64 {
+	now := b.now()
+	y, m, d := now.Date()
+	t := now.Sub(time.Date(y, m, d, 0, 0, 0, 0, now.Location()))
+	for _, w := range b.schedule {
+		if w.contains(t) {
+			return w.Rate
+		}
+	}
+	return b.rate
+}
+
+// updateGlobal 按时间表更新全局的桶, 调用者需持有锁
+func (b *Bandwidth) updateGlobal() {
+	if rate := b.scheduledRate(); rate != b.global.Rate() {
+		b.global.SetRate(rate)
+	}
+}
+
+// SetPeerRate 设置对方 peer (IP 或者 TLS 证书的 CommonName) 的速率 (Bytes/s), <= 0 表示不限速。
+// peer 为 "" 时设置所有没有单独设置的对方的速率, 每个对方各有一个桶。
+func (b *Bandwidth) SetPeerRate(peer string, bytesPerSec int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if peer == "" {
+		b.peerRate = bytesPerSec
+		for key, p := range b.peers {
+			if _, ok := b.peerRates[key]; !ok {
+				p.limiter.SetRate(bytesPerSec)
+			}
+		}
+		return
+	}
+	b.peerRates[peer] = bytesPerSec
+	if p, ok := b.peers[peer]; ok {
+		p.limiter.SetRate(bytesPerSec)
+	}
+}
+
+// PeerRate 返回对方 peer 的速率 (Bytes/s), peer 为 "" 时返回没有单独设置的对方的速率
+func (b *Bandwidth) PeerRate(peer string) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if r, ok := b.peerRates[peer]; ok && peer != "" {
+		return r
+	}
+	return b.peerRate
+}
+
+// peerLimiter 返回 conn 对方的桶: 先按 IP, 再按 CommonName 找单独设置的速率, 都没有就按 IP 用默认速率
+func (b *Bandwidth) peerLimiter(conn net.Conn) *RateLimiter {
+	ip, commonName := PeerIdentity(conn)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	key, rate := "", b.peerRate
+	if ip != nil {
+		key = ip.String()
+	}
+	if r, ok := b.peerRates[key]; ok {
+		rate = r
+	} else if r, ok := b.peerRates[commonName]; ok && commonName != "" {
+		key, rate = commonName, r
+	}
+
+	now := b.now()
+	b.sweepPeers(now)
+	p, ok := b.peers[key]
+	if !ok {
+		p = &peerBucket{limiter: NewRateLimiter(rate)}
+		b.peers[key] = p
+	}
+	p.used = now
+	return p.limiter
+}
+
+// sweepPeers 丢掉闲置超过 peerIdleTimeout 的桶, 每 peerIdleTimeout 最多清理一次, 调用者需持有锁
+func (b *Bandwidth) sweepPeers(now time.Time) {
+	if now.Sub(b.swept) < peerIdleTimeout {
+		return
+	}
+	b.swept = now
+	for key, p := range b.peers {
+		if now.Sub(p.used) >= peerIdleTimeout {
+			delete(b.peers, key)
+		}
+	}
+}
+
+// WaitN 从全局、conn 对方和 transfer (可以为 nil) 的桶各取 n 个令牌, 不够就阻塞等待
+func (b *Bandwidth) WaitN(conn net.Conn, transfer *RateLimiter, n int) {
+	b.mu.Lock()
+	b.updateGlobal()
+	b.mu.Unlock()
+
+	b.global.WaitN(n)
+	b.peerLimiter(conn).WaitN(n)
+	transfer.WaitN(n)
+}
+
+// writePacketLimited 按 b (nil 表示 DefaultBandwidth) 和 transfer 限速, 把 packet 分小块写到 conn
+func writePacketLimited(packet *Packet, conn net.Conn, b *Bandwidth, transfer *RateLimiter) (int, error) {
+	if b == nil {
+		b = DefaultBandwidth
+	}
+	b.mu.Lock()
+	b.updateGlobal()
+	b.mu.Unlock()
+
+	n, err := NewLimitedWriter(conn, b.global, b.peerLimiter(conn), transfer).Write(packet.ToBytes())
+	metricBytesSent.Add(float64(n))
+	return n, err
+}
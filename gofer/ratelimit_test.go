@@ -0,0 +1,112 @@
+package gofer
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBandwidthSchedule(t *testing.T) {
+	windows, err := ParseRateSchedule("09:00-18:00=1000, 22:00-06:00=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(windows) != 2 || windows[0].Start != 9*time.Hour || windows[1].End != 6*time.Hour {
+		t.Fatalf("ParseRateSchedule() = %+v", windows)
+	}
+	if _, err := ParseRateSchedule("9-18=1000"); err == nil {
+		t.Error("bad schedule should fail")
+	}
+
+	b := NewBandwidth()
+	b.SetRate(500)
+	b.SetSchedule(windows)
+	for _, c := range []struct {
+		clock string
+		want  int64
+	}{
+		{"08:59", 500},
+		{"09:00", 1000},
+		{"17:59", 1000},
+		{"18:00", 500},
+		{"23:00", 0}, // 跨过午夜
+		{"05:00", 0},
+	} {
+		now, _ := time.Parse("15:04", c.clock)
+		b.now = func() time.Time { return now }
+		if got := b.Rate(); got != c.want {
+			t.Errorf("Rate() at %s = %d, want %d", c.clock, got, c.want)
+		}
+	}
+}
+
+func TestBandwidthPeerRate(t *testing.T) {
+	a, c := net.Pipe()
+	defer a.Close()
+	defer c.Close()
+
+	b := NewBandwidth()
+	b.SetPeerRate("", 100)
+	l := b.peerLimiter(a)
+	if l.Rate() != 100 {
+		t.Errorf("default peer rate = %d, want 100", l.Rate())
+	}
+	if b.peerLimiter(c) != l { // 同一个对方共用一个桶
+		t.Error("connections of the same peer should share a limiter")
+	}
+	b.SetPeerRate("", 200)
+	if l.Rate() != 200 {
+		t.Errorf("peer rate after SetPeerRate = %d, want 200", l.Rate())
+	}
+}
+
+func TestBandwidthEvictsIdlePeers(t *testing.T) {
+	a, c := net.Pipe()
+	defer a.Close()
+	defer c.Close()
+
+	now := time.Now()
+	b := NewBandwidth()
+	b.now = func() time.Time { return now }
+	l := b.peerLimiter(a)
+
+	now = now.Add(peerIdleTimeout / 2)
+	if b.peerLimiter(a) != l {
+		t.Fatal("peer limiter in use should be kept")
+	}
+	now = now.Add(peerIdleTimeout)
+	if b.peerLimiter(a) == l {
+		t.Error("idle peer limiter should be dropped")
+	}
+	if len(b.peers) != 1 {
+		t.Errorf("len(peers) = %d, want 1", len(b.peers))
+	}
+}
+
+func TestWritePacketLimitedChunks(t *testing.T) {
+	a, c := net.Pipe()
+	defer a.Close()
+	defer c.Close()
+
+	packet := NewPacket(PacketTypeSimpleFile, []byte("name"), make([]byte, 16*rateLimitChunk))
+	b := NewBandwidth()
+	b.SetRate(int64(8 * rateLimitChunk)) // 整个 Packet 要透支 1s 的令牌, 但每一块 125ms 就能读到
+
+	go func() {
+		_, _ = writePacketLimited(packet, a, b, nil)
+	}()
+
+	buf := make([]byte, len(packet.ToBytes()))
+	read := 0
+	for read < len(buf) {
+		_ = c.SetReadDeadline(time.Now().Add(250 * time.Millisecond))
+		n, err := c.Read(buf[read:])
+		if err != nil {
+			t.Fatalf("read after %d bytes: %v", read, err)
+		}
+		if n > rateLimitChunk {
+			t.Errorf("read %d bytes at once, want at most %d", n, rateLimitChunk)
+		}
+		read += n
+	}
+}
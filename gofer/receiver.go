@@ -1,7 +1,7 @@
 package gofer
 
 import (
-	"fmt"
+	"io"
 	"net"
 )
 
@@ -12,6 +12,13 @@ type PacketReceiver interface {
 	Receive(packet *Packet, conn net.Conn) chan bool // 收完了就往里面传值
 }
 
+// PacketReceiverFunc 让普通的函数也可以作为 PacketReceiver 注册到 Distributer
+type PacketReceiverFunc func(packet *Packet, conn net.Conn) chan bool
+
+func (f PacketReceiverFunc) Receive(packet *Packet, conn net.Conn) chan bool {
+	return f(packet, conn)
+}
+
 // Receiver 负责从 conn 接收 packet, 然后分发给各种 PacketReceiver 处理
 //
 // ⚠️ 注意：
@@ -30,10 +37,26 @@ func (r Receiver) ReceiveAndHandle(conn net.Conn) chan bool {
 	packet, err := PacketFromReader(conn)
 
 	if err != nil {
-		fmt.Println("receive from", conn.RemoteAddr().String(), "failed:", err)
-	} else {
-		fmt.Println("receive from", conn.RemoteAddr().String(), "success")
+		logWarn("receive failed", fPeer(conn), fErr(err))
+		done := make(chan bool, 1)
+		done <- false
+		return done
 	}
+	logDebug("received", fPeer(conn), Field{"type", packet.Type})
 
 	return r.Distributer.Receive(packet, conn)
 }
+
+// ReceiveAndHandleAll 不断接收并处理数据包, 每个都处理完了再收下一个, 直到连接断开
+func (r Receiver) ReceiveAndHandleAll(conn net.Conn) {
+	for {
+		packet, err := PacketFromReader(conn)
+		if err != nil {
+			if err != io.EOF {
+				logWarn("receive failed", fPeer(conn), fErr(err))
+			}
+			return
+		}
+		<-r.Distributer.Receive(packet, conn)
+	}
+}
@@ -0,0 +1,383 @@
+package gofer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// 中继！！
+// 两端都在 NAT 后面，谁也连不上谁的时候，就需要一个双方都能连上的中继服务器。
+//
+// 流程:
+//
+//  1. 双方都主动连接 RelayServer, 各发送一个 RelayHello, 里面带着由事先约定好的 code 算出来的配对 ID (relayPairID),
+//     以及自己的角色: RelayRoleServe (相当于 -s) 或 RelayRoleDial (相当于 -c)。code 本身不发给中继
+//  2. RelayServer 把配对 ID 相同、角色互补的两个连接配成一对,
+//     然后把两个连接的数据流对接 (splice) 起来
+//  3. 之后双方在这条中继的管道上做 TLS 握手: Serve 的一方做 TLS 服务端, Dial 的一方做 TLS 客户端
+//  4. 证书是打包在程序里的, 谁都有, 所以光靠 TLS 挡不住中继在中间分别和两边握手。
+//     握手完以后双方再用 code 对 TLS 会话的 exporter 算 HMAC 互相核对 (relayConfirm):
+//     中间人两边的 TLS 会话不一样, 不知道 code 就算不出对的 HMAC, 这样 RelayServer 只能看到密文
+//  5. 核对通过后, 就和直连一样跑 Server / Client 了
+//
+// ⚠️ 注意：code 就是唯一的凭据。中间人拿到一方的 HMAC 以后可以离线猜 code, 所以 code 要足够长、猜不到
+// (比如随机的几个单词), 不能用 1234 这种。
+
+// RelayHello 是连接中继服务器后发送的第一个 Packet, 用来登记配对
+//
+// RelayHello is Packet that:
+//  - Type: 7
+//  - Info: code, 配对用的传输码
+//  - Data: role (const 1 Byte)
+type RelayHello struct {
+	*Packet
+	code string // just a name, do not use this, call Getter/Setter instead
+	role byte   // just a name, do not use this, call Getter/Setter instead
+}
+
+const PacketTypeRelayHello uint16 = 7
+
+// 中继的角色
+const (
+	RelayRoleServe byte = 's' // 等待对方的一端, 中继之后做 TLS 服务端
+	RelayRoleDial  byte = 'c' // 主动找对方的一端, 中继之后做 TLS 客户端
+)
+
+func NewRelayHello(code string, role byte) *RelayHello {
+	return &RelayHello{
+		Packet: NewPacket(PacketTypeRelayHello, []byte(code), []byte{role}),
+	}
+}
+
+// PacketAsRelayHello convert packet to RelayHello
+// Notice: only for packets whose Type==PacketTypeRelayHello
+func PacketAsRelayHello(packet *Packet) *RelayHello {
+	return &RelayHello{Packet: packet}
+}
+
+func (h RelayHello) Code() string {
+	return string(h.Info)
+}
+
+func (h *RelayHello) SetCode(code string) {
+	h.Info = []byte(code)
+	h.InfoSize = uint32(len(h.Info))
+}
+
+func (h RelayHello) Role() byte {
+	if len(h.Data) < 1 {
+		return 0
+	}
+	return h.Data[0]
+}
+
+func (h *RelayHello) SetRole(role byte) {
+	h.Data = []byte{role}
+	h.DataSize = 1
+}
+
+// RelayServer 是中继服务器, 实现 Server 接口
+//
+// 它不解密任何东西, 只负责配对和搬运数据。
+type RelayServer struct {
+	PairRate     int64         // 每一对连接的带宽上限 (Bytes/s, 两个方向共享), <= 0 不限速
+	WaitTimeout  time.Duration // 等待配对的超时时间
+	HelloTimeout time.Duration // 等待 RelayHello 的超时时间
+
+	mu      sync.Mutex
+	waiting map[string]*relayPeer // {code: 等待配对的一端}
+}
+
+// relayPeer 是一个已登记、等待配对的连接
+type relayPeer struct {
+	conn  net.Conn
+	role  byte
+	timer *time.Timer
+
+	// 等待的时候一直读着 conn, 这样对方断了马上就知道, 不会在以后配给下一个用这个 code 的人。
+	// Dial 的一方登记后马上开始 TLS 握手, 读到的数据先攒在 buffered 里, 配对后再转给对方。
+	watched  chan struct{} // watch 结束后关闭
+	buffered []byte        // 等待期间读到的数据
+	err      error         // watch 结束的原因
+}
+
+// relayMaxBuffered 是等待配对期间最多替一端攒多少数据, 超过了就当它不正常, 断开
+const relayMaxBuffered = 64 * 1024
+
+func NewRelayServer(pairRate int64) *RelayServer {
+	return &RelayServer{
+		PairRate:     pairRate,
+		WaitTimeout:  5 * time.Minute,
+		HelloTimeout: 10 * time.Second,
+		waiting:      map[string]*relayPeer{},
+	}
+}
+
+// ServeConn 读取 RelayHello, 登记或配对这个连接
+func (r *RelayServer) ServeConn(conn net.Conn) {
+	_ = conn.SetReadDeadline(time.Now().Add(r.HelloTimeout))
+	packet, err := PacketFromReader(conn)
+	_ = conn.SetReadDeadline(time.Time{})
+	if err != nil || packet.Type != PacketTypeRelayHello {
+		logWarn("RelayServer: bad hello", fPeer(conn), fErr(err))
+		_ = conn.Close()
+		return
+	}
+	hello := PacketAsRelayHello(packet)
+	code, role := hello.Code(), hello.Role()
+	if code == "" || (role != RelayRoleServe && role != RelayRoleDial) {
+		logWarn("RelayServer: invalid hello", fPeer(conn))
+		_ = conn.Close()
+		return
+	}
+
+	for {
+		r.mu.Lock()
+		peer, ok := r.waiting[code]
+		if ok && peer.role == role { // 同一个角色来了两次, 不知道该信谁, 拒绝后来的
+			r.mu.Unlock()
+			logWarn("RelayServer: role is already waiting", Field{"code", code}, Field{"role", string(role)})
+			_ = conn.Close()
+			return
+		}
+		if !ok { // 先到的, 登记等待
+			r.wait(conn, code, role)
+			r.mu.Unlock()
+			logInfo("RelayServer: waiting", Field{"code", code}, fPeer(conn))
+			return
+		}
+		delete(r.waiting, code)
+		r.mu.Unlock()
+
+		peer.timer.Stop() // 已经不在 waiting 里了, 超时了也不会再关闭它
+		// 停下 watch, 拿到它攒下的数据
+		_ = peer.conn.SetReadDeadline(time.Now())
+		<-peer.watched
+		_ = peer.conn.SetReadDeadline(time.Time{})
+		if !isTimeout(peer.err) { // 等着等着断了: 丢掉它, 这个连接重新配对
+			logInfo("RelayServer: waiting peer is gone", Field{"code", code}, fPeer(peer.conn), fErr(peer.err))
+			_ = peer.conn.Close()
+			continue
+		}
+		if _, err := conn.Write(peer.buffered); err != nil {
+			_ = peer.conn.Close()
+			_ = conn.Close()
+			return
+		}
+
+		logInfo("RelayServer: paired", Field{"code", code}, fPeer(peer.conn), Field{"peer2", peerOf(conn)})
+		r.splice(peer.conn, conn)
+		logInfo("RelayServer: over", Field{"code", code})
+		return
+	}
+}
+
+// wait 把 conn 登记为 code 的等待的一端 (调用时持有 r.mu)
+func (r *RelayServer) wait(conn net.Conn, code string, role byte) {
+	peer := &relayPeer{conn: conn, role: role, watched: make(chan struct{})}
+	// drop 在 peer 还在等的话把它移除, 关闭连接
+	drop := func(why string, err error) {
+		r.mu.Lock()
+		waiting := r.waiting[code] == peer
+		if waiting {
+			delete(r.waiting, code)
+		}
+		r.mu.Unlock()
+		if waiting {
+			logInfo("RelayServer: "+why, Field{"code", code}, fPeer(conn), fErr(err))
+			_ = conn.Close()
+		}
+	}
+	peer.timer = time.AfterFunc(r.WaitTimeout, func() {
+		drop("wait timeout", nil)
+	})
+	r.waiting[code] = peer
+
+	go func() { // watch
+		defer close(peer.watched)
+		buf := make([]byte, 4096)
+		for {
+			n, err := conn.Read(buf)
+			peer.buffered = append(peer.buffered, buf[:n]...)
+			if err == nil && len(peer.buffered) > relayMaxBuffered {
+				err = fmt.Errorf("sent too much before pairing")
+			}
+			if err != nil {
+				peer.err = err
+				if !isTimeout(err) { // 配对时设置的 deadline 不算
+					drop("waiting peer is gone", err)
+				}
+				return
+			}
+		}
+	}()
+}
+
+// relayPairID 由 code 算出在中继上配对用的 ID: 中继只看到它, 看不到 code
+func relayPairID(code string) string {
+	sum := sha256.Sum256([]byte("gofer relay pair\x00" + code))
+	return hex.EncodeToString(sum[:16])
+}
+
+// relayConfirmTimeout 是 TLS 握手以后等对方的 HMAC 的超时时间
+const relayConfirmTimeout = 30 * time.Second
+
+// relayConfirmMAC 是 role 一端对这个 TLS 会话、用 code 算出的 HMAC
+func relayConfirmMAC(exported []byte, code string, role byte) []byte {
+	mac := hmac.New(sha256.New, []byte(code))
+	mac.Write([]byte{role})
+	mac.Write(exported)
+	return mac.Sum(nil)
+}
+
+// relayConfirm 在中继的管道上握手完成后, 确认对方知道同一个 code, 而且和我们是同一个 TLS 会话 (中间没有人):
+// 双方各发自己对 TLS exporter 算的 HMAC, 再检查对方的。
+func relayConfirm(conn *tls.Conn, code string, role byte) error {
+	state := conn.ConnectionState()
+	exported, err := state.ExportKeyingMaterial("EXPORTER-gofer-relay-confirm", nil, 32)
+	if err != nil {
+		return err
+	}
+	peerRole := RelayRoleDial
+	if role == RelayRoleDial {
+		peerRole = RelayRoleServe
+	}
+
+	_ = conn.SetDeadline(time.Now().Add(relayConfirmTimeout))
+	defer conn.SetDeadline(time.Time{})
+	if _, err := conn.Write(relayConfirmMAC(exported, code, role)); err != nil {
+		return err
+	}
+	got := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(conn, got); err != nil {
+		return err
+	}
+	if !hmac.Equal(got, relayConfirmMAC(exported, code, peerRole)) {
+		return errors.New("the other side does not know the code, or the relay is in the middle")
+	}
+	return nil
+}
+
+// relayTLS 在中继的管道 conn 上握手 (role 决定做 TLS 的哪一端), 然后用 code 核对对方
+func relayTLS(conn net.Conn, code string, role byte) (*tls.Conn, error) {
+	var tlsConn *tls.Conn
+	if role == RelayRoleDial {
+		config, err := clientTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		config.MinVersion = tls.VersionTLS13 // exporter 要 TLS 1.3 (或者 EMS) 才安全
+		tlsConn = tls.Client(conn, config)
+	} else {
+		config, err := serverTLSConfig()
+		if err != nil {
+			return nil, err
+		}
+		config.MinVersion = tls.VersionTLS13
+		tlsConn = tls.Server(conn, config)
+	}
+	if err := tlsConn.Handshake(); err != nil {
+		return nil, fmt.Errorf("relay: TLS handshake failed: %v", err)
+	}
+	if err := relayConfirm(tlsConn, code, role); err != nil {
+		return nil, fmt.Errorf("relay: confirm code failed: %v", err)
+	}
+	return tlsConn, nil
+}
+
+// isTimeout 检查 err 是不是读写超时
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// splice 对接两个连接的数据流, 直到任意一方断开
+func (r *RelayServer) splice(a, b net.Conn) {
+	limiter := NewRateLimiter(r.PairRate)
+
+	var once sync.Once
+	closeBoth := func() {
+		_ = a.Close()
+		_ = b.Close()
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	pipe := func(dst, src net.Conn) {
+		defer wg.Done()
+		_, _ = io.Copy(NewLimitedWriter(dst, limiter), src)
+		once.Do(closeBoth)
+	}
+	go pipe(a, b)
+	go pipe(b, a)
+	wg.Wait()
+}
+
+// DialRelay 连接中继服务器 relayAddress, 以 code 和 role 登记。
+// 返回的连接在配对成功后就通向对方, 但还未加密, 一般不直接用, 而是用
+// DialRelayAndRunClientTLS 或 WaitRelayAndRunClientTLS。
+func DialRelay(relayAddress string, code string, role byte) (net.Conn, error) {
+	conn, err := net.Dial("tcp", relayAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := NewRelayHello(code, role).WriteTo(conn); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("relay hello failed: %v", err)
+	}
+	return conn, nil
+}
+
+// DialRelayAndRunClientTLS 通过中继服务器找到 code 对应的对方,
+// 在中继的管道上建立端到端的 TLS 连接 (用 code 核对过对方)，完成 client 的 Do。
+// 连不上中继, TLS 握手失败, 或者核对失败返回错误。
+func DialRelayAndRunClientTLS(relayAddress string, code string, client Client) error {
+	conn, err := DialRelay(relayAddress, relayPairID(code), RelayRoleDial)
+	if err != nil {
+		emitFailed(Event{Peer: relayAddress}, ErrCodeConnect, err)
+		return err
+	}
+
+	tlsConn, err := relayTLS(conn, code, RelayRoleDial)
+	if err != nil {
+		_ = conn.Close()
+		emitFailed(Event{Peer: relayAddress}, ErrCodeConnect, err)
+		return err
+	}
+
+	<-runClient(client, tlsConn)
+	return nil
+}
+
+// WaitRelayAndRunClientTLS 在中继服务器上以 code 等待对方, 配对后在中继的管道上
+// 建立端到端的 TLS 连接 (这一端做 TLS 服务端, 用 code 核对过对方)，完成 client 的 Do。
+// 连不上中继, TLS 握手失败, 或者核对失败返回错误。
+//
+// 中继之后谁 Send 谁 Receive 和谁做 TLS 服务端无关, 所以这里跑的也是 Client。
+func WaitRelayAndRunClientTLS(relayAddress string, code string, client Client) error {
+	conn, err := DialRelay(relayAddress, relayPairID(code), RelayRoleServe)
+	if err != nil {
+		emitFailed(Event{Peer: relayAddress}, ErrCodeConnect, err)
+		return err
+	}
+	logInfo("Waiting on relay", fAddr(relayAddress))
+
+	tlsConn, err := relayTLS(conn, code, RelayRoleServe)
+	if err != nil {
+		_ = conn.Close()
+		emitFailed(Event{Peer: relayAddress}, ErrCodeConnect, err)
+		return err
+	}
+
+	<-runClient(client, tlsConn)
+	return nil
+}
@@ -0,0 +1,163 @@
+package gofer
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRelayServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go (&server{Handler: NewRelayServer(0)}).Serve(listener)
+
+	a, err := DialRelay(listener.Addr().String(), "test-code", RelayRoleServe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+	b, err := DialRelay(listener.Addr().String(), "test-code", RelayRoleDial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	if _, err := b.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 5)
+	if _, err := io.ReadFull(a, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Errorf("relayed %q, want %q", buf, "hello")
+	}
+}
+
+func TestRelayServerWaitingPeerGone(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	relay := NewRelayServer(0)
+	go (&server{Handler: relay}).Serve(listener)
+
+	// 先来的断了, 不能配给后来的
+	gone, err := DialRelay(listener.Addr().String(), "test-code", RelayRoleServe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitRelay := func(want bool) {
+		for i := 0; i < 100; i++ {
+			relay.mu.Lock()
+			_, waiting := relay.waiting["test-code"]
+			relay.mu.Unlock()
+			if waiting == want {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("waiting should be %v", want)
+	}
+	waitRelay(true)
+	_ = gone.Close()
+	waitRelay(false)
+
+	// 等待期间发的数据, 配对后转给对方
+	b, err := DialRelay(listener.Addr().String(), "test-code", RelayRoleDial)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	if _, err := b.Write([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	a, err := DialRelay(listener.Addr().String(), "test-code", RelayRoleServe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.Close()
+
+	buf := make([]byte, 5)
+	_ = a.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.ReadFull(a, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "hello" {
+		t.Errorf("relayed %q, want %q", buf, "hello")
+	}
+}
+
+// tcpPair 返回一对连在一起的 TCP 连接
+func tcpPair(t *testing.T) (net.Conn, net.Conn) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	a, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a, b
+}
+
+func TestRelayTLS(t *testing.T) {
+	for _, codes := range [][2]string{{"same code", "same code"}, {"one code", "another code"}} {
+		a, b := tcpPair(t)
+		errs := make(chan error, 1)
+		go func() {
+			_, err := relayTLS(b, codes[1], RelayRoleServe)
+			errs <- err
+			_ = b.Close()
+		}()
+		_, err := relayTLS(a, codes[0], RelayRoleDial)
+		_ = a.Close()
+		serveErr := <-errs
+		if want := codes[0] == codes[1]; (err == nil) != want || (serveErr == nil) != want {
+			t.Errorf("codes %q: dial %v, serve %v", codes, err, serveErr)
+		}
+	}
+}
+
+func TestRelayTLSDetectsMiddleman(t *testing.T) {
+	// 中继分别和两边握手 (证书谁都有), 在中间转发明文
+	dial, m1 := tcpPair(t)
+	m2, serve := tcpPair(t)
+	defer dial.Close()
+	defer serve.Close()
+	go func() {
+		serverConfig, _ := serverTLSConfig()
+		clientConfig, _ := clientTLSConfig()
+		s, c := tls.Server(m1, serverConfig), tls.Client(m2, clientConfig)
+		defer s.Close()
+		defer c.Close()
+		if s.Handshake() != nil || c.Handshake() != nil {
+			return
+		}
+		go func() { _, _ = io.Copy(c, s) }()
+		_, _ = io.Copy(s, c)
+	}()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := relayTLS(serve, "test-code", RelayRoleServe)
+		errs <- err
+	}()
+	if _, err := relayTLS(dial, "test-code", RelayRoleDial); err == nil {
+		t.Error("dial side should detect the middleman")
+	}
+	if err := <-errs; err == nil {
+		t.Error("serve side should detect the middleman")
+	}
+}
@@ -1,13 +1,12 @@
 package gofer
 
 import (
-	"fmt"
 	"net"
 )
 
 // Sender 是发送者接口
 type Sender interface {
-	Send(conn net.Conn)
+	Send(conn net.Conn) error // 发送失败返回错误
 }
 
 // packetSender 是个通用的发 Packet 的 Sender
@@ -17,12 +16,13 @@ type packetSender struct {
 	PacketToSend *Packet
 }
 
-func (s packetSender) Send(conn net.Conn) {
+func (s packetSender) Send(conn net.Conn) error {
 	n, err := s.PacketToSend.WriteTo(conn)
 
 	if err != nil {
-		fmt.Println("send failed:", err)
+		logWarn("send failed", fPeer(conn), fErr(err))
 	} else {
-		fmt.Println("sent successfully:", n)
+		logInfo("sent successfully", fPeer(conn), Field{"length", n})
 	}
+	return err
 }
@@ -4,6 +4,7 @@ import (
 	"crypto/rand"
 	"crypto/tls"
 	"crypto/x509"
+	"errors"
 	"fmt"
 	"net"
 	"time"
@@ -18,76 +19,122 @@ type server struct {
 	Handler Server
 }
 
+// accept 出错后重试前等待的时间, 每次连续出错翻倍, 不超过 maxAcceptBackoff
+const (
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+)
+
 // Serve handles requests on incoming connections.
-func (s *server) Serve(listener net.Listener) {
+// listener 被关闭后返回 net.ErrClosed; 其他 accept 错误退避一会儿再重试。
+func (s *server) Serve(listener net.Listener) error {
+	var backoff time.Duration
 	for {
 		conn, err := listener.Accept()
 		if err != nil {
-			fmt.Println("Serve listener accept error:", err)
+			if errors.Is(err, net.ErrClosed) {
+				return err
+			}
+			if backoff == 0 {
+				backoff = minAcceptBackoff
+			} else if backoff *= 2; backoff > maxAcceptBackoff {
+				backoff = maxAcceptBackoff
+			}
+			logError("Serve: listener accept error", fErr(err), Field{"retry_in", backoff})
+			metricConnectionsRejected.Inc("accept_error")
+			time.Sleep(backoff)
 			continue
 		}
+		backoff = 0
+		metricConnectionsAccepted.Inc()
 		go s.Handler.ServeConn(conn)
 	}
 }
 
 // ListenAndServe listens on the TCP network address addr and then calls
 // Serve with handler to handle requests on incoming connections.
-func ListenAndServe(addr string, handler Server) {
-	listener, err := net.Listen("tcp", addr)
+// addr 是 ws://HOST:PORT/PATH 或者 wss://... 的话, 在 WebSocket 上服务。
+// 监听成功就一直服务下去, 直到 listener 被关闭 (比如 WebSocket 的 HTTP 服务停了);
+// 监听失败或者 listener 被关闭都返回错误。
+func ListenAndServe(addr string, handler Server) error {
+	listener, err := listen(addr)
 	if err != nil {
-		panic(err)
+		return err
 	}
 	defer listener.Close()
 
 	s := server{Handler: handler}
-	s.Serve(listener)
+	return s.Serve(listener)
 }
 
 // ListenAndServeTLS 作用和 ListenAndServe 一样，不过使用更安全的 TLS 连接
-func ListenAndServeTLS(addr string, handler Server) {
+func ListenAndServeTLS(addr string, handler Server) error {
 	// http://c.biancheng.net/view/4530.html
 	// https://colobu.com/2016/06/07/simple-golang-tls-examples/
+	config, err := serverTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	listener, err := listen(addr)
+	if err != nil {
+		return err
+	}
+	listener = tls.NewListener(listener, config)
+	defer listener.Close()
+	logInfo("Listening", Field{"network", listener.Addr().Network()}, Field{"addr", listener.Addr().String()})
+
+	s := server{Handler: handler}
+	return s.Serve(listener)
+}
+
+// listen 监听 TCP 地址 addr, 或者 ws:// wss:// 开头的 WebSocket 地址
+func listen(addr string) (net.Listener, error) {
+	if IsWebSocketAddress(addr) {
+		return ListenWebSocket(addr)
+	}
+	return net.Listen("tcp", addr)
+}
+
+// serverTLSConfig 构造服务端的 TLS 配置: 使用 server 证书, 并要求验证客户端证书
+func serverTLSConfig() (*tls.Config, error) {
 	//pemCert, pemKey, _, err := GeneratePEM([]string{addr, "www.random.com"})
 	//if err != nil {
 	//	panic(fmt.Errorf("failed to generate PEM: %#v", err))
 	//}
 	//pemCert, pemKey, rootPEM := GeneratePEMWithRoot()
 
-	pemCert, pemKey := GetCert(ServerCert)
+	pemCert, pemKey, err := GetCert(ServerCert)
+	if err != nil {
+		return nil, fmt.Errorf("server: read cert: %v", err)
+	}
 	cert, err := tls.X509KeyPair(pemCert, pemKey)
 	//cert, err := tls.LoadX509KeyPair("certs/server.pem", "certs/server.key")
 	if err != nil {
-		panic(fmt.Errorf("server: loadkeys: %s", err))
+		return nil, fmt.Errorf("server: loadkeys: %s", err)
 	}
 
 	//clientCert, err := ioutil.ReadFile("certs/client.pem")
 	//if err != nil {
 	//	panic("Unable to read client.pem")
 	//}
-	clientCert, _ := GetCert(ClientCert)
+	clientCert, _, err := GetCert(ClientCert)
+	if err != nil {
+		return nil, fmt.Errorf("server: read client cert: %v", err)
+	}
 
 	clientCertPool := x509.NewCertPool()
 	if ok := clientCertPool.AppendCertsFromPEM(clientCert); !ok { // AppendCertsFromPEM(clientCert)
-		panic("failed to parse root certificate")
+		return nil, fmt.Errorf("failed to parse root certificate")
 	}
 
-	config := tls.Config{
+	return &tls.Config{
 		Certificates: []tls.Certificate{cert},
 		ClientAuth:   tls.RequireAndVerifyClientCert,
 		ClientCAs:    clientCertPool,
 		Time:         time.Now,
 		Rand:         rand.Reader,
-	}
-
-	listener, err := tls.Listen("tcp", addr, &config)
-	if err != nil {
-		panic(err)
-	}
-	defer listener.Close()
-	fmt.Printf("Listening %s %s\n", listener.Addr().Network(), listener.Addr().String())
-
-	s := server{Handler: handler}
-	s.Serve(listener)
+	}, nil
 }
 
 // SendServer 发送服务
@@ -103,8 +150,11 @@ func NewSendServer(s Sender) *SendServer {
 
 // ServeConn 监听指定地址, 有客户端连接接入, 就给对方发送 PacketToSend
 func (s SendServer) ServeConn(conn net.Conn) {
-	fmt.Println("SendServer: send to", conn.RemoteAddr().String())
-	s.Send(conn)
+	logInfo("SendServer: send", fPeer(conn))
+	DefaultEvents.Emit(Event{Type: EventConnected, Direction: ProgressSend, Peer: peerOf(conn)})
+	if err := s.Send(conn); err != nil {
+		logWarn("SendServer: send failed", fPeer(conn), fErr(err))
+	}
 }
 
 // ReceiveServer 接收服务
@@ -119,8 +169,11 @@ func NewReceiveServer() *ReceiveServer {
 }
 
 // ServeConn 监听指定地址, 等待客户端连接接入,
-// 接收对方发来的 Packet, 交给 HandlePacket 处理
+// 接收对方发来的 Packet, 交给 HandlePacket 处理。
+// 一个连接上可以连续发送多个 Packet, 直到对方断开。
 func (r ReceiveServer) ServeConn(conn net.Conn) {
-	fmt.Println("ReceiveServer: connect", conn.RemoteAddr().String())
-	r.ReceiveAndHandle(conn)
+	defer conn.Close()
+	logInfo("ReceiveServer: connect", fPeer(conn))
+	DefaultEvents.Emit(Event{Type: EventConnected, Direction: ProgressRecv, Peer: peerOf(conn)})
+	r.ReceiveAndHandleAll(conn)
 }
@@ -4,10 +4,10 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 // SimpleFile 是简单的文件。
@@ -32,7 +32,7 @@ func NewSimpleFile(filePath string) *SimpleFile {
 	// Open file
 	file, err := os.Open(filePath)
 	if err != nil {
-		fmt.Println("Open file failed:", err)
+		logError("Open file failed", Field{"file", filePath}, fErr(err))
 		return &SimpleFile{}
 	}
 	defer file.Close()
@@ -40,7 +40,7 @@ func NewSimpleFile(filePath string) *SimpleFile {
 	// Read file
 	fileContent, err := ioutil.ReadAll(file)
 	if err != nil {
-		fmt.Println("Read file failed:", err)
+		logError("Read file failed", Field{"file", filePath}, fErr(err))
 		return &SimpleFile{}
 	}
 
@@ -81,59 +81,134 @@ func (s SimpleFile) WriteFileContent(writer io.Writer) (written int, err error)
 // SimpleFileSender 负责发一个文件
 type SimpleFileSender struct {
 	simpleFile *SimpleFile
+	limiter    *RateLimiter // 这个文件的限速, 见 SetRate
+
+	Bandwidth *Bandwidth // 全局和每个对方的限速, nil 表示用 DefaultBandwidth
+	Progress  *Progress  // 向它报告进度, nil 表示 DefaultProgress
 }
 
 func NewSimpleFileSender(filePath string) *SimpleFileSender {
 	return &SimpleFileSender{
 		simpleFile: NewSimpleFile(filePath),
+		limiter:    NewRateLimiter(0),
+	}
+}
+
+// SetRate 限制发送这个文件的速率 (Bytes/s), <= 0 表示不限速
+func (s *SimpleFileSender) SetRate(bytesPerSec int64) {
+	if s.limiter == nil {
+		s.limiter = NewRateLimiter(bytesPerSec)
 	}
+	s.limiter.SetRate(bytesPerSec)
 }
 
-func (s SimpleFileSender) Send(conn net.Conn) {
-	n, err := s.simpleFile.WriteTo(conn)
+func (s SimpleFileSender) Send(conn net.Conn) error {
+	if s.simpleFile.Packet == nil { // NewSimpleFile 读文件失败了
+		err := fmt.Errorf("simpleFile send failed: nothing to send")
+		emitFailed(Event{Direction: ProgressSend, Peer: peerOf(conn)}, ErrCodeIO, err)
+		return err
+	}
+	progress := progressOf(s.Progress)
+	name, peer := s.simpleFile.FileName(), conn.RemoteAddr().String()
+	progress.Start(ProgressSend, name+" "+peer, name, peer, 0, uint64(s.simpleFile.DataSize))
+
+	n, err := writePacketLimited(s.simpleFile.Packet, conn, s.Bandwidth, s.limiter) // 对方没法说它能解什么, 不压缩
+	progress.Finish(ProgressSend, name+" "+peer, err)
 
 	if err != nil {
-		fmt.Println("simpleFile send failed:", err)
+		logWarn("simpleFile send failed", fPeer(conn), fName(name), fErr(err))
 	} else {
-		fmt.Println("simpleFile sent successfully: length =", n)
+		logInfo("simpleFile sent successfully", fPeer(conn), fName(name), Field{"length", n})
 	}
+	return err
 }
 
 // SimpleFileSender 负责处理一个接收到的 SimpleFile 类型的 Packet
-type SimpleFileReceiver struct{}
+type SimpleFileReceiver struct {
+	Dir      string    // 收到的文件保存到这个目录, "" 表示当前目录
+	Progress *Progress // 向它报告进度, nil 表示 DefaultProgress
+}
 
 func NewSimpleFileReceiver() *SimpleFileReceiver {
 	return &SimpleFileReceiver{}
 }
 
+// NewSimpleFileReceiverIn 新建一个把文件保存到 dir 的 SimpleFileReceiver
+func NewSimpleFileReceiverIn(dir string) *SimpleFileReceiver {
+	return &SimpleFileReceiver{Dir: dir}
+}
+
 func (s SimpleFileReceiver) Receive(packet *Packet, conn net.Conn) chan bool {
 	done := make(chan bool, 1)
 
 	if packet.Type != PacketTypeSimpleFile {
-		log.Fatal("SimpleFileReceiver got a no SimpleFile packet:", packet.Header)
+		logError("SimpleFileReceiver got a no SimpleFile packet", fPeer(conn), Field{"type", packet.Type})
+		done <- false
+		return done
 	}
 	sf := PacketAsSimpleFile(packet)
 
-	file, err := os.OpenFile(sf.FileName(), os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
-	if err != nil {
-		fmt.Printf("[SimpleFile] %s: save failed: %v\n", sf.FileName(), err)
-		done <- false
-		return done
+	// 整个文件已经读到了, 剩下的只是写到磁盘
+	progress := progressOf(s.Progress)
+	var peer string
+	if conn != nil {
+		peer = conn.RemoteAddr().String()
 	}
-	defer file.Close()
+	DefaultEvents.Emit(Event{Type: EventHeader, Direction: ProgressRecv, Peer: peer,
+		Name: sf.FileName(), Size: uint64(sf.DataSize)})
+	progress.Start(ProgressRecv, sf.FileName(), sf.FileName(), peer, uint64(sf.DataSize), uint64(sf.DataSize))
 
-	if _, err := sf.WriteFileContent(file); err != nil {
-		fmt.Printf("[SimpleFile] %s: save failed: %v\n", sf.FileName(), err)
+	err := s.save(sf)
+	progress.Finish(ProgressRecv, sf.FileName(), err)
+	if err != nil {
+		logError("[SimpleFile] save failed", fName(sf.FileName()), fErr(err))
+		emitFailed(Event{Direction: ProgressRecv, Peer: peer, Name: sf.FileName()}, ErrCodeIO, err)
 		done <- false
 		return done
 	}
 
-	fmt.Printf("[SimpleFile] %s: %d Bytes saved.\n", sf.FileName(), sf.DataSize)
+	if compression := packet.WireCompression(); compression != CompressionNone {
+		logInfo("[SimpleFile] saved", fName(sf.FileName()), Field{"size", sf.DataSize},
+			Field{"wire", packet.WireDataSize()}, Field{"compression", compression})
+	} else {
+		logInfo("[SimpleFile] saved", fName(sf.FileName()), Field{"size", sf.DataSize})
+	}
 
 	done <- true
 	return done
 }
 
+// save 把 sf 保存到 Dir 里
+func (s SimpleFileReceiver) save(sf *SimpleFile) error {
+	name, err := saveFilePath(s.Dir, sf.FileName())
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0666)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = sf.WriteFileContent(file)
+	return err
+}
+
+// saveFilePath 返回把对方发来的文件 name 保存到目录 dir 的路径。
+// name 可以带子目录 (例如 "a/b.txt"), 但不能是绝对路径, 也不能用 ".." 跑到 dir 外面去。
+func saveFilePath(dir string, name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if clean == "." || filepath.IsAbs(clean) || clean == ".." ||
+		strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid file name: %q", name)
+	}
+	return filepath.Join(dir, clean), nil
+}
+
 // 注册 SimpleFileSender
 func init() {
 	DistributerInstance().Register(PacketTypeSimpleFile, NewSimpleFileReceiver())
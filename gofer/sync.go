@@ -0,0 +1,541 @@
+package gofer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 目录同步！！
+// gofer sync SRC HOST:DST 把本地目录 SRC 单向同步到对方 (Daemon) 收件箱里的 DST:
+//
+//  1. 客户端发送 ManifestRequest, Daemon 回一个 ManifestResponse: DST 下所有文件的清单
+//  2. 客户端把它和本地 SRC 的清单比较 (大小 + 修改时间, 或者 md5), 得出要做的事 (SyncAction)
+//  3. 客户端发送 SyncOp 删除对方多余的文件 (只有 --delete 时)
+//  4. 客户端推送新的、变了的文件 (SimpleFile 或 BigFile), 然后发送 SyncOp 设置它的修改时间,
+//     这样下次比较的时候就知道它没变
+//
+// Daemon 对每个 SyncOp 回传它自己表示成功, 失败则回 ErrorPacket。
+//
+// 双向同步 (--bidirectional) 见 sync_bidirectional.go。
+
+// ManifestRequest 是客户端请求一个目录下所有文件清单的 Packet
+//
+// ManifestRequest is Packet that:
+//  - Type: 15
+//  - Info: string, `path` relative to the inbox
+//  - Data: flags (const 1 Byte), ManifestWithHash: include md5 of files
+type ManifestRequest struct {
+	*Packet
+	path  string // just a name, do not use this, call Getter/Setter instead
+	flags byte   // just a name, do not use this, call Getter/Setter instead
+}
+
+const PacketTypeManifestRequest uint16 = 15
+
+// ManifestRequest 的 flags
+const ManifestWithHash byte = 1 << 0
+
+func NewManifestRequest(path string, flags byte) *ManifestRequest {
+	return &ManifestRequest{
+		Packet: NewPacket(PacketTypeManifestRequest, []byte(path), []byte{flags}),
+	}
+}
+
+// PacketAsManifestRequest convert packet to ManifestRequest
+// Notice: only for packets whose Type==PacketTypeManifestRequest
+func PacketAsManifestRequest(packet *Packet) *ManifestRequest {
+	return &ManifestRequest{Packet: packet}
+}
+
+func (r ManifestRequest) Path() string {
+	return string(r.Info)
+}
+
+func (r *ManifestRequest) SetPath(path string) {
+	r.Info = []byte(path)
+	r.InfoSize = uint32(len(r.Info))
+}
+
+func (r ManifestRequest) Flags() byte {
+	if len(r.Data) < 1 {
+		return 0
+	}
+	return r.Data[0]
+}
+
+func (r *ManifestRequest) SetFlags(flags byte) {
+	r.Data = []byte{flags}
+	r.DataSize = 1
+}
+
+// ManifestResponse 是一个目录下所有文件 (递归) 的清单
+//
+// ManifestResponse is Packet that:
+//  - Type: 16
+//  - Info: string, `path`
+//  - Data: json: [entry, ...], entry 同 ListEntry, 但 Name 是相对于 path 的路径 (用 '/' 分隔)
+type ManifestResponse struct {
+	*Packet
+	path string // just a name, do not use this, call Getter/Setter instead
+
+	Entries []ListEntry
+}
+
+const PacketTypeManifestResponse uint16 = 16
+
+func NewManifestResponse(path string, entries []ListEntry) *ManifestResponse {
+	if entries == nil {
+		entries = []ListEntry{}
+	}
+	r := &ManifestResponse{
+		Packet:  NewPacket(PacketTypeManifestResponse, []byte(path), make([]byte, 0)),
+		Entries: entries,
+	}
+	r.Data, _ = json.Marshal(r.Entries)
+	r.DataSize = uint32(len(r.Data))
+	return r
+}
+
+// PacketAsManifestResponse convert packet to ManifestResponse
+// Notice: only for packets whose Type==PacketTypeManifestResponse
+func PacketAsManifestResponse(packet *Packet) (*ManifestResponse, error) {
+	r := &ManifestResponse{Packet: packet}
+	if err := json.Unmarshal(packet.Data, &r.Entries); err != nil {
+		return nil, fmt.Errorf("bad manifest response: %v", err)
+	}
+	return r, nil
+}
+
+func (r ManifestResponse) Path() string {
+	return string(r.Info)
+}
+
+// SyncOp 是客户端请求对方修改收件箱里的文件的 Packet
+//
+// SyncOp is Packet that:
+//  - Type: 17
+//  - Info: string, `op`: SyncOpDelete, SyncOpChtimes or SyncOpGet
+//  - Data: json: {path, mtime, name}
+type SyncOp struct {
+	*Packet
+	op string // just a name, do not use this, call Getter/Setter instead
+
+	SyncOpArgs
+}
+
+// SyncOpArgs 是 SyncOp 中 Data 部分的内容
+type SyncOpArgs struct {
+	Path    string    `json:"path"`           // 相对于收件箱的路径
+	ModTime time.Time `json:"mtime"`          // SyncOpChtimes: 要设置的修改时间
+	Name    string    `json:"name,omitempty"` // SyncOpGet: 让客户端把文件保存为 name
+}
+
+const PacketTypeSyncOp uint16 = 17
+
+// SyncOp 的操作
+const (
+	SyncOpDelete  = "delete"  // 删除文件或目录 (递归)
+	SyncOpChtimes = "chtimes" // 设置修改时间
+	SyncOpGet     = "get"     // 把文件发给客户端 (SimpleFile 或 BigFile), 发完再回传
+)
+
+func NewSyncOp(op string, args SyncOpArgs) *SyncOp {
+	s := &SyncOp{
+		Packet:     NewPacket(PacketTypeSyncOp, []byte(op), make([]byte, 0)),
+		SyncOpArgs: args,
+	}
+	s.Data, _ = json.Marshal(s.SyncOpArgs)
+	s.DataSize = uint32(len(s.Data))
+	return s
+}
+
+// PacketAsSyncOp convert packet to SyncOp
+// Notice: only for packets whose Type==PacketTypeSyncOp
+func PacketAsSyncOp(packet *Packet) (*SyncOp, error) {
+	s := &SyncOp{Packet: packet}
+	if err := json.Unmarshal(packet.Data, &s.SyncOpArgs); err != nil {
+		return nil, fmt.Errorf("bad sync op: %v", err)
+	}
+	return s, nil
+}
+
+func (s SyncOp) Op() string {
+	return string(s.Info)
+}
+
+// buildManifest 递归列出 root 下的所有文件和目录, 不包括 root 自己。
+// 符号链接等特殊文件、BigFileReceiverWorker 的临时目录会被跳过;
+// skip 不为 nil 时, 它返回 true 的也跳过 (目录则整个跳过)。
+func buildManifest(root string, withHash bool, skip func(rel string, isDir bool) bool) ([]ListEntry, error) {
+	entries := []ListEntry{}
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		isDir := info.IsDir()
+		if (isDir && isBigFileSaveDir(info.Name())) || (skip != nil && skip(rel, isDir)) {
+			if isDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isDir && !info.Mode().IsRegular() {
+			return nil
+		}
+
+		e := listEntryFromFileInfo(info, p)
+		e.Name = rel
+		if withHash && !isDir && e.Hash == "" {
+			hash, _, err := FileHash(p)
+			if err != nil {
+				return err
+			}
+			e.Hash = FileIDString(hash)
+		}
+		entries = append(entries, e)
+		return nil
+	})
+	return entries, err
+}
+
+// isBigFileSaveDir 检查 name 是不是 BigFileReceiverWorker 保存分块的临时目录: "." + fileID
+func isBigFileSaveDir(name string) bool {
+	if len(name) != 1+32 || name[0] != '.' {
+		return false
+	}
+	for _, c := range name[1:] {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return false
+		}
+	}
+	return true
+}
+
+// SyncFilter 用 include / exclude 模式决定哪些文件参与同步。
+// 模式是 path.Match 的语法, 和相对路径或者文件名匹配上都算。
+//
+//  - 匹配 Exclude 的文件和目录 (及其下所有东西) 不参与同步
+//  - Include 不为空时, 只有匹配 Include 的文件参与同步 (目录总是会进去看看)
+//
+// 不参与同步的文件, 即使 --delete 也不会在对方那里被删掉。
+type SyncFilter struct {
+	Include []string
+	Exclude []string
+}
+
+// skips 检查相对路径为 rel 的文件 (或目录) 是否不参与同步。
+// 双向同步的状态库 SyncStateFile 总是不参与同步。
+func (f SyncFilter) skips(rel string, isDir bool) bool {
+	if rel == SyncStateFile || matchAnyPattern(f.Exclude, rel) {
+		return true
+	}
+	return !isDir && len(f.Include) > 0 && !matchAnyPattern(f.Include, rel)
+}
+
+// skipsWithParents 和 skips 一样, 不过 rel 的上级目录被排除的话也算
+func (f SyncFilter) skipsWithParents(rel string, isDir bool) bool {
+	for dir := path.Dir(rel); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if f.skips(dir, true) {
+			return true
+		}
+	}
+	return f.skips(rel, isDir)
+}
+
+func matchAnyPattern(patterns []string, rel string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SyncOptions 是 gofer sync 的选项
+type SyncOptions struct {
+	Delete   bool // 删除对方有、本地没有的文件 (双向同步时总是同步删除)
+	DryRun   bool // 只计算要做的事 (SyncClient.Plan), 不真的去做
+	Checksum bool // 用 md5 而不是 大小 + 修改时间 比较文件是否变了
+	Filter   SyncFilter
+
+	Bidirectional bool                        // 双向同步
+	Conflict      string                      // 双向同步时冲突的解决策略: SyncConflictNewest, SyncConflictKeepBoth, SyncConflictAsk
+	Ask           func(c SyncConflict) string // SyncConflictAsk 时询问用户, 返回 SyncResolveLocal, SyncResolveRemote 或 SyncResolveBoth
+}
+
+// SyncAction 是同步要做的一件事
+type SyncAction struct {
+	Op   string `json:"op"`   // SyncActionXxx
+	Path string `json:"path"` // 相对于 SRC 和 DST 的路径
+	Size int64  `json:"size"` // SyncActionPush, SyncActionPull: 文件大小
+}
+
+const (
+	SyncActionPush        = "push"         // 推送本地文件
+	SyncActionDelete      = "delete"       // 删除对方的文件
+	SyncActionPull        = "pull"         // 下载对方的文件 (双向同步)
+	SyncActionDeleteLocal = "delete-local" // 删除本地的文件 (双向同步)
+	SyncActionConflict    = "conflict"     // 两边都改了 (双向同步), 执行时按策略解决
+)
+
+func (a SyncAction) String() string {
+	if a.Op == SyncActionPush || a.Op == SyncActionPull {
+		return fmt.Sprintf("%s %s (%d Bytes)", a.Op, a.Path, a.Size)
+	}
+	return fmt.Sprintf("%s %s", a.Op, a.Path)
+}
+
+// planSync 比较本地清单 local 和对方清单 remote, 得出要做的事: 先删除, 后推送
+func planSync(local []ListEntry, remote []ListEntry, opts SyncOptions) []SyncAction {
+	localMap := map[string]ListEntry{}
+	for _, e := range local {
+		localMap[e.Name] = e
+	}
+	remoteMap := map[string]ListEntry{}
+	for _, e := range remote {
+		remoteMap[e.Name] = e
+	}
+
+	// 删除: 对方多余的, 以及 文件/目录 类型和本地不一样的
+	var deletes []string
+	for _, r := range remote {
+		if opts.Filter.skipsWithParents(r.Name, r.Type == ListEntryDir) {
+			continue
+		}
+		l, ok := localMap[r.Name]
+		if opts.Delete && (!ok || l.Type != r.Type) {
+			deletes = append(deletes, r.Name)
+		}
+	}
+	sort.Strings(deletes)
+
+	var plan []SyncAction
+	deleted := map[string]bool{}
+	for _, p := range deletes {
+		if parentIn(p, deleted) { // 上级目录已经整个删掉了
+			continue
+		}
+		deleted[p] = true
+		plan = append(plan, SyncAction{Op: SyncActionDelete, Path: p})
+	}
+
+	// 推送: 新的, 以及变了的
+	for _, l := range local {
+		if l.Type != ListEntryFile {
+			continue // 目录会随着里面的文件建出来, 空目录不同步
+		}
+		r, ok := remoteMap[l.Name]
+		switch {
+		case ok && r.Type != ListEntryFile && !deleted[l.Name]:
+			continue // 对方这里是个目录, 又不让删, 只好跳过 (和 rsync 一样)
+		case ok && !deleted[l.Name] && !parentIn(l.Name, deleted) && sameFile(l, r, opts.Checksum):
+			continue
+		}
+		plan = append(plan, SyncAction{Op: SyncActionPush, Path: l.Name, Size: l.Size})
+	}
+	return plan
+}
+
+// parentIn 检查 p 的某个上级目录是否在 dirs 里
+func parentIn(p string, dirs map[string]bool) bool {
+	for dir := path.Dir(p); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if dirs[dir] {
+			return true
+		}
+	}
+	return false
+}
+
+// sameFile 检查本地文件 l 和对方文件 r 是否相同
+func sameFile(l ListEntry, r ListEntry, checksum bool) bool {
+	if l.Size != r.Size {
+		return false
+	}
+	if checksum {
+		return l.Hash != "" && l.Hash == r.Hash
+	}
+	// 精确到秒, 有的文件系统存不了更精确的时间
+	return l.ModTime.Unix() == r.ModTime.Unix()
+}
+
+// SyncClient 把本地目录 Src 同步到对方收件箱里的 Dst, 实现 Client 接口
+//
+// 完成后 Plan 是计算出的要做的事, 出错的话 Err 不为 nil。
+type SyncClient struct {
+	Src string
+	Dst string
+	SyncOptions
+	// StateKey 在双向同步的状态库中区分不同的对方, 一般是 "HOST:PORT:DST"; 默认为 Dst
+	StateKey string
+
+	Plan []SyncAction
+	Err  error
+
+	bigFileSender *BigFileSender
+	distributer   *Distributer // 双向同步时处理下载的文件
+}
+
+func NewSyncClient(src string, dst string, opts SyncOptions) *SyncClient {
+	return &SyncClient{
+		Src:           src,
+		Dst:           dst,
+		SyncOptions:   opts,
+		bigFileSender: NewBigFileSender(),
+	}
+}
+
+func (s *SyncClient) Do(conn net.Conn) chan bool {
+	done := make(chan bool, 1)
+
+	go func() {
+		s.Err = s.sync(conn)
+		done <- s.Err == nil
+	}()
+
+	return done
+}
+
+// sync 比较两边的清单, 然后 (除非 DryRun) 依次执行 Plan
+func (s *SyncClient) sync(conn net.Conn) error {
+	if info, err := os.Stat(s.Src); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return fmt.Errorf("%s: not a directory", s.Src)
+	}
+
+	local, err := buildManifest(s.Src, s.Checksum, s.Filter.skips)
+	if err != nil {
+		return err
+	}
+	remote, err := s.remoteManifest(conn)
+	if err != nil {
+		return err
+	}
+
+	if s.Bidirectional {
+		return s.syncBidirectional(conn, local, remote)
+	}
+
+	s.Plan = planSync(local, remote, s.SyncOptions)
+	if s.DryRun {
+		return nil
+	}
+
+	modTimes := map[string]time.Time{}
+	for _, e := range local {
+		modTimes[e.Name] = e.ModTime
+	}
+
+	for _, a := range s.Plan {
+		logInfo("SyncClient: "+a.Op, Field{"path", a.Path})
+		remotePath := path.Join(s.Dst, a.Path)
+
+		switch a.Op {
+		case SyncActionDelete:
+			err = s.doSyncOp(conn, NewSyncOp(SyncOpDelete, SyncOpArgs{Path: remotePath}))
+		case SyncActionPush:
+			err = s.push(conn, filepath.Join(s.Src, filepath.FromSlash(a.Path)), remotePath)
+			if err == nil {
+				err = s.doSyncOp(conn, NewSyncOp(SyncOpChtimes,
+					SyncOpArgs{Path: remotePath, ModTime: modTimes[a.Path]}))
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", a, err)
+		}
+	}
+	return nil
+}
+
+// remoteManifest 请求对方 Dst 下的文件清单
+func (s *SyncClient) remoteManifest(conn net.Conn) ([]ListEntry, error) {
+	var flags byte
+	if s.Checksum {
+		flags |= ManifestWithHash
+	}
+	if _, err := NewManifestRequest(s.Dst, flags).WriteTo(conn); err != nil {
+		return nil, err
+	}
+	packet, err := readReply(conn, PacketTypeManifestResponse)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := PacketAsManifestResponse(packet)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Entries, nil
+}
+
+// push 把本地文件 localPath 推送到对方收件箱, 保存为 remotePath
+func (s *SyncClient) push(conn net.Conn, localPath string, remotePath string) error {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+
+	if info.Size() <= int64(DefaultBlockSize) {
+		content, err := ioutil.ReadFile(localPath)
+		if err != nil {
+			return err
+		}
+		_, err = NewPacket(PacketTypeSimpleFile, []byte(remotePath), content).WriteTo(conn)
+		return err
+	}
+
+	fileID, err := s.bigFileSender.AppendFileAs(localPath, remotePath)
+	if err != nil {
+		return err
+	}
+	return s.bigFileSender.SendFile(conn, fileID)
+}
+
+// doSyncOp 发送 op, 等待对方回传
+func (s *SyncClient) doSyncOp(conn net.Conn, op *SyncOp) error {
+	if _, err := op.WriteTo(conn); err != nil {
+		return err
+	}
+	_, err := readReply(conn, PacketTypeSyncOp)
+	return err
+}
+
+// readReply 读取对方回复的类型为 want 的 Packet, 对方回 ErrorPacket 的话返回这个错误。
+// 前面 BigFile 传输残留的 BigFileHeader 回传会被跳过。
+func readReply(conn net.Conn, want uint16) (*Packet, error) {
+	for {
+		packet, err := PacketFromReader(conn)
+		if err != nil {
+			return nil, err
+		}
+		switch packet.Type {
+		case want:
+			return packet, nil
+		case PacketTypeError:
+			return nil, PacketAsErrorPacket(packet)
+		case PacketTypeBigFileHeader:
+			continue
+		default:
+			return nil, fmt.Errorf("unexpected packet: %v", packet.Header)
+		}
+	}
+}
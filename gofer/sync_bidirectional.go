@@ -0,0 +1,392 @@
+package gofer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// 双向同步！！
+// 两台机器共用一个工作目录, 两边都可能改。只比较两边现在的样子是不够的:
+// 一边有、另一边没有的文件, 是一边新建的, 还是另一边删掉的?
+//
+// 所以客户端在 SRC 下保存一个状态库 (SyncStateFile), 记录上次同步完成时每个文件的版本 (那时两边是一样的)。
+// 和它比较就知道每一边改了什么:
+//
+//  - 只有一边变了 (改了、新建了或者删了): 把变化传到另一边
+//  - 两边都变了, 而且变得不一样: 冲突, 按 SyncOptions.Conflict 解决
+//
+// 删掉的文件在状态库里还有记录, 所以不会被另一边的旧版本"复活"。
+// 双向同步只管文件, 目录随着文件建出来, 空目录不会被删掉。
+
+// SyncStateFile 是双向同步的状态库的文件名, 保存在 SRC 下, 不参与同步
+const SyncStateFile = ".gofer-sync.json"
+
+// SyncState 是双向同步的状态库: {StateKey: {path: 上次同步完成时的文件}}
+type SyncState map[string]map[string]ListEntry
+
+// LoadSyncState 从文件读取状态库, 文件不存在则返回空的状态库
+func LoadSyncState(filename string) (SyncState, error) {
+	state := SyncState{}
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("bad sync state %s: %v", filename, err)
+	}
+	return state, nil
+}
+
+// Save 把状态库写到文件里 (先写临时文件再改名, 不会写坏)
+func (s SyncState) Save(filename string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// 冲突的解决策略
+const (
+	SyncConflictNewest   = "newest"    // 修改时间新的赢; 一边改了一边删了的话, 改了的赢
+	SyncConflictKeepBoth = "keep-both" // 两个版本都留下: 对方的版本改名为 "name.conflict-TIME.ext"
+	SyncConflictAsk      = "ask"       // 问用户 (SyncOptions.Ask)
+)
+
+// 冲突的解决办法
+const (
+	SyncResolveLocal  = "local"  // 用本地的版本
+	SyncResolveRemote = "remote" // 用对方的版本
+	SyncResolveBoth   = "both"   // 两个都留下
+)
+
+// SyncConflict 是双向同步时两边都改了的一个文件
+type SyncConflict struct {
+	Path   string
+	Local  *ListEntry // 本地的版本, nil 表示被删了
+	Remote *ListEntry // 对方的版本, nil 表示被删了
+}
+
+// bidirectionalView 是双向同步计算中, 一个路径在 本地、对方、状态库 里的样子 (nil 表示没有)
+type bidirectionalView struct {
+	local, remote, base *ListEntry
+}
+
+// bidirectionalViews 把三份清单按路径合到一起, 只看文件, 不参与同步的跳过
+func bidirectionalViews(local []ListEntry, remote []ListEntry, base map[string]ListEntry,
+	filter SyncFilter) map[string]*bidirectionalView {
+	views := map[string]*bidirectionalView{}
+	view := func(name string) *bidirectionalView {
+		if views[name] == nil {
+			views[name] = &bidirectionalView{}
+		}
+		return views[name]
+	}
+	for i := range local {
+		if local[i].Type == ListEntryFile {
+			view(local[i].Name).local = &local[i]
+		}
+	}
+	for i := range remote {
+		if remote[i].Type == ListEntryFile && !filter.skipsWithParents(remote[i].Name, false) {
+			view(remote[i].Name).remote = &remote[i]
+		}
+	}
+	for name := range base {
+		if !filter.skipsWithParents(name, false) {
+			e := base[name]
+			view(name).base = &e
+		}
+	}
+	return views
+}
+
+// changed 检查文件 now 相对于上次同步完成时的版本 base 是否变了
+func changed(now *ListEntry, base *ListEntry, checksum bool) bool {
+	if now == nil || base == nil {
+		return now != base
+	}
+	return !sameFile(*now, *base, checksum)
+}
+
+// planBidirectional 比较 本地、对方、状态库, 得出双向同步要做的事 (按路径排序)
+func planBidirectional(views map[string]*bidirectionalView, checksum bool) []SyncAction {
+	var names []string
+	for name := range views {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var plan []SyncAction
+	for _, name := range names {
+		v := views[name]
+		localChanged := changed(v.local, v.base, checksum)
+		remoteChanged := changed(v.remote, v.base, checksum)
+
+		switch {
+		case !localChanged && !remoteChanged:
+		case localChanged && !remoteChanged && v.local == nil:
+			plan = append(plan, SyncAction{Op: SyncActionDelete, Path: name})
+		case localChanged && !remoteChanged:
+			plan = append(plan, SyncAction{Op: SyncActionPush, Path: name, Size: v.local.Size})
+		case remoteChanged && !localChanged && v.remote == nil:
+			plan = append(plan, SyncAction{Op: SyncActionDeleteLocal, Path: name})
+		case remoteChanged && !localChanged:
+			plan = append(plan, SyncAction{Op: SyncActionPull, Path: name, Size: v.remote.Size})
+		case v.local == nil && v.remote == nil: // 两边都删了
+		case v.local != nil && v.remote != nil && sameFile(*v.local, *v.remote, checksum): // 两边改得一样
+		default:
+			plan = append(plan, SyncAction{Op: SyncActionConflict, Path: name})
+		}
+	}
+	return plan
+}
+
+// resolveNewest 按 SyncConflictNewest 策略解决冲突
+func resolveNewest(c SyncConflict) string {
+	switch {
+	case c.Remote == nil:
+		return SyncResolveLocal
+	case c.Local == nil:
+		return SyncResolveRemote
+	case c.Remote.ModTime.After(c.Local.ModTime):
+		return SyncResolveRemote
+	default:
+		return SyncResolveLocal
+	}
+}
+
+// resolve 按 s.Conflict 策略解决冲突 c, 返回 SyncResolveXxx
+func (s *SyncClient) resolve(c SyncConflict) (string, error) {
+	switch s.Conflict {
+	case SyncConflictNewest:
+		return resolveNewest(c), nil
+	case SyncConflictKeepBoth, "":
+		return SyncResolveBoth, nil
+	case SyncConflictAsk:
+		if s.Ask == nil {
+			return "", fmt.Errorf("no way to ask about the conflict")
+		}
+		switch r := s.Ask(c); r {
+		case SyncResolveLocal, SyncResolveRemote, SyncResolveBoth:
+			return r, nil
+		default:
+			return "", fmt.Errorf("unknown resolution %q", r)
+		}
+	default:
+		return "", fmt.Errorf("unknown conflict policy %q", s.Conflict)
+	}
+}
+
+// conflictName 返回冲突时对方版本的新名字: "dir/name.conflict-20060102-150405.ext"
+func conflictName(name string, e *ListEntry) string {
+	ext := path.Ext(name)
+	return fmt.Sprintf("%s.conflict-%s%s",
+		strings.TrimSuffix(name, ext), e.ModTime.Local().Format("20060102-150405"), ext)
+}
+
+// syncBidirectional 执行双向同步, 完成的部分记录到状态库里
+func (s *SyncClient) syncBidirectional(conn net.Conn, local []ListEntry, remote []ListEntry) (err error) {
+	stateFile := filepath.Join(s.Src, SyncStateFile)
+	state, err := LoadSyncState(stateFile)
+	if err != nil {
+		return err
+	}
+	key := s.StateKey
+	if key == "" {
+		key = s.Dst
+	}
+	base := state[key]
+	if base == nil {
+		base = map[string]ListEntry{}
+	}
+
+	views := bidirectionalViews(local, remote, base, s.Filter)
+	s.Plan = planBidirectional(views, s.Checksum)
+	if s.DryRun {
+		return nil
+	}
+
+	// 两边本来就一样的文件 (例如第一次同步时), 直接记下来
+	for name, v := range views {
+		switch {
+		case v.local != nil && v.remote != nil && sameFile(*v.local, *v.remote, s.Checksum):
+			base[name] = *v.local
+		case v.local == nil && v.remote == nil:
+			delete(base, name)
+		}
+	}
+	state[key] = base
+	defer func() {
+		if e := state.Save(stateFile); e != nil && err == nil {
+			err = e
+		}
+	}()
+
+	for _, a := range s.Plan {
+		logInfo("SyncClient: "+a.Op, Field{"path", a.Path})
+		v := views[a.Path]
+
+		op := a.Op
+		if op == SyncActionConflict {
+			resolution, err := s.resolve(SyncConflict{Path: a.Path, Local: v.local, Remote: v.remote})
+			if err != nil {
+				return fmt.Errorf("%s: %v", a, err)
+			}
+			if resolution == SyncResolveBoth && (v.local == nil || v.remote == nil) {
+				// 一边删了一边改了: 留下改了的那个就是两个都留下了
+				resolution = resolveNewest(SyncConflict{Local: v.local, Remote: v.remote})
+			}
+			logInfo("SyncClient: resolve conflict", Field{"path", a.Path}, Field{"resolution", resolution})
+			op = s.resolvedAction(resolution, v)
+		}
+
+		if err := s.doBidirectional(conn, op, a.Path, v, base); err != nil {
+			return fmt.Errorf("%s: %v", a, err)
+		}
+	}
+	return nil
+}
+
+// syncActionKeepBoth 是冲突以 SyncResolveBoth 解决时要做的事:
+// 对方的版本改名下载下来, 再把两个版本都推送过去
+const syncActionKeepBoth = "keep-both"
+
+// resolvedAction 把冲突的解决办法 resolution 变成要做的事
+func (s *SyncClient) resolvedAction(resolution string, v *bidirectionalView) string {
+	switch {
+	case resolution == SyncResolveBoth:
+		return syncActionKeepBoth
+	case resolution == SyncResolveLocal && v.local == nil:
+		return SyncActionDelete
+	case resolution == SyncResolveLocal:
+		return SyncActionPush
+	case v.remote == nil:
+		return SyncActionDeleteLocal
+	default:
+		return SyncActionPull
+	}
+}
+
+// doBidirectional 对路径 name 做 op, 成功后更新状态库 base
+func (s *SyncClient) doBidirectional(conn net.Conn, op string, name string,
+	v *bidirectionalView, base map[string]ListEntry) error {
+	remotePath := path.Join(s.Dst, name)
+	localPath := filepath.Join(s.Src, filepath.FromSlash(name))
+
+	switch op {
+	case SyncActionPush:
+		if err := s.pushWithModTime(conn, localPath, remotePath, v.local); err != nil {
+			return err
+		}
+		base[name] = *v.local
+	case SyncActionDelete:
+		if err := s.doSyncOp(conn, NewSyncOp(SyncOpDelete, SyncOpArgs{Path: remotePath})); err != nil {
+			return err
+		}
+		delete(base, name)
+	case SyncActionPull:
+		if err := s.pull(conn, remotePath, name, v.remote); err != nil {
+			return err
+		}
+		base[name] = *v.remote
+	case SyncActionDeleteLocal:
+		if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		delete(base, name)
+	case syncActionKeepBoth:
+		renamed := conflictName(name, v.remote)
+		if err := s.pull(conn, remotePath, renamed, v.remote); err != nil {
+			return err
+		}
+		if err := s.pushWithModTime(conn, localPath, remotePath, v.local); err != nil {
+			return err
+		}
+		base[name] = *v.local
+
+		e := *v.remote
+		e.Name = renamed
+		err := s.pushWithModTime(conn, filepath.Join(s.Src, filepath.FromSlash(renamed)),
+			path.Join(s.Dst, renamed), &e)
+		if err != nil {
+			return err
+		}
+		base[renamed] = e
+	}
+	return nil
+}
+
+// pushWithModTime 推送本地文件, 并把对方文件的修改时间设置为 e.ModTime
+func (s *SyncClient) pushWithModTime(conn net.Conn, localPath string, remotePath string, e *ListEntry) error {
+	if err := s.push(conn, localPath, remotePath); err != nil {
+		return err
+	}
+	return s.doSyncOp(conn, NewSyncOp(SyncOpChtimes, SyncOpArgs{Path: remotePath, ModTime: e.ModTime}))
+}
+
+// pull 下载对方收件箱里的 remotePath, 保存为 Src 下的 name, 修改时间设置为 e.ModTime
+func (s *SyncClient) pull(conn net.Conn, remotePath string, name string, e *ListEntry) error {
+	if _, err := NewSyncOp(SyncOpGet, SyncOpArgs{Path: remotePath, Name: name}).WriteTo(conn); err != nil {
+		return err
+	}
+
+	received := false
+	for {
+		packet, err := PacketFromReader(conn)
+		if err != nil {
+			return err
+		}
+		switch packet.Type {
+		case PacketTypeSyncOp: // 发完了
+			if !received {
+				return fmt.Errorf("nothing received")
+			}
+			localPath := filepath.Join(s.Src, filepath.FromSlash(name))
+			return os.Chtimes(localPath, e.ModTime, e.ModTime)
+		case PacketTypeError:
+			return PacketAsErrorPacket(packet)
+		case PacketTypeBigFileHeader:
+			if received {
+				continue // 对方重发的 header 来晚了, 不要再回传, 不然对方会以为我们要推送这个文件
+			}
+			fallthrough
+		case PacketTypeSimpleFile:
+			if ok := <-s.pullDistributer().Receive(packet, conn); !ok {
+				return fmt.Errorf("receive failed")
+			}
+			received = true
+		case PacketTypeBigFileResponse: // 多请求了一次的块来晚了, 交给 BigFileReceiver 丢掉
+			<-s.pullDistributer().Receive(packet, conn)
+		default:
+			return fmt.Errorf("unexpected packet: %v", packet.Header)
+		}
+	}
+}
+
+// pullDistributer 返回处理下载的文件的 Distributer: 文件保存到 Src 下
+func (s *SyncClient) pullDistributer() *Distributer {
+	if s.distributer == nil {
+		s.distributer = &Distributer{}
+		bigFile := NewBigFileReceiverIn(s.Src, s.distributer)
+		s.distributer.Register(PacketTypeSimpleFile, NewSimpleFileReceiverIn(s.Src))
+		s.distributer.Register(PacketTypeBigFileHeader, bigFile)
+		s.distributer.Register(PacketTypeBigFileResponse, bigFile)
+		s.distributer.Register(PacketTypeError, NewErrorPacketReceiver())
+	}
+	return s.distributer
+}
@@ -0,0 +1,145 @@
+package gofer
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSyncFilter(t *testing.T) {
+	f := SyncFilter{Include: []string{"*.go"}, Exclude: []string{"vendor", "*_test.go"}}
+	tests := []struct {
+		rel   string
+		isDir bool
+		want  bool
+	}{
+		{"main.go", false, false},
+		{"pkg/a.go", false, false},
+		{"pkg/a_test.go", false, true},
+		{"README.md", false, true},
+		{"pkg", true, false},
+		{"vendor", true, true},
+	}
+	for _, tt := range tests {
+		if got := f.skips(tt.rel, tt.isDir); got != tt.want {
+			t.Errorf("skips(%q) = %v, want %v", tt.rel, got, tt.want)
+		}
+	}
+	if !f.skipsWithParents("vendor/x/y.go", false) {
+		t.Error("files in an excluded directory should be skipped")
+	}
+}
+
+func TestPlanSync(t *testing.T) {
+	t0 := time.Unix(1600000000, 0)
+	t1 := t0.Add(time.Hour)
+	file := func(name string, size int64, mtime time.Time) ListEntry {
+		return ListEntry{Name: name, Type: ListEntryFile, Size: size, ModTime: mtime}
+	}
+	dir := func(name string) ListEntry {
+		return ListEntry{Name: name, Type: ListEntryDir}
+	}
+
+	local := []ListEntry{
+		file("same", 1, t0),
+		file("newer", 1, t1),
+		file("new", 1, t0),
+		dir("d"),
+		file("d/x", 1, t0),
+		file("was-dir", 1, t0),
+	}
+	remote := []ListEntry{
+		file("same", 1, t0.Add(time.Millisecond)),
+		file("newer", 1, t0),
+		dir("d"),
+		file("d/x", 1, t0),
+		file("d/extra", 1, t0),
+		dir("gone"),
+		file("gone/y", 1, t0),
+		dir("was-dir"),
+		file("was-dir/z", 1, t0),
+		file("skip.log", 1, t0),
+	}
+	opts := SyncOptions{Delete: true, Filter: SyncFilter{Exclude: []string{"*.log"}}}
+
+	want := []SyncAction{
+		{Op: SyncActionDelete, Path: "d/extra"},
+		{Op: SyncActionDelete, Path: "gone"},
+		{Op: SyncActionDelete, Path: "was-dir"},
+		{Op: SyncActionPush, Path: "newer", Size: 1},
+		{Op: SyncActionPush, Path: "new", Size: 1},
+		{Op: SyncActionPush, Path: "was-dir", Size: 1},
+	}
+	if got := planSync(local, remote, opts); !reflect.DeepEqual(got, want) {
+		t.Errorf("planSync() = %v, want %v", got, want)
+	}
+
+	// 不 --delete 的话, 对方是目录的文件只能跳过
+	opts.Delete = false
+	want = []SyncAction{
+		{Op: SyncActionPush, Path: "newer", Size: 1},
+		{Op: SyncActionPush, Path: "new", Size: 1},
+	}
+	if got := planSync(local, remote, opts); !reflect.DeepEqual(got, want) {
+		t.Errorf("planSync() without delete = %v, want %v", got, want)
+	}
+}
+
+func TestPlanBidirectional(t *testing.T) {
+	t0 := time.Unix(1600000000, 0)
+	t1 := t0.Add(time.Hour)
+	file := func(name string, size int64, mtime time.Time) ListEntry {
+		return ListEntry{Name: name, Type: ListEntryFile, Size: size, ModTime: mtime}
+	}
+
+	base := map[string]ListEntry{
+		"same":           file("same", 1, t0),
+		"local-changed":  file("local-changed", 1, t0),
+		"remote-changed": file("remote-changed", 1, t0),
+		"local-deleted":  file("local-deleted", 1, t0),
+		"remote-deleted": file("remote-deleted", 1, t0),
+		"both-changed":   file("both-changed", 1, t0),
+		"both-deleted":   file("both-deleted", 1, t0),
+		"changed-same":   file("changed-same", 1, t0),
+		"del-vs-mod":     file("del-vs-mod", 1, t0),
+	}
+	local := []ListEntry{
+		file("same", 1, t0),
+		file("local-changed", 2, t1),
+		file("remote-changed", 1, t0),
+		file("remote-deleted", 1, t0),
+		file("both-changed", 2, t1),
+		file("changed-same", 3, t1),
+		file("local-new", 1, t0),
+	}
+	remote := []ListEntry{
+		file("same", 1, t0),
+		file("local-changed", 1, t0),
+		file("remote-changed", 2, t1),
+		file("local-deleted", 1, t0),
+		file("both-changed", 3, t1),
+		file("changed-same", 3, t1),
+		file("del-vs-mod", 2, t1),
+		file("remote-new", 1, t0),
+	}
+
+	want := []SyncAction{
+		{Op: SyncActionConflict, Path: "both-changed"},
+		{Op: SyncActionConflict, Path: "del-vs-mod"},
+		{Op: SyncActionPush, Path: "local-changed", Size: 2},
+		{Op: SyncActionDelete, Path: "local-deleted"},
+		{Op: SyncActionPush, Path: "local-new", Size: 1},
+		{Op: SyncActionPull, Path: "remote-changed", Size: 2},
+		{Op: SyncActionDeleteLocal, Path: "remote-deleted"},
+		{Op: SyncActionPull, Path: "remote-new", Size: 1},
+	}
+	views := bidirectionalViews(local, remote, base, SyncFilter{})
+	if got := planBidirectional(views, false); !reflect.DeepEqual(got, want) {
+		t.Errorf("planBidirectional() = %v, want %v", got, want)
+	}
+
+	c := SyncConflict{Path: "del-vs-mod", Remote: &remote[6]}
+	if got := resolveNewest(c); got != SyncResolveRemote {
+		t.Errorf("resolveNewest(deleted vs modified) = %v, want %v", got, SyncResolveRemote)
+	}
+}
@@ -14,7 +14,6 @@ import (
 	_ "github.com/cdfmlr/gofer/statik"
 	"github.com/rakyll/statik/fs"
 	"io/ioutil"
-	"log"
 	"math/big"
 	mathrand "math/rand"
 	"net"
@@ -110,11 +109,11 @@ func GeneratePEM(hosts []string) (pemCert []byte, pemKey []byte, pin []byte, err
 
 // Generate a self-signed X.509 certificate for a TLS server.
 // https://golang.org/src/crypto/tls/generate_cert.go
-func GenerateCert(hosts []string, isCA bool) {
+func GenerateCert(hosts []string, isCA bool) (derBytes []byte, err error) {
 	bits := 4096
 	priv, err := rsa.GenerateKey(rand.Reader, bits)
 	if err != nil {
-		log.Fatalf("Failed to generate private key: %v", err)
+		return nil, fmt.Errorf("failed to generate private key: %v", err)
 	}
 
 	keyUsage := x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
@@ -125,7 +124,7 @@ func GenerateCert(hosts []string, isCA bool) {
 	serialNumberLimit := new(big.Int).Lsh(big.NewInt(1), 128)
 	serialNumber, err := rand.Int(rand.Reader, serialNumberLimit)
 	if err != nil {
-		log.Fatalf("Failed to generate serial number: %v", err)
+		return nil, fmt.Errorf("failed to generate serial number: %v", err)
 	}
 
 	template := x509.Certificate{
@@ -154,12 +153,11 @@ func GenerateCert(hosts []string, isCA bool) {
 		template.KeyUsage |= x509.KeyUsageCertSign
 	}
 
-	derBytes, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	derBytes, err = x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
 	if err != nil {
-		log.Fatalf("Failed to create certificate: %v", err)
+		return nil, fmt.Errorf("failed to create certificate: %v", err)
 	}
-
-	log.Println(derBytes)
+	return derBytes, nil
 }
 
 // CertTemplate is a helper function to create a cert template with a serial number and other required fields
@@ -203,16 +201,16 @@ func CreateCert(template, parent *x509.Certificate, pub interface{}, parentPriv
 }
 
 func GenerateRootCert() (
-	rootCert *x509.Certificate, rootCertPEM []byte, rootKeyPEM []byte, rootKey *rsa.PrivateKey) {
+	rootCert *x509.Certificate, rootCertPEM []byte, rootKeyPEM []byte, rootKey *rsa.PrivateKey, err error) {
 	// generate a new key-pair
-	rootKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	rootKey, err = rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
-		log.Fatalf("generating random key: %v", err)
+		return nil, nil, nil, nil, fmt.Errorf("generating random key: %v", err)
 	}
 
 	rootCertTmpl, err := CertTemplate()
 	if err != nil {
-		log.Fatalf("creating cert template: %v", err)
+		return nil, nil, nil, nil, fmt.Errorf("creating cert template: %v", err)
 	}
 	// describe what the certificate will be used for
 	rootCertTmpl.IsCA = true
@@ -223,7 +221,7 @@ func GenerateRootCert() (
 
 	rootCert, rootCertPEM, err = CreateCert(rootCertTmpl, rootCertTmpl, &rootKey.PublicKey, rootKey)
 	if err != nil {
-		log.Fatalf("error creating cert: %v", err)
+		return nil, nil, nil, nil, fmt.Errorf("error creating cert: %v", err)
 	}
 	//fmt.Printf("%s\n", rootCertPEM)
 	//fmt.Printf("%#x\n", rootCert.Signature) // more ugly binary
@@ -233,21 +231,21 @@ func GenerateRootCert() (
 		Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rootKey),
 	})
 
-	return rootCert, rootCertPEM, rootKeyPEM, rootKey
+	return rootCert, rootCertPEM, rootKeyPEM, rootKey, nil
 }
 
 func GenerateServCert(rootCert *x509.Certificate, rootKey interface{}) (
-	servCert *x509.Certificate, servCertPEM []byte, servKeyPEM []byte, servKey *rsa.PrivateKey) {
+	servCert *x509.Certificate, servCertPEM []byte, servKeyPEM []byte, servKey *rsa.PrivateKey, err error) {
 	// create a key-pair for the server
-	servKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	servKey, err = rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
-		log.Fatalf("generating random key: %v", err)
+		return nil, nil, nil, nil, fmt.Errorf("generating random key: %v", err)
 	}
 
 	// create a template for the server
 	servCertTmpl, err := CertTemplate()
 	if err != nil {
-		log.Fatalf("creating cert template: %v", err)
+		return nil, nil, nil, nil, fmt.Errorf("creating cert template: %v", err)
 	}
 	servCertTmpl.KeyUsage = x509.KeyUsageDigitalSignature
 	servCertTmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}
@@ -257,7 +255,7 @@ func GenerateServCert(rootCert *x509.Certificate, rootKey interface{}) (
 	// create a certificate which wraps the server's public key, sign it with the root private key
 	servCert, servCertPEM, err = CreateCert(servCertTmpl, rootCert, &servKey.PublicKey, rootKey)
 	if err != nil {
-		log.Fatalf("error creating cert: %v", err)
+		return nil, nil, nil, nil, fmt.Errorf("error creating cert: %v", err)
 	}
 
 	// PEM encode the private key
@@ -265,13 +263,19 @@ func GenerateServCert(rootCert *x509.Certificate, rootKey interface{}) (
 		Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(servKey),
 	})
 
-	return servCert, servCertPEM, servKeyPEM, servKey
+	return servCert, servCertPEM, servKeyPEM, servKey, nil
 }
 
-func GeneratePEMWithRoot() (pemCert []byte, pemKey []byte, rootCertPEM []byte) {
-	rootCert, rootCertPEM, _, rootKey := GenerateRootCert()
-	_, certPEM, keyPEM, _ := GenerateServCert(rootCert, rootKey)
-	return certPEM, keyPEM, rootCertPEM
+func GeneratePEMWithRoot() (pemCert []byte, pemKey []byte, rootCertPEM []byte, err error) {
+	rootCert, rootCertPEM, _, rootKey, err := GenerateRootCert()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	_, certPEM, keyPEM, _, err := GenerateServCert(rootCert, rootKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return certPEM, keyPEM, rootCertPEM, nil
 }
 
 // TODO: 👆以上的代码都没用，都跑不起来。还是用祖传手法 openssl 手动生成证书比较靠谱。
@@ -286,10 +290,10 @@ const (
 // certName 传入 ServerCert 或 ClientCert
 //
 // see static/certs/generate_cert.sh
-func GetCert(certName string) (certPEM []byte, certKey []byte) {
+func GetCert(certName string) (certPEM []byte, certKey []byte, err error) {
 	statikFS, err := fs.New()
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, err
 	}
 
 	pemPath := fmt.Sprintf("/certs/%s.pem", certName)
@@ -297,25 +301,25 @@ func GetCert(certName string) (certPEM []byte, certKey []byte) {
 
 	fPEM, err := statikFS.Open(pemPath)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, err
 	}
 	defer fPEM.Close()
 
 	certPEM, err = ioutil.ReadAll(fPEM)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, err
 	}
 
 	fKey, err := statikFS.Open(keyPath)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, err
 	}
 	defer fKey.Close()
 
 	certKey, err = ioutil.ReadAll(fKey)
 	if err != nil {
-		log.Fatal(err)
+		return nil, nil, err
 	}
 
-	return certPEM, certKey
+	return certPEM, certKey, nil
 }
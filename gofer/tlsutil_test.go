@@ -25,7 +25,10 @@ func TestGeneratePEM(t *testing.T) {
 //}
 
 func TestGenerateRootCert(t *testing.T) {
-	cert, certPEM, keyPEM, key := GenerateRootCert()
+	cert, certPEM, keyPEM, key, err := GenerateRootCert()
+	if err != nil {
+		t.Fatal(err)
+	}
 	t.Log(cert)
 	t.Log(string(certPEM))
 	t.Log(string(keyPEM))
@@ -33,8 +36,14 @@ func TestGenerateRootCert(t *testing.T) {
 }
 
 func TestGenerateServCert(t *testing.T) {
-	rootCert, _, _, rootKey := GenerateRootCert()
-	_, certPEM, keyPEM, _ := GenerateServCert(rootCert, rootKey)
+	rootCert, _, _, rootKey, err := GenerateRootCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, certPEM, keyPEM, _, err := GenerateServCert(rootCert, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
 	t.Log(string(certPEM))
 	t.Log(string(keyPEM))
 }
@@ -0,0 +1,238 @@
+package gofer
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 监视模式！！
+// gofer send -watch DIR -c HOST 一直连着对方, 监视目录 DIR (Linux 上用 inotify, 其他系统定时扫描),
+// DIR 下有文件新建或者修改了, 等它安定下来 (一段时间 Debounce 内没再变), 就推送过去:
+// 小文件用 SimpleFile, 大文件用 BigFile, 文件名是相对于 DIR 的路径。
+//
+// 变了的文件先进入待推送队列。连接断了的话, 没推送成功的文件留在队列里, 重新连上以后接着推送。
+
+// DefaultWatchDebounce 是默认的 Debounce: 文件这么久没变化才推送
+var DefaultWatchDebounce = 2 * time.Second
+
+// WatchDir 开始监视目录 dir, 其下 (递归) 有文件新建或者修改了, 就把文件的路径发到返回的 chan 里。
+// stop 关闭后停止监视, 并关闭返回的 chan。
+func WatchDir(dir string, stop <-chan struct{}) (<-chan string, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("%s: not a directory", dir)
+	}
+
+	changes := make(chan string, 64)
+	run, err := watchDir(dir, changes, stop) // 平台相关: watch_linux.go, watch_other.go
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		defer close(changes)
+		if err := run(); err != nil {
+			logError("WatchDir: watch failed", Field{"dir", dir}, fErr(err))
+		}
+	}()
+	return changes, nil
+}
+
+// WatchClient 监视目录 Dir, 把变了的文件推送给对方, 实现 Client 接口。
+//
+// 先调用 Watch 开始监视, 然后 (反复) 用 Do 连接对方推送。
+// Do 一直推送下去, 直到连接出错 (往通道扔 false), 没推送成功的文件留在队列里下次再推。
+type WatchClient struct {
+	Dir               string
+	Debounce          time.Duration // 文件这么久没变化才推送
+	SimpleFileMaxSize int64         // 不超过这个大小的文件用 SimpleFile 发, 否则用 BigFile
+
+	mu      sync.Mutex
+	pending map[string]time.Time // 待推送队列: {相对于 Dir 的路径: 最后一次变化的时间}
+	notify  chan struct{}        // 队列里加了东西
+
+	bigFileSender *BigFileSender
+}
+
+func NewWatchClient(dir string) *WatchClient {
+	return &WatchClient{
+		Dir:               dir,
+		Debounce:          DefaultWatchDebounce,
+		SimpleFileMaxSize: int64(DefaultBlockSize),
+		pending:           map[string]time.Time{},
+		notify:            make(chan struct{}, 1),
+		bigFileSender:     NewBigFileSender(),
+	}
+}
+
+// Watch 开始监视 Dir, 变了的文件加入待推送队列。stop 关闭后停止监视。
+func (w *WatchClient) Watch(stop <-chan struct{}) error {
+	changes, err := WatchDir(w.Dir, stop)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for p := range changes {
+			rel, err := filepath.Rel(w.Dir, p)
+			if err != nil {
+				continue
+			}
+			w.enqueue(filepath.ToSlash(rel), time.Now())
+		}
+	}()
+	return nil
+}
+
+// enqueue 把 rel 加入待推送队列, 最后一次变化的时间为 t
+func (w *WatchClient) enqueue(rel string, t time.Time) {
+	w.mu.Lock()
+	if last, ok := w.pending[rel]; !ok || t.After(last) {
+		w.pending[rel] = t
+	}
+	w.mu.Unlock()
+
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Pending 返回待推送的文件数
+func (w *WatchClient) Pending() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.pending)
+}
+
+// next 等待并取出队列里一个已经安定下来的文件 (最早变化的那个)
+func (w *WatchClient) next() (rel string, changedAt time.Time) {
+	for {
+		w.mu.Lock()
+		wait := w.Debounce
+		for p, t := range w.pending {
+			if d := w.Debounce - time.Since(t); d <= 0 {
+				if rel == "" || t.Before(changedAt) {
+					rel, changedAt = p, t
+				}
+			} else if d < wait {
+				wait = d
+			}
+		}
+		if rel != "" {
+			delete(w.pending, rel)
+			w.mu.Unlock()
+			return rel, changedAt
+		}
+		empty := len(w.pending) == 0
+		w.mu.Unlock()
+
+		if empty {
+			<-w.notify
+		} else {
+			select {
+			case <-w.notify:
+			case <-time.After(wait):
+			}
+		}
+	}
+}
+
+func (w *WatchClient) Do(conn net.Conn) chan bool {
+	logInfo("WatchClient: push changes", Field{"dir", w.Dir}, fPeer(conn))
+
+	done := make(chan bool, 1)
+	probe := &probeConn{Conn: conn}
+
+	go func() {
+		for {
+			rel, changedAt := w.next()
+			if !probe.alive() { // 闲着的时候对方断开了: SimpleFile 写进去也不会报错, 但是就丢了
+				w.enqueue(rel, changedAt)
+				done <- false
+				return
+			}
+			err := w.push(probe, rel)
+			switch {
+			case err == nil:
+				logInfo("WatchClient: pushed", Field{"path", rel})
+			case os.IsNotExist(err): // 还没来得及推送就被删了
+			default:
+				logWarn("WatchClient: push failed", Field{"path", rel}, fErr(err))
+				w.enqueue(rel, changedAt) // 留在队列里, 下次再推
+				done <- false
+				return
+			}
+		}
+	}()
+
+	return done
+}
+
+// push 把 Dir 下的 rel 推送给对方
+func (w *WatchClient) push(conn net.Conn, rel string) error {
+	localPath := filepath.Join(w.Dir, filepath.FromSlash(rel))
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	if info.Size() <= w.SimpleFileMaxSize {
+		content, err := ioutil.ReadFile(localPath)
+		if err != nil {
+			return err
+		}
+		_, err = NewPacket(PacketTypeSimpleFile, []byte(rel), content).WriteTo(conn)
+		return err
+	}
+
+	fileID, err := w.bigFileSender.AppendFileAs(localPath, rel)
+	if err != nil {
+		return err
+	}
+	return w.bigFileSender.SendFile(conn, fileID)
+}
+
+// probeConn 包装 conn, 可以在不弄丢对方发来的数据的情况下检查连接是否还活着
+type probeConn struct {
+	net.Conn
+	peeked []byte // alive 时读到的数据, 留给下一次 Read
+}
+
+func (c *probeConn) Read(b []byte) (int, error) {
+	if len(c.peeked) > 0 {
+		n := copy(b, c.peeked)
+		c.peeked = c.peeked[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
+
+// alive 试着读一下: 超时说明连接还在, 只是对方没说话; 读到 EOF 之类的错误说明断了
+func (c *probeConn) alive() bool {
+	if len(c.peeked) > 0 {
+		return true
+	}
+	buf := make([]byte, 1)
+	_ = c.Conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+	n, err := c.Conn.Read(buf)
+	_ = c.Conn.SetReadDeadline(time.Time{})
+
+	if n > 0 {
+		c.peeked = buf[:n]
+		return true
+	}
+	if e, ok := err.(net.Error); ok && e.Timeout() {
+		return true
+	}
+	return err == nil
+}
@@ -0,0 +1,131 @@
+//go:build linux
+
+package gofer
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// inotify 关心的事件: 文件写完关闭了、移进来了, 以及新建了子目录 (要接着监视它)
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_CREATE | syscall.IN_MODIFY
+
+// errWatchStopped 是发 changes 的时候 stop 关闭了: 没人读了, 不要一直卡着
+var errWatchStopped = errors.New("watch stopped")
+
+// watchDir 用 inotify 监视 dir 及其所有子目录。
+// 先把监视都设置好, 返回的 run 读取事件, 把变了的文件发到 changes, 直到 stop 关闭。
+// 事件太多, 内核的队列溢出了 (IN_Q_OVERFLOW) 的话, 重新扫描整个目录, 找出丢掉的事件里变了的文件。
+func watchDir(dir string, changes chan<- string, stop <-chan struct{}) (run func() error, err error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	file := os.NewFile(uintptr(fd), "inotify") // 非阻塞的 fd, 读的时候走 Go 的 poller, Close 可以打断 Read
+
+	dirs := map[int32]string{} // {watch descriptor: 目录}
+
+	emit := func(p string) error {
+		select {
+		case changes <- p:
+			return nil
+		case <-stop:
+			return errWatchStopped
+		}
+	}
+
+	// addDir 监视 root 及其下的所有子目录; 如果 emitFiles, 把已经在里面的、since 以后修改过的文件也当作变了的
+	addDir := func(root string, emitFiles bool, since time.Time) error {
+		return filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil // 可能刚被删掉了
+			}
+			if info.IsDir() {
+				wd, err := syscall.InotifyAddWatch(fd, p, inotifyMask)
+				if err != nil {
+					return os.NewSyscallError("inotify_add_watch", err)
+				}
+				dirs[int32(wd)] = p
+			} else if emitFiles && info.Mode().IsRegular() && !info.ModTime().Before(since) {
+				return emit(p)
+			}
+			return nil
+		})
+	}
+	if err := addDir(dir, false, time.Time{}); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	go func() {
+		<-stop
+		_ = file.Close()
+	}()
+
+	readEvents := func() error {
+		buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+		lastRead := time.Now() // 上一次读到事件的时间, 溢出时丢掉的事件都在这以后
+		for {
+			n, err := file.Read(buf)
+			if err != nil {
+				select {
+				case <-stop:
+					return nil
+				default:
+					return err
+				}
+			}
+			readAt := time.Now()
+
+			for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+				event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+				nameBytes := buf[offset+syscall.SizeofInotifyEvent : offset+syscall.SizeofInotifyEvent+int(event.Len)]
+				offset += syscall.SizeofInotifyEvent + int(event.Len)
+
+				if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+					logWarn("WatchDir: too many events, rescan", Field{"dir", dir})
+					// 修改时间的精度可能只有 1 秒, 往前多算一点; 已经监视的目录再加一次只是拿到原来的 wd
+					if err := addDir(dir, true, lastRead.Add(-time.Second)); err != nil {
+						return err
+					}
+					continue
+				}
+				parent, ok := dirs[event.Wd]
+				if !ok || event.Len == 0 {
+					continue
+				}
+				p := filepath.Join(parent, string(bytes.TrimRight(nameBytes, "\x00")))
+
+				switch {
+				case event.Mask&syscall.IN_ISDIR != 0:
+					if event.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) != 0 {
+						// 新的子目录: 监视它, 在设置好监视之前已经放进去的文件也要推送
+						if err := addDir(p, true, time.Time{}); err != nil {
+							return err
+						}
+					}
+				case event.Mask&syscall.IN_CREATE != 0:
+					// 刚建出来, 还在写, 等 IN_CLOSE_WRITE
+				default: // IN_CLOSE_WRITE, IN_MOVED_TO, IN_MODIFY
+					if err := emit(p); err != nil {
+						return err
+					}
+				}
+			}
+			lastRead = readAt
+		}
+	}
+
+	run = func() error {
+		if err := readEvents(); err != errWatchStopped {
+			return err
+		}
+		return nil
+	}
+	return run, nil
+}
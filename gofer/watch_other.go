@@ -0,0 +1,54 @@
+//go:build !linux
+
+package gofer
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// watchPollInterval 是没有 inotify 的系统上扫描目录的间隔
+var watchPollInterval = time.Second
+
+// watchDir 定时扫描 dir, 比较文件的大小和修改时间, 把变了的文件发到 changes, 直到 stop 关闭。
+func watchDir(dir string, changes chan<- string, stop <-chan struct{}) (run func() error, err error) {
+	last := scanDir(dir)
+
+	run = func() error {
+		ticker := time.NewTicker(watchPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return nil
+			case <-ticker.C:
+			}
+
+			now := scanDir(dir)
+			for p, info := range now {
+				if old, ok := last[p]; !ok || old.Size() != info.Size() || !old.ModTime().Equal(info.ModTime()) {
+					select { // 没人读了就别卡在这里
+					case changes <- p:
+					case <-stop:
+						return nil
+					}
+				}
+			}
+			last = now
+		}
+	}
+	return run, nil
+}
+
+// scanDir 返回 dir 下 (递归) 所有普通文件的信息: {路径: os.FileInfo}
+func scanDir(dir string) map[string]os.FileInfo {
+	files := map[string]os.FileInfo{}
+	_ = filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			files[p] = info
+		}
+		return nil
+	})
+	return files
+}
@@ -0,0 +1,95 @@
+package gofer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gofer-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	changes, err := WatchDir(dir, stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := filepath.Join(dir, "sub", "a.txt")
+	if err := os.MkdirAll(filepath.Dir(want), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(want, []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case p := <-changes:
+			if p == want {
+				return
+			}
+		case <-timeout:
+			t.Fatalf("no change reported for %s", want)
+		}
+	}
+}
+
+func TestWatchClientNext(t *testing.T) {
+	w := NewWatchClient(".")
+	w.Debounce = 50 * time.Millisecond
+
+	now := time.Now()
+	w.enqueue("late", now)
+	w.enqueue("early", now.Add(-time.Second))
+	w.enqueue("early", now.Add(-2*time.Second)) // 更早的变化不会覆盖更晚的
+
+	if rel, _ := w.next(); rel != "early" {
+		t.Errorf("next() = %q, want %q", rel, "early")
+	}
+	start := time.Now()
+	if rel, _ := w.next(); rel != "late" {
+		t.Errorf("next() = %q, want %q", rel, "late")
+	}
+	if time.Since(start) < 40*time.Millisecond {
+		t.Error("next() returned a file that hasn't settled")
+	}
+	if w.Pending() != 0 {
+		t.Errorf("Pending() = %d, want 0", w.Pending())
+	}
+}
+
+func TestWatchDirStopsWithoutReader(t *testing.T) {
+	dir := t.TempDir()
+	stop := make(chan struct{})
+	changes := make(chan string) // 没人读
+	run, err := watchDir(dir, changes, stop)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- run() }()
+
+	if err := os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1500 * time.Millisecond) // 等 run 发现它 (没有 inotify 的系统上要等一次扫描), 卡在发 changes 上
+	close(stop)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run did not return after stop")
+	}
+}
@@ -0,0 +1,340 @@
+package gofer
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/rakyll/statik/fs"
+)
+
+// 网页界面！！
+// gofer serve -web ADDR 在 http://ADDR/ 上提供一个网页界面, 页面 (static/web) 用 statik 打包在程序里:
+//
+//  - 浏览导出的目录, 下载里面的文件
+//  - 把文件拖进页面, 上传到收件箱
+//  - 实时查看正在进行的传输
+//
+// 网页的每个请求都通过 bufferedPipe (见 pipe.go) 和 Daemon 说原生协议 (ListRequest, GetRequest, BigFile),
+// 所以导出目录、收件箱的处理和权限规则都和原生的客户端一样; 规则按浏览器的 IP 匹配。
+//
+// 网页用的接口, 出错时和控制接口一样回 {"code": 错误码, "error": 原因}:
+//
+//  - GET /api/list?path=P: 列出导出的目录, 回 ListEntry 的数组
+//  - GET /api/get?path=P: 下载导出的文件
+//  - PUT /api/upload?name=N: 请求体是文件的内容, 以 N 保存到收件箱
+//  - GET /api/progress: text/event-stream, 每秒一次所有的传输 ([]FileProgress)
+
+// MaxWebUploadSize 是网页上传一个文件最大多少字节: 上传的文件要先存到临时目录, 不限制的话能把磁盘写满
+var MaxWebUploadSize int64 = 4 * 1024 * 1024 * 1024
+
+// 网页界面、HTTP 网关的超时: 上传、下载大文件和 /api/progress 都可能很久, 所以只限制读请求头和空闲的连接
+const (
+	httpReadHeaderTimeout = 10 * time.Second
+	httpIdleTimeout       = 2 * time.Minute
+)
+
+// newHTTPServer 返回带着上面的超时的 http.Server
+func newHTTPServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		IdleTimeout:       httpIdleTimeout,
+	}
+}
+
+// WebServer 是 Daemon 的网页界面
+type WebServer struct {
+	Daemon   *Daemon
+	Progress *Progress // 网页上显示它的进度, 上传也向它报告; nil 表示 DefaultProgress
+}
+
+func NewWebServer(daemon *Daemon) *WebServer {
+	return &WebServer{Daemon: daemon}
+}
+
+// ListenAndServe 监听 addr, 在后台用 HTTP 提供网页界面, 关闭返回的 listener 就停止
+func (s *WebServer) ListenAndServe(addr string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		_ = newHTTPServer(s.Handler()).Serve(listener)
+	}()
+	logInfo("Serving web UI", Field{"addr", "http://" + listener.Addr().String() + "/"})
+	return listener, nil
+}
+
+// Handler 返回网页界面的 http.Handler
+func (s *WebServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/list", s.list)
+	mux.HandleFunc("GET /api/get", s.get)
+	mux.HandleFunc("PUT /api/upload", s.upload)
+	mux.HandleFunc("GET /api/progress", s.progress)
+
+	if assets, err := fs.New(); err == nil {
+		mux.Handle("GET /", http.FileServer(webAssets{assets}))
+	} else {
+		logError("Web UI assets not found", fErr(err))
+	}
+	return mux
+}
+
+// webAssets 是 statik 里 /web 下的网页, 别的 (比如证书) 不给浏览器看
+type webAssets struct {
+	statik http.FileSystem
+}
+
+func (a webAssets) Open(name string) (http.File, error) {
+	return a.statik.Open(path.Join("/web", path.Clean("/"+name)))
+}
+
+// dial 返回一个连到 Daemon 的内存连接, 对 Daemon 来说, 对方就是发 HTTP 请求的浏览器
+func (s *WebServer) dial(r *http.Request) net.Conn {
+	remote, err := net.ResolveTCPAddr("tcp", r.RemoteAddr)
+	if err != nil {
+		remote = &net.TCPAddr{}
+	}
+	local, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	if !ok {
+		local = &net.TCPAddr{}
+	}
+	server, client := bufferedPipe(local, remote)
+	go s.Daemon.ServeConn(server)
+	return client
+}
+
+// list 处理 GET /api/list: 用 ListClient 列目录
+func (s *WebServer) list(w http.ResponseWriter, r *http.Request) {
+	conn := s.dial(r)
+	defer conn.Close()
+
+	l := NewListClient(r.URL.Query().Get("path"))
+	if <-l.Do(conn); l.Err != nil {
+		writeWebError(w, l.Err)
+		return
+	}
+	if l.Entries == nil {
+		l.Entries = []ListEntry{}
+	}
+	writeControl(w, http.StatusOK, l.Entries)
+}
+
+// get 处理 GET /api/get: 发 GetRequest, 把回来的 SimpleFile 或者 BigFile 写给浏览器
+func (s *WebServer) get(w http.ResponseWriter, r *http.Request) {
+	conn := s.dial(r)
+	defer conn.Close()
+
+	if _, err := NewGetRequest(r.URL.Query().Get("path")).WriteTo(conn); err != nil {
+		writeWebError(w, err)
+		return
+	}
+	packet, err := PacketFromReader(conn)
+	if err != nil {
+		writeWebError(w, err)
+		return
+	}
+	switch packet.Type {
+	case PacketTypeError:
+		writeWebError(w, PacketAsErrorPacket(packet))
+	case PacketTypeSimpleFile:
+		sf := PacketAsSimpleFile(packet)
+		setDownloadHeaders(w, sf.FileName(), uint64(sf.DataSize))
+		_, _ = sf.WriteFileContent(w)
+	case PacketTypeBigFileHeader:
+		streamBigFile(w, conn, PacketAsBigFileHeader(packet))
+	default:
+		writeWebError(w, fmt.Errorf("unexpected packet: %v", packet.Header))
+	}
+}
+
+// setDownloadHeaders 让浏览器把回复当作文件 name 下载
+func setDownloadHeaders(w http.ResponseWriter, name string, size uint64) {
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	w.Header().Set("Content-Length", strconv.FormatUint(size, 10))
+}
+
+// streamBigFile 按顺序一块一块地向 BigFileSender 请求 header 说的文件, 写给浏览器。
+// 写完了回传 header (和 BigFileReceiverWorker 一样); 浏览器走了就回 ErrorPacket (ErrCodeCanceled)。
+func streamBigFile(w http.ResponseWriter, conn net.Conn, header *BigFileHeader) {
+	setDownloadHeaders(w, header.FileName(), header.FileSize())
+	for start := uint64(0); start < header.FileSize(); {
+		if _, err := NewBigFileRequest(header.FileID(), start, DefaultBlockSize).WriteTo(conn); err != nil {
+			return
+		}
+		resp, err := readBigFileResponse(conn, header.FileID(), start)
+		if err != nil {
+			logWarn("Web: download failed", fName(header.FileName()), fErr(err))
+			return
+		}
+		if _, err := w.Write(resp.FileContent()); err != nil {
+			_, _ = NewErrorPacket(ErrCodeCanceled, FileIDString(header.FileID())).WriteTo(conn) // 浏览器走了
+			return
+		}
+		start += uint64(len(resp.FileContent()))
+	}
+	_, _ = header.WriteTo(conn)
+}
+
+// readBigFileResponse 从 conn 读到文件 fileID 从 start 开始的那一块, 跳过发送端定时重发的 header
+func readBigFileResponse(conn net.Conn, fileID []byte, start uint64) (*BigFileResponse, error) {
+	for {
+		packet, err := PacketFromReader(conn)
+		if err != nil {
+			return nil, err
+		}
+		switch packet.Type {
+		case PacketTypeError:
+			return nil, PacketAsErrorPacket(packet)
+		case PacketTypeBigFileResponse:
+			resp := PacketAsBigFileResponse(packet)
+			if FileIDString(resp.FileID()) != FileIDString(fileID) || resp.Start() != start {
+				continue
+			}
+			if len(resp.FileContent()) == 0 {
+				return nil, fmt.Errorf("empty block at %d", start)
+			}
+			return resp, nil
+		}
+	}
+}
+
+// upload 处理 PUT /api/upload: 先把请求体存到临时文件, 再用 BigFileSender 推送到收件箱
+func (s *WebServer) upload(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if _, err := saveFilePath("", name); err != nil {
+		writeWebError(w, NewErrorPacket(ErrCodeBadRequest, err.Error()))
+		return
+	}
+	if err := s.authorize(r, PermissionPush); err != nil {
+		writeWebError(w, err)
+		return
+	}
+
+	if r.ContentLength > MaxWebUploadSize {
+		writeUploadTooLarge(w)
+		return
+	}
+
+	tmp, err := ioutil.TempFile("", "gofer-web-")
+	if err != nil {
+		writeWebError(w, err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, http.MaxBytesReader(w, r.Body, MaxWebUploadSize))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeUploadTooLarge(w)
+		return
+	}
+	if err != nil {
+		writeWebError(w, NewErrorPacket(ErrCodeBadRequest, err.Error()))
+		return
+	}
+
+	conn := s.dial(r)
+	defer conn.Close()
+	sender := NewBigFileSender()
+	sender.Progress = s.Progress
+	fileID, err := sender.AppendFileAs(tmp.Name(), name)
+	if err == nil {
+		err = sender.SendFile(conn, fileID)
+	}
+	if err != nil {
+		writeWebError(w, err)
+		return
+	}
+	logInfo("Web: uploaded", Field{"client", r.RemoteAddr}, fName(name))
+	writeControl(w, http.StatusOK, map[string]string{"name": name, "file_id": FileIDString(fileID)})
+}
+
+// writeUploadTooLarge 回 413: 上传的文件超过了 MaxWebUploadSize
+func writeUploadTooLarge(w http.ResponseWriter) {
+	writeControlError(w, http.StatusRequestEntityTooLarge, ErrCodeBadRequest,
+		fmt.Sprintf("file too large: max %d bytes", MaxWebUploadSize))
+}
+
+// authorize 检查浏览器有没有 permission 权限, 以及有没有收件箱。
+// 网页上传先在这里检查, 这样能回给浏览器具体的原因。
+func (s *WebServer) authorize(r *http.Request, permission string) error {
+	host, _, _ := net.SplitHostPort(r.RemoteAddr)
+	rule, err := s.Daemon.ruleFor(net.ParseIP(host), "")
+	if err != nil {
+		return NewErrorPacket(ErrCodeForbidden, err.Error())
+	}
+	if !rule.allows(permission) {
+		return NewErrorPacket(ErrCodeForbidden, "permission denied: "+permission)
+	}
+	if _, ok := s.Daemon.inboxes[rule.Inbox]; !ok && permission == PermissionPush {
+		return NewErrorPacket(ErrCodeForbidden, "no inbox")
+	}
+	return nil
+}
+
+// progress 处理 GET /api/progress: 每秒推送一次所有的传输, 直到浏览器断开
+func (s *WebServer) progress(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeWebError(w, fmt.Errorf("streaming not supported"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		data, err := json.Marshal(progressOf(s.Progress).Files())
+		if err != nil {
+			return
+		}
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return
+		}
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// webErrorStatus 是各个错误码对应的 HTTP 状态码
+var webErrorStatus = map[string]int{
+	ErrCodeBadRequest: http.StatusBadRequest,
+	ErrCodeForbidden:  http.StatusForbidden,
+	ErrCodeNotFound:   http.StatusNotFound,
+	ErrCodeChecksum:   http.StatusUnprocessableEntity,
+}
+
+// writeWebError 把错误 (Daemon 回的 ErrorPacket, 或者别的错误) 回给浏览器
+func writeWebError(w http.ResponseWriter, err error) {
+	code := ErrorCode(err)
+	status, ok := webErrorStatus[code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	message := err.Error()
+	if e, ok := err.(*ErrorPacket); ok {
+		message = e.Message()
+	}
+	writeControlError(w, status, code, message)
+}
@@ -0,0 +1,76 @@
+package gofer
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestDaemon 起一个 Daemon: 导出目录里有一个两块多的 big.bin, 返回它的内容和收件箱的目录
+func newTestDaemon(t *testing.T) (daemon *Daemon, big []byte, inboxDir string) {
+	dir := t.TempDir()
+	exportDir, inboxDir := filepath.Join(dir, "export"), filepath.Join(dir, "inbox")
+	big = bytes.Repeat([]byte("gofer"), int(DefaultBlockSize)/2) // 两块多
+	if err := os.MkdirAll(exportDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(exportDir, "big.bin"), big, 0644); err != nil {
+		t.Fatal(err)
+	}
+	daemon, err := NewDaemon(&DaemonConfig{
+		Exports: map[string]string{"": exportDir},
+		Inboxes: map[string]string{"": inboxDir},
+		Clients: []ClientRule{{Match: "*", Permissions: []string{PermissionGet, PermissionList, PermissionPush}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return daemon, big, inboxDir
+}
+
+func TestWebServer(t *testing.T) {
+	daemon, big, inboxDir := newTestDaemon(t)
+	server := httptest.NewServer(NewWebServer(daemon).Handler())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/api/get?path=big.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || !bytes.Equal(got, big) {
+		t.Errorf("get: status %d, %d bytes, want %d bytes", resp.StatusCode, len(got), len(big))
+	}
+
+	if resp, err := http.Get(server.URL + "/api/get?path=nope"); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("get nope: %v, %v, want 404", resp.Status, err)
+	}
+
+	req, _ := http.NewRequest("PUT", server.URL+"/api/upload?name=sub/up.bin", bytes.NewReader(big))
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("upload: %v, %v", resp, err)
+	}
+	if got, err := ioutil.ReadFile(filepath.Join(inboxDir, "sub", "up.bin")); err != nil || !bytes.Equal(got, big) {
+		t.Errorf("uploaded: %d bytes, %v, want %d bytes", len(got), err, len(big))
+	}
+
+	maxSize := MaxWebUploadSize
+	MaxWebUploadSize = int64(len(big)) - 1
+	req, _ = http.NewRequest("PUT", server.URL+"/api/upload?name=toobig.bin", bytes.NewReader(big))
+	if resp, err := http.DefaultClient.Do(req); err != nil || resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("upload too large: %v, %v, want 413", resp, err)
+	}
+	MaxWebUploadSize = maxSize
+
+	if resp, err := http.Get(server.URL + "/index.html"); err != nil || resp.StatusCode != http.StatusOK {
+		t.Errorf("index.html: %v, %v", resp, err)
+	}
+	if resp, err := http.Get(server.URL + "/certs/server.key"); err != nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("certs/server.key: %v, %v, want 404", resp, err)
+	}
+}
@@ -0,0 +1,550 @@
+package gofer
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebSocket！！
+// 只放行 HTTPS/WebSocket 的代理后面, 可以把 Packet 流放在 WebSocket 连接上跑:
+// -s/-c 的地址写成 ws://HOST:PORT/PATH 或者 wss://HOST:PORT/PATH 就行。
+//
+//  - WebSocket 连接 (RFC 6455 的最小实现) 包装成 net.Conn: 写的每一块是一个二进制帧, 读的是帧的内容连起来的字节流,
+//    所以 Client、Server 不用改, 和 TCP 连接一样用
+//  - ListenAndServeTLS、DialTLS 遇到 ws:// wss:// 地址时, 照样在 WebSocket 连接里面做 gofer 自己的 TLS (自带的证书, 要验证客户端证书),
+//    所以加密和认证和直连一样; 中间有终结 TLS 的代理 (对外 wss://, 对内 ws://) 也没关系
+//  - wss:// 在 WebSocket 外面再套一层 TLS (服务端用自带的证书), 让代理看来是普通的 HTTPS。
+//    外层 TLS 只是为了过代理, 不验证证书, 认证靠里面那层
+//  - 客户端按 HTTPS_PROXY / HTTP_PROXY / NO_PROXY 环境变量走 HTTP 代理 (CONNECT), 代理是 https:// 的话和代理之间也用 TLS
+
+// WebSocketProtocol 是握手时声明的子协议
+const WebSocketProtocol = "gofer"
+
+// websocketGUID 是 RFC 6455 里算 Sec-WebSocket-Accept 用的固定值
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// websocketHandshakeTimeout 是 (代理的 CONNECT 和) WebSocket 握手的超时时间
+const websocketHandshakeTimeout = 30 * time.Second
+
+// WebSocket 帧的 opcode
+const (
+	wsOpContinuation byte = 0x0
+	wsOpText         byte = 0x1
+	wsOpBinary       byte = 0x2
+	wsOpClose        byte = 0x8
+	wsOpPing         byte = 0x9
+	wsOpPong         byte = 0xa
+)
+
+// IsWebSocketAddress 判断地址是不是 ws:// 或者 wss:// 开头的
+func IsWebSocketAddress(address string) bool {
+	return strings.HasPrefix(address, "ws://") || strings.HasPrefix(address, "wss://")
+}
+
+// parseWebSocketURL 解析 ws://HOST:PORT/PATH, 补上默认的端口 (80, 443) 和路径 (/)
+func parseWebSocketURL(address string) (*url.URL, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return nil, fmt.Errorf("websocket: bad address %q, want ws:// or wss://", address)
+	}
+	if u.Port() == "" {
+		port := "80"
+		if u.Scheme == "wss" {
+			port = "443"
+		}
+		u.Host = net.JoinHostPort(u.Hostname(), port)
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u, nil
+}
+
+// websocketAccept 根据客户端的 Sec-WebSocket-Key 算出服务端回的 Sec-WebSocket-Accept
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerHas 判断 (逗号分隔的) 请求头 name 里有没有 token, 不分大小写
+func headerHas(header http.Header, name string, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, v := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(v), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DialWebSocket 连接 ws://HOST:PORT/PATH (或者 wss://), 握手完成后返回 WebSocket 连接。
+// 返回的连接没有 gofer 的 TLS, 一般用 DialTLS。
+func DialWebSocket(address string) (net.Conn, error) {
+	u, err := parseWebSocketURL(address)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := dialThroughProxy(u)
+	if err != nil {
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Now().Add(websocketHandshakeTimeout))
+	if u.Scheme == "wss" {
+		tlsConn := tls.Client(conn, &tls.Config{
+			ServerName:         u.Hostname(),
+			InsecureSkipVerify: true, // 外层 TLS 只是为了过代理, 认证靠里面 gofer 的 TLS
+		})
+		if err := tlsConn.Handshake(); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("websocket: TLS handshake failed: %v", err)
+		}
+		conn = tlsConn
+	}
+
+	r, err := websocketClientHandshake(conn, u)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return newWebSocketConn(conn, r, true), nil
+}
+
+// dialThroughProxy 建立到 u 的 TCP 连接, 环境变量里配置了 HTTP 代理的话通过代理 CONNECT
+func dialThroughProxy(u *url.URL) (net.Conn, error) {
+	target := &url.URL{Scheme: "http", Host: u.Host}
+	if u.Scheme == "wss" {
+		target.Scheme = "https"
+	}
+	proxy, err := http.ProxyFromEnvironment(&http.Request{URL: target})
+	if err != nil {
+		return nil, fmt.Errorf("websocket: bad proxy: %v", err)
+	}
+	if proxy == nil {
+		return net.DialTimeout("tcp", u.Host, websocketHandshakeTimeout)
+	}
+
+	if proxy.Scheme != "http" && proxy.Scheme != "https" {
+		return nil, fmt.Errorf("websocket: unsupported proxy %s, want http:// or https://", proxy.Redacted())
+	}
+	proxyHost := proxy.Host
+	if proxy.Port() == "" {
+		port := "80"
+		if proxy.Scheme == "https" {
+			port = "443"
+		}
+		proxyHost = net.JoinHostPort(proxy.Hostname(), port)
+	}
+	conn, err := net.DialTimeout("tcp", proxyHost, websocketHandshakeTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("websocket: connect proxy %s: %v", proxyHost, err)
+	}
+	_ = conn.SetDeadline(time.Now().Add(websocketHandshakeTimeout))
+	if proxy.Scheme == "https" { // 和代理之间的 TLS 照常验证代理的证书
+		tlsConn := tls.Client(conn, &tls.Config{ServerName: proxy.Hostname()})
+		if err := tlsConn.Handshake(); err != nil {
+			_ = conn.Close()
+			return nil, fmt.Errorf("websocket: proxy %s: TLS handshake failed: %v", proxyHost, err)
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: u.Host},
+		Host:   u.Host,
+		Header: http.Header{},
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		auth := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+auth)
+	}
+	if err := req.Write(conn); err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("websocket: proxy CONNECT: %v", err)
+	}
+	// 代理回完 CONNECT 以后就是透明的管道了, 而服务端在收到握手前什么都不会发, 所以这里的 bufio.Reader 不会多读
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		_ = conn.Close()
+		return nil, fmt.Errorf("websocket: proxy CONNECT: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		_ = conn.Close()
+		return nil, fmt.Errorf("websocket: proxy CONNECT: %s", resp.Status)
+	}
+	_ = conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// websocketClientHandshake 发送升级请求, 检查服务端的回复, 返回之后读帧用的 bufio.Reader
+func websocketClientHandshake(conn net.Conn, u *url.URL) (*bufio.Reader, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := base64.StdEncoding.EncodeToString(nonce)
+
+	req := &http.Request{
+		Method: http.MethodGet,
+		URL:    &url.URL{Path: u.Path, RawQuery: u.RawQuery},
+		Host:   u.Host,
+		Header: http.Header{
+			"Upgrade":                {"websocket"},
+			"Connection":             {"Upgrade"},
+			"Sec-Websocket-Key":      {key},
+			"Sec-Websocket-Version":  {"13"},
+			"Sec-Websocket-Protocol": {WebSocketProtocol},
+		},
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, fmt.Errorf("websocket: handshake: %v", err)
+	}
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, req)
+	if err != nil {
+		return nil, fmt.Errorf("websocket: handshake: %v", err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("websocket: handshake: %s", resp.Status)
+	}
+	if !headerHas(resp.Header, "Upgrade", "websocket") || resp.Header.Get("Sec-WebSocket-Accept") != websocketAccept(key) {
+		return nil, fmt.Errorf("websocket: handshake: bad response from the server")
+	}
+	return r, nil
+}
+
+// ListenWebSocket 监听 ws://HOST:PORT/PATH (或者 wss://), 在 PATH 上接受 WebSocket 升级,
+// 返回的 listener Accept 的是握手完成的 WebSocket 连接。
+// 返回的连接没有 gofer 的 TLS, 一般用 ListenAndServeTLS。
+func ListenWebSocket(address string) (net.Listener, error) {
+	u, err := parseWebSocketURL(address)
+	if err != nil {
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", u.Host)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "wss" {
+		config, err := serverTLSConfig()
+		if err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+		config.ClientAuth = tls.NoClientCert // 外层 TLS 只是为了过代理, 认证靠里面 gofer 的 TLS
+		listener = tls.NewListener(listener, config)
+	}
+
+	l := &websocketListener{
+		Listener: listener,
+		conns:    make(chan net.Conn),
+		done:     make(chan struct{}),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc(u.Path, l.upgrade)
+	go func() {
+		_ = newHTTPServer(mux).Serve(listener)
+		_ = l.Close()
+	}()
+	return l, nil
+}
+
+// websocketListener 把 HTTP 服务升级出来的 WebSocket 连接当作 net.Listener 交出去
+type websocketListener struct {
+	net.Listener // 底层的 TCP (wss 的话是 TLS) listener, Addr 用它的
+
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (l *websocketListener) Accept() (net.Conn, error) {
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+func (l *websocketListener) Close() error {
+	err := net.ErrClosed
+	l.closeOnce.Do(func() {
+		close(l.done)
+		err = l.Listener.Close()
+	})
+	return err
+}
+
+// upgrade 处理 WebSocket 升级请求, 升级好的连接交给 Accept
+func (l *websocketListener) upgrade(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet || !headerHas(r.Header, "Connection", "upgrade") || !headerHas(r.Header, "Upgrade", "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		http.Error(w, "gofer: WebSocket only", http.StatusUpgradeRequired)
+		return
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Header.Get("Sec-WebSocket-Version") != "13" || key == "" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "gofer: bad WebSocket handshake", http.StatusBadRequest)
+		return
+	}
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "gofer: can not upgrade", http.StatusInternalServerError)
+		return
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		logWarn("WebSocket: hijack failed", Field{"client", r.RemoteAddr}, fErr(err))
+		return
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + websocketAccept(key) + "\r\n"
+	if headerHas(r.Header, "Sec-WebSocket-Protocol", WebSocketProtocol) {
+		response += "Sec-WebSocket-Protocol: " + WebSocketProtocol + "\r\n"
+	}
+	_ = conn.SetWriteDeadline(time.Now().Add(websocketHandshakeTimeout))
+	if _, err := rw.WriteString(response + "\r\n"); err == nil {
+		err = rw.Flush()
+	}
+	if err != nil {
+		logWarn("WebSocket: handshake failed", Field{"client", r.RemoteAddr}, fErr(err))
+		_ = conn.Close()
+		return
+	}
+	_ = conn.SetDeadline(time.Time{})
+
+	select {
+	case l.conns <- newWebSocketConn(conn, rw.Reader, false):
+	case <-l.done:
+		_ = conn.Close()
+	}
+}
+
+// websocketConn 把 WebSocket 连接包装成 net.Conn:
+// 每次 Write 发一个二进制帧; Read 把收到的数据帧的内容连成字节流, 顺便回应 ping 和 close。
+// 读超时不会弄坏连接 (帧头要么整个读到, 要么一点都不读), 和 TCP 连接一样可以接着读。
+type websocketConn struct {
+	net.Conn               // 底层连接 (TCP, wss 的话是 TLS), 地址和 deadline 都用它的
+	r        *bufio.Reader // 底层连接的读端, 握手时可能已经多读了一些
+	client   bool          // 是不是客户端: 客户端发的帧要加掩码
+
+	readMu    sync.Mutex
+	remaining uint64  // 当前数据帧还没读的字节数
+	mask      [4]byte // 当前数据帧的掩码
+	masked    bool
+	maskPos   int
+	eof       bool // 收到了对方的 close 帧
+
+	writeMu   sync.Mutex
+	closeSent bool // 发过 close 帧了, 由 writeMu 保护
+}
+
+func newWebSocketConn(conn net.Conn, r *bufio.Reader, client bool) *websocketConn {
+	return &websocketConn{Conn: conn, r: r, client: client}
+}
+
+func (c *websocketConn) Read(p []byte) (int, error) {
+	c.readMu.Lock()
+	defer c.readMu.Unlock()
+
+	for c.remaining == 0 {
+		if c.eof {
+			return 0, io.EOF
+		}
+		if err := c.nextFrame(); err != nil {
+			return 0, err
+		}
+	}
+	if uint64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	if c.masked {
+		for i := range p[:n] {
+			p[i] ^= c.mask[(c.maskPos+i)%4]
+		}
+		c.maskPos = (c.maskPos + n) % 4
+	}
+	c.remaining -= uint64(n)
+	return n, err
+}
+
+// errWebSocketProtocol 是对方发来的帧不对
+var errWebSocketProtocol = errors.New("websocket: protocol error")
+
+// protocolError 在对方发来的帧不对时, 发 close 帧 (1002 protocol error) 并关闭底层连接 (RFC 6455 §7.1.7)
+func (c *websocketConn) protocolError() error {
+	_ = c.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+	_ = c.writeClose([]byte{0x03, 0xea})
+	_ = c.Conn.Close()
+	c.eof = true
+	return errWebSocketProtocol
+}
+
+// nextFrame 读下一个帧的帧头: 数据帧的话设置 remaining 等着 Read 读内容; 控制帧直接处理掉。
+// 帧头 (和控制帧的内容) 先 Peek 完整了再消耗, 所以读超时不会读到一半。
+func (c *websocketConn) nextFrame() error {
+	head, err := c.r.Peek(2)
+	if err != nil {
+		return err
+	}
+	if head[0]&0x70 != 0 { // RSV1-3, 没有协商扩展, 必须是 0
+		return c.protocolError()
+	}
+	opcode, masked := head[0]&0x0f, head[1]&0x80 != 0
+	if masked == c.client { // 客户端发的帧必须加掩码, 服务端发的不能加 (RFC 6455 §5.1)
+		return c.protocolError()
+	}
+	size, headSize := uint64(head[1]&0x7f), 2
+	switch size {
+	case 126:
+		headSize += 2
+	case 127:
+		headSize += 8
+	}
+	if masked {
+		headSize += 4
+	}
+	if head, err = c.r.Peek(headSize); err != nil {
+		return err
+	}
+	switch size {
+	case 126:
+		size = uint64(binary.BigEndian.Uint16(head[2:4]))
+	case 127:
+		size = binary.BigEndian.Uint64(head[2:10])
+	}
+	var mask [4]byte
+	if masked {
+		copy(mask[:], head[headSize-4:])
+	}
+
+	switch opcode {
+	case wsOpContinuation, wsOpText, wsOpBinary:
+		_, _ = c.r.Discard(headSize)
+		c.remaining, c.mask, c.masked, c.maskPos = size, mask, masked, 0
+		return nil
+	case wsOpClose, wsOpPing, wsOpPong:
+	default:
+		return c.protocolError()
+	}
+
+	if size > 125 { // 控制帧的内容最多 125 字节
+		return c.protocolError()
+	}
+	frame, err := c.r.Peek(headSize + int(size))
+	if err != nil {
+		return err
+	}
+	payload := append([]byte(nil), frame[headSize:]...)
+	_, _ = c.r.Discard(len(frame))
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	switch opcode {
+	case wsOpPing:
+		return c.writeFrame(wsOpPong, payload)
+	case wsOpClose:
+		c.eof = true
+		if len(payload) > 2 {
+			payload = payload[:2] // 只回状态码
+		}
+		_ = c.writeClose(payload)
+		return io.EOF
+	}
+	return nil // pong
+}
+
+func (c *websocketConn) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := c.writeFrame(wsOpBinary, p); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writeFrame 发送一个完整的帧
+func (c *websocketConn) writeFrame(opcode byte, payload []byte) error {
+	frame := make([]byte, 2, 14+len(payload))
+	frame[0] = 0x80 | opcode // FIN
+	switch size := len(payload); {
+	case size <= 125:
+		frame[1] = byte(size)
+	case size <= 0xffff:
+		frame[1] = 126
+		frame = binary.BigEndian.AppendUint16(frame, uint16(size))
+	default:
+		frame[1] = 127
+		frame = binary.BigEndian.AppendUint64(frame, uint64(size))
+	}
+	if c.client {
+		var mask [4]byte
+		if _, err := rand.Read(mask[:]); err != nil {
+			return err
+		}
+		frame[1] |= 0x80
+		frame = append(frame, mask[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := range frame[start:] {
+			frame[start+i] ^= mask[i%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return net.ErrClosed
+	}
+	_, err := c.Conn.Write(frame)
+	return err
+}
+
+// writeClose 发送 close 帧 (只发一次)
+func (c *websocketConn) writeClose(payload []byte) error {
+	err := c.writeFrame(wsOpClose, payload)
+	c.writeMu.Lock()
+	c.closeSent = true
+	c.writeMu.Unlock()
+	return err
+}
+
+// Close 发送 close 帧 (正常关闭, 1000), 然后关闭底层连接
+func (c *websocketConn) Close() error {
+	_ = c.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+	_ = c.writeClose([]byte{0x03, 0xe8})
+	return c.Conn.Close()
+}
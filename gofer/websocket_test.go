@@ -0,0 +1,99 @@
+package gofer
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestWebSocket(t *testing.T) {
+	for _, scheme := range []string{"ws", "wss"} {
+		listener, err := ListenWebSocket(scheme + "://127.0.0.1:0/gofer")
+		if err != nil {
+			t.Fatal(err)
+		}
+		config, err := serverTLSConfig()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tlsListener := tls.NewListener(listener, config)
+
+		// 服务端把收到的东西原样发回去
+		big := bytes.Repeat([]byte("gofer"), 100000)
+		go func() {
+			conn, err := tlsListener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			_, _ = io.CopyN(conn, conn, int64(len(big)))
+		}()
+
+		conn, err := DialTLS(scheme + "://" + listener.Addr().String() + "/gofer")
+		if err != nil {
+			t.Fatalf("%s: dial: %v", scheme, err)
+		}
+		go func() {
+			_, _ = conn.Write(big[:10])
+			_, _ = conn.Write(big[10:])
+		}()
+		got, err := io.ReadAll(conn)
+		if err != nil || !bytes.Equal(got, big) {
+			t.Errorf("%s: echo: %d bytes, %v, want %d bytes", scheme, len(got), err, len(big))
+		}
+		_ = conn.Close()
+
+		if _, err := DialWebSocket(scheme + "://" + listener.Addr().String() + "/nope"); err == nil {
+			t.Errorf("%s: dial a wrong path: no error", scheme)
+		}
+		_ = listener.Close()
+	}
+}
+
+func TestWebSocketRejectsUnmaskedFrames(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	server := newWebSocketConn(a, bufio.NewReader(a), false)
+
+	go func() {
+		_, _ = b.Write([]byte{0x80 | wsOpBinary, 5, 'g', 'o', 'f', 'e', 'r'}) // 客户端发的, 没有掩码
+	}()
+	closed := make(chan []byte, 1)
+	go func() {
+		frame := make([]byte, 4)
+		_, _ = io.ReadFull(b, frame)
+		closed <- frame
+	}()
+
+	if _, err := server.Read(make([]byte, 16)); err != errWebSocketProtocol {
+		t.Errorf("read unmasked frame: %v, want %v", err, errWebSocketProtocol)
+	}
+	if frame := <-closed; !bytes.Equal(frame, []byte{0x80 | wsOpClose, 2, 0x03, 0xea}) {
+		t.Errorf("close frame = %x, want close 1002", frame)
+	}
+}
+
+// listener 关掉之后 Serve 要返回, 而不是一直空转 accept
+func TestServeReturnsWhenListenerClosed(t *testing.T) {
+	listener, err := ListenWebSocket("ws://127.0.0.1:0/gofer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- (&server{Handler: NewRelayServer(0)}).Serve(listener) }()
+
+	_ = listener.Close()
+	select {
+	case err := <-done:
+		if !errors.Is(err, net.ErrClosed) {
+			t.Errorf("Serve returned %v, want net.ErrClosed", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after the listener was closed")
+	}
+}
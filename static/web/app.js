@@ -0,0 +1,182 @@
+// gofer web UI: browse and download exports, upload into the inbox, watch transfers.
+// It only talks to the /api/ endpoints of gofer serve -web (see gofer/web.go).
+"use strict";
+
+const $ = (id) => document.getElementById(id);
+
+function formatBytes(n) {
+  const units = ["B", "KiB", "MiB", "GiB", "TiB"];
+  let i = 0;
+  while (n >= 1024 && i < units.length - 1) {
+    n /= 1024;
+    i++;
+  }
+  return (i === 0 ? n : n.toFixed(1)) + " " + units[i];
+}
+
+function showError(err) {
+  $("error").textContent = err ? String(err) : "";
+  $("error").hidden = !err;
+}
+
+// api fetches an /api/ endpoint and decodes its JSON, throwing the {"code", "error"} of failures.
+async function api(method, url, body) {
+  const resp = await fetch(url, { method, body });
+  const result = await resp.json().catch(() => ({}));
+  if (!resp.ok) {
+    throw new Error((result.code || resp.status) + ": " + (result.error || resp.statusText));
+  }
+  return result;
+}
+
+// Exports
+
+let currentPath = "";
+
+function cell(row, content) {
+  const td = row.insertCell();
+  if (content instanceof Node) {
+    td.appendChild(content);
+  } else {
+    td.textContent = content;
+  }
+  return td;
+}
+
+function link(text, onclick, href) {
+  const a = document.createElement("a");
+  a.textContent = text;
+  a.href = href || "#";
+  if (onclick) {
+    a.onclick = (e) => {
+      e.preventDefault();
+      onclick();
+    };
+  }
+  return a;
+}
+
+async function browse(path) {
+  try {
+    const entries = await api("GET", "/api/list?path=" + encodeURIComponent(path));
+    currentPath = path;
+    location.hash = path;
+    showError(null);
+    renderBreadcrumb(path);
+    renderEntries(path, entries);
+  } catch (err) {
+    showError(err);
+  }
+}
+
+function renderBreadcrumb(path) {
+  const nav = $("breadcrumb");
+  nav.textContent = "";
+  nav.appendChild(link("/", () => browse("")));
+  let prefix = "";
+  for (const part of path.split("/").filter(Boolean)) {
+    prefix += (prefix ? "/" : "") + part;
+    const p = prefix;
+    nav.append(" ", link(part, () => browse(p)), " /");
+  }
+}
+
+function renderEntries(path, entries) {
+  const tbody = $("entries");
+  tbody.textContent = "";
+  for (const e of entries) {
+    const full = (path ? path + "/" : "") + e.name;
+    const row = tbody.insertRow();
+    if (e.type === "dir") {
+      cell(row, link(e.name + "/", () => browse(full)));
+      cell(row, "");
+    } else {
+      cell(row, link(e.name, null, "/api/get?path=" + encodeURIComponent(full)));
+      cell(row, formatBytes(e.size));
+    }
+    cell(row, new Date(e.mtime).toLocaleString());
+  }
+}
+
+// Inbox
+
+function upload(file) {
+  const item = document.createElement("li");
+  const bar = document.createElement("progress");
+  bar.max = file.size || 1;
+  item.append(file.name + " ", bar);
+  $("uploads").prepend(item);
+
+  // XMLHttpRequest rather than fetch: it reports upload progress.
+  const xhr = new XMLHttpRequest();
+  xhr.open("PUT", "/api/upload?name=" + encodeURIComponent(file.name));
+  xhr.upload.onprogress = (e) => { bar.value = e.loaded; };
+  xhr.onload = () => {
+    if (xhr.status === 200) {
+      item.textContent = file.name + " uploaded (" + formatBytes(file.size) + ")";
+      return;
+    }
+    let reason = xhr.statusText;
+    try {
+      const result = JSON.parse(xhr.responseText);
+      reason = result.code + ": " + result.error;
+    } catch (_) {}
+    item.textContent = file.name + " failed: " + reason;
+    item.className = "failed";
+  };
+  xhr.onerror = () => {
+    item.textContent = file.name + " failed: connection lost";
+    item.className = "failed";
+  };
+  xhr.send(file);
+}
+
+function setupDropzone() {
+  const zone = $("dropzone");
+  zone.addEventListener("dragover", (e) => {
+    e.preventDefault();
+    zone.classList.add("over");
+  });
+  zone.addEventListener("dragleave", () => zone.classList.remove("over"));
+  zone.addEventListener("drop", (e) => {
+    e.preventDefault();
+    zone.classList.remove("over");
+    Array.from(e.dataTransfer.files).forEach(upload);
+  });
+  $("picker").addEventListener("change", (e) => {
+    Array.from(e.target.files).forEach(upload);
+    e.target.value = "";
+  });
+}
+
+// Transfers
+
+function watchProgress() {
+  const source = new EventSource("/api/progress");
+  source.onmessage = (e) => {
+    const files = JSON.parse(e.data);
+    const tbody = $("progress");
+    tbody.textContent = "";
+    for (const f of files.slice().reverse()) {
+      const row = tbody.insertRow();
+      cell(row, f.direction === "send" ? "↑" : "↓");
+      cell(row, f.name);
+      cell(row, f.peer || "");
+      const bar = document.createElement("progress");
+      bar.max = f.total || 1;
+      bar.value = f.total ? f.done : 1;
+      const state = cell(row, bar);
+      if (f.error) {
+        state.textContent = f.error;
+        state.className = "failed";
+      } else if (f.finished) {
+        state.append(" done");
+      }
+      cell(row, f.finished ? "" : formatBytes(f.rate) + "/s");
+    }
+  };
+}
+
+setupDropzone();
+watchProgress();
+browse(decodeURIComponent(location.hash.slice(1)));
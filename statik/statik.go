@@ -7,6 +7,6 @@ import (
 )
 
 func init() {
-	data := "PK\x03\x04\x14\x00\x08\x00\x08\x00\x8ci\x91Q\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x10\x00	\x00certs/client.keyUT\x05\x00\x019Y\xdb_d\xd5\xb7\x12\xa3\xd0\x01\x85\xe1\x9e\xa7\xd8^\xe3\x11\"S\x92\xe1\x92A\x88\xd0\x11/ \x109>\xbdg\xd7\xa5Oy\xaa\xaf\xfb\xff\xf3w\xbc\xa4h\xd6\x1f\xc7\xd3>\xdc[\xfa\xa3K\xf1\xbf\x1715M\xda\xa1\xc6s\"g\xf1\xf0;\xd5\xdfFa\x0f\x94\xe7\\I\xe68_\xe0ux@\xe8\x7f9(q\xdc\xa0\xf1\x9c+PA\xb6\x13>\x90	\xce\xb96D5\x15@\x17\x9et\x8d\xb4\xb0t'\x06\xc9k\xbb\x0c\x9c[tqW/\x9c\xb6\xc2o?\x84J0A\x9cj\x9d4\xcaL\xce\xed+r\xca\xdc,\xef\x8aVD\xd0\xe0\xc5jnY\xc8\x840NYrU4\xac\xcb\x87\x06\x94\x0e\xd4D\xc5\xa4\xec\x8a\xb2\x19\xfb`\x83p]=K2\xd3oL\x88sJ	\xdaP\xcf\xd3N \xa8\x96\xa4\xde\x87l\x9f\xbf\x03\x0ee\x08\xfa\x90t\xef\x12\xfe\xd4L\x18\xa5\x9c\xee\xd0\x96zn\xa7v\xe9\x18\xbd\xac}\x1e\x0e\xfdU\x1aD\xf8\xbb`\x86\x07\xe6\xb5!/\xeaL\x1fX\x93\\\x1bI\xb9\xd0\x99\xf8y\xc4\x0f\x98\xe6\xf3\x83\xc2\xe2b+?\x17\xba\xe2-\x91\n\x81\xa6\x14\x8e\xd5oo\xac\xb1\xeb\xed\xba\x01\x19\x0d\xe3<#\xeb\xcb\x8b\x97\xb9\xfaj\xa5\x04~oz\xee2\xa8\x0eL\xf7\x12h\xffCo\x1d\xde\x04z\x1fz\xb1\xe3?\xce3\x06t\xabK\x94\x07\xc9\x0c\x9f\xc1\xdb\x95Z5C\xaa>\x83n\xd2\xae\x1c4y\x8e\x93\x04\x08%N\xc6r\x06\xf7\x17.\x9c'\x99\x9b\x7f\x80\xcdd\x9fS\xb5\xb7x*CHNyCWYT\x8a\xde\xab-\x16$\xb9z%\xa0\xf7z\xae\x0c;\x9aA\x0f\x0e&a\x9c\xbd'\xfc\x02\xee\x81\xf7rJ[\x82\xe2\xb2\x12i\x98*tX\xfc\xde.{\x1a\xd9E\xc6\xaaK\xa2S\x8bP \x1f\x873\xba\"\xfd\xd5\x95\xeeq\xbf\xa0\xd5FcN\xb5\xc0\x0e\xf96\xf0;;\xc9\xcbr47G\xc7>\xa6\xc9\xdb\x90\xbd\x97\x87>\xbe\x07A\xb2E\xf8B\xda\xbd\x14\xe4\xf0\x8a\x1f_\xeb\xd9\xeb\xcd u\xe6,\xf9\xbf\x8b\xcc}\x9c\xa3(\xbc\x04\x84\xb02\x84J\x1c\x0b\xf3\x8d\xc6\xde\xfbi\xc7\xe7\x065\x05z\xadK\x0c\x03q^\x95\x95\x1d*\x8d9T\xbaKy\xa0\xd2\xf8\x13\xd0\xec\xf3\xe9\xa0yH\xa1\x1f\xcd\xe9\xb5\xfd\xc9\xdb\x8e\xc4\xb4a\xb67o\xba\xc2\xf4\x8f\xa0\x18\xc9m\x94\xe3p\"\x8c\x13\x1d\x89\x00l\xd1<y\x9cJ\xe8\xe3\xb4\xfdbIw\x18\xac\x93\xa7\xde\x1f\xabI\xe6\xccW\xdf\x9c\xab\xf3\xd0\x15\xb34\xc3\xb5l\xee1\x0b\xe7\xf1\xb9\xd0E\xe4\xcaL\x8d\xc2\xbe\xf8\n\xb7sb\xbc\xf1k\xd5\xfc\xf0@\xf1\x98\xc7\xae\xdd\x91\xc7` \x13\x8c%X\x16\x04\x0f\x1e\x95\xaag0Ff\xee\xaf8\\\x16\x1a\x10\x0f\x04\xd7\x94hu\x83;~\x116\x88\xc4\xfd\xb1?\xcc\x01{\x96G 7\xb6\x96\xa55\xe4\xfd~y\x14\x96S/V\xbb\x94\xe1\xb2\x860/\x8c;\xc7\xe8\x9e\xecI\x04\x14E\xc5/\x86\x80f+\xe8\xd2\xb8Q\xb0x\x1b\xae\xfb\xc3\xfe\x8f\x9c\xc4\xe8<b\xbe\xcay\xbf\x9a.\xe5\x01\x9c\x0e\xfbm\x8f9:\xe9\x88,/\xd3B\xdao\x8e\xf95\x7f\x101@\x03\x9b\x1f\xee\x8d\xfd\xfc\x86i7\xf9`Sb\x81\x15\x9bC;\x1bew\xc2\xe6|N\xc3\xc8\xd5beQz\xed\xc9\xf6O|)\x0c\x92\xf6c\xbad\xb4y\x87|=\x0f%\x16\x7f\x8b\x88\xc1\x93\xae\xc6@~\x1d\xbc\xaa\xab\xbc\x90\n%\x1b\x9aT\xc8\xae\xd3\xb9\x94\xbe\xbeB\xc5}\xd4\xa2\x1as\x9e\x88\x90\xc7\xc8\\{\xf7U\xfe\x91\x05\"\xf0\xa2t\xe0\xbb^\xbe\xf8\xae\xf1UYd?A\xbe\xe2\xfa\xec\x07\xc9Z<\xdaz\x81\x92!2\x92M\xef8\xa7\x12\x01\xa2C\xe7\xe7\xe8\xe3^\x7f\xd0\x93\x94\x86[C\xe3\x9e\x0f\xe7:\xe2\x8f\xd9>\xf4<\xe7\xbcW\xb9\xe2\xe0\x8b\xff\x92V&\x93p4\x1e\xf0\xf9\x81\x8ew\xb0,\x18\xbf\xc8\x9b\xef,\xff\xde\x00\x18\xce\x9a:\xfdk|\xe7Q;\xa9\x13]k\xd9^\xbc+	\xb6\xb0u\xd8\xd6\x0bkvh\xf37dn\x935\xa7*\xfc+\x96\xa4\x18\xd9h\xa9\x03\xef\x1c\x1fN\xdd\xd6'ny\xcfZ\x07\x08\xc9\xb5\x99\x1b\xcb\xe9\x0d+\xe4i)\xbd\xdf7\xca>@\x9e\x87\x99\x8c0Y\xf9\xf0\xd8\x0fHv\xf6|\xac\x08\xc7\x08\x03.X\xfdy\xc3\x95\xc0\xfd\xd2^\xa4U]\x83\x82*\x8c\x81\xfb\xb5\x0dt\x84zy\x0d6\xda\x18\xb6\x9e\xd9>\xa1\x9e\x016\x8c\xd7\xec\x8bv\x12\xfcFd\xf1\x8ez\xeco\x83\x11:\xe1\xd2\xf9\xa8\xaa\x14gr\xc9\x91\xa0\x12X\x06)\x07\x04#\x80o'\xe1\x06\x85\xe7\xcc\xdf\x13(\xf4\xa3\x0f\x07V	y	\xcdl\x19\xb9\x18\xdcX\xbfLyu\x94\xc1\xc8=\xc6Wt\xb4m,\x88\x1fne\x11\xab\xf5=c\xeed\x9b	\xb5\xda$\x93\x17\xf4\xb2\xd3\xd8j.%\xd2>\xd8VD5\xf2\xc2\x00]e\xc0\x10\x16x\xcb!\xcd\x9e\xfb\xac\xdf3\x08\xf0\xb7\x01\xb1\xaa\xa1\xe2`\x0c\x98\x9fn*\x00\x8b\x9b\x89\xe4\xfc*s#\xbea\xab\xf1n\x85\xc7\x9a\"\x98iO\xb3\xaa\x1b	A\xf5\xb3#\xdc\x97\xbe\xc3KNT\xe4_w$K\xfc\xff\x16\xfd7\x00\x00\xff\xffPK\x07\x08\x97\xa3\xe9\x1a\x1b\x05\x00\x00\xa8\x06\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x8ci\x91Q\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x10\x00	\x00certs/client.pemUT\x05\x00\x019Y\xdb_\x8c\x94M\xd3\xa28\x17@\xf7\xfc\x8awo\xbd\xd5|\xa3\x8bY\x84\x10\x100HP@\xd8\x81`0\x82\x08\xf2\xe9\xaf\x9fz\x9e\xae\x99MW\xf5t\x96\xa7Nn\xdd\xb3\xb9\xff\xffz:\xb2l\xef\x7f\x10\x05g\xdb\xb4!8\xa3o\xcaa\xdb6(\x83\x104-\x84\x04\x16J\xc4\x0e\xa4\xfb\x01\xcd3\xf0t\xfa\xe8\xaa\xc7\xdd\xda\xcd\xbc\x0e\xc8\xdb\x04\x06\xd4)C\x07\x0c\x1e\x16\x10B\xa4W\x18r\x01\n\x17\xc3\x00\xaeN\xbdH\x07\x14\x03^9E\x1ft\xc4`\xfe)\xcd\xb3\x19\xc4\xe6ZXt1\x18\xc0?\xbd\x16\xeba1\xa5M\xb4r\x98\xbcgH\x12#\"\xe4`\x00\xc7\x89\x0c\x94a\x9d~\x7f\x06\xf3\x1c\xa4\xe2\xaeI/\xf6\x98\x88A\x93\xc7\xcbzh\x84W\xde\x84\xcb\xde\x00\xd9\xd7\x86\xdc?+B\x82b#\xfe9\x95X\xdf\xd2\x98\xc5\xdby_]=\xcc\xc0\x82\x19\x92\xf0\x19/\x98\xd9B\xfc\xc5>\xdfL\xe0\xfe\x85\xec\xd7\xbe?\xc9\xe3~\xd7\xf7'y\xdc\xef\xfa\xfe+\x8fRt\xe70\xe0-x\xea\xac\x93\x9dK\x06A: !\x00\xb2\xad\x1b3\xf8\x12\\\xd0\xda: P\x0d\xf3I>9\xa6\x0c\xfcu\xdcc\xcb\xd1\x8a\x00\xad/\x0dr\xefz\x11\xa9\xb2\x8e\xebA\x02o\xd7\x98\xf6\xab\xa4y\xf1\xa3ic+\xec\xa8\xa42?\xbb\xe4\x18\x90\xe6\xa6t9\xc9\xafu\xc1\x0c>\x14v6)\x0bS\x86/\xae\xcb\xd3\xf5\xa6\xd1\xaa\xdc\xd8\x8eU;\x95|\xdbf\xbb\x81\xdf\xe5\xbb\xcd.\x8c\x87!\xf0\x10\xce\x1e\x89l\xf4\x99\n\xed\xb6\xea\xbbI\xe6\xed4\x0b\"\x85\xfdx\xce\x94k\xcb\xd8ib\x85|J\xfa\xdc\xe7\xf0\x85\xaeZ\xcd3\xf5\xc7\xb8\xd8\xab+j\xef\xa1\xb9\xc6m\xb3\x96\x079~\xae4\x97B\xbc\x8e\x82\xbad\x1b\xf1\x9e\xae\xa3\xa2r\x84\xfa\x9d\xde\xbf\xa4\x99f\xd7~\xa3\x8aI1\x96\xd1\xca\x0f\x12\x933\x18\xdaV\xe1{\xcdx\x16\xef\xc7j\\?\x8eri_}?\x08A\xf2\xeeo\x0f\xbbD\x0e\xf7<k}\x9d\xd3}\xbb\xad\x05\xa8\x9d\"m\xac\xa5{\xe86q\x90\xf8\xa7\xcd\xb2$\x8e\xc6\\\xa4\x06T\xc9\xa5\xde9\x13\xc4\xf6\xf9\xad\xc9)I\xd9\x00(\xd69\x00\xd0l\x90\xc4q\xdb\xd4\xae\xa6\xab\x07\x08:\xe8\x04\x18\x94\"\x1d@3\xd6\xf3d\"w\xc3\xcb:7\xe5\x0b\xd5z\xf8\xca\x12D\xe0vt\xb1\x86\x8a#\xe0\xf4\xb6\xc8\xa6Qu\xe9\xe5\xe8\xafnw[\x8c\xc6tx\xb8\xdb,jo\x8f\xb7\xc4\xa4D\xf5\xf1|\xb9\x08\xa3\xd9\xb3.\xe8\xb3z\xcbKlTs\x9e%\xa0zs\xda\xb6$\xc2z_\xe2\xfa\x03\x84Q\xa2\xb1iU\xc9\xd6AF\xec\xdb\x00ds\x8b\xc3Mk+\"~<\xe7\x06\xd1\x95\x0f\xc3\xa1YRa\xa45\x15)\x1a\xb9\x90\xf9o\"\xb5e\xbdK\xe5\x02{\x85\xc6\x17\xfe\xe0'\x01\xe8q\xab.E\xa4\x94r{\xb5\xefxriY\xcd\xc9 \x1e\x82O\xbe\xb2\x9e\x88\xd0\xbb^\x0e\x02\xb7\xa6\xc7\x0b\xc8\xcfAl\xe9\x9fm7}\x9cQ\x00\xf3-\x1dTf\x11\x7fWu-\x8c\xe8T\xcb\xcf\xacm\xae\xbd\xa1\xca\xa5a>\xe2\xd3\x9b4\xb2\nN\x97L\xe0X\xa1+\xc2\xed}\xd9E\xa6x\xddO\xa1\xba\x0c\xf3|\x81\xc9m\x8a$?\x8aW\x95.fY\xc0R\xceBY\x0d;M:\xa2\xbf\xb8\xefc\x86<\xe3\xd7\x03\xf7w\x00\x00\x00\xff\xffPK\x07\x08w\xbf\x8b\xfeS\x03\x00\x00\xfd\x04\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x8ai\x91Q\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x16\x00	\x00certs/generate_cert.shUT\x05\x00\x014Y\xdb_\xbc\x91OK\x031\x10\xc5\xef\xfd\x14C='S\x90\n\n\x11\xa5\x16\x11\xa4\x05\xadx^\x93\xa9\xc6\xcd\x9f:\x93U\xf7\xdb\xcbvs\xdd\x83\x97\x9e\x1e\xbc\x1f\x03\xef\xc7\x9c\x81u\xf0\x9e\xf7\xc4`\xae!\xc8\x15\xd88\x14:\xe6cH\x17+\x96\xd2\x14o\xc7hAk=\xcb\x07J\"\x01\x98\xbe@%\xfa\x01\x95\xb2#\x01\xf5\xbb\\\\\x82\xca]\xa9Gh\x89\x8b\xa0\x10\x7f\x13\xeb\x03EP-\xf5S\xbc\xa5\x1e\x94kz\x81\xf3\x8b\xe5\x02\x94to\x9f0\xc7\x95\xb9[\xe3\xf3\xcel\x9e^\xf1\xd1\xac\x1b.\x1f\xb85\xf7\xc36\xdc\xbe\x98\x87\x1d\xae6\xe68U[\xb7\x8f\x81u\xf4\x89\x90b\xe3\xc3\xadsL\"#\xbe\x19z\xed\xf3\xfc\xdf\x026xJeZ\xa0\xf2\xd3	\xd4g(ak\xc6%\xb3\xbf\x00\x00\x00\xff\xffPK\x07\x08\xbf\x087}\xd4\x00\x00\x00\xd1\x01\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x8ai\x91Q\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x10\x00	\x00certs/server.keyUT\x05\x00\x015Y\xdb_d\xd5\xb7\x16\xaaH\x00\xc6\xf1\x9e\xa7\xb8=g\x0fQ\xc1rf@\x92\xe4l\x87\x84\x01Ar\xd2\xa7\xdf\xb3\xb7\xdd\xaf\xfc\xaa\x7f\xf7\xfb\xe7\xbfAY\xd1\xac?\x8e\xa7E \x90\xff\x18r\xfa\xf7%LM\x93w\xacA \x01\x0b\xe2v\xaa\xdbF\xb9\x1d4\x04\xae|\x07\xc0G\xd0\xc0\x07\xc6~\x0b\xb0\x0c\xc0\xa0A\xe0\xa2\x83V\x96\xfc\x8bc@\x7f\x86\x9dH\xc4Y\xae\x0cc-\x0b#h\xbf\xdd%\xa4\x9fL\\ns<5\x9bb/\x0c\xe7\xa0\xb6\x12xs\xf9\xd5\xe6\x93\x14\xc7\x90\xec\xf2~T\xf9p\xb3[\xe6\xb0\xde\x8446\x18\x86\xf7\xdbs\xeefw\x89\xc2\xe9#\xad\xb2x\x95\xd2\x1a\xd8[\x8d\xa7\x19o\xabx\xd5\xc7\xb0\x9e\xa0\x94\x96\x87\x1f\xa8\x1dL\x9f\xec\x97c\x84P\xc8\x18b\n\x16\xf0k\x91\xfe\x12t;\xe1\xc1\xe4\x89\xf3eb*d\xec(\xa6{\xeb+Z\x9a\xc7\x84\x1f\xae\x16\xfdA>\x9bA\xde\x04\xc9\xe5K\xffz\x16\x98\xe6\xd3\x9d\x90\xf8P\xd0\x9d\x07=O\xc8\x1d\x9f\x89)\x15E%;_\x01\xe8\xda3\x07e9\xba!i\xce\xf4`6d\x16\x1a=\x9d\xe5\x86jJs\xce>\x9c\xf33\xca5q\xae[\"\x98\xad&;\\\x0f\x133\xa0\xf4v>\x19w\xd7o\xcf\x96\x05GWRK\xf1\xa1b\xbaz(\x16z\x19\xcf\x15\x99\x0b\xf2\x85\xa2\xf3*\x93\x97\xf0\x97\xd0D[\xbf\xeeI\x05\xb0	\x01\x90\x11\xc62\x04z\x93t\xb8\xed\x0bty_Cnwfj\xfcI\xe2\xf0\x1c\x06i\x05\x9eJ\xbb\x8eCg#c#\xa7\"~|\xea\x0d\x18vqC\xddf!\xd6D\xf7\x95MGe\xac/\x89O\xc1\xee\xf4\xb7x2!\xe5}#\xbe\xa4\x104\x9f\xfa5aD\xaf\xe9F\xb7\x8c\xdf\xeb\x83\xc8\x83\xc4\xb4\x1e\xc3\x81ny\x82\x98,;3\xfd\xc3\x9a\xa4y\xa0\xbe\xea+$k\xd7\xd2JQ\xf4aG\x16\xce\x87\xdc8h\x86\xe0\xe1ZC\xe7\x0e\xacq\xab\x88f\xaa\xbf\x87\x05\xebH4\x82\xd5l\xdb\xda\x98~\x07\n\x92\xe5\x15\\ph~\xe0\x852\xe1c\xed\xde\xf7\xc9\x86\x9b\x85\xf1\xc1\x07\x894IvS3/\x0f:\xc44\xcf\xac\xe7'\xd7\xe6\x8c\x13\xf3Tm\x9d)\xa3\xc0\xbb\x94+\xeby\x91\x9bK\xf5\x81S\x95\xf4\xa7\xac\x85-\xb4\xd0)\\p}\x1f\x97!w\x90\xd2\xcb\xf6\x8b\xe0T\xf9\xb3/\xdaq\xa6aI\xbfi%\xf5\x9c\xec}\xdb\xab#\xb4e\xe0c\xa6\xf9\xa5g\xc1E7ul\x11Ne\xc01\xdcD\xebm\xc42$\xae&?'D\x8d\x0b\x82\n\x9f\x87T\xc0\x8b\x17\x91\xe4\xfc\x13\xfd\xcb\xbddp\xb8\x9f\xa2R\x86\xb0>pL:0i\xbeM\xfb\x96\xde\xbf\x94\x02\xf43y\xa4\x93\x9d\x8f\x06Ix\x99#4\xf7\xf4\xc3y\xe9\xaep\x03\xcd\xd9\x06\xc3\xef\xfc\xaa_\xc8~\x15\x83\xeb\xb6\xdd3\xc7/\xbe\xbfi5#7\xa4\xbe^g\xf9#\xb5\xe4\xce\xb5\xd8=6%\x180\x07y-\xba\xb6\xd5\x08\xa6(\x19\x01\x9d\xe7y\xa1\xbf\x99\xc1\xfc\x9b\xfc\x9d\xa2\xce|\xcb\x0f\xb2G\xcb\x93\x9e\x8c\xe8qT\x1d\xf4\xbf,\xa6\xaa\x98\x96\x04\"\x11q\xde\xee/\x7f\xea\xc6\x8fY\xb6\xaf8,\xad\x8e\x17d-?\x1dNe\xb9s\xcd\x8b\x1c\xd6\x05\xb3\x87\\!X,\x0de\xba*\x87el\xfd\xb9\"\xcd\x0f\xb1h2\xf9R[\xfa\xee\xe22i\x81Z\xe7W}\xdc@v\x07!\xba\n\x97\xcf\xd8z\xbf\x89\xeb?\xd6\xa1K/x\xf4\x9b\"9S\x8b\xb7>\x92\x0b\xea\xfa\x1d\x08rV\xaa\x91\xea\x8cQ\x0d\x11NAp\x0f\x9c[!g\xc7\xf1&i\xb1f\xfc\xf0\xb6\x99\x9fyZSy\x19/MN\xc2\x89y\xf8\\X\xac/\xf6\xea\xa1\xae&B%\xa4\xed\x97\xb1G\xd5\xfa\xe5\xf7\xc9P\xa7\xce\xaa\x18u\x8d\xcfCIn\xb23\x02.v\x1c\x8e\xa4\xd8\xf6\xe0\xcd`|\xd6-\xbc\x8df\x0f\xfa\xc4_?\xe3I\x84kT\x7fk\xea\xc6\xd4Y\x9bZ\xddj\x15\xe6\xdcSn\xe8\xfdNz\x9e\xe3\xe6G%l\xb7\x0b\xe6O\xbd=\xe9t\xe3LD\xc7\xe2]\xb9;\x87\x011\x10l\x82\x0d\xc4\xeb\"\x8f\xef\x85\x8dh\x8ez\xbf\x8d\xae\xf4\x7f\xd7\xc7e\xa4\xecM\xdba\xc06\xd3\xae\x18Nh\x84q\x96!\x8d\x81QF\xb2\xfbqz\x1b:\xd8\x93w\x88\x0f\x1c\x9e\xdc\xeb\x93VW\xbei\xeb\xc5\xb5\x96\x19,\xbb\xef\xbc\xf0\xcf\x8b\xf8\xfb\x92\xde\xeb\x86\xdb\xeb\xadT\x15\xbc4\x87z3\xe8L\xf695\xa4jW\xd1\xd2\x99`\xef;\x99\xb3\xf2>\xa3\xf2\xe9\x9e\xbd.\x87\xb6`\xe9\x81\x1bgI\xec\x9eB\xdcWm\x10\xc6\xfc\x1d\x0c\n\x04\xa6\xd4\x9bi\"F\x97*\xe3K?\xa1\xaf\\@\xb0h\xdc\xfcg*=5\x0d\x15\xeb\xd2!\xaa/\xe6Wb\xfb\xfc\x06\xb0l9\x8cU\xe6\x92\x96\x9bZ\x8e\xa4\x8a)\x7f4L\xf9]\x0c\xcb\xda\x10X\xcc\xf8\x15Q6\xc9aG\xd5\x9b|'\x05\xc34\xf5%n\x8aWs\x8aO{\xadJ~\x0dF\x9e\xdf7^\xad\xd5$5\xdcDE\x89k4\xa5\x11hj2\xe5k\xa9\xfe\x08\xa8X'\xb5}7\xa5\x13\xc8bf\x85\x83c\x0c\x9d\xect\xe2\xaf;\xb2%\xfd\xdf\xa2\x7f\x03\x00\x00\xff\xffPK\x07\x08\x15\xfa\xa7(\x1f\x05\x00\x00\xa8\x06\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x8ai\x91Q\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x10\x00	\x00certs/server.pemUT\x05\x00\x015Y\xdb_\x8c\x94K\xb3\xaa<\x16@\xe7\xfc\x8a\x9e[]\x82\xa2\xe0\xa0\x07!\x89\xc8#h\xc0\x082C\xde\xaf\x83\xbc\xc1_\xdfu\xce\xad\xee\xc9\xad\xba\xdf\xcdp\xd5\xca\xae\xbd&\xfb\xdf\xdfO\xc1\xaaf\xfd\x0bb\xfb\xae\x9d5\x08\xee\xf8\x87rD\xd3PZ@\x08\xea\x06B\x8a|\x19\xa7\xcb!\x91\xb7\xa7;\xb0\x94\xb4l\xb32WO3\xaf\x00\xda\x9f\x01\x82JZ`\x93\x80R\x05\x02\xc3JF gc\xb6 \x04\x0c%\xb5\x1e\nH	\xe0\x0f\xce\xe3\x83\xaf\x04\xcc\xbf\xa4y>\xdb\xeey\x8d\xd4tA\x05 \xbf\xbc\x86(,\x9a\xfc\xfa\xb1r\x84\xf63\xa4O\xf4\xa0\xd4D@\xd7\x1f\x08\x07DI\x7f>\x83y\xb6\xfd\xdd\xa9\xf6=m|\xee\xec\xfa\xe5.\xabY\x0b\xefW\xcd\x96\x0b\x02\xc1\xf7\x86\xdc\xffV\x84\x14\xbb\xc8\xfd5\x95\xaa?\xd2\x18\xb8\xf2|\xc9B\x8b\x14`!\x05\xde\x93;YH\xa1-\xee7\xfb\xfc0\x81\xfb?,~\xef\xfb\x9b<\xeeO}\x7f\x93\xc7\xfd\xa9\xef\x9f\xf2\xd2\x14\xe7\x1c\x01\xbc\n\x9dVu\xb4\xd7\x1eQ\xac\x00\xca\x00\x105\x05\xcd\xe0[0@\xa3)\x80\xc2\x99W\xfbpM]\xc0\xd7\xcd\xe4\xc9\x1dN\x0cc\x88#\xe3\xce\x95ku`\xbc/\xb8\xf1\xd8\xb9m>\xaa\xd7^\xd8\xdf`\x99H\"\xe9?\x19\xf17\xf2\x9bm\xaa\xf0\xeb}\x11\xd9x-\x85\xd9*\xd0;O\x15v>\xf9]\xd5q\xb4\x7f\xb0\xb6F\x03\x96\x8f\xe8\x99\x81\xeb\x98\xa5m\x97\x8e\x83|\xd4\xdf,k\x15\xf4\x8cg\xe7~\xa9\x94\xa7\xbf[\xf7\x82\xc4\xa4@h\xef=\xf8\x94P\x7fI\xfa\x95\xf3D\xd0\xdarwh\x85\x04\x1a\x13t\xf9/k\x95-\xcd\x16X\xbd\xcfd\xa7\xc1K\xde\xe0QBT\x8c\x9d\xe3\x12\xa5\xbc\xf8\x9c\x90\xc8$\xfdf\xf2]\x0b)\xf7\xf6=\x82\xa2(\xc1\xb7U\x02\xba\xe6\x87 \x8e\xdf\x94mH\xc77$\xdf\x04\xcc\xf8\xe2\x83\xd0\xb8\x10\xd4\x85;\xf3\xb6\xd4o\x9c-\xc3\xe8I\xa4\xd4\xf0m\xff\xc5)\x1e\xb9o\xf5\xb2[\x04:\xe9'\xbf\xdc\x81\xb9\x8a\xb7}To]>1U\x0b\xbe\x0c\x7f\x80\xa4\x87\x8e\x14UvBD\x94\xae\x9a|\xd5\x8f\x93\x97\x80\x94(\x1c\x00xF\xf4\xa9\x1b\x8d\xafeSh\x01\x8aM\x85\x02\x94\xa6X\x01\xaa\xbf=z\x0b\xd0\xd8\xdd\xcbM\xb0L\xa0i\xcf\xb7\xf2\x94\xec\x06v)\xebn\xec\xbfL\xee\x9c\xdf}\xc99\x80\xebu\x93\x1f\xe2\x02\xbc>\xd2\xc4[\xfc\xd4\x0d\xe2us4\xf2,)\x9ck\x15\x15=\x14y\x15GX\x1d5\xb7\xb3\xfc(\x9ew\xed\x0d!\x95\x83\x8a\xa7iB\xd3\x07\xcdtk[\x11\xf5\xf9mx\xcc\x97\x8a\xe7\x13$\xf2X,=\xd5\xb4B\xcd\xa5\x96\xa2d\xb1\xc0\x9e\xc5r\x9f\xddX\x96\x02\x91\x7f\x05\xb6\xc4Q\xc1r\xeb\x1d\xee\n	 \xdbP\xf3W\xdd\x1b\xceV\xdd~ ?\xd9\xf6\xfa:V\xd9n\xaer9\xa4\xcd\x10\x94Y+u\xacH\x9b\\O\xcf\xfb\xd9i\x0c\xca\xc9\xd2xX#b\xd9\xe1\xc3\xacQc$9;\x1f\xec\xcf\xfb\xf4\xf2\x03\x8fmE6\x84\x9f~\xc0\xf5\xc7H\xa7}\xcf\x8f\xa7\xc1\x81\xf3J\x17F\xda\xc2)R\xc4)\x04V\x9d\xf9 a\xdfkg\xff\xe4\xe5G\x04\x8d\xd3\xc90;xxW2\xdb\xe4k\xd7\x9e\xcd5\xb6\xafBP\x9f\xed)\x08\xff\xc3\xfd\x1c3l\xa1\xdf\x0f\xdc\x7f\x03\x00\x00\xff\xffPK\x07\x08T43\xfbT\x03\x00\x00\xfd\x04\x00\x00PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x8ci\x91Q\x97\xa3\xe9\x1a\x1b\x05\x00\x00\xa8\x06\x00\x00\x10\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa4\x81\x00\x00\x00\x00certs/client.keyUT\x05\x00\x019Y\xdb_PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x8ci\x91Qw\xbf\x8b\xfeS\x03\x00\x00\xfd\x04\x00\x00\x10\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa4\x81b\x05\x00\x00certs/client.pemUT\x05\x00\x019Y\xdb_PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x8ai\x91Q\xbf\x087}\xd4\x00\x00\x00\xd1\x01\x00\x00\x16\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa4\x81\xfc\x08\x00\x00certs/generate_cert.shUT\x05\x00\x014Y\xdb_PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x8ai\x91Q\x15\xfa\xa7(\x1f\x05\x00\x00\xa8\x06\x00\x00\x10\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa4\x81\x1d\n\x00\x00certs/server.keyUT\x05\x00\x015Y\xdb_PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x8ai\x91QT43\xfbT\x03\x00\x00\xfd\x04\x00\x00\x10\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa4\x81\x83\x0f\x00\x00certs/server.pemUT\x05\x00\x015Y\xdb_PK\x05\x06\x00\x00\x00\x00\x05\x00\x05\x00i\x01\x00\x00\x1e\x13\x00\x00\x00\x00"
+	data := "PK\x03\x04\x14\x00\x08\x00\x08\x00\x8ci\x91Q\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x10\x00	\x00certs/client.keyUT\x05\x00\x019Y\xdb_\x04\xc0G\xd6kP\x00\x00\xe0\xb9U\xbcyN\xce/\xba\xa1\xce\xd5\x89(3\xf5\"D\xaf\xab\x7f\xdf\xf3\xf9|>yI\xd1\xac\x7f\x8e\xa7}\xb8\xb7\xf4O\x97\xe2\xe7\xf3\xf9|\"\xa6\xa6I;\xd4xN\xe4,\x1e~\xa7\xfa\xdb(\xec\x81\xf2\x9c+\xc9\x1c\xe7\x0b\xbc\x0e\x0f\x08\xfd/\x07%\x8e\x1b4\x9es\x05*\xc8v\xc2\x072\xc19\xd7\x86\xa8\xa6\x02\xe8\xc2\x93\xae\x91\x16\x96\xee\xc4 ym\x97\x81s\x8b.\xee\xea\x85\xd3V\xf8\xed\x87P	&\x88S\xad\x93F\x99\xc9\xb9}EN\x99\x9b\xe5]\xd1\x8a\x08\x1a\xbcX\xcd-\x0b\x99\x10\xc6)K\xae\x8a\x86u\xf9\xd0\x80\xd2\x81\x9a\xa8\x98\x94]Q6c\x1fl\x10\xae\xabgIf\xfa\x8d	qN)A\x1b\xeay\xda	\x04\xd5\x92\xd4\xfb\x90\xed\xdf\xef\x80C\x19\x82>$\xdd\xbb\x84?5\x13F)\xa7;\xb4\xa5\xfe\xb6S\xbbt\x8c^\xd6>\x0f\x87\xfe*\x0d\"\xfc]0\xc3\x03\xf3\xda\x90\x17u\xa6\x0f\xacI\xae\x8d\xa4\\\xe8L\xfc<\xe2\x07L\xf3\xf9Aaq\xb1\x95\x9f\x0b]\xf1\x96H\x85@S\n\xc7\xea\xb77\xd6\xd8\xf5v\xdd\x80\x8c\x86q\x9e\x91\xf5\xe5\xc5\xcb\\}\xb5R\x02\xbf7=w\x19T\x07\xa6{	\xb4\xff\xa1\xb7\x0eo\x02\xbd\x0f\xbd\xd8\xf1\x1f\xe7\x19\x03\xba\xd5%\xca\x83d\x86\xcf\xe0\xedJ\xad\x9a!U\x9fA7iW\x0e\x9a<\xc7I\x02\x84\x12'c9\x83\xfb\x0b\x17\xce\x93\xcc\xcd?\xc0f\xb2\xcf\xa9\xda[<\x95!$\xa7\xbc\xa1\xab,*E\xef\xd5\x16\x0b\x92\\\xbd\x12\xd0{=W\x86\x1d\xcd\xa0\x07\x07\x930\xce\xde\x13~\x01\xf7\xc0{9\xa5-AqY\x894L\x15:,~o\x97=\x8d\xec\"c\xd5%\xd1\xa9E(\x90\x8f\xc3\x19]\x91\xfe\xeaJ\xf7\xb8_\xd0j\xa31\xa7Z`\x87|\x1b\xf8\x9d\x9d\xe4e9\x9a\x9b\xa3c\x1f\xd3\xe4m\xc8\xde\xcbC\x1f\xdf\x83 \xd9\"|!\xed^\nrx\xc5\x8f\xaf\xf5\xd7\xeb\xcd u\xe6,\xf9\xbf\x8b\xcc}\x9c\xa3(\xbc\x04\x84\xb02\x84J\x1c\x0b\xf3\x8d\xc6\xde\xfbi\xc7\xe7\x065\x05z\xadK\x0c\x03q^\x95\x95\x1d*\x8d9T\xbaKy\xa0\xd2\xf8\x1f\xa0\xd9\xbf?\x07\xcdC\n\xfdhN\xaf\xed\x7f\xbc\xedHL\x1bf{\xf3\xa6+L\xff\x08\x8a\x91\xdcF9\x0e'\xc28\xd1\x91\x08\xc0\x16\xcd\x93\xc7\xa9\x84>N\xdb/\x96t\x87\xc1:y\xea\xfd\xb1\x9ad\xce|\xf5\xcd\xb9:\x0f]1K3\\\xcb\xe6\x1e\xb3p\x1e\x9f\x0b]D\xae\xcc\xd4(\xec\x8b\xafp;'\xc6\x1b\xbfV\xcd\x0f\x0f\x14\x8fy\xec\xda\x1dy\x0c\x062\xc1X\x82eA\xf0\xe0Q\xa9\xfa\x0b\xc6\xc8\xcc\xfd\x15\x87\xcbB\x03\xe2\x81\xe0\x9a\x12\xadnp\xc7/\xc2\x06\x91\xb8?\xf6\x879`\x7f\xe5\x11\xc8\x8d\xadei\x0dy\xbf_\x1e\x85\xe5\xd4\x8b\xd5.e\xb8\xac!\xcc\x0b\xe3\xce1\xba'{\x12\x01EQ\xf1\x8b!\xa0\xd9\n\xba4n\x14,\xde\x86\xeb\xfe\xb0\xae\xceCWLbt\x1e1_\xe5\xbc_M\x97\xf2\x00N\x87\xfd\xb6\xc7\x1c\x9dtD\x96\x97i!\xed7\xc7\xfc\x9a?\x88\x18\xa0\x81\xcd\x0f\xf7\xc6~~\xc3\xb4\x9b|\xb0)\xb1\xc0\x8a\xcd\xa1\x9d\x8d\xb2;as\xfeM\xc3\xc8\xd5beQz\xed\xc9\xf6O|)\x0c\x92\xf6c\xbad\xb4y\x87|=\x0f%\x16\x7f\x8b\x88\xc1\x93\xae\xc6@~\x1d\xbc\xaa\xab\xbc\x90\n%\x1b\x9aT\xc8\xae\xd3\xb9\x94\xbe\xbeB\xc5}\xd4\xa2\x1as\x9e\x88\x90\xc7\xc8\\{\xf7U\\\x9d\x87\xae@\x04^\x94\x0e|\xd7\xcb\x17\xdf5\xbe*\x8b\xec'\xc8W\\\x9f\xfd Y\x8bG[/P2DF\xb2\xe9\x1d\xe7T\"@t\xe8\xfc\x1c}\xdc\xeb\x0fz\x92\xd2pkh\xdc\xf3\xe1\\G\xfc1\xdb\x87\x9e\xe7\x9c\xf7*W\x1c|\xf1_\xd2\xcad\x12\x8e\xc6\x03\xfe}\xa0\xe3\x1d,\x0b\xc6/\xf2\xe6;\xcb\xbf7\x00\x86\xb3\xa6N\xff\x1a\xdfy\xd4N\xeaD\xd7Z\xb6\x17\xefJ\x82-l\x1d\xb6\xf5\xc2\x9a\x1d\xda\xfc\x0d\x99\xdbd\xcd\xa9\n]\x9d\x87\x92\x14#\x1b-u\xe0\x9d\xe3\xc3\xa9\xdb\xfa\xc4-\xefY\xeb\x00!\xb96sc9\xbda\x85<-\xa5\xf7\xfbF\xd9\x07\xc8\xf30\x93\x11&+\x1f\x1e\xfb\x01\xc9\xce\xfe\x1e+\xc21\xc2\x80\x0bV\x7f\xdep%p\xbf\xb4\x17iU\xd7\xa0\xa0\nc\xe0~m\x03\x1d\xa1^^\x83\x8d6\x86\xadg\xb6O\xa8g\x80\x0d\xe35\xfb\xa2\x9d\x04\xbf\x11Y\xbc\xa3\x1e\xfb\xdb`\x84N\xb8t>\xaa*\xc5\x99\\r$\xa8\x04\x96A\xca\x01\xc1\x08\xe0\xdbI\xb8A\xe19\xf3\xf7\x07\x14\xfa\xd1\x87\x03\xab\x84\xbc\x84f\xb6\x8c\\\x0cn\xac_\xa6\xbc:\xca`\xe4\x1e\xe3+:\xda6\x16\xc4\x0f\xb7\xb2\x88\xd5\xfa\x9e1w\xb2\xcd\x84Zm\x92\xc9\x0bz\xd9il5\x97\x12i\x1fl+\xa2\x1aya\x80\xae2`\x08\x0b\xbc\xe5\x90f\xcf}\xd6\xef\x19\x04\xf8\xdb\x80X\xd5Pq0\x06\xccO7\x15\x80\xc5\xcdDr~\x95\xb9\x11\xdf\xb0\xd5x\xb7\xc2cM\x11\xcc\xb4\xa7Y\xd5\x8d\x84\xa0\xfa\xd9\x11\xeeK\xdf\xe1%'*\xf2|>\x9fO\xc9\x12\xff9\x9e\xf6\xe1\xde\xd2?]\x8a\x9f\xcf\xe7\xf3\x89\xfc\x1f\x00PK\x07\x08\x97\xa3\xe9\x1a(\x05\x00\x00\xa8\x06\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x8ci\x91Q\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x10\x00	\x00certs/client.pemUT\x05\x00\x019Y\xdb_\x8c\x8f\xcd\xb2\xa28\x1cG\xf7<E\xef-\xab\xf9F\x17\xb3\x08!`\xc0 A\x01a\x07\x82A\x84\xcb\x05\xf9\xf4\xe9\xa7n\xdf\x9a\xd9LUOgy\xea\xe4_\xbf\xb3\xfdz:\xb2\xb0\xfb\x03\"\xff\x82M\x0c\xc1\x05}\xc1-G06X\x05!hZ\x08)\xcc\x95\xb0:\xd2\xee'4/\xc0\xd5\xd9\xb3+\x9f\x0fk?\xf3:\xa0/\x13\x18Pg\x15:\x12\xf0\xb4\x80\x10 \xbd$\x90\xf3Q\xb0\x18\x06pt\xe6\x86:`\x04\xf0\xca9|\xa3\x13\x01\xf3\xb74\xcf\xa6\x1f\x99kn\xb1\xc5\xa8\x00\xf9\xf6Z\xa2\x07\xf9\x944\xe1\xca\x11\xfa\x9a!\x8d\x8d\x90\xd2\xa3\x01l;4PJt\xf6\xeb3\x98g?\x11\xf7Mr\xc5c,\xfaM\x16-\xeb\xb1\x11>\xb3&X\x0e\x06H\xbf\x16r\xffL\x84\x14EF\xf4}\x95Z\xbf\xa41\x8dv\xf3\xa1\xbc\xb9\xa4\x02\x0b\xa9\x90D.d!\x15\x16\xa2/\xf6\xfe\xc5\x04\xee_X\xfd\xb7\xefO\xf2\xb8\xdf\xf5\xfdI\x1e\xf7\xbb\xbe\xff\xcbc\x0c=8\x02x\x0b\x9e;\xeb\x8c3\xc9\xa0H\x074\x00@\xc6\xba1\x83/\xc1\x01-\xd6\x01\x85j\x90M\xf2\xd96e\xe0\xad\xe3\x81X\xb6\x96\xfbh\xfd\xd4 \xf7\xaa\x17\x91)\xeb\xb8\x1e%\xf0r\x8c\xe9\xb0J\x9a\x1b=\x9b6\xb2\x82\x8eIj\xe5\xa5\xd7\x8c\x00\xda\xdc\x95.\xa3\xd9\xad\xce+\x83\x0f\x84=\xa6En\xca\xf0\x93\xeb\xb2d\xbdk\xac,6\xd8\xb6j\xbb\x94\xef\xbbt?\xf0\xfbl\xbf\xd9\x07\xd10\xf8.\"\xe93\x96\x8d>U!n\xcb\xbe\x9bd\x1e'\xa9\x1f*\xd5\xcf\x8f\x99qm\x11\xd9M\xa4\xd0w\xc1>\x0e\x19\xfcD7\xad\xe6+\xf5\xe7\xb8\xe0\xd5\x11\xb5\xd7\xd0\xdc\xa2\xb6Y\x8b\xa3\x1c}\xac,\x93\x02\xb2\x8e\x82\xba\xa4\x1b\xf1\x91\xac\xa3\xa2r\x94y\x9d\xde\x7fJ3Ko\xfdF\x15\xe3|,\xc2\x95\x1f\xa4JNa\x80\xad\xdcs\x9b\xf1\">N\xe5\xb8\xbem\xe5\xda~\xf6\xfd \xf8\xf1\xab\xbf?q\x81l\xee\xe3\xa2\xf5u\xc6\x0e\xed\xae\x16\xa0v\x0e\xb5\xb1\x96\x1e\x81\xd3D~\xec\x9d7\xcb\x12\xdbZ\xe5 \xd5gJ&\xf5\xf6\x85\xa2\xea\x90\xdd\x9b\x8c\xd1\xa4\x1a\x00#:\x07\x00\x9a\x0d\x1a\xdbN\x9b\xe0r\xba\xb9\x80\xa2\xa3N\x81\xc1\x18\xd2\x014#=\x8b'\xfa0\xdc\xb4s\x12>W\xad\xa7\xa7,~\x08\xee'\x87h(?\x01No\xf3t\x1aU\x87]O\xde\xeat\xf7\xc5hL\x9b\x87\xfb\xcd\xa2\xf6x\xbc\xc7&\xa3\xaaG\xe6\xebU\x18\xcd\xbe\xea\xfc>\xadw\xbcT\x8dj\xc6W1(_\x9c\xb6+\xa8\xb0>\x96\xa8~\x03a\x94XdZe\xbc\xb3\x91\x11y\x18\x80tnI\xb0i\xb1\"\x92\xe7\xc7\xdc \xb6\xf2A04K\"\x8c\xacf\"C#\x17T\xde\x8bJmQ\xef\x139'n\xae\xf1\xb97x\xb1\x0fz\xd2\xaaK\x1e*\x85\xdc\xde\xf0\x83L\x0e+\xca9\x1e\xc4\xa3\xff\xce\xd6\xaa\xa7\"to\xd7\xa3\xc0\xad\xc9\xe9\n\xb2\x8b\x1fY\xfa{\xd7Mo{\x14\xc0|O\x06\xb5\xb2\xa8\xb7/\xbb\x16\x86l\xaa\xe5\x8f\xb4mn\xbd\xa1\xca\x85a>\xa3\xf3\x8b6\xb2\n\xce\xd7T\xe0\xaa\\W\x84\xfb\xeb\xba\x0fM\xf1v\x98\x02u\x19\xe6\xf9\n\xe3\xfb\x14J^\x18\xad*[\xcc\"\x87\x85\x9c\x06\xb2\x1at\x9atB\x7fq\xdb\xedv\xbbE\xae\xf1\x03\"\xff\x82M\x0c\xc1\x05m\xb7\xdb\xed\x96\xfb{\x00PK\x07\x08w\xbf\x8b\xfe\\\x03\x00\x00\xfd\x04\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x8ai\x91Q\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x16\x00	\x00certs/generate_cert.shUT\x05\x00\x014Y\xdb_\xbc\x91\xcdJC1\x10\x85\xf7}\x8a\xa1\xae\x93)H\x05\x85\x88R\x8b\x08\xd2\x82V\\\xc7d\xaa\xf1\xe6\xa7\xce\xe4\xaa\xf7\xed\xe5\xb6\xd9v\xe1\xa6\xab\x03\xe7c\xe0|\xcc\x198\x0f\xefeK\x0c\xe6\x1a\xa2\\\x81Kc\xa1S\xd9\x87\xf4\xa9a\xa9\xb6\x06w\x88\x0e\xb4\xd6\x93\xb2\xa3,\x12\x81\xe9\x0bT\xa6\x1fP\xb9x\x12P\xbf\xf3\xd9%\xa8\xd2\xd7v\x84\x8e\xb8\n\n\xf17\xb1\xdeQ\x02\xd5\xd1p\x8cw4\x80\xf2v\x108\xbf\x98\xcf@I\xff\xf6	S\\\x98\xbb%>o\xcc\xea\xe9\x15\x1f\xcd\xd2r\xfd\xc0\xb5\xb9\x1f\xa7\xe3\xfa\xc5<lp\xb12\xfb\xa9\xda\xf9m\x8a\xacS\xc8\x84\x94l\x88\xb7\xde3\x89\x1c\xf0\xcd\xd8\xebP\xa6\xff\x16p1P\xae\xc7\x05\x1a?\x9d@{\x86\x12vF\xaa\xad\xc1M\xfe\x06\x00PK\x07\x08\xbf\x087}\xd2\x00\x00\x00\xd1\x01\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x8ai\x91Q\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x10\x00	\x00certs/server.keyUT\x05\x00\x015Y\xdb_\x04\xc0\xc7\xd6k@\x00\x00\xe0\xbd\xa7\xb8{\xc7Q\x13\xb2\x9ca\xa2\xfdz\xcfN\x94!Dt\x92\xa7\xbf\x1fEQ\x14\x05\x91\xaa\xdb\xff\\_\x8fA\x88\xfe\x99(\xa3(\x8a\xa2\x08K\xd7\xd1\x8eu\x08\x14`C\xdcMM\xd7\xaa\xb7\x83\x81\xc0Cw\x00\x02\x19\x9a\xf8\xc08\xe8\x00F\x00|t\x08<\xf9`\xd4\xa5\xf8\xe2\x040\xef\xcfN\xa4\xd2\x8cj\xd3\\\xab\xd2\x0c\xbbo\x7f\x89\x98\x07\x9bT\xdb\x9cL\xed\xa6:\x0b\xcb\xbbrW\x8b\x82\xb5\xfc\x1a\xebAJcD\xf6\xc50jB\xb49\x1d{\xd8/B\x19[\x0c\xa3\xfb\xed1\xf7\xb3\xb7\xc4\xd1\xf4VV$]\x95\xac\x01\xce\xd6\xe0i\xc6\xdb*]\x8d1j&\xa8d\xd5\x11\x84Z\x0f\xb3\x07\xf7\xe5Y1\x12s\x96\x98\xc2\x05\xfc:\xd9x\x8a\x86\x93\n`\xf2\xa5\xf92\xb1\xb5l\xeer\xc2\x0c\xf6W\xb2u\x9f\x8d\xde|#\x05\x1ft\xb6\x1f\xb4\x89\x8a'T\xc1\xf5,1#d;\xa1\x08\x91h\xb8\x7f\xcc<\xc9\xde\xf8H-\xa5,k\xe4~E`\xe8\x8f\x02T\xd5\xe8E\xa453\x1f\xab%\xf3\xc8\x1c\x98\xbc05K\x99\x0b\xee\xcf=\xdf#j\x88s\xddR\xd1\xeat\xe4\xf2\x03L\xad\x906\xba\xf9d\xbd\xdd\xb8=:\x0e\x1c}E/\xe5\x9bN\x98\xfaO\xb5\xe5\xa7\xf9Xek\x91\x03\xb1\xec\xfd\xda\x12\x14\xfc%t\xc91\xae{Z\x03lA\x00\x90\x8c1\x82\xc0h\xd3\x1ewC)_^\xd7\x88\xdf\xdd\x99\x1e\x7f\x8a\xf4y|>\xca\n|\x8d\xf1\\\x97\xc9G\xd6\x91\xdd\x9a\xf8	\x99\xff\xc1\xb0OZ\xfa6\x8b\x89.y\xcf|:js}*B\x06vw\xb8%\x93\x05i\xff\x1b\x0b\x15-C\xeba\\SV\xf2\xdb~\xf4\xaa\xe4\xb5\xfe\x11E\x98Z\xf6\xdf\xe7\x90oE*\xb3y~\xe6\xc6\x9b\xb3H\xeb\x90\x87z\xa8e\xa4_+;\x93\xe377rp>P\xeb\xca3\x04\x7f\x9e\xfd\xe9\xbd\x0fg\xdej\xa2\x9d\x9a\xefa\xc3&\x96\xccp\xb5\xba\xae1\xa7\xdf!\x87\xe9\xf2\x0c/8\xb2\xde\xf0B[\xf0o\xed_\xf7\xc9\x81\x9b\x8d\xf1!\x84\xa92)N\xdb\xb0O\x1f\xba\xc44\xcf\x9c\x1f\xa4\xd7\xf6LR\xeb\xd4\x1c\x83\xad\xe2\xd0\xbfT+\xe7\xfb\xb1W(\xcd\x813\x8d\x0c\xa6\xbc\x83\x1d\xb4\xe5S\xbc\xe0\xe6>.\x9f\xc2\x95\xd5\x019O\x82\xd7\xd0{_\xf4\xe3\xcc\xa2\x8ay1j\xe6\xbb\xf9\xeb\xb6\xd7G\xe4 \x10`\xb6\xfdeg\xc9\xc77m\xecd\x9c!\xc0\xb3\xfc\xc4\x18]\xcc\xb1$\xae\xa7\xa0 $\x9d\x0f\xc3\x1a\x9f\x87R\xc2\x8b\x1f\x93\xe4\xfc\x93\x82\xcb\xbdbq\xb4\x9f\x92ZE\xb09pB\xba0m\xbfm\xf7R^\xbf\x8c\x06\xcc#\xfd\xcb&\xa7\x18M\x92\xf0sWl\xef\xd9\x9b\xf7\xb3]\xe5?\x0c\xef\x98\xac\xb0\x0b\xabq!\x87U\n\xaf\xdbv\xcf\xdd\xa0\xfc\xfe\xa6\xd5\x8a\xbd\x88\xfe\xfa\xbd\x1d\x8c\xf4R\xb8\xd7r\xf7\xb9\x8c`\xc1\x1c\x16\x8d\xe49v+Z\x92b\x86LQ\x14\xa5\xf1b?\x96\x8c3\x04\xbeS\xdc[/\xf4G\x0e\xf2\xf2`&3\xfe;\xea\x1e\x06_\x0e\xd3u\xc2(\"\x91J\xb8\xe8\xf6g0\xf5\xe3\xdb\xaa\xbag\x12Uv/\x88H/N\x97\xd78\xfe\\\x8b\xb2\x80M\xc9\xee\x11_\x8a6\xc7@\xc4\xd4\xd5g\x19\xbb`\xaeI\xebM,:\"\x9fZ\xc7\xdc=\\\xa5\x1d\xd0\x9a\xe2j\x8c\x1b\xc8\xef \x92\xaf\xe2\xe5=v\xfeo\xe2\x87\xb7}\x18\xca\x13\x1e\xc3\xa6*\xee\xd4\xe1m\x88QI_\xbf\x1f\x82\x9c\xd5z\xa4{s\xd4\"\x19g \xbc\x87\xee\xadD\xf9q\xbcHFj\xd8 \xbam\xd6{\x9e\xd6\x0c-\xe3\xa5-H8\xb1\x7f\x01\x1f\x95\xeb\x93\xbb\xfar\xdf\x10\x91\x1a1\xce\xd3\xdc\xe3z\xfd\n\xfbdjSo\xd7\xac\xb6&\xe7\xa1\xa67\xe4\x8e\x80O\\\x97'i\xae;\x04+\x1c\x1fM\x07o\xa35\x80!\x0d\xd6\xf7x\x12\xd1\x1a7\xdf\x86\xbe\xb1M\xdeev\xbf\xda\xa55\x0f\xb4\x17\xf9\xbf\x93\x99\xe7\xa4\xfd\xd1)\xd7\xef\xa2\xf5\xd3n\x0f&\xdbxKf\x12\xe9\xae\xde\xdd\xc3\x84\x18\x88\x0e\xc1\x85\xd2uA\xe3k\xe1b\x86\xa7_/\xb3\xaf\x82\xdf\xf5\xef2\xd2\xce\xa6\xef0\xe4\xdaiWM72\xa3$\xcfe\x9d\x85qNr\xfbq\xfa\x9b|p\xa7\xe0\x12o\xf8y\xf0\xcfwV_\x85\xb6k\x16\xcf^f\xb0\xec\x81\xfb\xc4??\x16\xeeKvoZ~o\xb6JS\xf1\xd2\x1e\xda\xcddr\x14\xf0ZD7\x9e\xaag3\xc1\xddw\xb2\xe0\xd0>\xcb\xd5\xc3;\x07\x03E\x8eh\x1b\xa1\x97\xe4i\xe2\x9db2\xd4]\x18%\xc2\x1d|T\x08,e\xb0\xb2T\x8a/u.TA\xca\\\xf9\x90\xe0\xe4q\x0b\x1e\x99\xf2\xd0u\xb9\\\x97^\xa6\x87r~\xa6N l\x00#\xdbe\xed\xaaP\xf4\xc2\xd2\x0bY\xa9\xd9\xea\xc7\xc0L\xd8\xa5\xa8jL\x91\xc3lP\x13U\x9b\x1eN\\\xbf\xc8WZ\xb2l\xdb\\\x92\xb6|\xb6\xa7\xf4p\xd6\xba\x12\xd6p\x14\x84}\x13\xb4FK3\xd3K59\xf5\xcc\xb62C]K\xa7b\xad\xb4\x1f\x01U\xfb\xa4\xb7\xef\xa6\xf6\"Y\xce\x9cx\xf0\xaci\x90\xbdAP\x14EQ\xc8V\xfe\xb9\xbe\x1e\x83\x10\xfd3QFQ\x14E\x11\xff\x07\x00PK\x07\x08\x15\xfa\xa7()\x05\x00\x00\xa8\x06\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x8ai\x91Q\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x10\x00	\x00certs/server.pemUT\x05\x00\x015Y\xdb_\x8c\x8f\xcb\xd2\xa28\x1cG\xf7<E\xef-KP\x14\\\xcc\"$\x01\x11\x82\x06\x88 ;D\xb9\xf3!w\xf0\xe9\xa7\xbe\xee\x9a\xd9LUOgy\xea\xe4_\xbf\xb3\xfe~\n\xd6t\xeb\x07\xc4\xb6\xab\xab:\x04.\xfe\x86k\x8e\xe8:Jr\x08AUCHQ \xe3d\xde\xc7\xf2\xe6\xe8\x02KI\x8a&-2\xed8\xf1\n\xa0\x9d\n\x10T\x92\x1c\x9b\x04\x14\x1a\x10\x18VR\x029\x1b\xb3\x19!`(\x89uS@B\x00\xbfwn\x1f|!`\xfa%M\x93j{\xea\xf2\xd4\x92\x19\xe5\x80\xfc\xf2j\xa2\xb0\xe7\x18T\xb7\x85#\xb4\x9b \xbd\xa3\x1b\xa5&\x02\xe7\xf3\x0d\xe1\x90(\xc9\xcf\xcf`\x9a\xec`{\xac\x02_\x1f\xee[\xbbzx\xf3bV\xc2\xfbQ\xb1\xf9\x84@\xf8\xbd\x90\xfbg\"\xa4\xd8C\xde\xaf\xabT\xfb)\x0d\xa1'O\xa74\xb2H\x0ef\x92\xe3\x1dq\xc9Lr}\xf6\xbe\xd9\xe7'\x13\xb8\x7fa\xfe\xdf\xbe?\xc9\xe3~\xd7\xf7'y\xdc\xef\xfa\xfe//Ip\xc6\x11\xc0k\xd0i4G\x7f\xec\x10\xc5\n\xa0\x0c\x00QW\xd0\x04\xbe\x05\x03\xd4\xba\x02(\x9cx\xad\x8b\x96\xc4\x03|U\x8f\xbe\xdc\xe2\xd80\xfa\xd7\xd3p\xb9b)\xf7\x8c\x0f\x04\xef5\xb4^\x93\x0d\xda\xa5\x13vWX\xc4\x92H\xbaOJ\x82\x95\xfcf\xab2\xfaz\x9fD6\\\na\xb2r\xf4\xce\x12\x85\xa9\xc7\xa0-[\x8ev7\xd6T\xa8\xc7\xf2\x01\xddSp\x19\xd2\xa4i\x93\xa1\x97\x0f\xe77K\x1b\x05\xdd_\x93\xe3\x9eJ\xe5\x1el\x97\x9d 1)\x14\x1a\xb7\x03\x9f\x02\x9e\x1f\xd2\xf9\xc2\xf9\"hl\xb9\xdd7B\x0c\x8d\x11z\xfc\x97\xb5\xc8\x96n\x0b\xac\xda\xa5\xb2S\xe39\xab\xf1 !*\xbe\x9c\xc3\xfcLx\xf1>\"\x91I\xe7\xab\xc9\xb7\x0d\xa4\xdc;\xf0	z>c|]$p\xd6\x83\x08\xbc^o\xcaV\xa4\xe5k\x92\xadBf|\xf1ad\x9c\x08j\xa3\xady\x9d\xab7N\xe7~\xf0%R\xe8\xf8\xba\xfb\xe2\x14\x9f\xb8\x9bs\xd1\xce\x02\x1d\xcf\xc7\xa0\xd8\x82\xa9|m\xbag\xb5\xf1\xf8\xd8\xd4,\xf80\x82\x1e\x92\x0e:\xd2\xb3\xb4c\"\xa2d\xd1\xe5\xcb\xf90\xfa1H\x88\xc2\x01\x80'D\xefg\xa3\x0e\xf4t\x8c,@\xb1\xa9P\x80\x92\x04+@\x0b6\x07\x7f\x06:s\xfd\xcc\x04\xf3\x08\xeaF\xbd\x16\xc7x\xdb\xb3SQ\xb5C\xf7erj\xe6\x06\x92\xb3\x07\x97\xcb*\xdb\xbfr\xf0\xf8H#o\xf1c\xdb\x8b\x97\xd5\xc1\xc8\xd28w.\xe53\xef\xa0\xc8k\xf8\x89\xb5A\xf7Z+x\xbe\xa6msEH\xe3\xa0\xe2\xeb\xbaPwa=^\x9bFD]v\xedo\xd3\xa9\xe4\xf9\x18\x89<\x16\x0b_3\xadH\xf7\xa8\xa5(\xe9K`\xf7|v'\xef%K\xa1\xc8?B[\xe2\xa8`y\xd5\x16\xb7\xb9\x04\x90mh\xd9\xa3\xea\x0cg\xa3m>\x90\x1fm{y\x1c\xcat;\x95\x99\x1c\xd1\xba\x0f\x8b\xb4\x91Z\x96'uvN\xd4\xdd\xe4\xd4\x06\xe5di\xd8/Ob\xd9\xd1\xcd\xacPm\xc4\x19S\xf7\xf6\xe7}|\x04\xa1\xcf6\"\xeb\xa3O\xd7\xe3\xeac$\xe3\xae\xe3\x87c\xef\xc0i\xa13#M\xee\xe4	\xe2\x14\x02\xcb\xd6\xbc\x91\xa8\xebt58\xfa\xd9\x01A\xe3x4\xcc\x16\xee\xdf\xa5\xccV\xd9\xd26\xaa\xb9\xbc\xec\x8b\x10V\xaa=\x86\xd1_\xdcz\xbd^\xaf\xb1\x85~@l\xbb\xba\xaaC\xe0\xe2\xf5z\xbd^s\x7f\x0f\x00PK\x07\x08T43\xfb]\x03\x00\x00\xfd\x04\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x1a\xbeR]\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\n\x00	\x00web/app.jsUT\x05\x00\x01\xe5Z\xd5j\x9cW_o\xe4\xb6\x11\x7f\xd7\xa7\x98\xb0\x87\x80\x827\xdcs\xd0'o\x15\xa3\xbe\xb8\xa9\xdb\xcb\xf5p\xe7\x03\n\x04A\xc1\x95F+\xd6ZR%)\xaf\x1dg_\xf3^\xf4\x1b\xe6\x93\x14CR\xbb\x92\xfc\xa7\xd7\xf8\xc5\xbb\xe4p\xfe\xfef\xe6\xb7\xcb%lL\x8d\x16v\xb8\x86OWg\xb0\xb6f\xe7\x10\xa4\xae\xa02;\xdd\x1aY\x01\xdeu\xc6z\xb7\x80\xbe\x0b\xdf\x95\xf6\x06|\x83\xa0\xf4\xda\xdc-`'}\xd9\x80\xb7R\xbb\x1a\xad\x13\xd9r	W\x1e\x8cn\xef\xc1\xcb\xf6\xc6A\x92_\xcaN-\x01u\xd5\x19\xa5\xbd\x03S'\xeb\x0e\xed-\xc2W\xe4\x04w\x88\xf1t\xb9\xc3\xb5\xd8\x98\\d\xacw\x08\xce[Uz\xb6\xca\xb2\xd2h\xe7\xe1\x15\x14\xc0U\x95C\xf1\x0dT\xa6\xec\xb7\xa8\xbd\xd8\xa0\xbfl\x91>^\xdc_Ut\xbd\xca\xb2\xba\xd7\xa5WFCm\xecV\xfa\x8b{\x8f\x8e\xeb\x1c\x1e2\x80\xa8\xab\xd7\xca;(\xe0\x07v\xc1\x16\xc0\xfe\xaa\xc2\xbf\xef\xe3\xbf\xef\xe2\xbfku\xc1~\\e\x00-zPP\xc0k\xfa\xb2kT\x8b\xc05|S\xc0\xe9\xeb\xaf\x7f\x0f_~	\n\xfe\x105\x8a\x16\xf5\xc67\xf0\x15\x9cFk\x00\x1a\x96Q\x90\x1e\x03\xa8\x93\x13\xfa\xb0\xcf\x00,\xfa\xdej\xe0\n\x8a\xa2\x80\xd7p\x0e\x1a\xce@\x0bo\xfe\xa4\xee\xb0\xe2\xa7y\x0e'\xc0\x80\xc1I\xd4\xfe\x83\xfaq\x95\xedG\xe1\xb9\xc6\xec.\xad5\x96\xa3\xb5\xd1\xe0+\xce\x90NX.<\xde\xf97F{\xd4\x1e\n@k\xe1\x1c>z\xab\xf4&\x8a\x9f\x01c\xab\xe9\x93FU\x15j(\xe0\x0b\xb46\xd8Z.Av\nj\xf4e\x83\x0e\xa4\x9e\xd54\x02\x07KS\xa1\x03\xca\xe9_>\xfe\xed\xdd\x02|c\xcdN\xe9M@\xcd\x03\xa3kJp\xb4\xb3'\x1c\xd4R\xb5\xbdE'2\xe9\xeeu	\x87\xa0d\xa7\xf8\x16}c\xaa\x05\xf4\xb6]\xc0\xdaT\xf7\xe3\xdaYt\x1d\x14 wR\xf9\xe8\x18\x0fr\x0f0<\xa3\x17\xb0\xcfW\x87r[t}\xeb\x0f\x8fH\x83\xf8\xa73\x9a\xe7\xa2$,s\x1eP\xc5\x1f\xf6yx\xa5j\xe0_\x04)s3\x142\x84\x04\x1aw\x10S\xce\xa3RA\xb1\xc1\xcf?G\xa5\xceK\xdf\xbbP\xb7\xb3P\xb8A*D>\x13\xbb\xc6;\x9f\xe738D\xf9!\xf7\x97\xb1\x13\xb3\x8c0X\xf6\xd6\xa2\xf6\xef\xa5o\xa0\x08\xc5;B\xa1\xc4\xb6\xe5\xd6\xec\x16\x04p*\xf98c\xbe\x82\x02\xac\xd9	\xa5\x1dZ\xff\x86d\x0fq&yP\xday\xa9K45\xbc3\x15\x1e\xc2\xae\x84\xec:\xd4\xd5\x9bF\xb5\xd5 \x1d^\xef\x01[\x87G\xb9)\xe0\x92\xe4\x0c\xed\xbe\x9aB\xb8U\xfa\x86\xd3\xc3\x05\x18]\xb6\xaa\xbcY@c\xb1\x1e\xbb/\xa186|iQzL=\xcf\x99d\xc1\x1593N\xdf\xe29)\x83\"\xe8\xa4\xf4\xb3\xdf\xb1!\xf0do\x08T\x8at@c\x06\x03\x1ebd\x00(:\x8b\xb7\xa8\xfd\xb7X\xcb\xbe\xf51y\xf4\x97\x9e\x0c\x07\xfbY\xb42\x04;\x03x\x9c\xb8\xbc\x93\xbe\x89\xb6\xbd\xbdO\xa6b\xbc\xa8\xbdU\xe8\x0ep\xa5\x8e`\xdf]^S\x07\x85\xeek\x95\xf3\xe7\xf4\xbe \x88\xa1&\x08~\xfap\xf5\xc6l;\xa3Q\xfb\xa8;\xf94E\x0d\xdd\xc4\xf3\xd6\x94\x92J \x1a\xe9\xa67\xc7\xb1\xa2\xfb\xb6Mj,\xea\n\xed\x85EY\x95\xb6\xdf\xae\xa3\x8d\xf1\xddet;\\,\x86 \x12PB\x97\xc1qL\xc1lv\x05\xa9	0\x9e\xb67B\x85\x96\xb7P\xc0+\xce\xd6\x07\x9f\"\x16\xb4\xbc\x9d\xa1\x81Z%\x9e\x8f\xa1\x1c\xa0\xc7\x96l\x01\xb1\xfbS]\x18\xcbc\xea\xa8\xe5:\x8b\xb5\xbaK\xdd\x06\xb4O\x80Z\xc0y\xe8\xa4\xf54\xc7(Z\xe1\xbaVy\xd2\x95\x8bZ\xb5\x1e-\xbf0\xa6E\xa9\xf3\x01]I\xd1I\x01<}<\x07\xb6da\x08\xd3\xb8 u\xa9^!:\x9apQ0\x9e\x1e\x9d\xe7\x0c\xd8\"\xf6\x0d=\x9ay\xdf\xe5\xf9\x02\x18,\xd9\xb3)}\xbaL\xa3\xc4\xfa0>Cj\xd3mT\x16\xce\x9f\xcc\xec(-H9\x99(\x1dP]\xf7mK\xadE	\x83\xf3\x9078\x99\xe4\x00\x85\x96[\x1cg\xc1\x9a\x1d5s0\x1cg\xd7\x07\xb3\x1b\x9a\x8d\x864\n\x7f\xdfaX\xa0\xacR\x96\x0d\xe9\x86\xd1@\x0c\xa9\x8a\xba\xa3\xc1Y\xca\xc8\xb1T\xf2\xe9C\xc6\xd2\xe1d\xd0=\xa3z\x01\xd4,C\x87n\xf0\xe5\x06}\xd6\xe6\x98\xb1\xa0p\xea'\x1c\xa4\xf6\xd9\xd46m\xa2o\xa5G\x8eb\xeb\xd5\x16s\xe1\xcd[S\xca\x16\xd3\x92\x1fVK\xdc$WD\xddF`\x88\xd4\x8e\xd7\xaaM\xa3>f\\y\xdc\xbe0n[\xc5Fku-\xed\x0b\xb2\x9d5\x1b\x8b.\xa1g-\xad\xd8Jj%2\x19\"\xa3y|Jwd4\xb5fp\xe8P+B\xfaZ\xda<\xd1\x94\xe8\xb3c9\xcd\xe3 M/\x89\xf1\x01,\x97\xf0\xf7\xef\xdf\xfe\xd9\xfb\xee\x03\xfe\xabG\x02\x8f\xf4\x0dZ\xf0\x8d\xd4\x91&\x9cA\xd8\xfda\xa3\x0e\xd4vpR\x1c\x82\xbak((\xca\xeeT_\x84\xdd]c\x85\xe9Ps\xf6\xfe\xd3q Ge\xe7\xe4\xf6s#\xf9\x10W~\xd0\x13_	\xa3\x07'F\x9b\x87\xc2\x16\xb7\xb2\xed\x91\xb8\x9b _\xb1Z\xc5\x05\x13|\x88L\xbdHP\xa6\x02\xc6\x8e\xa0\xcbH/BW|\xfd\xfa\xf5\xb1'([\xb3\x06\x9e\xa6;z\x84\x15p\x8ab\x8c\xc5C\xd1\xa8QY\xce\x86\x05\x18I\xec\x18\xa146-Jg\x88G\x1e\xbd\xb9N\x1by\xbc\xee\x1e\xd13\"\x8f\xa2\x93\xd6a\x88\x83(\x95\xd1\x0e\xe9m\xea\x028\xeaN\xcc\x8a\x96\xdf\x91o\x8d\xe9V\xf2jX>\xff\xc8\xe1a\x9f}V\x1e\x88\x9cb5h${i\xe4P\x02\xcbV:\xf7\x8eRV\x00\x8b\x92!\x1d\xa3\xdaD\xb67+\xce\xe7\x1a-\x8d\xd6\x98\xd8\x91q\x9e\xfd?\xa6\xdd\xd0B\xf9\xec\x97\x02\xfa\xbe\xfb\xd6\x9a\xee'\xa3\x91\x8f\x1b\x9e\x0e\xe2\xb0\xaf\xd2u\xecW\xfa$dU]\x12\xefy\xab\x9cG\x8d\x96\xb3\xca\xca\x8d\xb9E\xcb\x16S\x92\xf4\x1cE\njB\xc6H\x07)\xe4,\xbc\x0fF\xf6\xff\xcbT\x8b\xf2\x16\x0f\x03{\xa6\xcc\xe2\xd6\xdc\xe2\xa0\xefeU\xa6\xfb\x8d\x1eO\x8d\x90\x0d\x80?Z+\xefEm\xcd\x96\xa3\xa8\xa4\x97\xd7\xe9\xa70m\x7ft\xb9\xa8\x8d\xbd\x94e\xc3c?\x8dB}\xc5Y\xa7\xca\x1b\xa4\xdfg\x8f\x93[6Rop\xee\xe8\xc4\x9a\x97v\x83\xfe\x05;\x00\x07\xa1a|\xc4%M\xb9\x8e\xab`\xf0\xd6\x8d\xd6A\xf8I\xff>\xcd\xa1	@\x9c\xe9m\x89i$\x06\x87?\x86\x13\x1e\xb9\xe80\xbbbn\xa2\xb00z\x8b\xce\xc9\x0d\x8e&\xdah\xad\x07\xef\xa7\xed\x1e\xf3\x98\xf2\xfb\x88\x87L\x8d\xbcDE&\x1c\xad&2\x12\x8c	\xd7\xaa\x12y.\x08\xa44^\x0e\xc4\xec\xb3\xa8\xc6x\xef\xd6\xa2R6\xf5'MXF=\xc7\x88\xce\xfd\xfa\xcb\xbf\x03\x99\xf9\xf5\x97\xff\xb0'\x1f\xd2~x\xf2\xa2C\x0c?\x0e\x0f\x8c\xe3\xb7lX\x80\xc9\x96\x15\xdex\xd9\x1ev\xecp;\x80b\xb8?\xa7\x80h\x06\x9c\x1d\xe5b\xfei\x8bP\x01\x8f\xa1\x0f\xabx\xd85u\x9c\xb3\xc7TB|4\x9f\xadQl5\x13zn\x98\x8d\x18\x17Q\xbcZ\xd4J+\xd7`\xf5\xd8N\xe2\x0c\x0c(\x82c\xee\xf6\xc9\xd2\xb8h\x83\x12*\x14Ui\xb2\xdc\x84\x95>n\xb6e\x02r\xe4[\xfb0Eg\xc3s\x95\xcd\x9ae\x95%&Y\xe1\xa3\xb5?\xf9\x95\x95Px\x9a\xe7\xf9*\xfb\xef\x00PK\x07\x08\xf9\x04U\xa3U\x07\x00\x00\x8a\x13\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x1a\xbeR]\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x0e\x00	\x00web/index.htmlUT\x05\x00\x01\xe5Z\xd5j\x94S=s\x1c!\x0c\xed\xefW\x10j\xdb\x8c]\xa5`ib\x17)\x92x\x127)\xd9Ek\x14\xb3\xc0\x08\xed\xf9\xe3\xd7g\x80\xdb\xbb\xdcd&\xe3ls\xe8Iz\xd2\xe3q\xfa\xc3\xed\xb7O\x0f?\xef\xef\x84\xe7%\x98\x9d\xae?\"\xd8\xf88H\x88\xb2\x02`\x9d\xd9	\xa1\x17`+&o\xa9\x00\x0fr\xe5\xf9\xf2\xa3<%\xa2]`\x90{\x84\xe7\x9c\x88\xa5\x98Rd\x88<\xc8gt\xec\x07\x07{\x9c\xe0\xb2\x05\x17\x02#2\xdapY&\x1b`\xb8\xee4\x8c\x1c\xc0<\xa6\x19H\xab\x1eT\xf6\x80\xf1I\x10\x84A\x16~\x0dP<\x00K\xe1	\xe6\x03r5\x95R\x17U}S=&\xf7\xda:k\x0cT\x8fBh\x7f\xbdQ\xfb\xeb\n\xf5\xf2\x9a\xae\xc1b1\x1e\n\x0bL\x8c)\nt\x83\x84\x97*\xa6\xb2\x8b\xf6i\x7fc\xee:\xa6\x95\xbf9\xc2\xd1\xee[\xfdH`\xddD\xeb2J\xa3U\xb4\xfbc\x05\xdb\xb1\xeb\xd9\xe2\xba\x9c\xd1LF\xb37_\xed\x02Z\xb1o\xc1\x0f|;\x05_\x92\xc3\x19\xc1u@\xd5z\xc5\x9b%\x1bWU\xdc\xe6CdB(u8o\xd7P?\xad\xfe\x98\xaf\xd5A\xa2\xd9\xfd\xad\x18\xe3\x98^\xce\xf4~\xae\xc8\x99Z\x87]\xad\xa3\x94\xdfR\x84c\xb9\x10\xb7\x94\xb2\x981@\x11\x1e\x08.D\"\xa1\x83\x1d!\x98\xc9\xa7T\xa0'5\xc6\xbc\xb2\xe0\xd7\x0c\x83\xac\x88l\x84\x19\xa7' )\x9650\xe6\x00\xc2\xa3s\x10\x8dV\x9db[@9<\xdd\xec\x1aZ\xef\x9aC\xb2\xaeI_\xc3;\x842\xd9Xf\xa0ss\x1f6\xf4L\xf0\xbf\xcd;zu\xe6\xe2=\xb4g\xdc3\xf7\x94\x1e	J9\x02\xdf-\xc3\xfb,\xcd\x87\xd6\xff\xf44\xb7f J$O\xd7\x98k\xb5V\xfd\xb5\xd7c\x99\x083\x8bB\xd3 m\xceW\xbf\xda\x9c\x8e\xd6\xbfT\x7fDZy^\x82\xd9\xfd\x1e\x00PK\x07\x08y\xcd\xb5n\xdb\x01\x00\x00-\x04\x00\x00PK\x03\x04\x14\x00\x08\x00\x08\x00\x1a\xbeR]\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x0d\x00	\x00web/style.cssUT\x05\x00\x01\xe5Z\xd5j|T\xcdn\xdb0\x0c\xbe\xfb)\x88\x1a\xbb\xc5\x81\xedmY\xab\x9c\xb6\xc3\xb0\x1dv*\xf6\x00\xb4H\xc7Be\xc9\x90\xe46i\x91w\x1f,;\xad\xdc\x9f!@\x12\xc1\xe4\xf7C~rc\xe9\x04O\x19@\x8f\xee\xa0\x8c\x80r\x9f\x01\xb4\xd6\x84\xa2\xc5^\xe9\x93\x80\x02\x87As\xe1O>p\xbf\x81\x1fZ\x99\xbb?(o\xe3\xf9\xa75a\x03W\xb7|\xb0\x0c\x7f\x7f_m\xe0\x17\xeb{\x0eJ\xe2\x06\xbe;\x85z\x03\x1e\x8d/<;\xd5N\xd8\xd2j\xeb\x04\xe4u]O\xc7\x06\xe5\xdd\xc1\xd9\xd1\x90\x80\xbc\xc5\xe9\xb3\xcf\xceY\xd61\x12\xbb(m@\"e\x0e\x02\xca\xedW\xee\xa1\x9a\xbe\xdf\xb4\x96%\x12]\xa7\x04m\xdb\xa6H]\xf5\x81O\xaf\x1eY@\xb5\xfd\xc2}\xac\xefQ\x99\xa5\xf4X<(\n\x9d\x80\x9b]9\x1c\xf7i;\xe0\x18\xec>UW\xbdh;g\x99g\x19\x94\xbd\x00M\xb3-\x1a\x1b\x82\xed\x05\xd4\x0bQW\xc7\xa7+\x11\xd5b\xcd:b\xf7\xdcQ\x0dG\xf0V+\x82\x9c\x88\x12\xd6\xe7\x8ar\xfbyA\x0d\xd8h\x8e\xc0\x8b\xf6\xaa,?%\x98\xd2j\x8d\x83g\x01\x97\x7f\xd1u\xe86\x10(\xf6\x05>\x86\x02\xb5:\x18\x01\x9a\xdb\xb0r\x19\x89\xe6M\xfc_(3O\x05\x0f\x9d\n\\\xf8\x01%\x0b0\xf6\xc1\xe10\xf3\x91h\x95\xf3\xa1\x90\x9d\xd23\xef\xabR\xd7\xa3\x8e\x08\xd6Q\xd18\xc6;\x01\xf1\xa7@\xad#\x06\xc2S\x12\xa8\xb2\xfcF7r\x7f1@,\xad\xc3i\x07\x13\xaf\x99]\xa2\xe8\xec\xfd\x12\xab7U\xa3!vZ-\xa5\xf9\xc4E\xd2\x8d}\xf3\xde\x12\x97	\x9c\xb3,'g\x87Gkx\x1d\xd6:\xdd\xa4\x80z8\x02\xa1\xef\x98 o\x9a&\x99\x9dCR\xa3\x17\xb0\x9b\x13\x96N_\xb2	\xec\xd2P\xefv\xbb5\xe9\xf6\xd9\xcf\x92\x99\xcb\xfdz\xb9\x10\xab+\xc6\xd7\xedu+_	\xd7\xd8\xb0\xfe`\x98rt~\x02\x1c\xac\x9a\xc5L\x96\xc7A[$\x1f[\xb4\xf2\xa1\xf0\xe1\xa4\xf92\xe84.\x91ip\xf6\xe0\xd8\xfbu,\x97\xc0n[T\x9aiE/\xcb\xb91g\xe7\xec\xfbo\x01\xee\xdfxk\x89%c:.Y\x96\xfb\xec\x9c\xfd\x1b\x00PK\x07\x08\xcd\xa5\xaf\x9a)\x02\x00\x00\xe6\x04\x00\x00PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x8ci\x91Q\x97\xa3\xe9\x1a(\x05\x00\x00\xa8\x06\x00\x00\x10\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81\x00\x00\x00\x00certs/client.keyUT\x05\x00\x019Y\xdb_PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x8ci\x91Qw\xbf\x8b\xfe\\\x03\x00\x00\xfd\x04\x00\x00\x10\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81o\x05\x00\x00certs/client.pemUT\x05\x00\x019Y\xdb_PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x8ai\x91Q\xbf\x087}\xd2\x00\x00\x00\xd1\x01\x00\x00\x16\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81\x12	\x00\x00certs/generate_cert.shUT\x05\x00\x014Y\xdb_PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x8ai\x91Q\x15\xfa\xa7()\x05\x00\x00\xa8\x06\x00\x00\x10\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x811\n\x00\x00certs/server.keyUT\x05\x00\x015Y\xdb_PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x8ai\x91QT43\xfb]\x03\x00\x00\xfd\x04\x00\x00\x10\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xb4\x81\xa1\x0f\x00\x00certs/server.pemUT\x05\x00\x015Y\xdb_PK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x1a\xbeR]\xf9\x04U\xa3U\x07\x00\x00\x8a\x13\x00\x00\n\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa4\x81E\x13\x00\x00web/app.jsUT\x05\x00\x01\xe5Z\xd5jPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x1a\xbeR]y\xcd\xb5n\xdb\x01\x00\x00-\x04\x00\x00\x0e\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa4\x81\xdb\x1a\x00\x00web/index.htmlUT\x05\x00\x01\xe5Z\xd5jPK\x01\x02\x14\x03\x14\x00\x08\x00\x08\x00\x1a\xbeR]\xcd\xa5\xaf\x9a)\x02\x00\x00\xe6\x04\x00\x00\x0d\x00	\x00\x00\x00\x00\x00\x00\x00\x00\x00\xa4\x81\xfb\x1c\x00\x00web/style.cssUT\x05\x00\x01\xe5Z\xd5jPK\x05\x06\x00\x00\x00\x00\x08\x00\x08\x003\x02\x00\x00h\x1f\x00\x00\x00\x00"
 	fs.Register(data)
 }